@@ -0,0 +1,18 @@
+package api_test
+
+import (
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+)
+
+func TestApi(t *testing.T) {
+	gomega.RegisterFailHandler(ginkgo.Fail)
+	ginkgo.RunSpecs(t, "Api Suite")
+}
+
+var _ = ginkgo.BeforeSuite(func() {
+	gin.SetMode(gin.TestMode)
+})
@@ -1,11 +1,16 @@
 package api
 
 import (
+	"errors"
+	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/spf13/cast"
 	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/model"
 	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/service"
+	"gorm.io/gorm"
 	"net/http"
+	"strconv"
+	"time"
 )
 
 func getBook(ctx *gin.Context) {
@@ -14,12 +19,36 @@ func getBook(ctx *gin.Context) {
 		makeResponse(ctx, http.StatusBadRequest, "failed", "invalid book id", nil)
 		return
 	}
-	book, err := service.GetManager().GetBook(bookId)
+	fields, err := model.ParseBookFields(ctx.Query("fields"))
 	if err != nil {
 		makeResponse(ctx, http.StatusBadRequest, "failed", err.Error(), nil)
 		return
 	}
-	makeResponse(ctx, http.StatusOK, "success", "", book)
+	book, err := getManager(ctx).GetLocalizedBook(bookId, ctx.GetHeader("Accept-Language"), fields.Columns())
+	if err != nil {
+		makeResponse(ctx, http.StatusBadRequest, "failed", err.Error(), nil)
+		return
+	}
+	if book.Language != "" {
+		ctx.Header("Content-Language", book.Language)
+	}
+	if fields.Has("covers") {
+		if err := fillCovers(ctx, book); err != nil {
+			makeResponse(ctx, http.StatusInternalServerError, "failed", err.Error(), nil)
+			return
+		}
+	}
+	data, err := fields.Project(book)
+	if err != nil {
+		makeResponse(ctx, http.StatusInternalServerError, "failed", err.Error(), nil)
+		return
+	}
+	//翻译与封面的修改不会更新 Book 的 UpdatedAt，包含它们时只使用 ETag
+	lastModified := book.UpdatedAt
+	if ctx.GetHeader("Accept-Language") != "" || fields.Has("covers") {
+		lastModified = time.Time{}
+	}
+	makeCachedResponse(ctx, data, lastModified)
 }
 
 func CreateBook(ctx *gin.Context) {
@@ -27,17 +56,172 @@ func CreateBook(ctx *gin.Context) {
 	err := ctx.Bind(&book)
 	if err != nil {
 		makeResponse(ctx, http.StatusBadRequest, "failed", err.Error(), nil)
+		return
 	}
 
-	err = service.GetManager().AddBook(&book)
+	err = getManager(ctx).AddBook(&book)
+	if err != nil {
+		makeResponse(ctx, writeErrorCode(err), "failed", err.Error(), nil)
+		return
+	}
+	makeResponse(ctx, http.StatusOK, "success", "", book)
+}
+
+//updateBook 部分修改 Book（PATCH），只更新请求中的非零值字段，返回修改后的 Book
+func updateBook(ctx *gin.Context) {
+	bookId, err := cast.ToUintE(ctx.Param("book_id"))
+	if err != nil {
+		makeResponse(ctx, http.StatusBadRequest, "failed", "invalid book id", nil)
+		return
+	}
+	var book model.Book
+	if err := ctx.ShouldBindJSON(&book); err != nil {
+		makeResponse(ctx, http.StatusBadRequest, "failed", err.Error(), nil)
+		return
+	}
+	//UpdateBook 不区分 Book 不存在与没有修改，先查询以便返回 404。
+	//副本可能还没有刚创建的 Book，从主库查询
+	if _, err := getManager(ctx).Primary().GetBook(bookId); err != nil {
+		makeResponse(ctx, listErrorCode(err), "failed", err.Error(), nil)
+		return
+	}
+	book.Model = gorm.Model{ID: bookId}
+	if err := getManager(ctx).UpdateBook(&book); err != nil {
+		makeResponse(ctx, writeErrorCode(err), "failed", err.Error(), nil)
+		return
+	}
+	updated, err := getManager(ctx).GetBook(bookId)
+	if err != nil {
+		makeResponse(ctx, listErrorCode(err), "failed", err.Error(), nil)
+		return
+	}
+	makeResponse(ctx, http.StatusOK, "success", "", updated)
+}
+
+//listBooks 分页返回 Book，同时返回符合条件的 Book 中的标签统计。
+//fields 参数只返回选择的字段，例如 fields=title,author。
+//删除或者新增 Book 不会改变页面中 Book 的 UpdatedAt，列表只使用 ETag 验证
+func listBooks(ctx *gin.Context) {
+	q, err := parseBookQuery(ctx)
+	if err != nil {
+		makeResponse(ctx, http.StatusBadRequest, "failed", err.Error(), nil)
+		return
+	}
+	fields, err := model.ParseBookFields(ctx.Query("fields"))
 	if err != nil {
 		makeResponse(ctx, http.StatusBadRequest, "failed", err.Error(), nil)
 		return
 	}
+	q.Columns = fields.Columns()
+	books, err := getManager(ctx).ListBooks(q)
+	if err != nil {
+		makeResponse(ctx, listErrorCode(err), "failed", err.Error(), nil)
+		return
+	}
+	tags, err := getManager(ctx).TagFacets(q)
+	if err != nil {
+		makeResponse(ctx, listErrorCode(err), "failed", err.Error(), nil)
+		return
+	}
+	data := make([]interface{}, 0, len(books))
+	for _, book := range books {
+		projected, err := fields.Project(book)
+		if err != nil {
+			makeResponse(ctx, http.StatusInternalServerError, "failed", err.Error(), nil)
+			return
+		}
+		data = append(data, projected)
+	}
+	makeCachedResponse(ctx, gin.H{
+		"books":  data,
+		"facets": gin.H{"tags": tags},
+	}, time.Time{})
+}
+
+//parseBookQuery 解析 Book 列表的查询参数
+func parseBookQuery(ctx *gin.Context) (model.BookQuery, error) {
+	sort, err := model.ParseBookSort(ctx.Query("sort"))
+	if err != nil {
+		return model.BookQuery{}, err
+	}
+	subjectId, err := cast.ToUintE(ctx.DefaultQuery("subject", "0"))
+	if err != nil {
+		return model.BookQuery{}, errors.New("invalid subject id")
+	}
+	page, err := parsePageOptions(ctx)
+	if err != nil {
+		return model.BookQuery{}, err
+	}
+	return model.BookQuery{
+		PageOptions: page,
+		Sort:        sort,
+		Tag:         ctx.Query("tag"),
+		SubjectID:   subjectId,
+	}, nil
+}
+
+//maxPageSize 列表每页最多的条目数量
+const maxPageSize = 100
+
+//parsePageOptions 解析 page_number 与 page_size，page_size 默认为 20。
+//page_number 小于 0 或者 page_size 不在 [1, maxPageSize] 范围内时返回错误
+func parsePageOptions(ctx *gin.Context) (model.PageOptions, error) {
+	pageNumber, err := strconv.Atoi(ctx.DefaultQuery("page_number", "0"))
+	if err != nil || pageNumber < 0 {
+		return model.PageOptions{}, errors.New("invalid page_number")
+	}
+	pageSize, err := strconv.Atoi(ctx.DefaultQuery("page_size", "20"))
+	if err != nil || pageSize < 1 || pageSize > maxPageSize {
+		return model.PageOptions{}, fmt.Errorf("page_size must be between 1 and %d", maxPageSize)
+	}
+	return model.PageOptions{PageNumber: pageNumber, PageSize: pageSize}, nil
+}
+
+//listErrorCode 返回查询 Book 列表失败时的状态码
+func listErrorCode(err error) int {
+	switch {
+	case errors.Is(err, model.ErrInvalidTag), errors.Is(err, model.ErrInvalidSort):
+		return http.StatusBadRequest
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func getBookByISBN(ctx *gin.Context) {
+	book, err := getManager(ctx).GetBookByISBN(ctx.Param("isbn"))
+	if err != nil {
+		code := http.StatusNotFound
+		if errors.Is(err, model.ErrInvalidISBN) {
+			code = http.StatusBadRequest
+		}
+		makeResponse(ctx, code, "failed", err.Error(), nil)
+		return
+	}
+	if err := fillCovers(ctx, book); err != nil {
+		makeResponse(ctx, http.StatusInternalServerError, "failed", err.Error(), nil)
+		return
+	}
 	makeResponse(ctx, http.StatusOK, "success", "", book)
 }
 
+//writeErrorCode 返回写入 Book 失败时的状态码
+func writeErrorCode(err error) int {
+	switch {
+	case errors.Is(err, service.ErrDuplicateISBN):
+		return http.StatusConflict
+	case errors.Is(err, service.ErrQuotaExceeded), errors.Is(err, service.ErrUnknownTenant):
+		return http.StatusForbidden
+	default:
+		return http.StatusBadRequest
+	}
+}
+
 func makeResponse(ctx *gin.Context, code int, status, msg string, data interface{}) {
+	if code >= http.StatusBadRequest {
+		ctx.Writer.Header().Del("Cache-Control")
+	}
 	ctx.JSON(code, gin.H{
 		"status":  status,
 		"message": msg,
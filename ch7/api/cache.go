@@ -0,0 +1,88 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+//DefaultCacheControl 默认的 Cache-Control，key 为 "METHOD /path"，例如 "GET /books/:book_id"。
+//Book 按照租户隔离，只允许客户端缓存，每次使用前通过 ETag 重新验证
+var DefaultCacheControl = map[string]string{
+	"GET /books/:book_id": "private, no-cache",
+	"GET /books/":         "private, no-cache",
+}
+
+//CacheControl 按照路由返回 Cache-Control，makeResponse 返回错误时删除，错误响应不会被缓存
+func CacheControl(policies map[string]string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if policy, ok := policies[ctx.Request.Method+" "+ctx.FullPath()]; ok {
+			ctx.Header("Cache-Control", policy)
+		}
+		ctx.Next()
+	}
+}
+
+//makeCachedResponse 与 makeResponse 一样返回 data，同时根据响应内容生成 ETag，lastModified 不为零时返回 Last-Modified。
+//请求的 If-None-Match 或者 If-Modified-Since 表明客户端的缓存仍然有效时返回 304 Not Modified。
+//响应内容还依赖其他数据时 lastModified 传零值，只使用 ETag 验证
+func makeCachedResponse(ctx *gin.Context, data interface{}, lastModified time.Time) {
+	body, err := json.Marshal(gin.H{
+		"status":  "success",
+		"message": "",
+		"data":    data,
+	})
+	if err != nil {
+		makeResponse(ctx, http.StatusInternalServerError, "failed", err.Error(), nil)
+		return
+	}
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+
+	header := ctx.Writer.Header()
+	header.Set("ETag", etag)
+	header.Add("Vary", TenantHeader)
+	header.Add("Vary", "Accept-Language")
+	if !lastModified.IsZero() {
+		header.Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+	if notModified(ctx.Request, etag, lastModified) {
+		ctx.Status(http.StatusNotModified)
+		ctx.Writer.WriteHeaderNow()
+		return
+	}
+	ctx.Data(http.StatusOK, "application/json; charset=utf-8", body)
+}
+
+//notModified 按照 RFC 7232 判断缓存是否有效，有 If-None-Match 时忽略 If-Modified-Since
+func notModified(req *http.Request, etag string, lastModified time.Time) bool {
+	if inm := req.Header.Get("If-None-Match"); inm != "" {
+		return etagMatch(inm, etag)
+	}
+	ims := req.Header.Get("If-Modified-Since")
+	if ims == "" || lastModified.IsZero() {
+		return false
+	}
+	since, err := http.ParseTime(ims)
+	if err != nil {
+		return false
+	}
+	//Last-Modified 只精确到秒
+	return !lastModified.Truncate(time.Second).After(since)
+}
+
+//etagMatch GET 请求使用弱比较，忽略 W/ 前缀
+func etagMatch(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
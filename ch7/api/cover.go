@@ -0,0 +1,188 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/cast"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/blobstore"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/cover"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/model"
+	"gorm.io/gorm"
+)
+
+//coverStore 封面存储，由 SetCoverStore 设置
+var coverStore blobstore.Store
+
+//SetCoverStore 设置封面存储，未设置时封面相关接口返回 503
+func SetCoverStore(store blobstore.Store) {
+	coverStore = store
+}
+
+//coverURL 返回封面的访问地址
+func coverURL(bookId uint, size string) string {
+	return fmt.Sprintf("%s/%d/cover/%s", bookBasePath, bookId, size)
+}
+
+//fillCovers 填充 Book 的封面地址
+func fillCovers(ctx *gin.Context, book *model.Book) error {
+	covers, err := getManager(ctx).ListCovers(book.ID)
+	if err != nil {
+		return err
+	}
+	setCovers(book, covers)
+	return nil
+}
+
+//fillBooksCovers 一次查询填充多个 Book 的封面地址
+func fillBooksCovers(ctx *gin.Context, books []*model.Book) error {
+	bookIds := make([]uint, 0, len(books))
+	for _, book := range books {
+		bookIds = append(bookIds, book.ID)
+	}
+	covers, err := getManager(ctx).CoversByBooks(bookIds)
+	if err != nil {
+		return err
+	}
+	for _, book := range books {
+		setCovers(book, covers[book.ID])
+	}
+	return nil
+}
+
+func setCovers(book *model.Book, covers []*model.Cover) {
+	if len(covers) == 0 {
+		return
+	}
+	book.Covers = make(map[string]string, len(covers))
+	for _, c := range covers {
+		book.Covers[c.Size] = coverURL(book.ID, c.Size)
+	}
+}
+
+func uploadCover(ctx *gin.Context) {
+	if coverStore == nil {
+		makeResponse(ctx, http.StatusServiceUnavailable, "failed", "cover store is not configured", nil)
+		return
+	}
+	bookId, err := cast.ToUintE(ctx.Param("book_id"))
+	if err != nil {
+		makeResponse(ctx, http.StatusBadRequest, "failed", "invalid book id", nil)
+		return
+	}
+	if _, err := getManager(ctx).GetBook(bookId); err != nil {
+		makeResponse(ctx, http.StatusNotFound, "failed", err.Error(), nil)
+		return
+	}
+
+	//multipart 的边界等内容额外预留 1MB
+	ctx.Request.Body = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, cover.MaxSize+1<<20)
+	header, err := ctx.FormFile("cover")
+	if err != nil {
+		code := http.StatusBadRequest
+		if isBodyTooLarge(err) {
+			code = http.StatusRequestEntityTooLarge
+		}
+		makeResponse(ctx, code, "failed", err.Error(), nil)
+		return
+	}
+	if header.Size > cover.MaxSize {
+		makeResponse(ctx, http.StatusRequestEntityTooLarge, "failed",
+			fmt.Sprintf("cover is larger than %d bytes", cover.MaxSize), nil)
+		return
+	}
+	file, err := header.Open()
+	if err != nil {
+		makeResponse(ctx, http.StatusBadRequest, "failed", err.Error(), nil)
+		return
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	data, err := io.ReadAll(io.LimitReader(file, cover.MaxSize+1))
+	if err != nil {
+		makeResponse(ctx, http.StatusBadRequest, "failed", err.Error(), nil)
+		return
+	}
+
+	images, err := cover.Process(data)
+	if err != nil {
+		code := http.StatusBadRequest
+		if errors.Is(err, cover.ErrUnsupportedType) {
+			code = http.StatusUnsupportedMediaType
+		}
+		makeResponse(ctx, code, "failed", err.Error(), nil)
+		return
+	}
+
+	covers := make([]*model.Cover, 0, len(images))
+	for _, img := range images {
+		key := fmt.Sprintf("covers/%d/%s%s", bookId, img.Size, img.Extension)
+		if err := coverStore.Put(ctx, key, bytes.NewReader(img.Data)); err != nil {
+			makeResponse(ctx, http.StatusInternalServerError, "failed", err.Error(), nil)
+			return
+		}
+		covers = append(covers, &model.Cover{
+			Size:        img.Size,
+			Key:         key,
+			ContentType: img.ContentType,
+			Width:       img.Width,
+			Height:      img.Height,
+		})
+	}
+	if err := getManager(ctx).SaveCovers(bookId, covers); err != nil {
+		makeResponse(ctx, http.StatusInternalServerError, "failed", err.Error(), nil)
+		return
+	}
+
+	urls := make(map[string]string, len(covers))
+	for _, c := range covers {
+		urls[c.Size] = coverURL(bookId, c.Size)
+	}
+	makeResponse(ctx, http.StatusOK, "success", "", urls)
+}
+
+func getCover(ctx *gin.Context) {
+	if coverStore == nil {
+		makeResponse(ctx, http.StatusServiceUnavailable, "failed", "cover store is not configured", nil)
+		return
+	}
+	bookId, err := cast.ToUintE(ctx.Param("book_id"))
+	if err != nil {
+		makeResponse(ctx, http.StatusBadRequest, "failed", "invalid book id", nil)
+		return
+	}
+	c, err := getManager(ctx).GetCover(bookId, ctx.Param("size"))
+	if err != nil {
+		code := http.StatusInternalServerError
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			code = http.StatusNotFound
+		}
+		makeResponse(ctx, code, "failed", err.Error(), nil)
+		return
+	}
+	reader, err := coverStore.Get(ctx, c.Key)
+	if err != nil {
+		code := http.StatusInternalServerError
+		if errors.Is(err, blobstore.ErrNotFound) {
+			code = http.StatusNotFound
+		}
+		makeResponse(ctx, code, "failed", err.Error(), nil)
+		return
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+	ctx.Header("Cache-Control", "public, max-age=86400")
+	ctx.DataFromReader(http.StatusOK, -1, c.ContentType, reader, nil)
+}
+
+//isBodyTooLarge 请求体超过 http.MaxBytesReader 的限制，Go 1.19 之前没有导出的错误类型，只能比较错误信息
+func isBodyTooLarge(err error) bool {
+	return strings.Contains(err.Error(), "http: request body too large")
+}
@@ -0,0 +1,97 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/model"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/stream"
+)
+
+//EventHeartbeat 没有事件时发送心跳的间隔，避免代理因为连接空闲而断开
+var EventHeartbeat = 15 * time.Second
+
+//eventRetry 建议客户端断线后重连的等待时间
+const eventRetry = 3 * time.Second
+
+//eventBroker Book 事件的广播，由 SetEventBroker 设置
+var eventBroker *stream.Broker
+
+//SetEventBroker 设置 /books/events 使用的 Broker
+func SetEventBroker(broker *stream.Broker) {
+	eventBroker = broker
+}
+
+//streamEvents 以 Server-Sent Events 推送 Book 的新增、更新与删除事件。
+//客户端重连时通过 Last-Event-ID 请求头或者 last_event_id 参数补发断开期间的事件，
+//无法完整补发时先推送 reset 事件，客户端需要重新加载全部数据
+func streamEvents(ctx *gin.Context) {
+	if eventBroker == nil {
+		makeResponse(ctx, http.StatusServiceUnavailable, "failed", "event stream is not configured", nil)
+		return
+	}
+	lastEventId := ctx.GetHeader("Last-Event-ID")
+	if lastEventId == "" {
+		lastEventId = ctx.Query("last_event_id")
+	}
+	var resume bool
+	var afterId uint64
+	if lastEventId != "" {
+		var err error
+		if afterId, err = strconv.ParseUint(lastEventId, 10, 64); err != nil {
+			makeResponse(ctx, http.StatusBadRequest, "failed", "invalid last event id", nil)
+			return
+		}
+		resume = true
+	}
+	var tenantId string
+	if m := requestManager(ctx); m != nil {
+		tenantId, _ = m.TenantID()
+	}
+	sub := eventBroker.Subscribe(tenantId, resume, uint(afterId))
+	defer sub.Close()
+
+	header := ctx.Writer.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	header.Set("X-Accel-Buffering", "no")
+	ctx.Status(http.StatusOK)
+	_ = sse.Encode(ctx.Writer, sse.Event{Retry: uint(eventRetry.Milliseconds())})
+	if sub.Lost {
+		_ = sse.Encode(ctx.Writer, sse.Event{Event: "reset", Data: "events are lost, reload all books"})
+	}
+	for _, event := range sub.Replay {
+		writeEvent(ctx, event)
+	}
+	ctx.Writer.Flush()
+
+	heartbeat := time.NewTicker(EventHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-ctx.Request.Context().Done():
+			return
+		case event, ok := <-sub.Events():
+			if !ok {
+				//跟不上事件的速度被断开，客户端重连后从缓冲区补发
+				return
+			}
+			writeEvent(ctx, event)
+		case <-heartbeat.C:
+			_, _ = ctx.Writer.WriteString(": heartbeat\n\n")
+		}
+		ctx.Writer.Flush()
+	}
+}
+
+func writeEvent(ctx *gin.Context, event *model.OutboxEvent) {
+	_ = sse.Encode(ctx.Writer, sse.Event{
+		Id:    strconv.FormatUint(uint64(event.ID), 10),
+		Event: string(event.Type),
+		Data:  event,
+	})
+}
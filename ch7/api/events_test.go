@@ -0,0 +1,121 @@
+package api_test
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/api"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/model"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/stream"
+)
+
+var _ = ginkgo.Describe("book event stream", func() {
+	var server *httptest.Server
+	var broker *stream.Broker
+
+	ginkgo.BeforeEach(func() {
+		broker = stream.NewBroker(2)
+		api.SetEventBroker(broker)
+		heartbeat := api.EventHeartbeat
+		api.EventHeartbeat = 20 * time.Millisecond
+		router := gin.New()
+		api.InitRoute(router.Group("/books"))
+		server = httptest.NewServer(router)
+		ginkgo.DeferCleanup(func() {
+			server.Close()
+			api.SetEventBroker(nil)
+			api.EventHeartbeat = heartbeat
+		})
+	})
+
+	publish := func(id uint) {
+		event, err := model.NewBookEvent(model.EventBookCreated, &model.Book{Title: "Go"})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		event.ID = id
+		gomega.Expect(broker.Publish(context.Background(), event)).To(gomega.Succeed())
+	}
+
+	//connect 连接事件流，返回逐行读取响应的 channel
+	connect := func(lastEventId string) (*http.Response, <-chan string) {
+		ctx, cancel := context.WithCancel(context.Background())
+		ginkgo.DeferCleanup(cancel)
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/books/events", nil)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		if lastEventId != "" {
+			req.Header.Set("Last-Event-ID", lastEventId)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		lines := make(chan string, 100)
+		go func() {
+			defer close(lines)
+			scanner := bufio.NewScanner(resp.Body)
+			for scanner.Scan() {
+				lines <- scanner.Text()
+			}
+		}()
+		ginkgo.DeferCleanup(func() {
+			_ = resp.Body.Close()
+		})
+		return resp, lines
+	}
+
+	ginkgo.It("push events as they are published", func() {
+		resp, lines := connect("")
+		gomega.Expect(resp.StatusCode).To(gomega.Equal(http.StatusOK))
+		gomega.Expect(resp.Header.Get("Content-Type")).To(gomega.Equal("text/event-stream"))
+		gomega.Eventually(lines).Should(gomega.Receive(gomega.Equal("retry:3000")))
+
+		publish(7)
+		gomega.Eventually(lines).Should(gomega.Receive(gomega.Equal("id:7")))
+		gomega.Eventually(lines).Should(gomega.Receive(gomega.Equal("event:book.created")))
+		var data string
+		gomega.Eventually(lines).Should(gomega.Receive(&data))
+		gomega.Expect(data).To(gomega.HavePrefix("data:{"))
+		gomega.Expect(data).To(gomega.ContainSubstring(`"id":7`))
+	})
+
+	ginkgo.It("send heartbeats while idle", func() {
+		_, lines := connect("")
+		gomega.Eventually(lines).Should(gomega.Receive(gomega.Equal(": heartbeat")))
+	})
+
+	ginkgo.It("replay events after Last-Event-ID", func() {
+		publish(1)
+		publish(2)
+		_, lines := connect("1")
+		gomega.Eventually(lines).Should(gomega.Receive(gomega.Equal("id:2")))
+	})
+
+	ginkgo.It("ask the client to reload when events are lost", func() {
+		for id := uint(1); id <= 3; id++ {
+			publish(id)
+		}
+		_, lines := connect("0")
+		gomega.Eventually(lines).Should(gomega.Receive(gomega.Equal("event:reset")))
+		gomega.Eventually(lines).Should(gomega.Receive(gomega.Equal("id:2")))
+	})
+
+	ginkgo.It("reject invalid Last-Event-ID", func() {
+		resp, _ := connect("abc")
+		gomega.Expect(resp.StatusCode).To(gomega.Equal(http.StatusBadRequest))
+	})
+
+	ginkgo.It("return 503 without broker", func() {
+		api.SetEventBroker(nil)
+		resp, err := http.Get(server.URL + "/books/events")
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		defer func() {
+			_ = resp.Body.Close()
+		}()
+		gomega.Expect(resp.StatusCode).To(gomega.Equal(http.StatusServiceUnavailable))
+		gomega.Expect(strings.ToLower(resp.Header.Get("Content-Type"))).To(gomega.ContainSubstring("json"))
+	})
+})
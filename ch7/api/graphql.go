@@ -0,0 +1,52 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/gql"
+)
+
+//errMutationOverGet GET 请求只能执行 query，避免通过链接触发修改
+var errMutationOverGet = errors.New("mutations must use POST")
+
+//executor 执行 GraphQL 查询，在 InitGraphQLRoute 中创建
+var executor *gql.Executor
+
+//graphqlQuery 按照 GraphQL over HTTP 的约定处理请求：GET 的参数在查询字符串中，只能执行 query；
+//POST 的请求体为 JSON。响应使用 GraphQL 的 {data, errors} 格式，而不是 makeResponse
+func graphqlQuery(ctx *gin.Context) {
+	var req gql.Request
+	if ctx.Request.Method == http.MethodGet {
+		req.Query = ctx.Query("query")
+		req.OperationName = ctx.Query("operationName")
+		if variables := ctx.Query("variables"); variables != "" {
+			if err := json.Unmarshal([]byte(variables), &req.Variables); err != nil {
+				graphqlError(ctx, http.StatusBadRequest, err)
+				return
+			}
+		}
+	} else if err := ctx.ShouldBindJSON(&req); err != nil {
+		graphqlError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	operation, err := executor.Prepare(req)
+	if err != nil {
+		graphqlError(ctx, http.StatusBadRequest, err)
+		return
+	}
+	if operation.Type != "query" && ctx.Request.Method == http.MethodGet {
+		ctx.Header("Allow", http.MethodPost)
+		graphqlError(ctx, http.StatusMethodNotAllowed, errMutationOverGet)
+		return
+	}
+	ctx.JSON(http.StatusOK, executor.Run(ctx.Request.Context(), getManager(ctx), operation))
+}
+
+func graphqlError(ctx *gin.Context, code int, err error) {
+	ctx.JSON(code, gin.H{"errors": []gqlerrors.FormattedError{gqlerrors.FormatError(err)}})
+}
@@ -0,0 +1,136 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/cast"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/model"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/service"
+	"gorm.io/gorm"
+)
+
+//stockRequest 库存变更请求，adjust 时 Quantity 可以为负数
+type stockRequest struct {
+	Quantity int64  `json:"quantity"`
+	Reason   string `json:"reason"`
+}
+
+//stockOperation 库存变更操作
+type stockOperation func(m *service.Manager, bookId uint, warehouse string, quantity int64, reason string) (*model.Inventory, error)
+
+var stockOperations = map[string]stockOperation{
+	"reserve": (*service.Manager).ReserveStock,
+	"release": (*service.Manager).ReleaseStock,
+	"fulfill": (*service.Manager).FulfillStock,
+	"adjust":  (*service.Manager).AdjustStock,
+}
+
+func listStock(ctx *gin.Context) {
+	bookId, err := cast.ToUintE(ctx.Param("book_id"))
+	if err != nil {
+		makeResponse(ctx, http.StatusBadRequest, "failed", "invalid book id", nil)
+		return
+	}
+	inventories, err := getManager(ctx).ListStock(bookId)
+	if err != nil {
+		makeResponse(ctx, http.StatusInternalServerError, "failed", err.Error(), nil)
+		return
+	}
+	makeResponse(ctx, http.StatusOK, "success", "", inventories)
+}
+
+func changeStock(ctx *gin.Context) {
+	bookId, err := cast.ToUintE(ctx.Param("book_id"))
+	if err != nil {
+		makeResponse(ctx, http.StatusBadRequest, "failed", "invalid book id", nil)
+		return
+	}
+	operation, ok := stockOperations[ctx.Param("operation")]
+	if !ok {
+		makeResponse(ctx, http.StatusNotFound, "failed", "unknown stock operation", nil)
+		return
+	}
+	var req stockRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		makeResponse(ctx, http.StatusBadRequest, "failed", err.Error(), nil)
+		return
+	}
+	if _, err := getManager(ctx).GetBook(bookId); err != nil {
+		makeResponse(ctx, http.StatusNotFound, "failed", err.Error(), nil)
+		return
+	}
+	inventory, err := operation(getManager(ctx), bookId, ctx.Param("warehouse"), req.Quantity, req.Reason)
+	if err != nil {
+		makeResponse(ctx, stockErrorCode(err), "failed", err.Error(), nil)
+		return
+	}
+	makeResponse(ctx, http.StatusOK, "success", "", inventory)
+}
+
+func setLowStockThreshold(ctx *gin.Context) {
+	bookId, err := cast.ToUintE(ctx.Param("book_id"))
+	if err != nil {
+		makeResponse(ctx, http.StatusBadRequest, "failed", "invalid book id", nil)
+		return
+	}
+	var req struct {
+		Threshold int64 `json:"threshold"`
+	}
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		makeResponse(ctx, http.StatusBadRequest, "failed", err.Error(), nil)
+		return
+	}
+	if err := getManager(ctx).SetLowStockThreshold(bookId, ctx.Param("warehouse"), req.Threshold); err != nil {
+		makeResponse(ctx, stockErrorCode(err), "failed", err.Error(), nil)
+		return
+	}
+	makeResponse(ctx, http.StatusOK, "success", "", nil)
+}
+
+func listLowStock(ctx *gin.Context) {
+	page, err := parsePageOptions(ctx)
+	if err != nil {
+		makeResponse(ctx, http.StatusBadRequest, "failed", err.Error(), nil)
+		return
+	}
+	inventories, err := getManager(ctx).ListLowStock(ctx.Query("warehouse"), page.PageNumber, page.PageSize)
+	if err != nil {
+		makeResponse(ctx, http.StatusInternalServerError, "failed", err.Error(), nil)
+		return
+	}
+	makeResponse(ctx, http.StatusOK, "success", "", inventories)
+}
+
+func listStockMovements(ctx *gin.Context) {
+	bookId, err := cast.ToUintE(ctx.Param("book_id"))
+	if err != nil {
+		makeResponse(ctx, http.StatusBadRequest, "failed", "invalid book id", nil)
+		return
+	}
+	page, err := parsePageOptions(ctx)
+	if err != nil {
+		makeResponse(ctx, http.StatusBadRequest, "failed", err.Error(), nil)
+		return
+	}
+	movements, err := getManager(ctx).ListStockMovements(bookId, page.PageNumber, page.PageSize)
+	if err != nil {
+		makeResponse(ctx, http.StatusInternalServerError, "failed", err.Error(), nil)
+		return
+	}
+	makeResponse(ctx, http.StatusOK, "success", "", movements)
+}
+
+func stockErrorCode(err error) int {
+	switch {
+	case errors.Is(err, service.ErrInsufficientStock):
+		return http.StatusConflict
+	case errors.Is(err, service.ErrInvalidQuantity):
+		return http.StatusBadRequest
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
+	}
+}
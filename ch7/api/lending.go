@@ -0,0 +1,218 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/cast"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/model"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/service"
+	"gorm.io/gorm"
+)
+
+//memberRequest 借出和预约请求
+type memberRequest struct {
+	MemberID uint `json:"member_id" binding:"required"`
+}
+
+func createMember(ctx *gin.Context) {
+	var member model.Member
+	if err := ctx.ShouldBindJSON(&member); err != nil {
+		makeResponse(ctx, http.StatusBadRequest, "failed", err.Error(), nil)
+		return
+	}
+	if member.Name == "" {
+		makeResponse(ctx, http.StatusBadRequest, "failed", "name is required", nil)
+		return
+	}
+	if err := getManager(ctx).CreateMember(&member); err != nil {
+		makeResponse(ctx, http.StatusInternalServerError, "failed", err.Error(), nil)
+		return
+	}
+	makeResponse(ctx, http.StatusOK, "success", "", member)
+}
+
+func getMember(ctx *gin.Context) {
+	memberId, err := cast.ToUintE(ctx.Param("member_id"))
+	if err != nil {
+		makeResponse(ctx, http.StatusBadRequest, "failed", "invalid member id", nil)
+		return
+	}
+	member, err := getManager(ctx).GetMember(memberId)
+	if err != nil {
+		makeResponse(ctx, lendingErrorCode(err), "failed", err.Error(), nil)
+		return
+	}
+	makeResponse(ctx, http.StatusOK, "success", "", member)
+}
+
+func listMemberLoans(ctx *gin.Context) {
+	memberId, err := cast.ToUintE(ctx.Param("member_id"))
+	if err != nil {
+		makeResponse(ctx, http.StatusBadRequest, "failed", "invalid member id", nil)
+		return
+	}
+	page, err := parsePageOptions(ctx)
+	if err != nil {
+		makeResponse(ctx, http.StatusBadRequest, "failed", err.Error(), nil)
+		return
+	}
+	loans, err := getManager(ctx).ListMemberLoans(memberId, page.PageNumber, page.PageSize)
+	if err != nil {
+		makeResponse(ctx, http.StatusInternalServerError, "failed", err.Error(), nil)
+		return
+	}
+	makeResponse(ctx, http.StatusOK, "success", "", loans)
+}
+
+func setHoldings(ctx *gin.Context) {
+	bookId, err := cast.ToUintE(ctx.Param("book_id"))
+	if err != nil {
+		makeResponse(ctx, http.StatusBadRequest, "failed", "invalid book id", nil)
+		return
+	}
+	var req struct {
+		Copies int `json:"copies"`
+	}
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		makeResponse(ctx, http.StatusBadRequest, "failed", err.Error(), nil)
+		return
+	}
+	if _, err := getManager(ctx).GetBook(bookId); err != nil {
+		makeResponse(ctx, http.StatusNotFound, "failed", err.Error(), nil)
+		return
+	}
+	holding, err := getManager(ctx).SetHoldings(bookId, req.Copies)
+	if err != nil {
+		makeResponse(ctx, lendingErrorCode(err), "failed", err.Error(), nil)
+		return
+	}
+	makeResponse(ctx, http.StatusOK, "success", "", holding)
+}
+
+func checkout(ctx *gin.Context) {
+	bookId, err := cast.ToUintE(ctx.Param("book_id"))
+	if err != nil {
+		makeResponse(ctx, http.StatusBadRequest, "failed", "invalid book id", nil)
+		return
+	}
+	var req memberRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		makeResponse(ctx, http.StatusBadRequest, "failed", err.Error(), nil)
+		return
+	}
+	loan, err := getManager(ctx).Checkout(bookId, req.MemberID)
+	if err != nil {
+		makeResponse(ctx, lendingErrorCode(err), "failed", err.Error(), nil)
+		return
+	}
+	makeResponse(ctx, http.StatusOK, "success", "", loan)
+}
+
+func placeHold(ctx *gin.Context) {
+	bookId, err := cast.ToUintE(ctx.Param("book_id"))
+	if err != nil {
+		makeResponse(ctx, http.StatusBadRequest, "failed", "invalid book id", nil)
+		return
+	}
+	var req memberRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		makeResponse(ctx, http.StatusBadRequest, "failed", err.Error(), nil)
+		return
+	}
+	hold, err := getManager(ctx).PlaceHold(bookId, req.MemberID)
+	if err != nil {
+		makeResponse(ctx, lendingErrorCode(err), "failed", err.Error(), nil)
+		return
+	}
+	makeResponse(ctx, http.StatusOK, "success", "", hold)
+}
+
+func listHolds(ctx *gin.Context) {
+	bookId, err := cast.ToUintE(ctx.Param("book_id"))
+	if err != nil {
+		makeResponse(ctx, http.StatusBadRequest, "failed", "invalid book id", nil)
+		return
+	}
+	holds, err := getManager(ctx).ListHolds(bookId)
+	if err != nil {
+		makeResponse(ctx, http.StatusInternalServerError, "failed", err.Error(), nil)
+		return
+	}
+	makeResponse(ctx, http.StatusOK, "success", "", holds)
+}
+
+func cancelHold(ctx *gin.Context) {
+	holdId, err := cast.ToUintE(ctx.Param("hold_id"))
+	if err != nil {
+		makeResponse(ctx, http.StatusBadRequest, "failed", "invalid hold id", nil)
+		return
+	}
+	hold, err := getManager(ctx).CancelHold(holdId)
+	if err != nil {
+		makeResponse(ctx, lendingErrorCode(err), "failed", err.Error(), nil)
+		return
+	}
+	makeResponse(ctx, http.StatusOK, "success", "", hold)
+}
+
+func renewLoan(ctx *gin.Context) {
+	loanId, err := cast.ToUintE(ctx.Param("loan_id"))
+	if err != nil {
+		makeResponse(ctx, http.StatusBadRequest, "failed", "invalid loan id", nil)
+		return
+	}
+	loan, err := getManager(ctx).RenewLoan(loanId)
+	if err != nil {
+		makeResponse(ctx, lendingErrorCode(err), "failed", err.Error(), nil)
+		return
+	}
+	makeResponse(ctx, http.StatusOK, "success", "", loan)
+}
+
+func returnLoan(ctx *gin.Context) {
+	loanId, err := cast.ToUintE(ctx.Param("loan_id"))
+	if err != nil {
+		makeResponse(ctx, http.StatusBadRequest, "failed", "invalid loan id", nil)
+		return
+	}
+	loan, err := getManager(ctx).ReturnLoan(loanId)
+	if err != nil {
+		makeResponse(ctx, lendingErrorCode(err), "failed", err.Error(), nil)
+		return
+	}
+	makeResponse(ctx, http.StatusOK, "success", "", loan)
+}
+
+func listOverdueLoans(ctx *gin.Context) {
+	page, err := parsePageOptions(ctx)
+	if err != nil {
+		makeResponse(ctx, http.StatusBadRequest, "failed", err.Error(), nil)
+		return
+	}
+	loans, err := getManager(ctx).ListOverdueLoans(time.Now(), page.PageNumber, page.PageSize)
+	if err != nil {
+		makeResponse(ctx, http.StatusInternalServerError, "failed", err.Error(), nil)
+		return
+	}
+	makeResponse(ctx, http.StatusOK, "success", "", loans)
+}
+
+func lendingErrorCode(err error) int {
+	switch {
+	case errors.Is(err, model.ErrInvalidTransition),
+		errors.Is(err, service.ErrNoCopyAvailable),
+		errors.Is(err, service.ErrLoanLimit),
+		errors.Is(err, service.ErrHoldsWaiting),
+		errors.Is(err, service.ErrDuplicateHold):
+		return http.StatusConflict
+	case errors.Is(err, service.ErrInvalidQuantity):
+		return http.StatusBadRequest
+	case errors.Is(err, service.ErrNotLendable), errors.Is(err, gorm.ErrRecordNotFound):
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
+	}
+}
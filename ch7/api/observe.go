@@ -0,0 +1,143 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/service"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/trace"
+)
+
+const (
+	RequestIDHeader   = "X-Request-ID"   //RequestIDHeader 请求标识，客户端没有传入时生成
+	TraceparentHeader = "traceparent"    //TraceparentHeader W3C Trace Context 请求头
+	requestIDKey      = "api:request_id" //requestIDKey 当前请求的标识
+)
+
+var requestIDPattern = regexp.MustCompile(`^[a-zA-Z0-9._:-]{1,128}$`)
+
+//RequestID 使用客户端传入的 X-Request-ID，没有或者格式不正确时生成新的，并在响应中返回
+func RequestID() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		requestId := ctx.GetHeader(RequestIDHeader)
+		if !requestIDPattern.MatchString(requestId) {
+			requestId = newRequestID()
+		}
+		ctx.Set(requestIDKey, requestId)
+		ctx.Header(RequestIDHeader, requestId)
+		ctx.Next()
+	}
+}
+
+func newRequestID() string {
+	var id [16]byte
+	_, _ = rand.Read(id[:])
+	return hex.EncodeToString(id[:])
+}
+
+//Trace 为每个请求创建 Span，请求带有 traceparent 时作为上游 Span 的子 Span。
+//Span 保存在 ctx.Request 的 Context 中，handler 通过 getManager 访问数据库时为每条 SQL 创建子 Span
+func Trace() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		reqCtx := ctx.Request.Context()
+		if sc, err := trace.ParseTraceparent(ctx.GetHeader(TraceparentHeader)); err == nil {
+			reqCtx = trace.ContextWithRemote(reqCtx, sc)
+		}
+		route := ctx.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		reqCtx, span := trace.Start(reqCtx, ctx.Request.Method+" "+route)
+		defer span.Finish()
+		span.SetAttribute("http.method", ctx.Request.Method)
+		span.SetAttribute("http.route", route)
+		span.SetAttribute("http.target", ctx.Request.URL.RequestURI())
+		if requestId := ctx.GetString(requestIDKey); requestId != "" {
+			span.SetAttribute("request_id", requestId)
+		}
+		ctx.Request = ctx.Request.WithContext(reqCtx)
+		ctx.Header(TraceparentHeader, span.Context().Traceparent())
+
+		ctx.Next()
+
+		status := ctx.Writer.Status()
+		span.SetAttribute("http.status_code", strconv.Itoa(status))
+		if err := ctx.Errors.Last(); err != nil {
+			span.SetError(err.Err)
+		} else if status >= http.StatusInternalServerError {
+			span.SetError(errors.New(http.StatusText(status)))
+		}
+	}
+}
+
+//requestLog 一个请求的日志
+type requestLog struct {
+	Time      time.Time `json:"time"`
+	RequestID string    `json:"request_id,omitempty"`
+	TraceID   string    `json:"trace_id,omitempty"`
+	SpanID    string    `json:"span_id,omitempty"`
+	Tenant    string    `json:"tenant,omitempty"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	Route     string    `json:"route,omitempty"`
+	Status    int       `json:"status"`
+	LatencyMs float64   `json:"latency_ms"`
+	Bytes     int       `json:"bytes"`
+	ClientIP  string    `json:"client_ip"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	Error     string    `json:"error,omitempty"`
+}
+
+//RequestLog 请求结束后向 w 写入一行 JSON 格式的日志，代替 gin.Logger 的文本日志。
+//注册在 RequestID 之后、Trace 之前，日志中带有请求标识与调用链标识
+func RequestLog(w io.Writer) gin.HandlerFunc {
+	var mu sync.Mutex
+	return func(ctx *gin.Context) {
+		start := time.Now()
+		path := ctx.Request.URL.Path
+
+		ctx.Next()
+
+		entry := requestLog{
+			Time:      start,
+			RequestID: ctx.GetString(requestIDKey),
+			Method:    ctx.Request.Method,
+			Path:      path,
+			Route:     ctx.FullPath(),
+			Status:    ctx.Writer.Status(),
+			LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+			Bytes:     ctx.Writer.Size(),
+			ClientIP:  ctx.ClientIP(),
+			UserAgent: ctx.Request.UserAgent(),
+		}
+		if entry.Bytes < 0 {
+			entry.Bytes = 0
+		}
+		if span := trace.FromContext(ctx.Request.Context()); span != nil {
+			entry.TraceID = span.TraceID
+			entry.SpanID = span.SpanID
+		}
+		if m, ok := ctx.Get(managerKey); ok {
+			entry.Tenant, _ = m.(*service.Manager).TenantID()
+		}
+		if err := ctx.Errors.Last(); err != nil {
+			entry.Error = err.Error()
+		}
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		_, _ = w.Write(append(data, '\n'))
+	}
+}
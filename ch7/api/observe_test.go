@@ -0,0 +1,102 @@
+package api_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/api"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/trace"
+)
+
+var _ = ginkgo.Describe("request logging & tracing", func() {
+	const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	var router *gin.Engine
+	var logs *bytes.Buffer
+	var exporter *trace.MemoryExporter
+
+	ginkgo.BeforeEach(func() {
+		exporter = trace.NewMemoryExporter()
+		trace.SetExporter(exporter)
+		ginkgo.DeferCleanup(func() {
+			trace.SetExporter(nil)
+		})
+		logs = &bytes.Buffer{}
+		router = gin.New()
+		router.Use(api.RequestID(), api.RequestLog(logs), api.Trace())
+		router.GET("/books/:book_id", func(ctx *gin.Context) {
+			_, span := trace.Start(ctx.Request.Context(), "load book")
+			span.Finish()
+			ctx.Status(http.StatusOK)
+		})
+		router.GET("/fail", func(ctx *gin.Context) {
+			ctx.Status(http.StatusInternalServerError)
+		})
+	})
+
+	request := func(path string, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	lastLog := func() map[string]interface{} {
+		lines := strings.Split(strings.TrimSpace(logs.String()), "\n")
+		var entry map[string]interface{}
+		gomega.Expect(json.Unmarshal([]byte(lines[len(lines)-1]), &entry)).To(gomega.Succeed())
+		return entry
+	}
+
+	ginkgo.It("propagate the request id of the client", func() {
+		w := request("/books/1", map[string]string{api.RequestIDHeader: "req-1"})
+		gomega.Expect(w.Header().Get(api.RequestIDHeader)).To(gomega.Equal("req-1"))
+		gomega.Expect(lastLog()).To(gomega.HaveKeyWithValue("request_id", "req-1"))
+	})
+
+	ginkgo.It("generate a request id when missing or invalid", func() {
+		w := request("/books/1", map[string]string{api.RequestIDHeader: "bad id\n"})
+		gomega.Expect(w.Header().Get(api.RequestIDHeader)).To(gomega.MatchRegexp("^[0-9a-f]{32}$"))
+	})
+
+	ginkgo.It("log requests as json", func() {
+		request("/books/1?x=1", nil)
+		entry := lastLog()
+		gomega.Expect(entry).To(gomega.HaveKeyWithValue("method", "GET"))
+		gomega.Expect(entry).To(gomega.HaveKeyWithValue("path", "/books/1"))
+		gomega.Expect(entry).To(gomega.HaveKeyWithValue("route", "/books/:book_id"))
+		gomega.Expect(entry).To(gomega.HaveKeyWithValue("status", float64(http.StatusOK)))
+		gomega.Expect(entry).To(gomega.HaveKey("latency_ms"))
+		gomega.Expect(entry).To(gomega.HaveKey("trace_id"))
+	})
+
+	ginkgo.It("continue the trace of traceparent", func() {
+		w := request("/books/1", map[string]string{api.TraceparentHeader: traceparent})
+
+		spans := exporter.Spans()
+		gomega.Expect(spans).To(gomega.HaveLen(2))
+		handler := spans[1]
+		gomega.Expect(handler.Name).To(gomega.Equal("GET /books/:book_id"))
+		gomega.Expect(handler.TraceID).To(gomega.Equal("4bf92f3577b34da6a3ce929d0e0e4736"))
+		gomega.Expect(handler.ParentID).To(gomega.Equal("00f067aa0ba902b7"))
+		gomega.Expect(handler.Attributes).To(gomega.HaveKeyWithValue("http.status_code", "200"))
+		gomega.Expect(spans[0].ParentID).To(gomega.Equal(handler.SpanID))
+		gomega.Expect(w.Header().Get(api.TraceparentHeader)).To(gomega.Equal(handler.Context().Traceparent()))
+		gomega.Expect(lastLog()).To(gomega.HaveKeyWithValue("trace_id", handler.TraceID))
+	})
+
+	ginkgo.It("mark spans of server errors as failed", func() {
+		request("/fail", nil)
+		spans := exporter.Spans()
+		gomega.Expect(spans).To(gomega.HaveLen(1))
+		gomega.Expect(spans[0].Error).To(gomega.Equal(http.StatusText(http.StatusInternalServerError)))
+	})
+})
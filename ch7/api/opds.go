@@ -0,0 +1,193 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/cover"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/feed"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/model"
+)
+
+const exportBatchSize = 500 //exportBatchSize 导出时每次读取的 Book 数量
+
+//opdsBasePath OPDS 路由的前缀
+var opdsBasePath = "/opds"
+
+//opdsRoot 返回导航 feed，入口指向不同排序与主题的获取 feed
+func opdsRoot(ctx *gin.Context) {
+	subjects, err := getManager(ctx).ListSubjects()
+	if err != nil {
+		makeResponse(ctx, http.StatusInternalServerError, "failed", err.Error(), nil)
+		return
+	}
+	now := time.Now()
+	booksPath := opdsBasePath + "/books"
+	entries := []*feed.Entry{
+		feed.NavigationEntry("urn:books:new", "New books", "Recently added books", now,
+			feed.Link{Rel: feed.RelSortNew, Href: booksPath, Type: feed.AcquisitionType}),
+		feed.NavigationEntry("urn:books:rating", "Top rated", "Books with the highest average rating", now,
+			feed.Link{Rel: feed.RelSortPop, Href: booksPath + "?sort=" + string(model.SortByRating), Type: feed.AcquisitionType}),
+		feed.NavigationEntry("urn:books:reviews", "Most reviewed", "Books with the most reviews", now,
+			feed.Link{Rel: "subsection", Href: booksPath + "?sort=" + string(model.SortByReviewCount), Type: feed.AcquisitionType}),
+	}
+	for _, subject := range subjects {
+		entries = append(entries, feed.NavigationEntry(fmt.Sprintf("urn:subject:%d", subject.ID),
+			subject.Name, "Books in "+subject.Name, subject.UpdatedAt,
+			feed.Link{Rel: "subsection", Href: fmt.Sprintf("%s?subject=%d", booksPath, subject.ID), Type: feed.AcquisitionType}))
+	}
+
+	writeFeed(ctx, feed.NavigationType, feed.Feed{
+		ID:      "urn:catalog",
+		Title:   "Catalog",
+		Updated: now,
+		Links: []feed.Link{
+			{Rel: "self", Href: opdsBasePath, Type: feed.NavigationType},
+			{Rel: "start", Href: opdsBasePath, Type: feed.NavigationType},
+		},
+	}, func(w *feed.Writer) error {
+		for _, entry := range entries {
+			if err := w.WriteEntry(entry); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+//opdsBooks 返回 ListBooks 的一页作为获取 feed，查询参数与 Book 列表相同
+func opdsBooks(ctx *gin.Context) {
+	q, err := parseBookQuery(ctx)
+	if err != nil {
+		makeResponse(ctx, http.StatusBadRequest, "failed", err.Error(), nil)
+		return
+	}
+	books, err := getManager(ctx).ListBooks(q)
+	if err != nil {
+		makeResponse(ctx, listErrorCode(err), "failed", err.Error(), nil)
+		return
+	}
+
+	links := []feed.Link{
+		{Rel: "self", Href: pageURL(ctx, q.PageNumber), Type: feed.AcquisitionType},
+		{Rel: "start", Href: opdsBasePath, Type: feed.NavigationType},
+		{Rel: "up", Href: opdsBasePath, Type: feed.NavigationType},
+		{Rel: "first", Href: pageURL(ctx, 0), Type: feed.AcquisitionType},
+	}
+	if q.PageNumber > 0 {
+		links = append(links, feed.Link{Rel: "previous", Href: pageURL(ctx, q.PageNumber-1), Type: feed.AcquisitionType})
+	}
+	//不统计总数，本页已满时认为还有下一页
+	if len(books) == q.PageSize {
+		links = append(links, feed.Link{Rel: "next", Href: pageURL(ctx, q.PageNumber+1), Type: feed.AcquisitionType})
+	}
+	if err := fillBooksCovers(ctx, books); err != nil {
+		makeResponse(ctx, http.StatusInternalServerError, "failed", err.Error(), nil)
+		return
+	}
+	//空页面没有可以参考的时间，使用当前时间
+	updated := time.Now()
+	if len(books) > 0 {
+		updated = time.Time{}
+		for _, book := range books {
+			if book.UpdatedAt.After(updated) {
+				updated = book.UpdatedAt
+			}
+		}
+	}
+
+	writeFeed(ctx, feed.AcquisitionType, feed.Feed{
+		ID:      "urn:books:" + ctx.Request.URL.RawQuery,
+		Title:   "Books",
+		Updated: updated,
+		Links:   links,
+	}, func(w *feed.Writer) error {
+		for _, book := range books {
+			if err := w.WriteEntry(feed.BookEntry(book, entryLinks(book)...)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+//exportMARC 以 MARCXML 格式流式导出符合条件的所有 Book
+func exportMARC(ctx *gin.Context) {
+	q, err := parseBookQuery(ctx)
+	if err != nil {
+		makeResponse(ctx, http.StatusBadRequest, "failed", err.Error(), nil)
+		return
+	}
+	ctx.Header("Content-Type", "application/marcxml+xml; charset=utf-8")
+	ctx.Header("Content-Disposition", `attachment; filename="books.marcxml"`)
+	ctx.Status(http.StatusOK)
+	w, err := feed.NewMARCWriter(ctx.Writer)
+	if err != nil {
+		log.Printf("export marcxml failed: %s", err)
+		return
+	}
+	written := 0
+	err = getManager(ctx).EachBook(q, exportBatchSize, func(book *model.Book) error {
+		if err := w.Write(book); err != nil {
+			return err
+		}
+		written++
+		if written%exportBatchSize == 0 {
+			ctx.Writer.Flush()
+		}
+		return nil
+	})
+	if err != nil {
+		//响应已经开始发送，只能中断输出，客户端会得到不完整的 XML
+		log.Printf("export marcxml failed after %d books: %s", written, err)
+		return
+	}
+	if err := w.Close(); err != nil {
+		log.Printf("export marcxml failed: %s", err)
+	}
+}
+
+//writeFeed 写入 feed 头部后调用 entries 写入条目，写入过程中出错时只能中断输出
+func writeFeed(ctx *gin.Context, contentType string, header feed.Feed, entries func(w *feed.Writer) error) {
+	ctx.Header("Content-Type", contentType+";charset=utf-8")
+	ctx.Status(http.StatusOK)
+	w, err := feed.NewWriter(ctx.Writer, header)
+	if err == nil {
+		err = entries(w)
+	}
+	if err == nil {
+		err = w.Close()
+	}
+	if err != nil {
+		log.Printf("write opds feed failed: %s", err)
+	}
+}
+
+//pageURL 返回当前 feed 第 pageNumber 页的地址，保留其他查询参数
+func pageURL(ctx *gin.Context, pageNumber int) string {
+	query := ctx.Request.URL.Query()
+	query.Set("page_number", strconv.Itoa(pageNumber))
+	u := url.URL{Path: ctx.Request.URL.Path, RawQuery: query.Encode()}
+	return u.String()
+}
+
+//entryLinks 返回 Book 条目的详情、借阅与封面链接
+func entryLinks(book *model.Book) []feed.Link {
+	bookPath := fmt.Sprintf("%s/%d", bookBasePath, book.ID)
+	links := []feed.Link{
+		{Rel: "alternate", Href: bookPath, Type: "application/json"},
+		{Rel: feed.RelBorrow, Href: bookPath + "/checkout", Type: "application/json"},
+	}
+	if href, ok := book.Covers[cover.Original]; ok {
+		links = append(links, feed.Link{Rel: feed.RelImage, Href: href})
+	}
+	if href, ok := book.Covers[cover.Thumbnails[0].Name]; ok {
+		links = append(links, feed.Link{Rel: feed.RelThumbnail, Href: href})
+	}
+	return links
+}
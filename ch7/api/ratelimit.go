@@ -0,0 +1,54 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/ratelimit"
+)
+
+//APIKeyHeader 客户端标识，不是配置中的 API Key 时按照客户端IP限流
+const APIKeyHeader = "X-API-Key"
+
+//RateLimit 令牌桶限流中间件，按照 API Key 或客户端IP、以及路由分别计数。
+//客户端IP来自 ClientIP，只有可信代理转发的 X-Forwarded-For 才会被采用，见 gin.Engine.SetTrustedProxies
+func RateLimit(store ratelimit.Store, config ratelimit.Config) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		route := fmt.Sprintf("%s %s", ctx.Request.Method, ctx.FullPath())
+		limit := config.LimitFor(route)
+		if limit.Unlimited() {
+			ctx.Next()
+			return
+		}
+
+		client := ctx.GetHeader(APIKeyHeader)
+		if !config.Authenticated(client) {
+			client = ctx.ClientIP()
+		}
+		result, err := store.Take(route+"|"+client, limit, time.Now())
+		if err != nil {
+			//限流存储不可用时不影响正常请求
+			ctx.Next()
+			return
+		}
+
+		ctx.Header("RateLimit-Limit", strconv.Itoa(result.Limit))
+		ctx.Header("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		ctx.Header("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+		if !result.Allowed {
+			ctx.Header("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+			makeResponse(ctx, http.StatusTooManyRequests, "failed", "too many requests", nil)
+			ctx.Abort()
+			return
+		}
+		ctx.Next()
+	}
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
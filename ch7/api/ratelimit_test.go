@@ -0,0 +1,103 @@
+package api_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/gin-gonic/gin"
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/api"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/ratelimit"
+)
+
+var _ = ginkgo.Describe("rate limit middleware", func() {
+	var router *gin.Engine
+
+	ginkgo.BeforeEach(func() {
+		config := ratelimit.Config{
+			Default: ratelimit.Limit{Rate: 1, Burst: 2},
+			Routes: map[string]ratelimit.Limit{
+				"GET /books/unlimited": {},
+			},
+			APIKeys: []string{"key", "other"},
+		}
+		router = gin.New()
+		gomega.Expect(router.SetTrustedProxies(nil)).To(gomega.Succeed())
+		group := router.Group("/books")
+		group.Use(api.RateLimit(ratelimit.NewMemoryStore(), config))
+		group.GET("/limited", func(ctx *gin.Context) { ctx.Status(http.StatusOK) })
+		group.GET("/unlimited", func(ctx *gin.Context) { ctx.Status(http.StatusOK) })
+	})
+
+	request := func(path, apiKey string, headers ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if apiKey != "" {
+			req.Header.Set(api.APIKeyHeader, apiKey)
+		}
+		for i := 0; i+1 < len(headers); i += 2 {
+			req.Header.Set(headers[i], headers[i+1])
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	ginkgo.Context("client within limit", func() {
+		ginkgo.It("return rate limit headers", func() {
+			w := request("/books/limited", "key")
+			gomega.Expect(w.Code).To(gomega.Equal(http.StatusOK))
+			gomega.Expect(w.Header().Get("RateLimit-Limit")).To(gomega.Equal("2"))
+			gomega.Expect(w.Header().Get("RateLimit-Remaining")).To(gomega.Equal("1"))
+			gomega.Expect(w.Header().Get("RateLimit-Reset")).To(gomega.Equal("1"))
+		})
+	})
+
+	ginkgo.Context("client exceeds limit", func() {
+		ginkgo.It("return 429 with Retry-After", func() {
+			request("/books/limited", "key")
+			request("/books/limited", "key")
+			w := request("/books/limited", "key")
+			gomega.Expect(w.Code).To(gomega.Equal(http.StatusTooManyRequests))
+			gomega.Expect(w.Header().Get("Retry-After")).To(gomega.Equal("1"))
+			gomega.Expect(w.Header().Get("RateLimit-Remaining")).To(gomega.Equal("0"))
+		})
+		ginkgo.It("not affect other clients", func() {
+			request("/books/limited", "key")
+			request("/books/limited", "key")
+			gomega.Expect(request("/books/limited", "other").Code).To(gomega.Equal(http.StatusOK))
+		})
+		ginkgo.It("count unknown api keys by client ip", func() {
+			request("/books/limited", "unknown-1")
+			request("/books/limited", "unknown-2")
+			gomega.Expect(request("/books/limited", "unknown-3").Code).To(gomega.Equal(http.StatusTooManyRequests))
+			gomega.Expect(request("/books/limited", "key").Code).To(gomega.Equal(http.StatusOK))
+		})
+		ginkgo.It("ignore X-Forwarded-For from untrusted peers", func() {
+			request("/books/limited", "", "X-Forwarded-For", "10.0.0.1")
+			request("/books/limited", "", "X-Forwarded-For", "10.0.0.2")
+			w := request("/books/limited", "", "X-Forwarded-For", "10.0.0.3")
+			gomega.Expect(w.Code).To(gomega.Equal(http.StatusTooManyRequests))
+		})
+	})
+
+	ginkgo.Context("request from trusted proxy", func() {
+		ginkgo.It("count by X-Forwarded-For", func() {
+			gomega.Expect(router.SetTrustedProxies([]string{"192.0.2.0/24"})).To(gomega.Succeed())
+			request("/books/limited", "", "X-Forwarded-For", "10.0.0.1")
+			request("/books/limited", "", "X-Forwarded-For", "10.0.0.1")
+			gomega.Expect(request("/books/limited", "", "X-Forwarded-For", "10.0.0.1").Code).To(gomega.Equal(http.StatusTooManyRequests))
+			gomega.Expect(request("/books/limited", "", "X-Forwarded-For", "10.0.0.2").Code).To(gomega.Equal(http.StatusOK))
+		})
+	})
+
+	ginkgo.Context("route is unlimited", func() {
+		ginkgo.It("never reject", func() {
+			for i := 0; i < 5; i++ {
+				w := request("/books/unlimited", "")
+				gomega.Expect(w.Code).To(gomega.Equal(http.StatusOK))
+				gomega.Expect(w.Header().Get("RateLimit-Limit")).To(gomega.BeEmpty())
+			}
+		})
+	})
+})
@@ -0,0 +1,36 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/cast"
+	"gorm.io/gorm"
+)
+
+//maxSimilarBooks 相似推荐的最大数量
+const maxSimilarBooks = 50
+
+func similarBooks(ctx *gin.Context) {
+	bookId, err := cast.ToUintE(ctx.Param("book_id"))
+	if err != nil {
+		makeResponse(ctx, http.StatusBadRequest, "failed", "invalid book id", nil)
+		return
+	}
+	limit := cast.ToInt(ctx.DefaultQuery("limit", "10"))
+	if limit <= 0 || limit > maxSimilarBooks {
+		makeResponse(ctx, http.StatusBadRequest, "failed", "invalid limit", nil)
+		return
+	}
+	recommendations, err := getManager(ctx).SimilarBooks(bookId, limit)
+	if err != nil {
+		code := http.StatusInternalServerError
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			code = http.StatusNotFound
+		}
+		makeResponse(ctx, code, "failed", err.Error(), nil)
+		return
+	}
+	makeResponse(ctx, http.StatusOK, "success", "", recommendations)
+}
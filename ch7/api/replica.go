@@ -0,0 +1,16 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+//ReadYourWrites 让请求写入数据之后的读取都使用主库，避免只读副本的延迟导致读不到刚写入的数据。
+//需要注册在 Tenant 之后，基于 Tenant 准备的 Manager 记录写入
+func ReadYourWrites() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if m := requestManager(ctx); m != nil {
+			ctx.Set(managerKey, m.TrackWrites())
+		}
+		ctx.Next()
+	}
+}
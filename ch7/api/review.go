@@ -0,0 +1,114 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/cast"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/model"
+	"gorm.io/gorm"
+)
+
+const (
+	UserHeader   = "X-User-ID" //UserHeader 通过请求头指定评价的用户
+	UserClaimKey = "user_id"   //UserClaimKey 认证中间件解析出的用户，保存在 gin.Context 中
+)
+
+//reviewRequest 创建或替换评价的请求
+type reviewRequest struct {
+	Rating int    `json:"rating"`
+	Text   string `json:"text"`
+}
+
+//currentUser 返回当前请求的用户，认证中间件解析出的用户优先于请求头
+func currentUser(ctx *gin.Context) string {
+	if claim, ok := ctx.Get(UserClaimKey); ok {
+		if userId, ok := claim.(string); ok {
+			return userId
+		}
+	}
+	return ctx.GetHeader(UserHeader)
+}
+
+func listReviews(ctx *gin.Context) {
+	bookId, err := cast.ToUintE(ctx.Param("book_id"))
+	if err != nil {
+		makeResponse(ctx, http.StatusBadRequest, "failed", "invalid book id", nil)
+		return
+	}
+	page, err := parsePageOptions(ctx)
+	if err != nil {
+		makeResponse(ctx, http.StatusBadRequest, "failed", err.Error(), nil)
+		return
+	}
+	rating, err := getManager(ctx).GetRating(bookId)
+	if err != nil {
+		makeResponse(ctx, http.StatusInternalServerError, "failed", err.Error(), nil)
+		return
+	}
+	reviews, err := getManager(ctx).ListReviews(bookId, page.PageNumber, page.PageSize)
+	if err != nil {
+		makeResponse(ctx, http.StatusInternalServerError, "failed", err.Error(), nil)
+		return
+	}
+	makeResponse(ctx, http.StatusOK, "success", "", gin.H{
+		"rating":      rating,
+		"reviews":     reviews,
+		"page_number": page.PageNumber,
+		"page_size":   page.PageSize,
+	})
+}
+
+func saveReview(ctx *gin.Context) {
+	bookId, err := cast.ToUintE(ctx.Param("book_id"))
+	if err != nil {
+		makeResponse(ctx, http.StatusBadRequest, "failed", "invalid book id", nil)
+		return
+	}
+	userId := currentUser(ctx)
+	if userId == "" {
+		makeResponse(ctx, http.StatusUnauthorized, "failed", "user is required", nil)
+		return
+	}
+	var req reviewRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		makeResponse(ctx, http.StatusBadRequest, "failed", err.Error(), nil)
+		return
+	}
+	review := &model.Review{BookID: bookId, UserID: userId, Rating: req.Rating, Text: req.Text}
+	if err := getManager(ctx).SaveReview(review); err != nil {
+		makeResponse(ctx, reviewErrorCode(err), "failed", err.Error(), nil)
+		return
+	}
+	makeResponse(ctx, http.StatusOK, "success", "", review)
+}
+
+func deleteReview(ctx *gin.Context) {
+	bookId, err := cast.ToUintE(ctx.Param("book_id"))
+	if err != nil {
+		makeResponse(ctx, http.StatusBadRequest, "failed", "invalid book id", nil)
+		return
+	}
+	userId := currentUser(ctx)
+	if userId == "" {
+		makeResponse(ctx, http.StatusUnauthorized, "failed", "user is required", nil)
+		return
+	}
+	if err := getManager(ctx).DeleteReview(bookId, userId); err != nil {
+		makeResponse(ctx, reviewErrorCode(err), "failed", err.Error(), nil)
+		return
+	}
+	makeResponse(ctx, http.StatusOK, "success", "", nil)
+}
+
+func reviewErrorCode(err error) int {
+	switch {
+	case errors.Is(err, model.ErrInvalidRating):
+		return http.StatusBadRequest
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -1,8 +1,176 @@
 package api
 
-import "github.com/gin-gonic/gin"
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/gql"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/ratelimit"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/service"
+)
+
+//RouterOptions NewRouter 的配置
+type RouterOptions struct {
+	//RequireTenant 拒绝没有租户的请求
+	RequireTenant bool
+	//RateLimit 不为空时对 Book 路由限流
+	RateLimit *ratelimit.Config
+	//CacheControl 各个路由的 Cache-Control，为 nil 时使用 DefaultCacheControl
+	CacheControl map[string]string
+	//TrustedProxies 可信代理的IP或CIDR，只采用这些代理转发的 X-Forwarded-For，为空时使用连接的对端地址
+	TrustedProxies []string
+}
+
+//NewRouter 创建注册了所有路由的 gin.Engine，封面存储需要提前通过 SetCoverStore 设置。
+//请求日志以 JSON 格式写入 gin.DefaultWriter，TrustedProxies 格式错误时返回 error
+func NewRouter(opts RouterOptions) (*gin.Engine, error) {
+	r := gin.New()
+	if err := r.SetTrustedProxies(opts.TrustedProxies); err != nil {
+		return nil, err
+	}
+	r.Use(RequestID(), RequestLog(gin.DefaultWriter), Trace(), gin.Recovery())
+	r.GET("/healthz", healthz)
+	cacheControl := opts.CacheControl
+	if cacheControl == nil {
+		cacheControl = DefaultCacheControl
+	}
+	r.Use(Tenant(opts.RequireTenant), ReadYourWrites(), CacheControl(cacheControl))
+	group := r.Group("/books")
+	if opts.RateLimit != nil {
+		group.Use(RateLimit(ratelimit.NewMemoryStore(), *opts.RateLimit))
+	}
+	InitRoute(group)
+	InitWebhookRoute(r.Group("/webhooks"))
+	InitMemberRoute(r.Group("/members"))
+	InitLoanRoute(r.Group("/loans"))
+	InitHoldRoute(r.Group("/holds"))
+	InitSeriesRoute(r.Group("/series"))
+	InitWorkRoute(r.Group("/works"))
+	InitTagRoute(r.Group("/tags"))
+	InitSubjectRoute(r.Group("/subjects"))
+	InitOPDSRoute(r.Group("/opds"))
+	InitExportRoute(r.Group("/export"))
+	InitGraphQLRoute(r.Group("/graphql"))
+	return r, nil
+}
+
+//healthz 数据库可用时返回 200，用于就绪检查
+func healthz(ctx *gin.Context) {
+	m := service.GetManager()
+	if m == nil {
+		makeResponse(ctx, http.StatusServiceUnavailable, "failed", "database is not initialized", nil)
+		return
+	}
+	if err := m.Ping(); err != nil {
+		makeResponse(ctx, http.StatusServiceUnavailable, "failed", err.Error(), nil)
+		return
+	}
+	makeResponse(ctx, http.StatusOK, "success", "", nil)
+}
+
+//bookBasePath Book 路由的前缀，用于生成封面等资源的地址
+var bookBasePath = "/books"
 
 func InitRoute(group *gin.RouterGroup) {
+	bookBasePath = group.BasePath()
 	group.GET("/:book_id", getBook)
+	group.GET("/isbn/:isbn", getBookByISBN)
+	group.GET("/", listBooks)
+	group.GET("/events", streamEvents)
 	group.POST("/", CreateBook)
+	group.PATCH("/:book_id", updateBook)
+	group.PUT("/:book_id/cover", uploadCover)
+	group.GET("/:book_id/cover/:size", getCover)
+	group.GET("/:book_id/translations", listTranslations)
+	group.PUT("/:book_id/translations/:language", saveTranslation)
+	group.DELETE("/:book_id/translations/:language", deleteTranslation)
+	group.GET("/stock/low", listLowStock)
+	group.GET("/:book_id/stock", listStock)
+	group.GET("/:book_id/stock/movements", listStockMovements)
+	group.POST("/:book_id/stock/:warehouse/:operation", changeStock)
+	group.PUT("/:book_id/stock/:warehouse/threshold", setLowStockThreshold)
+	group.PUT("/:book_id/holdings", setHoldings)
+	group.POST("/:book_id/checkout", checkout)
+	group.GET("/:book_id/holds", listHolds)
+	group.POST("/:book_id/holds", placeHold)
+	group.GET("/:book_id/reviews", listReviews)
+	group.PUT("/:book_id/reviews", saveReview)
+	group.DELETE("/:book_id/reviews", deleteReview)
+	group.GET("/:book_id/editions", listEditions)
+	group.GET("/:book_id/series/next", nextInSeries)
+	group.GET("/:book_id/similar", similarBooks)
+	group.GET("/:book_id/tags", listBookTags)
+	group.PUT("/:book_id/tags", setBookTags)
+	group.GET("/:book_id/subjects", listBookSubjects)
+	group.PUT("/:book_id/subjects/:subject_id", assignSubject)
+	group.DELETE("/:book_id/subjects/:subject_id", unassignSubject)
+}
+
+func InitWebhookRoute(group *gin.RouterGroup) {
+	group.POST("/", createWebhook)
+	group.GET("/", listWebhooks)
+	group.GET("/:webhook_id", getWebhook)
+	group.PUT("/:webhook_id", updateWebhook)
+	group.DELETE("/:webhook_id", deleteWebhook)
+	group.GET("/:webhook_id/deliveries", listWebhookDeliveries)
+}
+
+func InitMemberRoute(group *gin.RouterGroup) {
+	group.POST("/", createMember)
+	group.GET("/:member_id", getMember)
+	group.GET("/:member_id/loans", listMemberLoans)
+}
+
+func InitLoanRoute(group *gin.RouterGroup) {
+	group.GET("/overdue", listOverdueLoans)
+	group.POST("/:loan_id/renew", renewLoan)
+	group.POST("/:loan_id/return", returnLoan)
+}
+
+func InitHoldRoute(group *gin.RouterGroup) {
+	group.DELETE("/:hold_id", cancelHold)
+}
+
+func InitSeriesRoute(group *gin.RouterGroup) {
+	group.POST("/", createSeries)
+	group.GET("/:series_id", getSeries)
+	group.DELETE("/:series_id", deleteSeries)
+	group.PUT("/:series_id/books/:book_id", addToSeries)
+	group.DELETE("/:series_id/books/:book_id", removeFromSeries)
+}
+
+func InitWorkRoute(group *gin.RouterGroup) {
+	group.POST("/", createWork)
+	group.GET("/:work_id", getWork)
+	group.DELETE("/:work_id", deleteWork)
+	group.PUT("/:work_id/editions/:book_id", addEdition)
+	group.DELETE("/:work_id/editions/:book_id", removeEdition)
+}
+
+func InitTagRoute(group *gin.RouterGroup) {
+	group.GET("/", listTags)
+}
+
+func InitSubjectRoute(group *gin.RouterGroup) {
+	group.POST("/", createSubject)
+	group.GET("/", listSubjects)
+	group.DELETE("/:subject_id", deleteSubject)
+}
+
+func InitOPDSRoute(group *gin.RouterGroup) {
+	group.GET("", opdsRoot)
+	group.GET("/books", opdsBooks)
+}
+
+func InitExportRoute(group *gin.RouterGroup) {
+	group.GET("/marcxml", exportMARC)
+}
+
+func InitGraphQLRoute(group *gin.RouterGroup) {
+	var err error
+	if executor, err = gql.NewExecutor(); err != nil {
+		panic(err)
+	}
+	group.GET("", graphqlQuery)
+	group.POST("", graphqlQuery)
 }
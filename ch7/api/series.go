@@ -0,0 +1,226 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/cast"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/model"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/service"
+	"gorm.io/gorm"
+)
+
+func createSeries(ctx *gin.Context) {
+	var series model.Series
+	if err := ctx.ShouldBindJSON(&series); err != nil {
+		makeResponse(ctx, http.StatusBadRequest, "failed", err.Error(), nil)
+		return
+	}
+	series.Entries = nil
+	if err := getManager(ctx).CreateSeries(&series); err != nil {
+		makeResponse(ctx, relationErrorCode(err), "failed", err.Error(), nil)
+		return
+	}
+	makeResponse(ctx, http.StatusOK, "success", "", series)
+}
+
+func getSeries(ctx *gin.Context) {
+	seriesId, err := cast.ToUintE(ctx.Param("series_id"))
+	if err != nil {
+		makeResponse(ctx, http.StatusBadRequest, "failed", "invalid series id", nil)
+		return
+	}
+	series, err := getManager(ctx).GetSeries(seriesId)
+	if err != nil {
+		makeResponse(ctx, relationErrorCode(err), "failed", err.Error(), nil)
+		return
+	}
+	makeResponse(ctx, http.StatusOK, "success", "", series)
+}
+
+func deleteSeries(ctx *gin.Context) {
+	seriesId, err := cast.ToUintE(ctx.Param("series_id"))
+	if err != nil {
+		makeResponse(ctx, http.StatusBadRequest, "failed", "invalid series id", nil)
+		return
+	}
+	if err := getManager(ctx).DeleteSeries(seriesId); err != nil {
+		makeResponse(ctx, relationErrorCode(err), "failed", err.Error(), nil)
+		return
+	}
+	makeResponse(ctx, http.StatusOK, "success", "", nil)
+}
+
+func addToSeries(ctx *gin.Context) {
+	seriesId, err := cast.ToUintE(ctx.Param("series_id"))
+	if err != nil {
+		makeResponse(ctx, http.StatusBadRequest, "failed", "invalid series id", nil)
+		return
+	}
+	bookId, err := cast.ToUintE(ctx.Param("book_id"))
+	if err != nil {
+		makeResponse(ctx, http.StatusBadRequest, "failed", "invalid book id", nil)
+		return
+	}
+	var req struct {
+		Position int `json:"position"`
+	}
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		makeResponse(ctx, http.StatusBadRequest, "failed", err.Error(), nil)
+		return
+	}
+	entry, err := getManager(ctx).AddToSeries(seriesId, bookId, req.Position)
+	if err != nil {
+		makeResponse(ctx, relationErrorCode(err), "failed", err.Error(), nil)
+		return
+	}
+	makeResponse(ctx, http.StatusOK, "success", "", entry)
+}
+
+func removeFromSeries(ctx *gin.Context) {
+	seriesId, err := cast.ToUintE(ctx.Param("series_id"))
+	if err != nil {
+		makeResponse(ctx, http.StatusBadRequest, "failed", "invalid series id", nil)
+		return
+	}
+	bookId, err := cast.ToUintE(ctx.Param("book_id"))
+	if err != nil {
+		makeResponse(ctx, http.StatusBadRequest, "failed", "invalid book id", nil)
+		return
+	}
+	if err := getManager(ctx).RemoveFromSeries(seriesId, bookId); err != nil {
+		makeResponse(ctx, relationErrorCode(err), "failed", err.Error(), nil)
+		return
+	}
+	makeResponse(ctx, http.StatusOK, "success", "", nil)
+}
+
+func nextInSeries(ctx *gin.Context) {
+	bookId, err := cast.ToUintE(ctx.Param("book_id"))
+	if err != nil {
+		makeResponse(ctx, http.StatusBadRequest, "failed", "invalid book id", nil)
+		return
+	}
+	entry, err := getManager(ctx).NextInSeries(bookId)
+	if err != nil {
+		makeResponse(ctx, relationErrorCode(err), "failed", err.Error(), nil)
+		return
+	}
+	makeResponse(ctx, http.StatusOK, "success", "", entry)
+}
+
+func createWork(ctx *gin.Context) {
+	var work model.Work
+	if err := ctx.ShouldBindJSON(&work); err != nil {
+		makeResponse(ctx, http.StatusBadRequest, "failed", err.Error(), nil)
+		return
+	}
+	work.Editions = nil
+	if err := getManager(ctx).CreateWork(&work); err != nil {
+		makeResponse(ctx, relationErrorCode(err), "failed", err.Error(), nil)
+		return
+	}
+	makeResponse(ctx, http.StatusOK, "success", "", work)
+}
+
+func getWork(ctx *gin.Context) {
+	workId, err := cast.ToUintE(ctx.Param("work_id"))
+	if err != nil {
+		makeResponse(ctx, http.StatusBadRequest, "failed", "invalid work id", nil)
+		return
+	}
+	work, err := getManager(ctx).GetWork(workId)
+	if err != nil {
+		makeResponse(ctx, relationErrorCode(err), "failed", err.Error(), nil)
+		return
+	}
+	makeResponse(ctx, http.StatusOK, "success", "", work)
+}
+
+func deleteWork(ctx *gin.Context) {
+	workId, err := cast.ToUintE(ctx.Param("work_id"))
+	if err != nil {
+		makeResponse(ctx, http.StatusBadRequest, "failed", "invalid work id", nil)
+		return
+	}
+	if err := getManager(ctx).DeleteWork(workId); err != nil {
+		makeResponse(ctx, relationErrorCode(err), "failed", err.Error(), nil)
+		return
+	}
+	makeResponse(ctx, http.StatusOK, "success", "", nil)
+}
+
+func addEdition(ctx *gin.Context) {
+	workId, err := cast.ToUintE(ctx.Param("work_id"))
+	if err != nil {
+		makeResponse(ctx, http.StatusBadRequest, "failed", "invalid work id", nil)
+		return
+	}
+	bookId, err := cast.ToUintE(ctx.Param("book_id"))
+	if err != nil {
+		makeResponse(ctx, http.StatusBadRequest, "failed", "invalid book id", nil)
+		return
+	}
+	var req struct {
+		Label string `json:"label"`
+	}
+	//label 可以省略
+	if ctx.Request.ContentLength != 0 {
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			makeResponse(ctx, http.StatusBadRequest, "failed", err.Error(), nil)
+			return
+		}
+	}
+	edition, err := getManager(ctx).AddEdition(workId, bookId, req.Label)
+	if err != nil {
+		makeResponse(ctx, relationErrorCode(err), "failed", err.Error(), nil)
+		return
+	}
+	makeResponse(ctx, http.StatusOK, "success", "", edition)
+}
+
+func removeEdition(ctx *gin.Context) {
+	workId, err := cast.ToUintE(ctx.Param("work_id"))
+	if err != nil {
+		makeResponse(ctx, http.StatusBadRequest, "failed", "invalid work id", nil)
+		return
+	}
+	bookId, err := cast.ToUintE(ctx.Param("book_id"))
+	if err != nil {
+		makeResponse(ctx, http.StatusBadRequest, "failed", "invalid book id", nil)
+		return
+	}
+	if err := getManager(ctx).RemoveEdition(workId, bookId); err != nil {
+		makeResponse(ctx, relationErrorCode(err), "failed", err.Error(), nil)
+		return
+	}
+	makeResponse(ctx, http.StatusOK, "success", "", nil)
+}
+
+func listEditions(ctx *gin.Context) {
+	bookId, err := cast.ToUintE(ctx.Param("book_id"))
+	if err != nil {
+		makeResponse(ctx, http.StatusBadRequest, "failed", "invalid book id", nil)
+		return
+	}
+	editions, err := getManager(ctx).ListEditions(bookId)
+	if err != nil {
+		makeResponse(ctx, relationErrorCode(err), "failed", err.Error(), nil)
+		return
+	}
+	makeResponse(ctx, http.StatusOK, "success", "", editions)
+}
+
+func relationErrorCode(err error) int {
+	switch {
+	case errors.Is(err, model.ErrNameRequired):
+		return http.StatusBadRequest
+	case errors.Is(err, service.ErrPositionTaken):
+		return http.StatusConflict
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,157 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/cast"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/model"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/service"
+	"gorm.io/gorm"
+)
+
+func listBookTags(ctx *gin.Context) {
+	bookId, err := cast.ToUintE(ctx.Param("book_id"))
+	if err != nil {
+		makeResponse(ctx, http.StatusBadRequest, "failed", "invalid book id", nil)
+		return
+	}
+	tags, err := getManager(ctx).ListBookTags(bookId)
+	if err != nil {
+		makeResponse(ctx, classificationErrorCode(err), "failed", err.Error(), nil)
+		return
+	}
+	makeResponse(ctx, http.StatusOK, "success", "", tags)
+}
+
+func setBookTags(ctx *gin.Context) {
+	bookId, err := cast.ToUintE(ctx.Param("book_id"))
+	if err != nil {
+		makeResponse(ctx, http.StatusBadRequest, "failed", "invalid book id", nil)
+		return
+	}
+	var req struct {
+		Tags []string `json:"tags"`
+	}
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		makeResponse(ctx, http.StatusBadRequest, "failed", err.Error(), nil)
+		return
+	}
+	tags, err := getManager(ctx).SetBookTags(bookId, req.Tags)
+	if err != nil {
+		makeResponse(ctx, classificationErrorCode(err), "failed", err.Error(), nil)
+		return
+	}
+	makeResponse(ctx, http.StatusOK, "success", "", tags)
+}
+
+//listTags 返回所有标签以及使用次数
+func listTags(ctx *gin.Context) {
+	tags, err := getManager(ctx).TagFacets(model.BookQuery{})
+	if err != nil {
+		makeResponse(ctx, classificationErrorCode(err), "failed", err.Error(), nil)
+		return
+	}
+	makeResponse(ctx, http.StatusOK, "success", "", tags)
+}
+
+func listBookSubjects(ctx *gin.Context) {
+	bookId, err := cast.ToUintE(ctx.Param("book_id"))
+	if err != nil {
+		makeResponse(ctx, http.StatusBadRequest, "failed", "invalid book id", nil)
+		return
+	}
+	subjects, err := getManager(ctx).ListBookSubjects(bookId)
+	if err != nil {
+		makeResponse(ctx, classificationErrorCode(err), "failed", err.Error(), nil)
+		return
+	}
+	makeResponse(ctx, http.StatusOK, "success", "", subjects)
+}
+
+func assignSubject(ctx *gin.Context) {
+	bookId, err := cast.ToUintE(ctx.Param("book_id"))
+	if err != nil {
+		makeResponse(ctx, http.StatusBadRequest, "failed", "invalid book id", nil)
+		return
+	}
+	subjectId, err := cast.ToUintE(ctx.Param("subject_id"))
+	if err != nil {
+		makeResponse(ctx, http.StatusBadRequest, "failed", "invalid subject id", nil)
+		return
+	}
+	if err := getManager(ctx).AssignSubject(bookId, subjectId); err != nil {
+		makeResponse(ctx, classificationErrorCode(err), "failed", err.Error(), nil)
+		return
+	}
+	makeResponse(ctx, http.StatusOK, "success", "", nil)
+}
+
+func unassignSubject(ctx *gin.Context) {
+	bookId, err := cast.ToUintE(ctx.Param("book_id"))
+	if err != nil {
+		makeResponse(ctx, http.StatusBadRequest, "failed", "invalid book id", nil)
+		return
+	}
+	subjectId, err := cast.ToUintE(ctx.Param("subject_id"))
+	if err != nil {
+		makeResponse(ctx, http.StatusBadRequest, "failed", "invalid subject id", nil)
+		return
+	}
+	if err := getManager(ctx).UnassignSubject(bookId, subjectId); err != nil {
+		makeResponse(ctx, classificationErrorCode(err), "failed", err.Error(), nil)
+		return
+	}
+	makeResponse(ctx, http.StatusOK, "success", "", nil)
+}
+
+func createSubject(ctx *gin.Context) {
+	var subject model.Subject
+	if err := ctx.ShouldBindJSON(&subject); err != nil {
+		makeResponse(ctx, http.StatusBadRequest, "failed", err.Error(), nil)
+		return
+	}
+	//路径由服务端生成
+	subject.Path = ""
+	if err := getManager(ctx).CreateSubject(&subject); err != nil {
+		makeResponse(ctx, classificationErrorCode(err), "failed", err.Error(), nil)
+		return
+	}
+	makeResponse(ctx, http.StatusOK, "success", "", subject)
+}
+
+func listSubjects(ctx *gin.Context) {
+	subjects, err := getManager(ctx).ListSubjects()
+	if err != nil {
+		makeResponse(ctx, classificationErrorCode(err), "failed", err.Error(), nil)
+		return
+	}
+	makeResponse(ctx, http.StatusOK, "success", "", subjects)
+}
+
+func deleteSubject(ctx *gin.Context) {
+	subjectId, err := cast.ToUintE(ctx.Param("subject_id"))
+	if err != nil {
+		makeResponse(ctx, http.StatusBadRequest, "failed", "invalid subject id", nil)
+		return
+	}
+	if err := getManager(ctx).DeleteSubject(subjectId); err != nil {
+		makeResponse(ctx, classificationErrorCode(err), "failed", err.Error(), nil)
+		return
+	}
+	makeResponse(ctx, http.StatusOK, "success", "", nil)
+}
+
+func classificationErrorCode(err error) int {
+	switch {
+	case errors.Is(err, model.ErrInvalidTag), errors.Is(err, model.ErrNameRequired):
+		return http.StatusBadRequest
+	case errors.Is(err, service.ErrSubjectHasChildren):
+		return http.StatusConflict
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
+	}
+}
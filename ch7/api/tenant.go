@@ -0,0 +1,80 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/service"
+)
+
+const (
+	TenantHeader   = "X-Tenant-ID" //TenantHeader 通过请求头指定租户
+	TenantClaimKey = "tenant_id"   //TenantClaimKey 认证中间件解析出的租户，保存在 gin.Context 中
+	managerKey     = "api:manager" //managerKey 当前请求使用的 Manager
+)
+
+var tenantIdPattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+//Tenant 解析请求所属的租户，并为后续的 handler 准备只能访问该租户数据的 Manager。
+//认证中间件解析出的租户优先于请求头，两者不一致时拒绝请求；
+//required 为 false 时，没有租户的请求使用不区分租户的 Manager
+func Tenant(required bool) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		tenantId := ctx.GetHeader(TenantHeader)
+		if claim, ok := ctx.Get(TenantClaimKey); ok {
+			claimed, _ := claim.(string)
+			if tenantId != "" && tenantId != claimed {
+				makeResponse(ctx, http.StatusForbidden, "failed", "tenant does not match credentials", nil)
+				ctx.Abort()
+				return
+			}
+			tenantId = claimed
+		}
+
+		if tenantId == "" {
+			if required {
+				makeResponse(ctx, http.StatusBadRequest, "failed", "tenant is required", nil)
+				ctx.Abort()
+				return
+			}
+			ctx.Next()
+			return
+		}
+		if !tenantIdPattern.MatchString(tenantId) {
+			makeResponse(ctx, http.StatusBadRequest, "failed", "invalid tenant id", nil)
+			ctx.Abort()
+			return
+		}
+		if _, err := service.GetManager().GetTenant(tenantId); err != nil {
+			code := http.StatusInternalServerError
+			if errors.Is(err, service.ErrUnknownTenant) {
+				code = http.StatusForbidden
+			}
+			makeResponse(ctx, code, "failed", err.Error(), nil)
+			ctx.Abort()
+			return
+		}
+		ctx.Set(managerKey, service.GetManager().ForTenant(tenantId))
+		ctx.Next()
+	}
+}
+
+//getManager 返回当前请求使用的 Manager，handler 都应该通过它访问数据。
+//Manager 使用请求的 Context，SQL 会记录在请求的调用链中
+func getManager(ctx *gin.Context) *service.Manager {
+	m := requestManager(ctx)
+	if m == nil {
+		return nil
+	}
+	return m.WithContext(ctx.Request.Context())
+}
+
+//requestManager 返回中间件为请求准备的 Manager
+func requestManager(ctx *gin.Context) *service.Manager {
+	if m, ok := ctx.Get(managerKey); ok {
+		return m.(*service.Manager)
+	}
+	return service.GetManager()
+}
@@ -0,0 +1,55 @@
+package api_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/gin-gonic/gin"
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/api"
+)
+
+var _ = ginkgo.Describe("tenant middleware", func() {
+	newRouter := func(required bool, claim string) *gin.Engine {
+		router := gin.New()
+		if claim != "" {
+			router.Use(func(ctx *gin.Context) {
+				ctx.Set(api.TenantClaimKey, claim)
+			})
+		}
+		router.Use(api.Tenant(required))
+		router.GET("/books/", func(ctx *gin.Context) { ctx.Status(http.StatusOK) })
+		return router
+	}
+	request := func(router *gin.Engine, tenant string) int {
+		req := httptest.NewRequest(http.MethodGet, "/books/", nil)
+		if tenant != "" {
+			req.Header.Set(api.TenantHeader, tenant)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	ginkgo.Context("tenant is required", func() {
+		ginkgo.It("reject requests without tenant", func() {
+			gomega.Expect(request(newRouter(true, ""), "")).To(gomega.Equal(http.StatusBadRequest))
+		})
+	})
+	ginkgo.Context("tenant is optional", func() {
+		ginkgo.It("accept requests without tenant", func() {
+			gomega.Expect(request(newRouter(false, ""), "")).To(gomega.Equal(http.StatusOK))
+		})
+	})
+	ginkgo.Context("tenant id is invalid", func() {
+		ginkgo.It("reject the request", func() {
+			gomega.Expect(request(newRouter(false, ""), "a b/c")).To(gomega.Equal(http.StatusBadRequest))
+		})
+	})
+	ginkgo.Context("header does not match credentials", func() {
+		ginkgo.It("reject the request", func() {
+			gomega.Expect(request(newRouter(true, "acme"), "other")).To(gomega.Equal(http.StatusForbidden))
+		})
+	})
+})
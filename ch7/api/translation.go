@@ -0,0 +1,72 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/cast"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/model"
+)
+
+func listTranslations(ctx *gin.Context) {
+	bookId, err := cast.ToUintE(ctx.Param("book_id"))
+	if err != nil {
+		makeResponse(ctx, http.StatusBadRequest, "failed", "invalid book id", nil)
+		return
+	}
+	if _, err := getManager(ctx).GetBook(bookId); err != nil {
+		makeResponse(ctx, http.StatusNotFound, "failed", err.Error(), nil)
+		return
+	}
+	translations, err := getManager(ctx).ListTranslations(bookId)
+	if err != nil {
+		makeResponse(ctx, http.StatusInternalServerError, "failed", err.Error(), nil)
+		return
+	}
+	makeResponse(ctx, http.StatusOK, "success", "", translations)
+}
+
+func saveTranslation(ctx *gin.Context) {
+	bookId, err := cast.ToUintE(ctx.Param("book_id"))
+	if err != nil {
+		makeResponse(ctx, http.StatusBadRequest, "failed", "invalid book id", nil)
+		return
+	}
+	var translation model.BookTranslation
+	if err := ctx.ShouldBindJSON(&translation); err != nil {
+		makeResponse(ctx, http.StatusBadRequest, "failed", err.Error(), nil)
+		return
+	}
+	if translation.Title == "" {
+		makeResponse(ctx, http.StatusBadRequest, "failed", "title is required", nil)
+		return
+	}
+	translation.BookID = bookId
+	translation.Language = ctx.Param("language")
+	if _, err := model.CanonicalLanguage(translation.Language); err != nil {
+		makeResponse(ctx, http.StatusBadRequest, "failed", "invalid language tag", nil)
+		return
+	}
+	if _, err := getManager(ctx).GetBook(bookId); err != nil {
+		makeResponse(ctx, http.StatusNotFound, "failed", err.Error(), nil)
+		return
+	}
+	if err := getManager(ctx).SaveTranslation(&translation); err != nil {
+		makeResponse(ctx, http.StatusInternalServerError, "failed", err.Error(), nil)
+		return
+	}
+	makeResponse(ctx, http.StatusOK, "success", "", translation)
+}
+
+func deleteTranslation(ctx *gin.Context) {
+	bookId, err := cast.ToUintE(ctx.Param("book_id"))
+	if err != nil {
+		makeResponse(ctx, http.StatusBadRequest, "failed", "invalid book id", nil)
+		return
+	}
+	if err := getManager(ctx).DeleteTranslation(bookId, ctx.Param("language")); err != nil {
+		makeResponse(ctx, http.StatusBadRequest, "failed", err.Error(), nil)
+		return
+	}
+	makeResponse(ctx, http.StatusOK, "success", "", nil)
+}
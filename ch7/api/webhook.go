@@ -0,0 +1,134 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/cast"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/model"
+)
+
+//webhookRequest 创建与更新订阅的请求，Active 为空时默认启用
+type webhookRequest struct {
+	URL      string           `json:"url"`
+	Secret   string           `json:"secret"`
+	Events   model.EventTypes `json:"events"`
+	Catalogs model.Catalogs   `json:"catalogs"`
+	Active   *bool            `json:"active"`
+}
+
+func (r webhookRequest) subscription() *model.WebhookSubscription {
+	active := true
+	if r.Active != nil {
+		active = *r.Active
+	}
+	return &model.WebhookSubscription{
+		URL:      r.URL,
+		Secret:   r.Secret,
+		Events:   r.Events,
+		Catalogs: r.Catalogs,
+		Active:   active,
+	}
+}
+
+func createWebhook(ctx *gin.Context) {
+	var req webhookRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		makeResponse(ctx, http.StatusBadRequest, "failed", err.Error(), nil)
+		return
+	}
+	subscription := req.subscription()
+	if err := subscription.Validate(); err != nil {
+		makeResponse(ctx, http.StatusBadRequest, "failed", err.Error(), nil)
+		return
+	}
+	if err := getManager(ctx).CreateWebhook(subscription); err != nil {
+		makeResponse(ctx, http.StatusInternalServerError, "failed", err.Error(), nil)
+		return
+	}
+	//只有创建时返回 Secret
+	makeResponse(ctx, http.StatusOK, "success", "", subscription)
+}
+
+func listWebhooks(ctx *gin.Context) {
+	subscriptions, err := getManager(ctx).ListWebhooks()
+	if err != nil {
+		makeResponse(ctx, http.StatusInternalServerError, "failed", err.Error(), nil)
+		return
+	}
+	for _, subscription := range subscriptions {
+		subscription.Secret = ""
+	}
+	makeResponse(ctx, http.StatusOK, "success", "", subscriptions)
+}
+
+func getWebhook(ctx *gin.Context) {
+	subscriptionId, err := cast.ToUintE(ctx.Param("webhook_id"))
+	if err != nil {
+		makeResponse(ctx, http.StatusBadRequest, "failed", "invalid webhook id", nil)
+		return
+	}
+	subscription, err := getManager(ctx).GetWebhook(subscriptionId)
+	if err != nil {
+		makeResponse(ctx, http.StatusNotFound, "failed", err.Error(), nil)
+		return
+	}
+	subscription.Secret = ""
+	makeResponse(ctx, http.StatusOK, "success", "", subscription)
+}
+
+func updateWebhook(ctx *gin.Context) {
+	subscriptionId, err := cast.ToUintE(ctx.Param("webhook_id"))
+	if err != nil {
+		makeResponse(ctx, http.StatusBadRequest, "failed", "invalid webhook id", nil)
+		return
+	}
+	var req webhookRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		makeResponse(ctx, http.StatusBadRequest, "failed", err.Error(), nil)
+		return
+	}
+	subscription := req.subscription()
+	subscription.ID = subscriptionId
+	if err := subscription.Validate(); err != nil {
+		makeResponse(ctx, http.StatusBadRequest, "failed", err.Error(), nil)
+		return
+	}
+	if err := getManager(ctx).UpdateWebhook(subscription); err != nil {
+		makeResponse(ctx, http.StatusInternalServerError, "failed", err.Error(), nil)
+		return
+	}
+	getWebhook(ctx)
+}
+
+func deleteWebhook(ctx *gin.Context) {
+	subscriptionId, err := cast.ToUintE(ctx.Param("webhook_id"))
+	if err != nil {
+		makeResponse(ctx, http.StatusBadRequest, "failed", "invalid webhook id", nil)
+		return
+	}
+	if err := getManager(ctx).DeleteWebhook(subscriptionId); err != nil {
+		makeResponse(ctx, http.StatusInternalServerError, "failed", err.Error(), nil)
+		return
+	}
+	makeResponse(ctx, http.StatusOK, "success", "", nil)
+}
+
+func listWebhookDeliveries(ctx *gin.Context) {
+	subscriptionId, err := cast.ToUintE(ctx.Param("webhook_id"))
+	if err != nil {
+		makeResponse(ctx, http.StatusBadRequest, "failed", "invalid webhook id", nil)
+		return
+	}
+	page, err := parsePageOptions(ctx)
+	if err != nil {
+		makeResponse(ctx, http.StatusBadRequest, "failed", err.Error(), nil)
+		return
+	}
+	deliveries, err := getManager(ctx).ListWebhookDeliveries(subscriptionId, page.PageNumber, page.PageSize)
+	if err != nil {
+		makeResponse(ctx, http.StatusInternalServerError, "failed", err.Error(), nil)
+		return
+	}
+	makeResponse(ctx, http.StatusOK, "success", "", deliveries)
+}
@@ -0,0 +1,49 @@
+package blobstore_test
+
+import (
+	"context"
+	"io"
+	"strings"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/blobstore"
+)
+
+var _ = ginkgo.Describe("local store", func() {
+	var store *blobstore.LocalStore
+	ctx := context.Background()
+
+	ginkgo.BeforeEach(func() {
+		var err error
+		store, err = blobstore.NewLocalStore(ginkgo.GinkgoT().TempDir())
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+	})
+
+	ginkgo.It("read what was written", func() {
+		gomega.Expect(store.Put(ctx, "covers/1/small.jpg", strings.NewReader("old"))).To(gomega.Succeed())
+		gomega.Expect(store.Put(ctx, "covers/1/small.jpg", strings.NewReader("new"))).To(gomega.Succeed())
+		reader, err := store.Get(ctx, "covers/1/small.jpg")
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		defer func() {
+			_ = reader.Close()
+		}()
+		content, err := io.ReadAll(reader)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(string(content)).To(gomega.Equal("new"))
+	})
+
+	ginkgo.It("return ErrNotFound after delete", func() {
+		gomega.Expect(store.Put(ctx, "a.jpg", strings.NewReader("data"))).To(gomega.Succeed())
+		gomega.Expect(store.Delete(ctx, "a.jpg")).To(gomega.Succeed())
+		gomega.Expect(store.Delete(ctx, "a.jpg")).To(gomega.Succeed())
+		_, err := store.Get(ctx, "a.jpg")
+		gomega.Expect(err).To(gomega.MatchError(blobstore.ErrNotFound))
+	})
+
+	ginkgo.It("reject keys outside root", func() {
+		gomega.Expect(store.Put(ctx, "../escape", strings.NewReader("data"))).NotTo(gomega.Succeed())
+		_, err := store.Get(ctx, "")
+		gomega.Expect(err).To(gomega.HaveOccurred())
+	})
+})
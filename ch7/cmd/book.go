@@ -0,0 +1,282 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cast"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/model"
+)
+
+var bookCommands []command
+
+func init() {
+	bookCommands = []command{
+		{"add", "add a book", addBook},
+		{"get", "get a book by id", getBook},
+		{"list", "list books page by page", listBooks},
+		{"update", "update fields of a book", updateBook},
+		{"delete", "delete a book by id", deleteBook},
+	}
+}
+
+//bookCommand 分发 book 的子命令
+func bookCommand(args []string) int {
+	if len(args) > 0 {
+		for _, cmd := range bookCommands {
+			if cmd.name == args[0] {
+				return cmd.run(args[1:])
+			}
+		}
+		fmt.Fprintf(os.Stderr, "unknown book command %q\n", args[0])
+	}
+	fmt.Fprintln(os.Stderr, "usage: cmd book <command> [flags]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "commands:")
+	for _, cmd := range bookCommands {
+		fmt.Fprintf(os.Stderr, "  %-8s %s\n", cmd.name, cmd.summary)
+	}
+	return exitUsage
+}
+
+//bookFlags add 与 update 共用的 Book 字段参数
+type bookFlags struct {
+	title  *string
+	author *string
+	pages  *int
+	weight *int
+	isbn   *string
+}
+
+func addBookFlags(fs *flag.FlagSet) *bookFlags {
+	return &bookFlags{
+		title:  fs.String("title", "", "title of the book"),
+		author: fs.String("author", "", "author of the book"),
+		pages:  fs.Int("pages", 0, "number of pages"),
+		weight: fs.Int("weight", 0, "weight in grams"),
+		isbn:   fs.String("isbn", "", "isbn10 or isbn13"),
+	}
+}
+
+//apply 只修改命令行中指定的字段
+func (f *bookFlags) apply(fs *flag.FlagSet, book *model.Book) {
+	fs.Visit(func(fl *flag.Flag) {
+		switch fl.Name {
+		case "title":
+			book.Title = *f.title
+		case "author":
+			book.Author = *f.author
+		case "pages":
+			book.Pages = int32(*f.pages)
+		case "weight":
+			book.Weight = int32(*f.weight)
+		case "isbn":
+			//NormalizeISBN 会将 ISBN-10 转换为 ISBN-13 并补全 ISBN10
+			book.ISBN10, book.ISBN13 = "", model.ISBN(*f.isbn)
+		}
+	})
+}
+
+//parseWithID 解析参数与 Book ID，ID 可以放在 flag 之前或之后
+func parseWithID(fs *flag.FlagSet, args []string) (uint, error) {
+	var id string
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		id, args = args[0], args[1:]
+	}
+	if err := fs.Parse(args); err != nil {
+		return 0, err
+	}
+	if id == "" && fs.NArg() > 0 {
+		id = fs.Arg(0)
+	}
+	if id == "" {
+		return 0, errors.New("book id is required")
+	}
+	bookId, err := cast.ToUintE(id)
+	if err != nil || bookId == 0 {
+		return 0, fmt.Errorf("invalid book id %q", id)
+	}
+	return bookId, nil
+}
+
+func addBook(args []string) int {
+	fs := newFlagSet("book add")
+	db := addDBFlags(fs)
+	fields := addBookFlags(fs)
+	output := addOutputFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	format, err := parseOutputFormat(*output)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	var book model.Book
+	fields.apply(fs, &book)
+	if !book.IsValid() {
+		fmt.Fprintln(os.Stderr, "author is required")
+		return exitUsage
+	}
+	manager, err := db.manager()
+	if err != nil {
+		return fail(err)
+	}
+	if err := manager.AddBook(&book); err != nil {
+		return fail(err)
+	}
+	if err := writeBook(os.Stdout, format, &book); err != nil {
+		return fail(err)
+	}
+	return exitOK
+}
+
+func getBook(args []string) int {
+	fs := newFlagSet("book get")
+	db := addDBFlags(fs)
+	output := addOutputFlag(fs)
+	bookId, err := parseWithID(fs, args)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	format, err := parseOutputFormat(*output)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	manager, err := db.manager()
+	if err != nil {
+		return fail(err)
+	}
+	book, err := manager.GetBook(bookId)
+	if err != nil {
+		return fail(err)
+	}
+	if err := writeBook(os.Stdout, format, book); err != nil {
+		return fail(err)
+	}
+	return exitOK
+}
+
+func listBooks(args []string) int {
+	fs := newFlagSet("book list")
+	db := addDBFlags(fs)
+	output := addOutputFlag(fs)
+	pageNumber := fs.Int("page", 0, "page number, starts from 0")
+	pageSize := fs.Int("size", 20, "page size")
+	sort := fs.String("sort", "", "sort by: rating or reviews, by id if empty")
+	tag := fs.String("tag", "", "only list books with this tag")
+	subject := fs.Uint("subject", 0, "only list books in this subject or its children")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	format, err := parseOutputFormat(*output)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	if err := validatePage(*pageNumber, *pageSize); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	bookSort, err := model.ParseBookSort(*sort)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	manager, err := db.manager()
+	if err != nil {
+		return fail(err)
+	}
+	books, err := manager.ListBooks(model.BookQuery{
+		PageOptions: model.PageOptions{PageNumber: *pageNumber, PageSize: *pageSize},
+		Sort:        bookSort,
+		Tag:         *tag,
+		SubjectID:   *subject,
+	})
+	if err != nil {
+		return fail(err)
+	}
+	if err := writeBooks(os.Stdout, format, books); err != nil {
+		return fail(err)
+	}
+	return exitOK
+}
+
+//maxPageSize 每页最多的 Book 数量，与 API 的限制一致
+const maxPageSize = 100
+
+//validatePage page 不能小于 0，size 需要在 [1, maxPageSize] 范围内
+func validatePage(page, size int) error {
+	if page < 0 {
+		return fmt.Errorf("invalid page %d, must not be negative", page)
+	}
+	if size < 1 || size > maxPageSize {
+		return fmt.Errorf("invalid size %d, must be between 1 and %d", size, maxPageSize)
+	}
+	return nil
+}
+
+func updateBook(args []string) int {
+	fs := newFlagSet("book update")
+	db := addDBFlags(fs)
+	fields := addBookFlags(fs)
+	output := addOutputFlag(fs)
+	bookId, err := parseWithID(fs, args)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	format, err := parseOutputFormat(*output)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	manager, err := db.manager()
+	if err != nil {
+		return fail(err)
+	}
+	//UpdateBook 不区分 Book 不存在与没有修改，先查询以便返回 exitNotFound
+	book, err := manager.GetBook(bookId)
+	if err != nil {
+		return fail(err)
+	}
+	fields.apply(fs, book)
+	if err := manager.UpdateBook(book); err != nil {
+		return fail(err)
+	}
+	if book, err = manager.GetBook(bookId); err != nil {
+		return fail(err)
+	}
+	if err := writeBook(os.Stdout, format, book); err != nil {
+		return fail(err)
+	}
+	return exitOK
+}
+
+func deleteBook(args []string) int {
+	fs := newFlagSet("book delete")
+	db := addDBFlags(fs)
+	bookId, err := parseWithID(fs, args)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	manager, err := db.manager()
+	if err != nil {
+		return fail(err)
+	}
+	//DeleteBook 删除不存在的 Book 不返回错误，脚本需要区分时先查询
+	if _, err := manager.GetBook(bookId); err != nil {
+		return fail(err)
+	}
+	if err := manager.DeleteBook(bookId); err != nil {
+		return fail(err)
+	}
+	fmt.Fprintf(os.Stderr, "deleted book %d\n", bookId)
+	return exitOK
+}
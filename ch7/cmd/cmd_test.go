@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"io"
+	"strings"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/model"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/seed"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/service"
+	"gorm.io/gorm"
+)
+
+var _ = ginkgo.Describe("admin commands", func() {
+	books := []*model.Book{
+		{Model: gorm.Model{ID: 1}, Title: "Dune", Author: "Frank Herbert", Pages: 412, Weight: 500, ISBN13: "9780441172719"},
+		{Model: gorm.Model{ID: 2}, Title: "Flowers", Author: "Daniel Keyes", Pages: 311},
+	}
+
+	ginkgo.Describe("write books", func() {
+		ginkgo.It("align columns in table", func() {
+			var buf bytes.Buffer
+			gomega.Expect(writeBooks(&buf, formatTable, books)).To(gomega.Succeed())
+			gomega.Expect(buf.String()).To(gomega.Equal(
+				"ID  TITLE    AUTHOR         PAGES  WEIGHT  ISBN13\n" +
+					"1   Dune     Frank Herbert  412    500     9780441172719\n" +
+					"2   Flowers  Daniel Keyes   311    0       \n"))
+		})
+		ginkgo.It("use json field names in yaml", func() {
+			var buf bytes.Buffer
+			gomega.Expect(writeBook(&buf, formatYAML, books[0])).To(gomega.Succeed())
+			gomega.Expect(buf.String()).To(gomega.ContainSubstring("isbn13: \"9780441172719\"\n"))
+			gomega.Expect(buf.String()).To(gomega.ContainSubstring("pages: 412\n"))
+			gomega.Expect(buf.String()).To(gomega.ContainSubstring("ID: 1\n"))
+		})
+		ginkgo.It("write empty json array without books", func() {
+			var buf bytes.Buffer
+			gomega.Expect(writeBooks(&buf, formatJSON, nil)).To(gomega.Succeed())
+			gomega.Expect(buf.String()).To(gomega.Equal("[]\n"))
+		})
+		ginkgo.It("reject unknown output format", func() {
+			_, err := parseOutputFormat("xml")
+			gomega.Expect(err).To(gomega.HaveOccurred())
+		})
+	})
+
+	ginkgo.Describe("parse book id", func() {
+		ginkgo.It("accept id before or after flags", func() {
+			for _, args := range [][]string{{"7", "-o", "json"}, {"-o", "json", "7"}} {
+				fs := flag.NewFlagSet("test", flag.ContinueOnError)
+				output := addOutputFlag(fs)
+				bookId, err := parseWithID(fs, args)
+				gomega.Expect(err).NotTo(gomega.HaveOccurred())
+				gomega.Expect(bookId).To(gomega.Equal(uint(7)))
+				gomega.Expect(*output).To(gomega.Equal("json"))
+			}
+		})
+		ginkgo.It("reject missing or invalid id", func() {
+			for _, args := range [][]string{{}, {"abc"}, {"0"}} {
+				_, err := parseWithID(flag.NewFlagSet("test", flag.ContinueOnError), args)
+				gomega.Expect(err).To(gomega.HaveOccurred())
+			}
+		})
+	})
+
+	ginkgo.Describe("update book fields", func() {
+		ginkgo.It("only change flags given on command line", func() {
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			fields := addBookFlags(fs)
+			gomega.Expect(fs.Parse([]string{"-pages", "420", "-isbn", "0-441-17271-7"})).To(gomega.Succeed())
+			book := *books[0]
+			fields.apply(fs, &book)
+			gomega.Expect(book.Title).To(gomega.Equal("Dune"))
+			gomega.Expect(book.Pages).To(gomega.Equal(int32(420)))
+			gomega.Expect(book.ISBN13).To(gomega.Equal(model.ISBN("0-441-17271-7")))
+			gomega.Expect(book.ISBN10).To(gomega.BeEmpty())
+		})
+	})
+
+	ginkgo.Describe("read books to import", func() {
+		readAll := func(read bookReader) ([]*model.Book, error) {
+			var result []*model.Book
+			for {
+				book, err := read()
+				if errors.Is(err, io.EOF) {
+					return result, nil
+				}
+				if err != nil {
+					return result, err
+				}
+				result = append(result, book)
+			}
+		}
+		ginkgo.It("read csv columns by name", func() {
+			read, err := newBookReader(formatCSV, strings.NewReader("Author,title,pages,extra\nFrank Herbert,Dune,412,x\n"))
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			result, err := readAll(read)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(result).To(gomega.Equal([]*model.Book{{Title: "Dune", Author: "Frank Herbert", Pages: 412}}))
+		})
+		ginkgo.It("report invalid numbers in csv", func() {
+			read, err := newBookReader(formatCSV, strings.NewReader("title,pages\nDune,many\n"))
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			_, err = readAll(read)
+			gomega.Expect(err).To(gomega.MatchError(`invalid pages "many"`))
+		})
+		ginkgo.It("drop ids of exported ndjson", func() {
+			var buf bytes.Buffer
+			write, done, err := newBookWriter(formatNDJSON, &buf)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			for _, book := range books {
+				gomega.Expect(write(book)).To(gomega.Succeed())
+			}
+			gomega.Expect(done()).To(gomega.Succeed())
+
+			read, err := newBookReader(formatNDJSON, strings.NewReader(buf.String()+"\n"))
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			result, err := readAll(read)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(result).To(gomega.HaveLen(2))
+			gomega.Expect(result[0].ID).To(gomega.BeZero())
+			gomega.Expect(result[0].ISBN13).To(gomega.Equal(books[0].ISBN13))
+		})
+		ginkgo.It("return conflict when only duplicates failed", func() {
+			input := "title,author\nDune,Frank Herbert\nEmma,Jane Austen\nFlowers,Daniel Keyes\n"
+			read, err := newBookReader(formatCSV, strings.NewReader(input))
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			store := &fakeImporter{failures: map[string]error{"Emma": service.ErrDuplicateISBN}}
+			gomega.Expect(importFrom(store, read, true, io.Discard)).To(gomega.Equal(exitConflict))
+			gomega.Expect(store.titles).To(gomega.Equal([]string{"Dune", "Flowers"}))
+
+			read, err = newBookReader(formatCSV, strings.NewReader(input))
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			store = &fakeImporter{failures: map[string]error{"Dune": service.ErrDuplicateISBN, "Flowers": errors.New("boom")}}
+			gomega.Expect(importFrom(store, read, true, io.Discard)).To(gomega.Equal(exitFailure))
+		})
+	})
+
+	ginkgo.Describe("serve flags", func() {
+		ginkgo.It("override cache control of routes", func() {
+			policies, err := parseCacheControl([]string{
+				"GET /books/:book_id=public, max-age=60",
+				"GET /books/=",
+				"GET /opds/books = public, max-age=300",
+			})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(policies).To(gomega.Equal(map[string]string{
+				"GET /books/:book_id": "public, max-age=60",
+				"GET /opds/books":     "public, max-age=300",
+			}))
+		})
+		ginkgo.It("reject cache control without route", func() {
+			_, err := parseCacheControl([]string{"public, max-age=60"})
+			gomega.Expect(err).To(gomega.HaveOccurred())
+		})
+		ginkgo.It("fail when the database is not available", func() {
+			gomega.Expect(run([]string{"serve", "-dsn", "nope"})).To(gomega.Equal(exitFailure))
+		})
+	})
+
+	ginkgo.Describe("seed", func() {
+		ginkgo.It("insert books in batches & stop at the first error", func() {
+			store := &fakeSeeder{failAt: -1}
+			var progress bytes.Buffer
+			added, err := seedBooks(store, seed.NewGenerator(1), 2500, 1000, &progress)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(added).To(gomega.Equal(2500))
+			gomega.Expect(store.batches).To(gomega.Equal([]int{1000, 1000, 500}))
+			gomega.Expect(progress.String()).To(gomega.Equal("seeded 1000/2500 books\nseeded 2000/2500 books\n"))
+
+			store = &fakeSeeder{failAt: 1}
+			added, err = seedBooks(store, seed.NewGenerator(1), 2500, 1000, io.Discard)
+			gomega.Expect(err).To(gomega.MatchError(service.ErrDuplicateISBN))
+			gomega.Expect(added).To(gomega.Equal(1000))
+		})
+		ginkgo.It("anonymize every book of a dump", func() {
+			read, err := newBookReader(formatCSV, strings.NewReader("title,author,pages,isbn13\n"+
+				"Dune,Frank Herbert,412,9780441172719\n"+
+				"Children of Dune,Frank Herbert,444,\n"))
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			var anonymized []*model.Book
+			n, err := anonymizeBooks(read, func(book *model.Book) error {
+				anonymized = append(anonymized, book)
+				return nil
+			}, seed.NewAnonymizer(1))
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(n).To(gomega.Equal(2))
+			gomega.Expect(anonymized[0].Author).To(gomega.Equal(anonymized[1].Author))
+			gomega.Expect(anonymized[0].Author).NotTo(gomega.Equal("Frank Herbert"))
+			gomega.Expect(anonymized[1].Pages).To(gomega.Equal(int32(444)))
+		})
+		ginkgo.It("reject invalid batch size", func() {
+			gomega.Expect(run([]string{"seed", "-batch", "0"})).To(gomega.Equal(exitUsage))
+			gomega.Expect(run([]string{"seed", "-anonymize", "-format", "marcxml"})).To(gomega.Equal(exitUsage))
+		})
+	})
+
+	ginkgo.Describe("exit codes", func() {
+		ginkgo.It("map errors for scripts", func() {
+			gomega.Expect(exitCode(nil)).To(gomega.Equal(exitOK))
+			gomega.Expect(exitCode(gorm.ErrRecordNotFound)).To(gomega.Equal(exitNotFound))
+			gomega.Expect(exitCode(service.ErrDuplicateISBN)).To(gomega.Equal(exitConflict))
+			gomega.Expect(exitCode(errors.New("boom"))).To(gomega.Equal(exitFailure))
+		})
+		ginkgo.It("return usage error for unknown commands", func() {
+			gomega.Expect(run([]string{"nope"})).To(gomega.Equal(exitUsage))
+			gomega.Expect(run([]string{"book", "nope"})).To(gomega.Equal(exitUsage))
+			gomega.Expect(run([]string{"loadgen", "-mix", "delete=1"})).To(gomega.Equal(exitUsage))
+			gomega.Expect(run([]string{"loadgen", "-rps", "0"})).To(gomega.Equal(exitUsage))
+			gomega.Expect(run([]string{"book", "list", "-page", "-1"})).To(gomega.Equal(exitUsage))
+			gomega.Expect(run([]string{"book", "list", "-size", "0"})).To(gomega.Equal(exitUsage))
+			gomega.Expect(run([]string{"book", "list", "-size", "101"})).To(gomega.Equal(exitUsage))
+		})
+	})
+})
+
+//fakeSeeder 记录每次写入的数量，第 failAt 次写入时返回错误
+type fakeSeeder struct {
+	batches []int
+	failAt  int
+}
+
+func (s *fakeSeeder) AddBooks(books []*model.Book) error {
+	if len(s.batches) == s.failAt {
+		return service.ErrDuplicateISBN
+	}
+	s.batches = append(s.batches, len(books))
+	return nil
+}
+
+//fakeImporter 记录保存的 Book 标题，failures 中的标题返回对应的错误
+type fakeImporter struct {
+	titles   []string
+	failures map[string]error
+}
+
+func (s *fakeImporter) AddBook(book *model.Book) error {
+	if err := s.failures[book.Title]; err != nil {
+		return err
+	}
+	s.titles = append(s.titles, book.Title)
+	return nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/loadgen"
+)
+
+//loadgenCommand 按照固定的速率向服务发送 create/get/list/update 请求，输出延迟与错误率。
+//摘要写入标准错误，JSON 报告写入 -out 或标准输出，便于比较多次压测
+func loadgenCommand(args []string) int {
+	fs := newFlagSet("loadgen")
+	url := fs.String("url", "http://127.0.0.1:8080", "base url of the server")
+	tenant := fs.String("tenant", "", "send requests as this tenant")
+	rps := fs.Float64("rps", 50, "requests per second, sent on schedule without waiting for responses")
+	duration := fs.Duration("duration", 30*time.Second, "duration of the test")
+	mix := fs.String("mix", loadgen.DefaultMix, "weights of operations")
+	seedValue := fs.Int64("seed", 1, "random seed of operations and books")
+	timeout := fs.Duration("timeout", 10*time.Second, "timeout of a request")
+	maxInFlight := fs.Int("max-in-flight", 1000, "max requests in flight, requests over it are dropped")
+	prefill := fs.Int("prefill", 100, "books created before the test for get and update")
+	out := fs.String("out", "", "write the json report to this file, stdout if empty")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	parsedMix, err := loadgen.ParseMix(*mix)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	if *rps <= 0 || *duration <= 0 || *maxInFlight <= 0 || *prefill < 0 {
+		fmt.Fprintln(os.Stderr, "rps, duration and max-in-flight must be positive, prefill must not be negative")
+		return exitUsage
+	}
+
+	//中断时停止发送新的请求，仍然输出已经完成的请求的报告
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	fmt.Fprintf(os.Stderr, "sending %.1f rps to %s for %s\n", *rps, *url, *duration)
+	report, err := loadgen.Run(ctx, loadgen.Config{
+		BaseURL:     *url,
+		Tenant:      *tenant,
+		RPS:         *rps,
+		Duration:    *duration,
+		Mix:         parsedMix,
+		Seed:        *seedValue,
+		MaxInFlight: *maxInFlight,
+		Prefill:     *prefill,
+		Client:      loadgen.NewClient(*maxInFlight, *timeout),
+	})
+	if err != nil {
+		return fail(err)
+	}
+	if err := report.WriteText(os.Stderr); err != nil {
+		return fail(err)
+	}
+	w := os.Stdout
+	if *out != "" {
+		file, err := os.Create(*out)
+		if err != nil {
+			return fail(err)
+		}
+		defer func() {
+			_ = file.Close()
+		}()
+		w = file
+	}
+	if err := report.WriteJSON(w); err != nil {
+		return fail(err)
+	}
+	return exitOK
+}
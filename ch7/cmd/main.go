@@ -1,29 +1,150 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
-	"github.com/gin-gonic/gin"
-	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/api"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/model"
 	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/service"
+	"gorm.io/gorm"
 )
 
-var (
-	dsn     = flag.String("dsn", "user:pass@tcp(127.0.0.1:3306)/dbname?charset=utf8mb4&parseTime=True&loc=Local", "database dsn")
-	address = flag.String("address", "0.0.0.0:8080", "server bind address")
+//进程退出码，便于脚本判断执行结果
+const (
+	exitOK       = 0 //exitOK 执行成功
+	exitFailure  = 1 //exitFailure 执行失败，例如无法连接数据库
+	exitUsage    = 2 //exitUsage 命令或参数错误
+	exitNotFound = 3 //exitNotFound 操作的 Book 不存在
+	exitConflict = 4 //exitConflict 与已有数据冲突，例如 ISBN 重复
 )
 
+const defaultDsn = "user:pass@tcp(127.0.0.1:3306)/dbname?charset=utf8mb4&parseTime=True&loc=Local"
+
+//command 子命令，run 返回进程退出码
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) int
+}
+
+var commands []command
+
+func init() {
+	commands = []command{
+		{"serve", "start the http server", serve},
+		{"book", "add, get, list, update or delete books", bookCommand},
+		{"import", "import books from ndjson or csv", importBooks},
+		{"export", "export books as ndjson, csv or marcxml", exportBooks},
+		{"migrate", "create or update tables", migrate},
+		{"replay", "publish outbox events again", replay},
+		{"seed", "generate or anonymize books", seedCommand},
+		{"loadgen", "benchmark the book api", loadgenCommand},
+	}
+}
+
 func main() {
-	flag.Parse()
-	err := service.InitManagerFromDsn(*dsn)
-	if err != nil {
-		fmt.Println("init database failed")
-	}
-	r := gin.Default()
-	group := r.Group("/books")
-	api.InitRoute(group)
-	err = r.Run(*address)
-	if err != nil {
-		panic("failed to start server")
+	os.Exit(run(os.Args[1:]))
+}
+
+//run 执行子命令，没有子命令或第一个参数是 flag 时启动服务，兼容之前的启动方式
+func run(args []string) int {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return serve(args)
+	}
+	for _, cmd := range commands {
+		if cmd.name == args[0] {
+			return cmd.run(args[1:])
+		}
+	}
+	if args[0] == "help" {
+		usage(os.Stdout)
+		return exitOK
+	}
+	fmt.Fprintf(os.Stderr, "unknown command %q\n", args[0])
+	usage(os.Stderr)
+	return exitUsage
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "usage: cmd <command> [flags]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-8s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "run 'cmd <command> -h' for flags of the command")
+}
+
+//newFlagSet 创建子命令的 FlagSet，解析失败时由调用方返回 exitUsage
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	return fs
+}
+
+//dbFlags 访问数据库的子命令共用的参数
+type dbFlags struct {
+	dsn    *string
+	tenant *string
+}
+
+func addDBFlags(fs *flag.FlagSet) *dbFlags {
+	return &dbFlags{
+		dsn:    fs.String("dsn", defaultDsn, "database dsn"),
+		tenant: fs.String("tenant", "", "only access books of this tenant"),
+	}
+}
+
+//manager 连接数据库，指定租户时返回只能访问该租户数据的 Manager
+func (f *dbFlags) manager() (*service.Manager, error) {
+	if err := service.InitManagerFromDsn(*f.dsn); err != nil {
+		return nil, fmt.Errorf("init database failed: %w", err)
+	}
+	if *f.tenant != "" {
+		return service.GetManager().ForTenant(*f.tenant), nil
+	}
+	return service.GetManager(), nil
+}
+
+//migrate 创建或更新数据库表
+func migrate(args []string) int {
+	fs := newFlagSet("migrate")
+	dsn := fs.String("dsn", defaultDsn, "database dsn")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if err := service.InitManagerFromDsn(*dsn); err != nil {
+		return fail(fmt.Errorf("init database failed: %w", err))
+	}
+	if err := service.GetManager().Migrate(); err != nil {
+		return fail(fmt.Errorf("migrate database failed: %w", err))
+	}
+	fmt.Fprintln(os.Stderr, "migrated")
+	return exitOK
+}
+
+//fail 输出错误并返回对应的退出码
+func fail(err error) int {
+	fmt.Fprintf(os.Stderr, "error: %s\n", err)
+	return exitCode(err)
+}
+
+func exitCode(err error) int {
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return exitNotFound
+	case errors.Is(err, service.ErrDuplicateISBN):
+		return exitConflict
+	case errors.Is(err, model.ErrInvalidISBN):
+		return exitUsage
+	default:
+		return exitFailure
 	}
 }
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/model"
+	"gopkg.in/yaml.v2"
+)
+
+//outputFormat 命令输出 Book 的格式
+type outputFormat string
+
+const (
+	formatTable outputFormat = "table" //formatTable 对齐的表格，便于人阅读
+	formatJSON  outputFormat = "json"  //formatJSON 与 HTTP 接口相同的 JSON
+	formatYAML  outputFormat = "yaml"  //formatYAML 字段与 JSON 相同的 YAML
+)
+
+func addOutputFlag(fs *flag.FlagSet) *string {
+	return fs.String("o", string(formatTable), "output format: table, json or yaml")
+}
+
+func parseOutputFormat(s string) (outputFormat, error) {
+	switch f := outputFormat(s); f {
+	case formatTable, formatJSON, formatYAML:
+		return f, nil
+	default:
+		return "", fmt.Errorf("invalid output format %q", s)
+	}
+}
+
+//writeBook 输出单个 Book，JSON 与 YAML 输出对象
+func writeBook(w io.Writer, format outputFormat, book *model.Book) error {
+	if format == formatTable {
+		return writeTable(w, []*model.Book{book})
+	}
+	return encode(w, format, book)
+}
+
+//writeBooks 输出 Book 列表，JSON 与 YAML 输出数组，没有 Book 时输出空数组
+func writeBooks(w io.Writer, format outputFormat, books []*model.Book) error {
+	if format == formatTable {
+		return writeTable(w, books)
+	}
+	if books == nil {
+		books = []*model.Book{}
+	}
+	return encode(w, format, books)
+}
+
+func writeTable(w io.Writer, books []*model.Book) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tTITLE\tAUTHOR\tPAGES\tWEIGHT\tISBN13")
+	for _, book := range books {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%d\t%d\t%s\n", book.ID, book.Title, book.Author, book.Pages, book.Weight, book.ISBN13)
+	}
+	return tw.Flush()
+}
+
+//encode 输出 JSON 或 YAML。YAML 先编码为 JSON，保证字段名与 json tag 一致
+func encode(w io.Writer, format outputFormat, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	if format == formatJSON {
+		_, err = fmt.Fprintf(w, "%s\n", data)
+		return err
+	}
+	//YAML 是 JSON 的超集，解析 JSON 可以保留整数类型
+	var generic interface{}
+	if err := yaml.Unmarshal(data, &generic); err != nil {
+		return err
+	}
+	data, err = yaml.Marshal(generic)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/outbox"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/service"
+)
+
+//replay 将 outbox 中的历史事件重新投递，用于下游系统重建数据
+func replay(args []string) int {
+	fs := newFlagSet("replay")
+	dsn := fs.String("dsn", defaultDsn, "database dsn")
+	after := fs.Uint("after", 0, "replay events with id greater than this")
+	webhookURL := fs.String("webhook", "", "publish events to this url")
+	file := fs.String("file", "", "append events to this file as ndjson")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if err := service.InitManagerFromDsn(*dsn); err != nil {
+		return fail(fmt.Errorf("init database failed: %w", err))
+	}
+
+	var sinks []outbox.Sink
+	if *webhookURL != "" {
+		sinks = append(sinks, outbox.NewWebhookSink(*webhookURL))
+	}
+	if *file != "" {
+		sink, err := outbox.NewFileSink(*file)
+		if err != nil {
+			return fail(fmt.Errorf("open file failed: %w", err))
+		}
+		defer func() {
+			_ = sink.Close()
+		}()
+		sinks = append(sinks, sink)
+	}
+	if len(sinks) == 0 {
+		fmt.Fprintln(os.Stderr, "no sink, use --webhook or --file")
+		return exitUsage
+	}
+
+	count, err := outbox.NewRelay(service.GetManager().AllTenants(), sinks...).Replay(context.Background(), *after)
+	fmt.Printf("replayed %d events\n", count)
+	if err != nil {
+		return fail(fmt.Errorf("replay failed: %w", err))
+	}
+	return exitOK
+}
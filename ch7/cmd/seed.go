@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/model"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/seed"
+)
+
+const (
+	defaultSeedBatch = 1000 //defaultSeedBatch 每个事务写入的 Book 数量
+	maxSeedBatch     = 5000 //maxSeedBatch 一条 INSERT 的参数数量不能超过数据库的限制
+)
+
+//bookSeeder 批量写入 Book，*service.Manager 实现了该接口
+type bookSeeder interface {
+	AddBooks(books []*model.Book) error
+}
+
+//seedCommand 按照种子生成大量 Book 写入数据库或文件，-anonymize 时匿名化已有的导出文件
+func seedCommand(args []string) int {
+	fs := newFlagSet("seed")
+	db := addDBFlags(fs)
+	seedValue := fs.Int64("seed", 1, "random seed, the same seed generates the same books")
+	count := fs.Int("count", 10000, "number of books to generate")
+	batch := fs.Int("batch", defaultSeedBatch, "books inserted in one transaction")
+	out := fs.String("out", "", "write books as ndjson to this file instead of the database, - for stdout")
+	anonymize := fs.Bool("anonymize", false, "anonymize books read from the input file or stdin instead of generating")
+	format := fs.String("format", string(formatNDJSON), "format of input and output with -anonymize: ndjson or csv")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if *count < 0 || *batch <= 0 || *batch > maxSeedBatch {
+		fmt.Fprintf(os.Stderr, "count must not be negative and batch must be in [1, %d]\n", maxSeedBatch)
+		return exitUsage
+	}
+	switch transferFormat(*format) {
+	case formatNDJSON, formatCSV:
+	default:
+		fmt.Fprintf(os.Stderr, "invalid format %q\n", *format)
+		return exitUsage
+	}
+	if *anonymize {
+		return anonymizeCommand(*seedValue, transferFormat(*format), fs.Arg(0), *out)
+	}
+
+	generator := seed.NewGenerator(*seedValue)
+	if *out != "" {
+		return writeOutput(*out, formatNDJSON, func(write func(book *model.Book) error) (int, error) {
+			for i := 0; i < *count; i++ {
+				if err := write(generator.Next()); err != nil {
+					return i, err
+				}
+			}
+			return *count, nil
+		})
+	}
+	manager, err := db.manager()
+	if err != nil {
+		return fail(err)
+	}
+	added, err := seedBooks(manager, generator, *count, *batch, os.Stderr)
+	fmt.Fprintf(os.Stderr, "seeded %d books\n", added)
+	if err != nil {
+		return fail(err)
+	}
+	return exitOK
+}
+
+//seedBooks 生成 count 个 Book，每 batch 个写入一次，每写入约 10% 输出一次进度
+func seedBooks(store bookSeeder, generator *seed.Generator, count, batch int, progress io.Writer) (int, error) {
+	books := make([]*model.Book, 0, batch)
+	step := count / 10
+	if step < batch {
+		step = batch
+	}
+	added, reported := 0, 0
+	for added < count {
+		books = books[:0]
+		for len(books) < batch && added+len(books) < count {
+			books = append(books, generator.Next())
+		}
+		if err := store.AddBooks(books); err != nil {
+			return added, err
+		}
+		added += len(books)
+		if added-reported >= step && added < count {
+			reported = added
+			fmt.Fprintf(progress, "seeded %d/%d books\n", added, count)
+		}
+	}
+	return added, nil
+}
+
+//anonymizeCommand 读取 input 中的 Book，匿名化之后按照同样的格式写入 out
+func anonymizeCommand(seedValue int64, format transferFormat, input, out string) int {
+	in, closeIn, err := openInput(input)
+	if err != nil {
+		return fail(err)
+	}
+	defer closeIn()
+	read, err := newBookReader(format, in)
+	if err != nil {
+		return fail(err)
+	}
+	if out == "" {
+		out = "-"
+	}
+	anonymizer := seed.NewAnonymizer(seedValue)
+	return writeOutput(out, format, func(write func(book *model.Book) error) (int, error) {
+		return anonymizeBooks(read, write, anonymizer)
+	})
+}
+
+//anonymizeBooks 匿名化 read 读取的所有 Book 并写入 write，返回写入的数量
+func anonymizeBooks(read bookReader, write func(book *model.Book) error, anonymizer *seed.Anonymizer) (int, error) {
+	for n := 0; ; n++ {
+		book, err := read()
+		if errors.Is(err, io.EOF) {
+			return n, nil
+		}
+		if err != nil {
+			return n, fmt.Errorf("record %d: %w", n+1, err)
+		}
+		if err := write(anonymizer.Anonymize(book)); err != nil {
+			return n, err
+		}
+	}
+}
+
+//writeOutput 打开 path 并按照 format 写入 fn 生成的 Book，path 为 - 时写入标准输出
+func writeOutput(path string, format transferFormat, fn func(write func(book *model.Book) error) (int, error)) int {
+	var w io.Writer = os.Stdout
+	if path != "-" {
+		file, err := os.Create(path)
+		if err != nil {
+			return fail(err)
+		}
+		defer func() {
+			_ = file.Close()
+		}()
+		w = file
+	}
+	buffered := bufio.NewWriter(w)
+	write, done, err := newBookWriter(format, buffered)
+	if err != nil {
+		return fail(err)
+	}
+	n, err := fn(write)
+	if err == nil {
+		err = done()
+	}
+	if err == nil {
+		err = buffered.Flush()
+	}
+	fmt.Fprintf(os.Stderr, "wrote %d books\n", n)
+	if err != nil {
+		return fail(err)
+	}
+	return exitOK
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/api"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/blobstore"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/outbox"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/ratelimit"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/recommend"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/service"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/stream"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/trace"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/webhook"
+)
+
+//serveOptions serve 子命令的参数
+type serveOptions struct {
+	dsn             string
+	replicaDsns     stringList
+	replicaCheck    time.Duration
+	address         string
+	rateLimitConfig string
+	autoMigrate     bool
+	eventWebhook    string
+	eventFile       string
+	coverDir        string
+	requireTenant   bool
+	traceExporter   string
+	cacheControl    stringList
+	trustedProxies  stringList
+}
+
+//stringList 可以重复指定的 flag
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+//parseCacheControl 在默认配置的基础上覆盖 -cache-control 指定的路由，策略为空时不返回 Cache-Control
+func parseCacheControl(values []string) (map[string]string, error) {
+	policies := make(map[string]string, len(api.DefaultCacheControl)+len(values))
+	for route, policy := range api.DefaultCacheControl {
+		policies[route] = policy
+	}
+	for _, value := range values {
+		route, policy, ok := strings.Cut(value, "=")
+		route = strings.TrimSpace(route)
+		if !ok || !strings.Contains(route, " /") {
+			return nil, fmt.Errorf("invalid cache control %q, expect 'METHOD /path=policy'", value)
+		}
+		if policy = strings.TrimSpace(policy); policy == "" {
+			delete(policies, route)
+		} else {
+			policies[route] = policy
+		}
+	}
+	return policies, nil
+}
+
+func serve(args []string) int {
+	var opts serveOptions
+	fs := newFlagSet("serve")
+	fs.StringVar(&opts.dsn, "dsn", defaultDsn, "database dsn")
+	fs.Var(&opts.replicaDsns, "replica-dsn", "read replica dsn, repeat for more replicas")
+	fs.DurationVar(&opts.replicaCheck, "replica-check-interval", 5*time.Second, "interval of replica health checks")
+	fs.StringVar(&opts.address, "address", "0.0.0.0:8080", "server bind address")
+	fs.StringVar(&opts.rateLimitConfig, "ratelimit-config", "", "rate limit config file (json), disabled if empty")
+	fs.BoolVar(&opts.autoMigrate, "auto-migrate", true, "create or update tables on start")
+	fs.StringVar(&opts.eventWebhook, "event-webhook", "", "publish book events to this url")
+	fs.StringVar(&opts.eventFile, "event-file", "", "append book events to this file as ndjson")
+	fs.StringVar(&opts.coverDir, "cover-dir", "./covers", "directory to store book cover images")
+	fs.BoolVar(&opts.requireTenant, "require-tenant", false, "reject requests without tenant and isolate every query by tenant")
+	fs.StringVar(&opts.traceExporter, "trace-exporter", "", "export spans of requests and sql: stdout, disabled if empty")
+	fs.Var(&opts.cacheControl, "cache-control", "Cache-Control of a route as 'GET /books/:book_id=public, max-age=60', repeat for more routes")
+	fs.Var(&opts.trustedProxies, "trusted-proxy", "ip or cidr of a proxy whose X-Forwarded-For is trusted, repeat for more proxies")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	cacheControl, err := parseCacheControl(opts.cacheControl)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	switch opts.traceExporter {
+	case "":
+	case "stdout":
+		trace.SetExporter(trace.NewStdoutExporter())
+	default:
+		fmt.Fprintf(os.Stderr, "unknown trace exporter %q\n", opts.traceExporter)
+		return exitUsage
+	}
+
+	broker := stream.NewBroker(stream.DefaultBufferSize)
+	api.SetEventBroker(broker)
+	if err := service.InitManagerFromDsn(opts.dsn, opts.replicaDsns...); err != nil {
+		return fail(fmt.Errorf("init database failed: %w", err))
+	}
+	if err := startBackground(opts, broker); err != nil {
+		return fail(err)
+	}
+
+	service.SetTenantRequired(opts.requireTenant)
+	routerOpts := api.RouterOptions{RequireTenant: opts.requireTenant, CacheControl: cacheControl, TrustedProxies: opts.trustedProxies}
+	if opts.rateLimitConfig != "" {
+		config, err := ratelimit.LoadConfig(opts.rateLimitConfig)
+		if err != nil {
+			return fail(fmt.Errorf("load rate limit config failed: %w", err))
+		}
+		routerOpts.RateLimit = config
+	}
+	store, err := blobstore.NewLocalStore(opts.coverDir)
+	if err != nil {
+		return fail(fmt.Errorf("init cover store failed: %w", err))
+	}
+	api.SetCoverStore(store)
+	r, err := api.NewRouter(routerOpts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid trusted proxy: %s\n", err)
+		return exitUsage
+	}
+	if err := r.Run(opts.address); err != nil {
+		return fail(fmt.Errorf("failed to start server: %w", err))
+	}
+	return exitOK
+}
+
+//startBackground 初始化数据库表，启动事件投递、webhook 投递与副本健康检查，
+//初始化失败时不启动任何后台任务
+func startBackground(opts serveOptions, broker *stream.Broker) error {
+	if opts.autoMigrate {
+		if err := service.GetManager().Migrate(); err != nil {
+			return fmt.Errorf("migrate database failed: %w", err)
+		}
+	}
+	dispatcher := webhook.NewDispatcher(service.GetManager().AllTenants())
+	sinks, err := eventSinks(opts, broker, dispatcher)
+	if err != nil {
+		return fmt.Errorf("init event sinks failed: %w", err)
+	}
+
+	if len(opts.replicaDsns) > 0 {
+		go func() {
+			_ = service.GetManager().WatchReplicas(context.Background(), opts.replicaCheck)
+		}()
+	}
+	go func() {
+		_ = dispatcher.Run(context.Background())
+	}()
+	go func() {
+		_ = outbox.NewRelay(service.GetManager().AllTenants(), sinks...).Run(context.Background())
+	}()
+	return nil
+}
+
+func eventSinks(opts serveOptions, broker *stream.Broker, dispatcher *webhook.Dispatcher) ([]outbox.Sink, error) {
+	sinks := []outbox.Sink{
+		broker,
+		dispatcher,
+		recommend.NewConsumer(func(tenantId string) recommend.Store {
+			return service.GetManager().ForTenant(tenantId)
+		}),
+	}
+	if opts.eventWebhook != "" {
+		sinks = append(sinks, outbox.NewWebhookSink(opts.eventWebhook))
+	}
+	if opts.eventFile != "" {
+		sink, err := outbox.NewFileSink(opts.eventFile)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+	return sinks, nil
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/feed"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/model"
+	"gorm.io/gorm"
+)
+
+//transferFormat import 与 export 的文件格式
+type transferFormat string
+
+const (
+	formatNDJSON  transferFormat = "ndjson"  //formatNDJSON 每行一个 Book JSON
+	formatCSV     transferFormat = "csv"     //formatCSV 第一行为列名
+	formatMARCXML transferFormat = "marcxml" //formatMARCXML 只支持导出
+)
+
+//csvColumns 导出 CSV 的列，导入时按照列名读取，忽略 id 与未知的列
+var csvColumns = []string{"id", "title", "author", "pages", "weight", "isbn10", "isbn13"}
+
+//exportBatchSize 导出时每次读取的 Book 数量
+const exportBatchSize = 500
+
+//bookReader 依次读取 Book，读完时返回 io.EOF
+type bookReader func() (*model.Book, error)
+
+func importBooks(args []string) int {
+	fs := newFlagSet("import")
+	db := addDBFlags(fs)
+	format := fs.String("format", string(formatNDJSON), "input format: ndjson or csv")
+	keepGoing := fs.Bool("keep-going", false, "continue importing after a book failed")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	in, closeIn, err := openInput(fs.Arg(0))
+	if err != nil {
+		return fail(err)
+	}
+	defer closeIn()
+	read, err := newBookReader(transferFormat(*format), in)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	manager, err := db.manager()
+	if err != nil {
+		return fail(err)
+	}
+	return importFrom(manager, read, *keepGoing, os.Stderr)
+}
+
+//bookImporter 保存导入的 Book，由 service.Manager 实现
+type bookImporter interface {
+	AddBook(book *model.Book) error
+}
+
+//importFrom 依次保存读取的 Book 并返回退出码，失败的都是 ISBN 重复时返回 exitConflict
+func importFrom(store bookImporter, read bookReader, keepGoing bool, progress io.Writer) int {
+	imported, failed, conflicts := 0, 0, 0
+	for record := 1; ; record++ {
+		book, err := read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err == nil {
+			err = store.AddBook(book)
+		}
+		if err != nil {
+			failed++
+			if exitCode(err) == exitConflict {
+				conflicts++
+			}
+			fmt.Fprintf(progress, "record %d: %s\n", record, err)
+			if !keepGoing {
+				break
+			}
+			continue
+		}
+		imported++
+	}
+	fmt.Fprintf(progress, "imported %d books, %d failed\n", imported, failed)
+	switch {
+	case failed == 0:
+		return exitOK
+	case conflicts == failed:
+		return exitConflict
+	default:
+		return exitFailure
+	}
+}
+
+func exportBooks(args []string) int {
+	fs := newFlagSet("export")
+	db := addDBFlags(fs)
+	format := fs.String("format", string(formatNDJSON), "output format: ndjson, csv or marcxml")
+	tag := fs.String("tag", "", "only export books with this tag")
+	subject := fs.Uint("subject", 0, "only export books in this subject or its children")
+	out := fs.String("out", "", "output file, stdout if empty")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	switch transferFormat(*format) {
+	case formatNDJSON, formatCSV, formatMARCXML:
+	default:
+		fmt.Fprintf(os.Stderr, "invalid format %q\n", *format)
+		return exitUsage
+	}
+	manager, err := db.manager()
+	if err != nil {
+		return fail(err)
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		file, err := os.Create(*out)
+		if err != nil {
+			return fail(err)
+		}
+		defer func() {
+			_ = file.Close()
+		}()
+		w = file
+	}
+	buffered := bufio.NewWriter(w)
+	write, done, err := newBookWriter(transferFormat(*format), buffered)
+	if err != nil {
+		return fail(err)
+	}
+	count := 0
+	err = manager.EachBook(model.BookQuery{Tag: *tag, SubjectID: *subject}, exportBatchSize, func(book *model.Book) error {
+		count++
+		return write(book)
+	})
+	if err == nil {
+		err = done()
+	}
+	if err == nil {
+		err = buffered.Flush()
+	}
+	if err != nil {
+		return fail(err)
+	}
+	fmt.Fprintf(os.Stderr, "exported %d books\n", count)
+	return exitOK
+}
+
+//openInput 打开输入文件，没有指定或为 - 时读取标准输入
+func openInput(path string) (io.Reader, func(), error) {
+	if path == "" || path == "-" {
+		return os.Stdin, func() {}, nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return file, func() { _ = file.Close() }, nil
+}
+
+//newBookReader 返回按照 format 读取 Book 的函数，读取的 Book 不保留 ID 等由数据库生成的字段
+func newBookReader(format transferFormat, r io.Reader) (bookReader, error) {
+	switch format {
+	case formatNDJSON:
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		return func() (*model.Book, error) {
+			for scanner.Scan() {
+				line := strings.TrimSpace(scanner.Text())
+				if line == "" {
+					continue
+				}
+				book, err := model.NewBookFromJSON(line)
+				if err != nil {
+					return nil, err
+				}
+				book.Model = gorm.Model{}
+				return book, nil
+			}
+			if err := scanner.Err(); err != nil {
+				return nil, err
+			}
+			return nil, io.EOF
+		}, nil
+	case formatCSV:
+		reader := csv.NewReader(r)
+		header, err := reader.Read()
+		if err != nil {
+			return nil, fmt.Errorf("read csv header failed: %w", err)
+		}
+		columns := make(map[string]int, len(header))
+		for i, name := range header {
+			columns[strings.ToLower(strings.TrimSpace(name))] = i
+		}
+		return func() (*model.Book, error) {
+			record, err := reader.Read()
+			if err != nil {
+				return nil, err
+			}
+			return bookFromCSV(columns, record)
+		}, nil
+	default:
+		return nil, fmt.Errorf("invalid input format %q", format)
+	}
+}
+
+func bookFromCSV(columns map[string]int, record []string) (*model.Book, error) {
+	value := func(name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+	number := func(name string) (int32, error) {
+		if value(name) == "" {
+			return 0, nil
+		}
+		n, err := strconv.ParseInt(value(name), 10, 32)
+		if err != nil {
+			return 0, fmt.Errorf("invalid %s %q", name, value(name))
+		}
+		return int32(n), nil
+	}
+	book := &model.Book{
+		Title:  value("title"),
+		Author: value("author"),
+		ISBN10: model.ISBN(value("isbn10")),
+		ISBN13: model.ISBN(value("isbn13")),
+	}
+	var err error
+	if book.Pages, err = number("pages"); err != nil {
+		return nil, err
+	}
+	if book.Weight, err = number("weight"); err != nil {
+		return nil, err
+	}
+	return book, nil
+}
+
+//newBookWriter 返回按照 format 写入 Book 的函数，done 写入结尾并检查错误
+func newBookWriter(format transferFormat, w io.Writer) (write func(book *model.Book) error, done func() error, err error) {
+	switch format {
+	case formatNDJSON:
+		encoder := json.NewEncoder(w)
+		return func(book *model.Book) error {
+			return encoder.Encode(book)
+		}, func() error { return nil }, nil
+	case formatCSV:
+		writer := csv.NewWriter(w)
+		if err := writer.Write(csvColumns); err != nil {
+			return nil, nil, err
+		}
+		return func(book *model.Book) error {
+				return writer.Write([]string{
+					strconv.FormatUint(uint64(book.ID), 10), book.Title, book.Author,
+					strconv.Itoa(int(book.Pages)), strconv.Itoa(int(book.Weight)),
+					string(book.ISBN10), string(book.ISBN13),
+				})
+			}, func() error {
+				writer.Flush()
+				return writer.Error()
+			}, nil
+	case formatMARCXML:
+		writer, err := feed.NewMARCWriter(w)
+		if err != nil {
+			return nil, nil, err
+		}
+		return writer.Write, writer.Close, nil
+	default:
+		return nil, nil, fmt.Errorf("invalid output format %q", format)
+	}
+}
@@ -0,0 +1,199 @@
+package cover
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/gif" //注册 gif 解码器
+	"image/jpeg"
+	"image/png"
+	"net/http"
+)
+
+const (
+	MaxSize      = 5 << 20 //MaxSize 上传图片的最大字节数
+	MaxDimension = 8000    //MaxDimension 图片宽高的最大像素，避免解码超大图片耗尽内存
+	Original     = "original"
+)
+
+//ErrUnsupportedType 不支持的图片格式
+var ErrUnsupportedType = errors.New("unsupported image type, only support [jpeg,png,gif]")
+
+//Thumbnail 缩略图尺寸，图片等比缩放到 Width x Height 以内
+type Thumbnail struct {
+	Name   string
+	Width  int
+	Height int
+}
+
+//Thumbnails 生成的缩略图尺寸
+var Thumbnails = []Thumbnail{
+	{Name: "small", Width: 100, Height: 150},
+	{Name: "medium", Width: 300, Height: 450},
+	{Name: "large", Width: 600, Height: 900},
+}
+
+//Image 处理后的一张图片
+type Image struct {
+	Size        string
+	ContentType string
+	Extension   string
+	Width       int
+	Height      int
+	Data        []byte
+}
+
+//Sniff 根据文件内容判断图片类型，而不是信任客户端上传的 Content-Type
+func Sniff(data []byte) (string, error) {
+	contentType := http.DetectContentType(data)
+	switch contentType {
+	case "image/jpeg", "image/png", "image/gif":
+		return contentType, nil
+	default:
+		return "", ErrUnsupportedType
+	}
+}
+
+//Process 校验图片并生成所有尺寸的缩略图，返回的第一张为原图。
+//png 缩略图保持 png 格式以保留透明通道，其他格式输出 jpeg
+func Process(data []byte) ([]*Image, error) {
+	if len(data) > MaxSize {
+		return nil, fmt.Errorf("image is larger than %d bytes", MaxSize)
+	}
+	contentType, err := Sniff(data)
+	if err != nil {
+		return nil, err
+	}
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if config.Width > MaxDimension || config.Height > MaxDimension {
+		return nil, fmt.Errorf("image is larger than %dx%d", MaxDimension, MaxDimension)
+	}
+	decoded, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	//所有缩略图共用一次转换的结果
+	src := ToRGBA(decoded)
+
+	images := []*Image{{
+		Size:        Original,
+		ContentType: contentType,
+		Extension:   extension(contentType),
+		Width:       config.Width,
+		Height:      config.Height,
+		Data:        data,
+	}}
+	for _, thumbnail := range Thumbnails {
+		dst := Resize(src, thumbnail.Width, thumbnail.Height)
+		img, err := encode(dst, contentType == "image/png")
+		if err != nil {
+			return nil, err
+		}
+		img.Size = thumbnail.Name
+		images = append(images, img)
+	}
+	return images, nil
+}
+
+//ToRGBA 将图片转换为 RGBA，src 已经是 RGBA 时直接返回
+func ToRGBA(src image.Image) *image.RGBA {
+	if rgba, ok := src.(*image.RGBA); ok {
+		return rgba
+	}
+	bounds := src.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), src, bounds.Min, draw.Src)
+	return rgba
+}
+
+//Resize 将图片等比缩小到 maxWidth x maxHeight 以内，不会放大图片，不需要缩小时直接返回 src。
+//每个目标像素取对应区域内源像素的平均值(box filter)
+func Resize(src *image.RGBA, maxWidth, maxHeight int) *image.RGBA {
+	bounds := src.Bounds()
+	width, height := fit(bounds.Dx(), bounds.Dy(), maxWidth, maxHeight)
+	if width == bounds.Dx() && height == bounds.Dy() {
+		return src
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0, y1 := y*bounds.Dy()/height, (y+1)*bounds.Dy()/height
+		for x := 0; x < width; x++ {
+			x0, x1 := x*bounds.Dx()/width, (x+1)*bounds.Dx()/width
+			var r, g, b, a, n int
+			for sy := y0; sy < y1; sy++ {
+				offset := src.PixOffset(bounds.Min.X+x0, bounds.Min.Y+sy)
+				for sx := x0; sx < x1; sx++ {
+					r += int(src.Pix[offset])
+					g += int(src.Pix[offset+1])
+					b += int(src.Pix[offset+2])
+					a += int(src.Pix[offset+3])
+					offset += 4
+					n++
+				}
+			}
+			offset := dst.PixOffset(x, y)
+			dst.Pix[offset] = uint8(r / n)
+			dst.Pix[offset+1] = uint8(g / n)
+			dst.Pix[offset+2] = uint8(b / n)
+			dst.Pix[offset+3] = uint8(a / n)
+		}
+	}
+	return dst
+}
+
+//fit 计算等比缩放后的宽高
+func fit(width, height, maxWidth, maxHeight int) (int, int) {
+	if width <= maxWidth && height <= maxHeight {
+		return width, height
+	}
+	if width*maxHeight > height*maxWidth {
+		return maxWidth, atLeastOne(height * maxWidth / width)
+	}
+	return atLeastOne(width * maxHeight / height), maxHeight
+}
+
+func atLeastOne(n int) int {
+	if n < 1 {
+		return 1
+	}
+	return n
+}
+
+func encode(img image.Image, asPNG bool) (*Image, error) {
+	var buf bytes.Buffer
+	contentType := "image/jpeg"
+	var err error
+	if asPNG {
+		contentType = "image/png"
+		err = png.Encode(&buf, img)
+	} else {
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: 85})
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Image{
+		ContentType: contentType,
+		Extension:   extension(contentType),
+		Width:       img.Bounds().Dx(),
+		Height:      img.Bounds().Dy(),
+		Data:        buf.Bytes(),
+	}, nil
+}
+
+func extension(contentType string) string {
+	switch contentType {
+	case "image/png":
+		return ".png"
+	case "image/gif":
+		return ".gif"
+	default:
+		return ".jpg"
+	}
+}
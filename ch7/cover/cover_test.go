@@ -0,0 +1,105 @@
+package cover_test
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/cover"
+)
+
+//newImage 创建左半边黑色、右半边白色的图片
+func newImage(width, height int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if x < width/2 {
+				img.Set(x, y, color.Black)
+			} else {
+				img.Set(x, y, color.White)
+			}
+		}
+	}
+	return img
+}
+
+var _ = ginkgo.Describe("cover", func() {
+	ginkgo.Describe("sniff content type", func() {
+		ginkgo.It("accept images by content", func() {
+			var buf bytes.Buffer
+			gomega.Expect(jpeg.Encode(&buf, newImage(10, 10), nil)).To(gomega.Succeed())
+			contentType, err := cover.Sniff(buf.Bytes())
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(contentType).To(gomega.Equal("image/jpeg"))
+		})
+		ginkgo.It("reject other content", func() {
+			_, err := cover.Sniff([]byte("<html><body>not an image</body></html>"))
+			gomega.Expect(err).To(gomega.MatchError(cover.ErrUnsupportedType))
+		})
+	})
+
+	ginkgo.DescribeTable("resize keeps aspect ratio",
+		func(width, height, maxWidth, maxHeight, expectWidth, expectHeight int) {
+			dst := cover.Resize(newImage(width, height), maxWidth, maxHeight)
+			gomega.Expect(dst.Bounds().Dx()).To(gomega.Equal(expectWidth))
+			gomega.Expect(dst.Bounds().Dy()).To(gomega.Equal(expectHeight))
+		},
+		ginkgo.Entry("wide image", 400, 200, 100, 150, 100, 50),
+		ginkgo.Entry("tall image", 200, 600, 100, 150, 50, 150),
+		ginkgo.Entry("small image is not enlarged", 40, 60, 100, 150, 40, 60),
+	)
+
+	ginkgo.It("average pixels when shrinking", func() {
+		dst := cover.Resize(newImage(4, 2), 2, 1)
+		gomega.Expect(dst.RGBAAt(0, 0)).To(gomega.Equal(color.RGBA{A: 255}))
+		gomega.Expect(dst.RGBAAt(1, 0)).To(gomega.Equal(color.RGBA{R: 255, G: 255, B: 255, A: 255}))
+
+		//SubImage 的 Bounds 不从 0 开始
+		sub := newImage(8, 2).SubImage(image.Rect(2, 0, 6, 2)).(*image.RGBA)
+		gomega.Expect(cover.Resize(sub, 2, 1)).To(gomega.Equal(dst))
+	})
+
+	ginkgo.It("convert images to rgba only when needed", func() {
+		src := newImage(4, 2)
+		gomega.Expect(cover.ToRGBA(src)).To(gomega.BeIdenticalTo(src))
+		gomega.Expect(cover.Resize(src, 10, 10)).To(gomega.BeIdenticalTo(src))
+
+		gray := image.NewGray(image.Rect(1, 1, 3, 2))
+		gray.SetGray(2, 1, color.Gray{Y: 255})
+		rgba := cover.ToRGBA(gray)
+		gomega.Expect(rgba.Bounds()).To(gomega.Equal(image.Rect(0, 0, 2, 1)))
+		gomega.Expect(rgba.RGBAAt(1, 0)).To(gomega.Equal(color.RGBA{R: 255, G: 255, B: 255, A: 255}))
+	})
+
+	ginkgo.Describe("process upload", func() {
+		ginkgo.Context("a png image", func() {
+			ginkgo.It("keep original & generate png thumbnails", func() {
+				var buf bytes.Buffer
+				gomega.Expect(png.Encode(&buf, newImage(1200, 1800))).To(gomega.Succeed())
+				images, err := cover.Process(buf.Bytes())
+				gomega.Expect(err).NotTo(gomega.HaveOccurred())
+				gomega.Expect(images).To(gomega.HaveLen(1 + len(cover.Thumbnails)))
+				gomega.Expect(images[0].Size).To(gomega.Equal(cover.Original))
+				gomega.Expect(images[0].Data).To(gomega.Equal(buf.Bytes()))
+				for i, thumbnail := range cover.Thumbnails {
+					gomega.Expect(images[i+1].Size).To(gomega.Equal(thumbnail.Name))
+					gomega.Expect(images[i+1].Width).To(gomega.Equal(thumbnail.Width))
+					gomega.Expect(images[i+1].ContentType).To(gomega.Equal("image/png"))
+					_, format, err := image.Decode(bytes.NewReader(images[i+1].Data))
+					gomega.Expect(err).NotTo(gomega.HaveOccurred())
+					gomega.Expect(format).To(gomega.Equal("png"))
+				}
+			})
+		})
+		ginkgo.Context("image too large", func() {
+			ginkgo.It("return error", func() {
+				_, err := cover.Process(make([]byte, cover.MaxSize+1))
+				gomega.Expect(err).To(gomega.HaveOccurred())
+			})
+		})
+	})
+})
@@ -0,0 +1,124 @@
+package e2e_test
+
+import (
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/api"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/service"
+)
+
+//get 发送 GET 请求，返回响应与响应体
+func get(path string, headers ...string) (*http.Response, []byte) {
+	req, err := http.NewRequest(http.MethodGet, server.URL+path, nil)
+	gomega.Expect(err).NotTo(gomega.HaveOccurred())
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	resp, err := http.DefaultClient.Do(req)
+	gomega.Expect(err).NotTo(gomega.HaveOccurred())
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	body, err := io.ReadAll(resp.Body)
+	gomega.Expect(err).NotTo(gomega.HaveOccurred())
+	return resp, body
+}
+
+var _ = ginkgo.Describe("Conditional requests", func() {
+	ginkgo.BeforeEach(func() {
+		createBook("Go", 100)
+	})
+
+	ginkgo.It("return 304 when the etag of a book matches", func() {
+		resp, _ := get("/books/1")
+		gomega.Expect(resp.StatusCode).To(gomega.Equal(http.StatusOK))
+		etag := resp.Header.Get("ETag")
+		gomega.Expect(etag).To(gomega.MatchRegexp(`^"[0-9a-f]{32}"$`))
+		gomega.Expect(resp.Header.Get("Cache-Control")).To(gomega.Equal("private, no-cache"))
+		//默认包含封面，只使用 ETag
+		gomega.Expect(resp.Header.Get("Last-Modified")).To(gomega.BeEmpty())
+
+		resp, body := get("/books/1", "If-None-Match", `"other", W/`+etag)
+		gomega.Expect(resp.StatusCode).To(gomega.Equal(http.StatusNotModified))
+		gomega.Expect(body).To(gomega.BeEmpty())
+		gomega.Expect(resp.Header.Get("ETag")).To(gomega.Equal(etag))
+
+		//选择不同的字段时内容不同
+		resp, _ = get("/books/1?fields=title", "If-None-Match", etag)
+		gomega.Expect(resp.StatusCode).To(gomega.Equal(http.StatusOK))
+	})
+
+	ginkgo.It("return 304 when the book is not modified since", func() {
+		const path = "/books/1?fields=title,updated_at"
+		resp, _ := get(path)
+		lastModified := resp.Header.Get("Last-Modified")
+		gomega.Expect(lastModified).NotTo(gomega.BeEmpty())
+
+		resp, _ = get(path, "If-Modified-Since", lastModified)
+		gomega.Expect(resp.StatusCode).To(gomega.Equal(http.StatusNotModified))
+
+		earlier := time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)
+		resp, _ = get(path, "If-Modified-Since", earlier)
+		gomega.Expect(resp.StatusCode).To(gomega.Equal(http.StatusOK))
+
+		//If-None-Match 优先
+		resp, _ = get(path, "If-Modified-Since", lastModified, "If-None-Match", `"other"`)
+		gomega.Expect(resp.StatusCode).To(gomega.Equal(http.StatusOK))
+	})
+
+	ginkgo.It("change the etag of a list page when books change", func() {
+		resp, _ := get("/books/")
+		gomega.Expect(resp.StatusCode).To(gomega.Equal(http.StatusOK))
+		etag := resp.Header.Get("ETag")
+		resp, _ = get("/books/", "If-None-Match", etag)
+		gomega.Expect(resp.StatusCode).To(gomega.Equal(http.StatusNotModified))
+
+		createBook("Rust", 100)
+		resp, _ = get("/books/", "If-None-Match", etag)
+		gomega.Expect(resp.StatusCode).To(gomega.Equal(http.StatusOK))
+		gomega.Expect(resp.Header.Get("ETag")).NotTo(gomega.Equal(etag))
+	})
+
+	ginkgo.It("validate localized books only by etag", func() {
+		resp, _ := get("/books/1?fields=title,updated_at", "Accept-Language", "zh-CN")
+		gomega.Expect(resp.Header.Values("Vary")).To(gomega.ContainElements(api.TenantHeader, "Accept-Language"))
+		gomega.Expect(resp.Header.Get("Last-Modified")).To(gomega.BeEmpty())
+		etag := resp.Header.Get("ETag")
+
+		//新增翻译不会修改 Book 的 UpdatedAt
+		gomega.Expect(call(http.MethodPut, "/books/1/translations/zh-CN", fields{"title": "Go 语言"}, nil)).
+			To(gomega.Equal(http.StatusOK))
+		since := time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+		resp, _ = get("/books/1?fields=title,updated_at", "Accept-Language", "zh-CN", "If-Modified-Since", since)
+		gomega.Expect(resp.StatusCode).To(gomega.Equal(http.StatusOK))
+		resp, _ = get("/books/1?fields=title,updated_at", "Accept-Language", "zh-CN", "If-None-Match", etag)
+		gomega.Expect(resp.StatusCode).To(gomega.Equal(http.StatusOK))
+	})
+
+	ginkgo.It("not send last modified for a list page", func() {
+		resp, _ := get("/books/")
+		gomega.Expect(resp.Header.Get("Last-Modified")).To(gomega.BeEmpty())
+
+		//删除 Book 之后页面中剩余 Book 的 UpdatedAt 不变
+		createBook("Rust", 100)
+		resp, _ = get("/books/")
+		etag := resp.Header.Get("ETag")
+		gomega.Expect(service.GetManager().DeleteBook(2)).To(gomega.Succeed())
+		since := time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+		resp, _ = get("/books/", "If-Modified-Since", since)
+		gomega.Expect(resp.StatusCode).To(gomega.Equal(http.StatusOK))
+		resp, _ = get("/books/", "If-None-Match", etag)
+		gomega.Expect(resp.StatusCode).To(gomega.Equal(http.StatusOK))
+	})
+
+	ginkgo.It("not cache errors", func() {
+		resp, _ := get("/books/99")
+		gomega.Expect(resp.StatusCode).NotTo(gomega.Equal(http.StatusOK))
+		gomega.Expect(resp.Header.Get("ETag")).To(gomega.BeEmpty())
+		gomega.Expect(resp.Header.Get("Cache-Control")).To(gomega.BeEmpty())
+	})
+})
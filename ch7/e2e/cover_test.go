@@ -0,0 +1,62 @@
+package e2e_test
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"os"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/cover"
+)
+
+//uploadCover 以 multipart 表单上传封面，返回状态码
+func uploadCover(path string, data []byte) int {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	part, err := w.CreateFormFile("cover", "cover.png")
+	gomega.Expect(err).NotTo(gomega.HaveOccurred())
+	_, err = part.Write(data)
+	gomega.Expect(err).NotTo(gomega.HaveOccurred())
+	gomega.Expect(w.Close()).To(gomega.Succeed())
+
+	req, err := http.NewRequest(http.MethodPut, server.URL+path, &body)
+	gomega.Expect(err).NotTo(gomega.HaveOccurred())
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	resp, err := http.DefaultClient.Do(req)
+	gomega.Expect(err).NotTo(gomega.HaveOccurred())
+	_ = resp.Body.Close()
+	return resp.StatusCode
+}
+
+var _ = ginkgo.Describe("Covers", func() {
+	ginkgo.BeforeEach(func() {
+		createBook("Go", 100)
+	})
+
+	ginkgo.It("upload a cover & generate thumbnails", func() {
+		var buf bytes.Buffer
+		gomega.Expect(png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 200, 300)))).To(gomega.Succeed())
+		gomega.Expect(uploadCover("/books/1/cover", buf.Bytes())).To(gomega.Equal(http.StatusOK))
+		resp, _ := get("/books/1/cover/small")
+		gomega.Expect(resp.StatusCode).To(gomega.Equal(http.StatusOK))
+	})
+
+	ginkgo.It("remove covers of previous specs on reset", func() {
+		var buf bytes.Buffer
+		gomega.Expect(png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 200, 300)))).To(gomega.Succeed())
+		gomega.Expect(uploadCover("/books/1/cover", buf.Bytes())).To(gomega.Equal(http.StatusOK))
+		gomega.Expect(os.ReadDir(server.CoverDir())).NotTo(gomega.BeEmpty())
+
+		gomega.Expect(server.Reset()).To(gomega.Succeed())
+		gomega.Expect(os.ReadDir(server.CoverDir())).To(gomega.BeEmpty())
+	})
+
+	ginkgo.It("return 413 when the request body is too large", func() {
+		gomega.Expect(uploadCover("/books/1/cover", make([]byte, cover.MaxSize+2<<20))).
+			To(gomega.Equal(http.StatusRequestEntityTooLarge))
+	})
+})
@@ -27,7 +27,7 @@ var _ = ginkgo.Describe("Api", func() {
 		})
 		ginkgo.It("smoking test", func() {
 			ginkgo.By("creating book")
-			urlCrate := fmt.Sprintf("http://%s/books/", address)
+			urlCrate := server.URL + "/books/"
 			content, err := json.Marshal(b)
 			gomega.Expect(err).NotTo(gomega.HaveOccurred())
 			response, err := http.Post(urlCrate, "application/json", bytes.NewBuffer(content))
@@ -52,7 +52,7 @@ var _ = ginkgo.Describe("Api", func() {
 			gomega.Expect(b.Weight).To(gomega.Equal(bookInserted.Data.Weight))
 
 			ginkgo.By("get book")
-			url := fmt.Sprintf("http://%s/books/%d", address, bookInserted.Data.ID)
+			url := fmt.Sprintf("%s/books/%d", server.URL, bookInserted.Data.ID)
 			resp, err := http.Get(url)
 			gomega.Expect(err).NotTo(gomega.HaveOccurred())
 			defer func(Body io.ReadCloser) {
@@ -0,0 +1,41 @@
+package e2e_test
+
+import (
+	"net/http"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/model"
+)
+
+var _ = ginkgo.Describe("Sparse responses", func() {
+	ginkgo.BeforeEach(func() {
+		status := call(http.MethodPost, "/books/", &model.Book{Title: "Les Miserables", Author: "Victor Hugo", Pages: 2783, Weight: 1200}, nil)
+		gomega.Expect(status).To(gomega.Equal(http.StatusOK))
+	})
+
+	ginkgo.It("return only selected fields of a book", func() {
+		var book fields
+		gomega.Expect(call(http.MethodGet, "/books/1?fields=title,first_name,human_weight,catalog", nil, &book)).
+			To(gomega.Equal(http.StatusOK))
+		gomega.Expect(book).To(gomega.Equal(fields{
+			"title":        "Les Miserables",
+			"first_name":   "Victor",
+			"human_weight": "1200g",
+			"catalog":      float64(model.CategoryNovel),
+		}))
+	})
+
+	ginkgo.It("return only selected fields of listed books", func() {
+		var list struct {
+			Books []fields
+		}
+		gomega.Expect(call(http.MethodGet, "/books/?fields=title,author&sort=rating", nil, &list)).To(gomega.Equal(http.StatusOK))
+		gomega.Expect(list.Books).To(gomega.Equal([]fields{{"title": "Les Miserables", "author": "Victor Hugo"}}))
+	})
+
+	ginkgo.It("reject unknown fields", func() {
+		gomega.Expect(call(http.MethodGet, "/books/1?fields=title,tenant_id", nil, nil)).To(gomega.Equal(http.StatusBadRequest))
+		gomega.Expect(call(http.MethodGet, "/books/?fields=password", nil, nil)).To(gomega.Equal(http.StatusBadRequest))
+	})
+})
@@ -0,0 +1,94 @@
+package e2e_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/url"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/api"
+)
+
+//graphqlResponse GraphQL over HTTP 的响应
+type graphqlResponse struct {
+	Data   map[string]interface{}
+	Errors []struct {
+		Message string
+	}
+}
+
+func postGraphQL(query string) (int, *graphqlResponse) {
+	content, err := json.Marshal(map[string]interface{}{"query": query})
+	gomega.Expect(err).NotTo(gomega.HaveOccurred())
+	resp, err := http.Post(server.URL+"/graphql", "application/json", bytes.NewReader(content))
+	gomega.Expect(err).NotTo(gomega.HaveOccurred())
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	var result graphqlResponse
+	gomega.Expect(json.NewDecoder(resp.Body).Decode(&result)).To(gomega.Succeed())
+	return resp.StatusCode, &result
+}
+
+var _ = ginkgo.Describe("GraphQL", func() {
+	ginkgo.It("query books with nested author books & reviews", func() {
+		createBook("first", 100)
+		createBook("second", 400)
+		for _, user := range []string{"alice", "bob", "carol"} {
+			gomega.Expect(call(http.MethodPut, "/books/1/reviews", fields{"rating": 4}, nil, api.UserHeader, user)).
+				To(gomega.Equal(http.StatusOK))
+		}
+
+		status, result := postGraphQL(`{
+			books(sort: ID) {
+				title catalog
+				author { name books(limit: 1) { title } }
+				rating { averageRating reviewCount }
+				reviews(limit: 2) { userId }
+			}
+		}`)
+		gomega.Expect(status).To(gomega.Equal(http.StatusOK))
+		gomega.Expect(result.Errors).To(gomega.BeEmpty())
+		books := result.Data["books"].([]interface{})
+		gomega.Expect(books).To(gomega.HaveLen(2))
+		first := books[0].(map[string]interface{})
+		gomega.Expect(first["catalog"]).To(gomega.Equal("SHORT_STORY"))
+		gomega.Expect(first["author"]).To(gomega.Equal(map[string]interface{}{
+			"name": "test author", "books": []interface{}{map[string]interface{}{"title": "first"}},
+		}))
+		gomega.Expect(first["rating"]).To(gomega.Equal(map[string]interface{}{"averageRating": 4.0, "reviewCount": 3.0}))
+		//最新的两条评价
+		gomega.Expect(first["reviews"]).To(gomega.Equal([]interface{}{
+			map[string]interface{}{"userId": "carol"}, map[string]interface{}{"userId": "bob"},
+		}))
+		gomega.Expect(books[1].(map[string]interface{})["reviews"]).To(gomega.BeEmpty())
+	})
+
+	ginkgo.It("add, update & delete books with mutations", func() {
+		status, result := postGraphQL(`mutation { addBook(input: {title: "Emma", author: "Jane Austen", pages: 474}) { id } }`)
+		gomega.Expect(status).To(gomega.Equal(http.StatusOK))
+		gomega.Expect(result.Errors).To(gomega.BeEmpty())
+
+		_, result = postGraphQL(`mutation { updateBook(id: 1, input: {isbn: "0-14-143958-0"}) { title isbn13 } }`)
+		gomega.Expect(result.Errors).To(gomega.BeEmpty())
+		gomega.Expect(result.Data["updateBook"]).To(gomega.Equal(map[string]interface{}{"title": "Emma", "isbn13": "9780141439587"}))
+
+		_, result = postGraphQL(`mutation { deleteBook(id: 1) }`)
+		gomega.Expect(result.Errors).To(gomega.BeEmpty())
+		_, result = postGraphQL(`{ book(id: 1) { title } }`)
+		gomega.Expect(result.Data).To(gomega.HaveKeyWithValue("book", gomega.BeNil()))
+	})
+
+	ginkgo.It("reject mutations over GET & queries over the limits", func() {
+		resp, err := http.Get(server.URL + "/graphql?query=" + url.QueryEscape(`mutation { deleteBook(id: 1) }`))
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		_ = resp.Body.Close()
+		gomega.Expect(resp.StatusCode).To(gomega.Equal(http.StatusMethodNotAllowed))
+
+		status, result := postGraphQL(`{ books(size: 100) { reviews(limit: 50) { text } } }`)
+		gomega.Expect(status).To(gomega.Equal(http.StatusBadRequest))
+		gomega.Expect(result.Errors[0].Message).To(gomega.Equal("query is too complex"))
+	})
+})
@@ -0,0 +1,186 @@
+package e2e
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/api"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/blobstore"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/service"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+//ReadyTimeout 等待服务就绪的最长时间
+const ReadyTimeout = 10 * time.Second
+
+//Options 启动测试服务的配置
+type Options struct {
+	//DatabaseFile 使用文件保存数据，便于失败后查看；为空时使用内存数据库
+	DatabaseFile string
+	//RequireTenant 拒绝没有租户的请求
+	RequireTenant bool
+}
+
+//Server 在进程内运行的 Book 服务，监听随机端口，使用 SQLite 代替 MySQL
+type Server struct {
+	//URL 服务地址，例如 http://127.0.0.1:34567
+	URL string
+
+	db       *gorm.DB
+	server   *http.Server
+	coverDir string
+}
+
+//Start 初始化数据库与路由，启动服务并等待就绪。服务使用全局的 Manager 与封面存储，
+//同一个进程内同时只能运行一个 Server
+func Start(opts Options) (*Server, error) {
+	dsn := opts.DatabaseFile
+	if dsn == "" {
+		//共享缓存让连接池中的连接访问同一个内存数据库，名字随机避免不同 Server 共用
+		dsn = fmt.Sprintf("file:e2e-%d?mode=memory&cache=shared", rand.Int63())
+	}
+	db, err := gorm.Open(sqlite.Open(dsn+pragmas(dsn)), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		return nil, err
+	}
+	manager := service.NewManager(db)
+	if err := manager.Migrate(); err != nil {
+		return nil, err
+	}
+	service.SetManager(manager)
+	service.SetTenantRequired(opts.RequireTenant)
+
+	coverDir, err := os.MkdirTemp("", "e2e-covers-")
+	if err != nil {
+		return nil, err
+	}
+	store, err := blobstore.NewLocalStore(coverDir)
+	if err != nil {
+		return nil, err
+	}
+	api.SetCoverStore(store)
+
+	gin.SetMode(gin.TestMode)
+	router, err := api.NewRouter(api.RouterOptions{RequireTenant: opts.RequireTenant})
+	if err != nil {
+		return nil, err
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		URL:      "http://" + listener.Addr().String(),
+		db:       db,
+		server:   &http.Server{Handler: router},
+		coverDir: coverDir,
+	}
+	go func() {
+		_ = s.server.Serve(listener)
+	}()
+	if err := s.WaitReady(ReadyTimeout); err != nil {
+		_ = s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+//pragmas 多个连接同时写入时等待锁，而不是立即返回 database is locked
+func pragmas(dsn string) string {
+	sep := "?"
+	for _, c := range dsn {
+		if c == '?' {
+			sep = "&"
+		}
+	}
+	return sep + "_pragma=busy_timeout(5000)&_pragma=foreign_keys(0)"
+}
+
+//WaitReady 轮询 /healthz 直到返回 200 或超时
+func (s *Server) WaitReady(timeout time.Duration) error {
+	client := &http.Client{Timeout: time.Second}
+	deadline := time.Now().Add(timeout)
+	for {
+		resp, err := client.Get(s.URL + "/healthz")
+		if err == nil {
+			_ = resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				return nil
+			}
+			err = fmt.Errorf("healthz returned %d", resp.StatusCode)
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("server is not ready after %s: %w", timeout, err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+//CoverDir 封面存储的目录，Close 时删除
+func (s *Server) CoverDir() string {
+	return s.coverDir
+}
+
+//Reset 清空所有表、重置自增 ID 并删除所有封面，在每个用例之前调用，用例之间不共享数据
+func (s *Server) Reset() error {
+	if err := clearDir(s.coverDir); err != nil {
+		return err
+	}
+	var tables []string
+	err := s.db.Raw("SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%'").
+		Scan(&tables).Error
+	if err != nil {
+		return err
+	}
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		for _, table := range tables {
+			if err := tx.Exec("DELETE FROM " + tx.Statement.Quote(table)).Error; err != nil {
+				return err
+			}
+		}
+		//只有使用 AUTOINCREMENT 的表才会创建 sqlite_sequence
+		if tx.Migrator().HasTable("sqlite_sequence") {
+			return tx.Exec("DELETE FROM sqlite_sequence").Error
+		}
+		return nil
+	})
+}
+
+//clearDir 删除目录中的所有文件，保留目录本身
+func clearDir(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := os.RemoveAll(filepath.Join(dir, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//Close 停止服务，关闭数据库并删除封面目录
+func (s *Server) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := s.server.Shutdown(ctx)
+	if errors.Is(err, http.ErrServerClosed) {
+		err = nil
+	}
+	if db, dbErr := s.db.DB(); dbErr == nil {
+		_ = db.Close()
+	}
+	_ = os.RemoveAll(s.coverDir)
+	return err
+}
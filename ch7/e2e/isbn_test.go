@@ -0,0 +1,49 @@
+package e2e_test
+
+import (
+	"net/http"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/model"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/service"
+)
+
+var _ = ginkgo.Describe("ISBN", func() {
+	emma := func() *model.Book {
+		return &model.Book{Title: "Emma", Author: "Jane Austen", Pages: 474, ISBN10: "0-14-143958-0"}
+	}
+
+	ginkgo.It("reject a duplicate isbn of a live book", func() {
+		gomega.Expect(call(http.MethodPost, "/books/", emma(), nil)).To(gomega.Equal(http.StatusOK))
+		gomega.Expect(call(http.MethodPost, "/books/", emma(), nil)).To(gomega.Equal(http.StatusConflict))
+	})
+
+	ginkgo.It("add the isbn of a deleted book again", func() {
+		var book model.Book
+		gomega.Expect(call(http.MethodPost, "/books/", emma(), &book)).To(gomega.Equal(http.StatusOK))
+		gomega.Expect(service.GetManager().DeleteBook(book.ID)).To(gomega.Succeed())
+
+		var added model.Book
+		gomega.Expect(call(http.MethodPost, "/books/", emma(), &added)).To(gomega.Equal(http.StatusOK))
+		gomega.Expect(added.ISBN13).To(gomega.Equal(model.ISBN("9780141439587")))
+		gomega.Expect(call(http.MethodGet, "/books/isbn/9780141439587", nil, &book)).To(gomega.Equal(http.StatusOK))
+		gomega.Expect(book.ID).To(gomega.Equal(added.ID))
+	})
+
+	ginkgo.It("add the isbn of a deleted book again within a tenant", func() {
+		for _, tenantId := range []string{"acme", "globex"} {
+			gomega.Expect(service.GetManager().CreateTenant(&model.Tenant{ID: tenantId})).To(gomega.Succeed())
+		}
+		var book model.Book
+		gomega.Expect(call(http.MethodPost, "/books/", emma(), &book, "X-Tenant-ID", "acme")).To(gomega.Equal(http.StatusOK))
+		gomega.Expect(call(http.MethodPost, "/books/", emma(), nil, "X-Tenant-ID", "globex")).To(gomega.Equal(http.StatusOK))
+		gomega.Expect(call(http.MethodPost, "/books/", emma(), nil, "X-Tenant-ID", "acme")).To(gomega.Equal(http.StatusConflict))
+
+		gomega.Expect(service.GetManager().ForTenant("acme").DeleteBook(book.ID)).To(gomega.Succeed())
+		gomega.Expect(call(http.MethodPost, "/books/", emma(), nil, "X-Tenant-ID", "acme")).To(gomega.Equal(http.StatusOK))
+		//其他租户的 Book 不受影响
+		gomega.Expect(call(http.MethodGet, "/books/isbn/9780141439587", nil, &book, "X-Tenant-ID", "globex")).To(gomega.Equal(http.StatusOK))
+		gomega.Expect(book.ISBN13).To(gomega.Equal(model.ISBN("9780141439587")))
+	})
+})
@@ -0,0 +1,111 @@
+package e2e_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/api"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/model"
+)
+
+//call 发送 JSON 请求，data 不为空时解析响应中的 data，返回状态码
+func call(method, path string, body interface{}, data interface{}, headers ...string) int {
+	var reader io.Reader
+	if body != nil {
+		content, err := json.Marshal(body)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		reader = bytes.NewReader(content)
+	}
+	req, err := http.NewRequest(method, server.URL+path, reader)
+	gomega.Expect(err).NotTo(gomega.HaveOccurred())
+	req.Header.Set("Content-Type", "application/json")
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	resp, err := http.DefaultClient.Do(req)
+	gomega.Expect(err).NotTo(gomega.HaveOccurred())
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if data != nil {
+		var response struct {
+			Data json.RawMessage
+		}
+		gomega.Expect(json.NewDecoder(resp.Body).Decode(&response)).To(gomega.Succeed())
+		gomega.Expect(json.Unmarshal(response.Data, data)).To(gomega.Succeed())
+	}
+	return resp.StatusCode
+}
+
+func createBook(title string, pages int32) *model.Book {
+	var book model.Book
+	status := call(http.MethodPost, "/books/", &model.Book{Title: title, Author: "test author", Pages: pages}, &book)
+	gomega.Expect(status).To(gomega.Equal(http.StatusOK))
+	return &book
+}
+
+var _ = ginkgo.Describe("Library", func() {
+	ginkgo.Describe("state between specs", func() {
+		//两个用例都从空库开始，自增 ID 也被重置
+		for _, title := range []string{"first", "second"} {
+			title := title
+			ginkgo.It("start from an empty database for "+title, func() {
+				var list struct {
+					Books []*model.Book
+				}
+				gomega.Expect(call(http.MethodGet, "/books/", nil, &list)).To(gomega.Equal(http.StatusOK))
+				gomega.Expect(list.Books).To(gomega.BeEmpty())
+				gomega.Expect(createBook(title, 100).ID).To(gomega.Equal(uint(1)))
+			})
+		}
+	})
+
+	ginkgo.Describe("reviews", func() {
+		ginkgo.It("sort books by rating", func() {
+			low, high := createBook("low", 100), createBook("high", 100)
+			for user, rating := range map[string]int{"alice": 2, "bob": 3} {
+				gomega.Expect(call(http.MethodPut, "/books/1/reviews", fields{"rating": rating}, nil, api.UserHeader, user)).
+					To(gomega.Equal(http.StatusOK))
+			}
+			//同一个用户再次评价时覆盖之前的评分
+			for _, rating := range []int{1, 5} {
+				gomega.Expect(call(http.MethodPut, "/books/2/reviews", fields{"rating": rating}, nil, api.UserHeader, "alice")).
+					To(gomega.Equal(http.StatusOK))
+			}
+
+			var list struct {
+				Books []*model.Book
+			}
+			gomega.Expect(call(http.MethodGet, "/books/?sort=rating", nil, &list)).To(gomega.Equal(http.StatusOK))
+			gomega.Expect(list.Books).To(gomega.HaveLen(2))
+			gomega.Expect(list.Books[0].ID).To(gomega.Equal(high.ID))
+			gomega.Expect(list.Books[0].AverageRating).To(gomega.Equal(5.0))
+			gomega.Expect(list.Books[0].ReviewCount).To(gomega.Equal(int64(1)))
+			gomega.Expect(list.Books[1].ID).To(gomega.Equal(low.ID))
+			gomega.Expect(list.Books[1].AverageRating).To(gomega.Equal(2.5))
+		})
+	})
+
+	ginkgo.Describe("lending", func() {
+		ginkgo.It("checkout the last copy & reject the next member", func() {
+			book := createBook("lending", 100)
+			gomega.Expect(call(http.MethodPut, "/books/1/holdings", fields{"copies": 1}, nil)).To(gomega.Equal(http.StatusOK))
+			var member model.Member
+			for _, name := range []string{"alice", "bob"} {
+				gomega.Expect(call(http.MethodPost, "/members/", fields{"name": name}, &member)).To(gomega.Equal(http.StatusOK))
+			}
+
+			var loan model.Loan
+			gomega.Expect(call(http.MethodPost, "/books/1/checkout", fields{"member_id": 1}, &loan)).To(gomega.Equal(http.StatusOK))
+			gomega.Expect(loan.BookID).To(gomega.Equal(book.ID))
+			gomega.Expect(call(http.MethodPost, "/books/1/checkout", fields{"member_id": member.ID}, nil)).To(gomega.Equal(http.StatusConflict))
+		})
+	})
+})
+
+//fields 请求体的简写
+type fields map[string]interface{}
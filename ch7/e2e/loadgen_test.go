@@ -0,0 +1,47 @@
+package e2e_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/loadgen"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/model"
+)
+
+var _ = ginkgo.Describe("Load", func() {
+	ginkgo.Describe("update book", func() {
+		ginkgo.It("update non-zero fields & return the book", func() {
+			book := createBook("before", 120)
+			var updated model.Book
+			status := call(http.MethodPatch, fmt.Sprintf("/books/%d", book.ID), &model.Book{Title: "after", Weight: 250}, &updated)
+			gomega.Expect(status).To(gomega.Equal(http.StatusOK))
+			gomega.Expect(updated.Title).To(gomega.Equal("after"))
+			gomega.Expect(updated.Weight).To(gomega.Equal(int32(250)))
+			gomega.Expect(updated.Pages).To(gomega.Equal(int32(120)))
+		})
+		ginkgo.It("not replace books by put", func() {
+			book := createBook("before", 120)
+			status := call(http.MethodPut, fmt.Sprintf("/books/%d", book.ID), &model.Book{Title: "after"}, nil)
+			gomega.Expect(status).NotTo(gomega.Equal(http.StatusOK))
+		})
+		ginkgo.It("return 404 for missing book", func() {
+			status := call(http.MethodPatch, "/books/404", &model.Book{Title: "after"}, nil)
+			gomega.Expect(status).To(gomega.Equal(http.StatusNotFound))
+		})
+	})
+
+	ginkgo.It("run the default mix without errors", func() {
+		mix, err := loadgen.ParseMix(loadgen.DefaultMix)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		report, err := loadgen.Run(context.Background(), loadgen.Config{
+			BaseURL: server.URL, RPS: 100, Duration: 500 * time.Millisecond, Mix: mix, Seed: 1, Prefill: 10,
+		})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(report.Total.Requests).To(gomega.Equal(int64(50)))
+		gomega.Expect(report.Total.Status).To(gomega.Equal(map[string]int64{"200": 50}))
+	})
+})
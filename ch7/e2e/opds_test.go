@@ -0,0 +1,34 @@
+package e2e_test
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"net/http"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("OPDS", func() {
+	ginkgo.It("link covers of the books in a page", func() {
+		createBook("Go", 100)
+		createBook("Rust", 100)
+		var buf bytes.Buffer
+		gomega.Expect(png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 200, 300)))).To(gomega.Succeed())
+		gomega.Expect(uploadCover("/books/1/cover", buf.Bytes())).To(gomega.Equal(http.StatusOK))
+
+		resp, body := get("/opds/books")
+		gomega.Expect(resp.StatusCode).To(gomega.Equal(http.StatusOK))
+		gomega.Expect(string(body)).To(gomega.ContainSubstring(`href="/books/1/cover/original"`))
+		gomega.Expect(string(body)).To(gomega.ContainSubstring(`href="/books/1/cover/small"`))
+		gomega.Expect(string(body)).NotTo(gomega.ContainSubstring("/books/2/cover"))
+	})
+
+	ginkgo.It("use the current time as updated of an empty page", func() {
+		resp, body := get("/opds/books")
+		gomega.Expect(resp.StatusCode).To(gomega.Equal(http.StatusOK))
+		gomega.Expect(string(body)).To(gomega.ContainSubstring("<updated>"))
+		gomega.Expect(string(body)).NotTo(gomega.ContainSubstring("0001-01-01"))
+	})
+})
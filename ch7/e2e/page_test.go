@@ -0,0 +1,45 @@
+package e2e_test
+
+import (
+	"net/http"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("Pagination", func() {
+	//expectPageValidation 检查 path 的分页参数，path 不带查询参数
+	expectPageValidation := func(path string) {
+		for _, query := range []string{"page_size=0", "page_size=101", "page_size=abc", "page_number=-1"} {
+			resp, _ := get(path + "?" + query)
+			gomega.Expect(resp.StatusCode).To(gomega.Equal(http.StatusBadRequest), query)
+		}
+		resp, _ := get(path + "?page_number=1&page_size=100")
+		gomega.Expect(resp.StatusCode).To(gomega.Equal(http.StatusOK))
+	}
+
+	ginkgo.It("validate pages of webhook deliveries", func() {
+		expectPageValidation("/webhooks/1/deliveries")
+	})
+
+	ginkgo.It("validate pages of stock", func() {
+		createBook("Go", 100)
+		expectPageValidation("/books/stock/low")
+		expectPageValidation("/books/1/stock/movements")
+	})
+
+	ginkgo.It("validate pages of loans", func() {
+		expectPageValidation("/members/1/loans")
+		expectPageValidation("/loans/overdue")
+	})
+
+	ginkgo.It("validate pages of reviews", func() {
+		createBook("Go", 100)
+		expectPageValidation("/books/1/reviews")
+	})
+
+	ginkgo.It("validate pages of books", func() {
+		expectPageValidation("/books/")
+		expectPageValidation("/opds/books")
+	})
+})
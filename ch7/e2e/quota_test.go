@@ -0,0 +1,48 @@
+package e2e_test
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/model"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/service"
+)
+
+var _ = ginkgo.Describe("tenant quota", func() {
+	ginkgo.It("not exceed the quota with concurrent creates", func() {
+		const maxBooks, clients = 3, 10
+		gomega.Expect(service.GetManager().CreateTenant(&model.Tenant{ID: "acme", MaxBooks: maxBooks})).To(gomega.Succeed())
+
+		statuses := make([]int, clients)
+		var wg sync.WaitGroup
+		for i := 0; i < clients; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer ginkgo.GinkgoRecover()
+				defer wg.Done()
+				book := &model.Book{Title: fmt.Sprintf("book %d", i), Author: "test author", Pages: 10}
+				statuses[i] = call(http.MethodPost, "/books/", book, nil, "X-Tenant-ID", "acme")
+			}(i)
+		}
+		wg.Wait()
+		//并发请求时可能建立了没有发送过请求的连接，服务端关闭时会一直等待它们
+		http.DefaultClient.CloseIdleConnections()
+
+		created := 0
+		for _, status := range statuses {
+			if status == http.StatusOK {
+				created++
+			}
+		}
+		gomega.Expect(created).To(gomega.Equal(maxBooks))
+		gomega.Expect(statuses).To(gomega.ContainElement(http.StatusForbidden))
+		var list struct {
+			Books []*model.Book
+		}
+		gomega.Expect(call(http.MethodGet, "/books/", nil, &list, "X-Tenant-ID", "acme")).To(gomega.Equal(http.StatusOK))
+		gomega.Expect(list.Books).To(gomega.HaveLen(maxBooks))
+	})
+})
@@ -0,0 +1,110 @@
+package feed_test
+
+import (
+	"bytes"
+	"encoding/xml"
+	"time"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/feed"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/model"
+	"gorm.io/gorm"
+)
+
+//atomFeed 按照命名空间解析 feed，验证输出的 XML 是合法的 Atom
+type atomFeed struct {
+	XMLName xml.Name `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string   `xml:"http://www.w3.org/2005/Atom id"`
+	Links   []struct {
+		Rel  string `xml:"rel,attr"`
+		Href string `xml:"href,attr"`
+	} `xml:"http://www.w3.org/2005/Atom link"`
+	Entries []struct {
+		ID          string   `xml:"http://www.w3.org/2005/Atom id"`
+		Title       string   `xml:"http://www.w3.org/2005/Atom title"`
+		Author      string   `xml:"http://www.w3.org/2005/Atom author>name"`
+		Identifiers []string `xml:"http://purl.org/dc/terms/ identifier"`
+		Links       []struct {
+			Rel  string `xml:"rel,attr"`
+			Href string `xml:"href,attr"`
+		} `xml:"http://www.w3.org/2005/Atom link"`
+	} `xml:"http://www.w3.org/2005/Atom entry"`
+}
+
+var _ = ginkgo.Describe("feed", func() {
+	updated := time.Date(2022, 5, 1, 10, 0, 0, 0, time.UTC)
+	book := &model.Book{
+		Model:  gorm.Model{ID: 7, UpdatedAt: updated},
+		Title:  "Les Misérables",
+		Author: "Victor Marie Hugo",
+		Pages:  1463,
+		ISBN10: "0451419431",
+		ISBN13: "9780451419439",
+	}
+
+	ginkgo.Describe("opds", func() {
+		ginkgo.It("stream an acquisition feed with namespaced entries", func() {
+			var buf bytes.Buffer
+			w, err := feed.NewWriter(&buf, feed.Feed{
+				ID:      "urn:books",
+				Title:   "Books",
+				Updated: updated,
+				Links:   []feed.Link{{Rel: "next", Href: "/opds/books?page_number=1", Type: feed.AcquisitionType}},
+			})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(w.WriteEntry(feed.BookEntry(book, feed.Link{Rel: feed.RelBorrow, Href: "/books/7/checkout"}))).To(gomega.Succeed())
+			gomega.Expect(w.WriteEntry(feed.BookEntry(&model.Book{Model: gorm.Model{ID: 8}, Title: "Untitled"}))).To(gomega.Succeed())
+			gomega.Expect(w.Close()).To(gomega.Succeed())
+
+			var parsed atomFeed
+			gomega.Expect(xml.Unmarshal(buf.Bytes(), &parsed)).To(gomega.Succeed())
+			gomega.Expect(parsed.ID).To(gomega.Equal("urn:books"))
+			gomega.Expect(parsed.Links[0].Rel).To(gomega.Equal("next"))
+			gomega.Expect(parsed.Entries).To(gomega.HaveLen(2))
+			gomega.Expect(parsed.Entries[0].ID).To(gomega.Equal("urn:isbn:9780451419439"))
+			gomega.Expect(parsed.Entries[0].Author).To(gomega.Equal("Victor Marie Hugo"))
+			gomega.Expect(parsed.Entries[0].Identifiers).To(gomega.Equal([]string{"urn:isbn:9780451419439", "urn:isbn:0451419431"}))
+			gomega.Expect(parsed.Entries[0].Links[0].Rel).To(gomega.Equal(feed.RelBorrow))
+			gomega.Expect(parsed.Entries[1].ID).To(gomega.Equal("urn:book:8"))
+		})
+	})
+
+	ginkgo.Describe("marc", func() {
+		ginkgo.It("map book fields to marc tags", func() {
+			record := feed.BookRecord(book)
+			gomega.Expect(record.ControlFields).To(gomega.ContainElement(feed.ControlField{Tag: "001", Value: "7"}))
+			gomega.Expect(record.ControlFields).To(gomega.ContainElement(feed.ControlField{Tag: "005", Value: "20220501100000.0"}))
+
+			fields := map[string][]string{}
+			for _, field := range record.DataFields {
+				fields[field.Tag+field.Ind1+field.Ind2] = append(fields[field.Tag+field.Ind1+field.Ind2], field.Subfields[0].Value)
+			}
+			gomega.Expect(fields).To(gomega.Equal(map[string][]string{
+				"020  ": {"9780451419439", "0451419431"},
+				"1001 ": {"Hugo, Victor Marie"},
+				"24510": {"Les Misérables"},
+				"300  ": {"1463 p."},
+				"655 4": {"Novel"},
+			}))
+		})
+
+		ginkgo.It("stream records in a collection", func() {
+			var buf bytes.Buffer
+			w, err := feed.NewMARCWriter(&buf)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(w.Write(book)).To(gomega.Succeed())
+			gomega.Expect(w.Write(&model.Book{Model: gorm.Model{ID: 8}, Title: "Anonymous", Pages: 20})).To(gomega.Succeed())
+			gomega.Expect(w.Close()).To(gomega.Succeed())
+
+			var collection struct {
+				XMLName xml.Name      `xml:"http://www.loc.gov/MARC21/slim collection"`
+				Records []feed.Record `xml:"http://www.loc.gov/MARC21/slim record"`
+			}
+			gomega.Expect(xml.Unmarshal(buf.Bytes(), &collection)).To(gomega.Succeed())
+			gomega.Expect(collection.Records).To(gomega.HaveLen(2))
+			gomega.Expect(collection.Records[1].DataFields[0].Tag).To(gomega.Equal("245"))
+			gomega.Expect(collection.Records[1].DataFields[0].Ind1).To(gomega.Equal("0"))
+		})
+	})
+})
@@ -0,0 +1,130 @@
+package feed
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/model"
+)
+
+//MARCNamespace MARCXML 命名空间
+const MARCNamespace = "http://www.loc.gov/MARC21/slim"
+
+//marcLeader 图书（a）专著（m）的记录头，长度与基地址在 MARCXML 中不需要计算
+const marcLeader = "00000nam a2200000 a 4500"
+
+//ControlField MARC 控制字段
+type ControlField struct {
+	Tag   string `xml:"tag,attr"`
+	Value string `xml:",chardata"`
+}
+
+//Subfield MARC 子字段
+type Subfield struct {
+	Code  string `xml:"code,attr"`
+	Value string `xml:",chardata"`
+}
+
+//DataField MARC 数据字段
+type DataField struct {
+	Tag       string     `xml:"tag,attr"`
+	Ind1      string     `xml:"ind1,attr"`
+	Ind2      string     `xml:"ind2,attr"`
+	Subfields []Subfield `xml:"subfield"`
+}
+
+//Record MARC 记录
+type Record struct {
+	XMLName       xml.Name       `xml:"record"`
+	Leader        string         `xml:"leader"`
+	ControlFields []ControlField `xml:"controlfield"`
+	DataFields    []DataField    `xml:"datafield"`
+}
+
+//BookRecord 将 Book 转换为 MARC 记录：
+//001 ID、005 更新时间、020 ISBN、100 主要作者、245 题名、300 页数、655 类型
+func BookRecord(book *model.Book) *Record {
+	record := &Record{
+		Leader: marcLeader,
+		ControlFields: []ControlField{
+			{Tag: "001", Value: fmt.Sprint(book.ID)},
+			{Tag: "005", Value: book.UpdatedAt.UTC().Format("20060102150405.0")},
+		},
+	}
+	for _, isbn := range []model.ISBN{book.ISBN13, book.ISBN10} {
+		if isbn != "" {
+			record.DataFields = append(record.DataFields, dataField("020", " ", " ", "a", string(isbn)))
+		}
+	}
+	//有主要作者时题名不作为主要款目，245 第一指示符为 1
+	titleAdded := "0"
+	if book.IsValid() {
+		titleAdded = "1"
+		record.DataFields = append(record.DataFields, dataField("100", "1", " ", "a", invertedName(book)))
+	}
+	record.DataFields = append(record.DataFields, dataField("245", titleAdded, "0", "a", book.Title))
+	if book.Pages > 0 {
+		record.DataFields = append(record.DataFields, dataField("300", " ", " ", "a", fmt.Sprintf("%d p.", book.Pages)))
+	}
+	genre := "Novel"
+	if book.Catalog() == model.CategoryShortStory {
+		genre = "Short story"
+	}
+	record.DataFields = append(record.DataFields, dataField("655", " ", "4", "a", genre))
+	return record
+}
+
+func dataField(tag, ind1, ind2, code, value string) DataField {
+	return DataField{Tag: tag, Ind1: ind1, Ind2: ind2, Subfields: []Subfield{{Code: code, Value: value}}}
+}
+
+//invertedName 返回 "姓, 名 中间名" 形式的作者名
+func invertedName(book *model.Book) string {
+	given := strings.TrimSpace(book.FirstName() + " " + book.MiddleName())
+	if given == "" {
+		return book.LastName()
+	}
+	return book.LastName() + ", " + given
+}
+
+//MARCWriter 流式写入 MARCXML collection
+type MARCWriter struct {
+	enc  *xml.Encoder
+	root xml.StartElement
+}
+
+//NewMARCWriter 写入 collection 的开始标签
+func NewMARCWriter(w io.Writer) (*MARCWriter, error) {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return nil, err
+	}
+	writer := &MARCWriter{
+		enc: xml.NewEncoder(w),
+		root: xml.StartElement{
+			Name: xml.Name{Local: "collection"},
+			Attr: []xml.Attr{{Name: xml.Name{Local: "xmlns"}, Value: MARCNamespace}},
+		},
+	}
+	if err := writer.enc.EncodeToken(writer.root); err != nil {
+		return nil, err
+	}
+	return writer, writer.enc.Flush()
+}
+
+//Write 写入一本 Book
+func (w *MARCWriter) Write(book *model.Book) error {
+	if err := w.enc.Encode(BookRecord(book)); err != nil {
+		return err
+	}
+	return w.enc.Flush()
+}
+
+//Close 结束 collection，不会关闭底层的 io.Writer
+func (w *MARCWriter) Close() error {
+	if err := w.enc.EncodeToken(w.root.End()); err != nil {
+		return err
+	}
+	return w.enc.Flush()
+}
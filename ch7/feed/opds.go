@@ -0,0 +1,171 @@
+package feed
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/model"
+)
+
+const (
+	AtomNamespace = "http://www.w3.org/2005/Atom"       //AtomNamespace Atom 命名空间，feed 的默认命名空间
+	OPDSNamespace = "http://opds-spec.org/2010/catalog" //OPDSNamespace OPDS 命名空间
+	DCNamespace   = "http://purl.org/dc/terms/"         //DCNamespace Dublin Core 命名空间
+
+	NavigationType  = "application/atom+xml;profile=opds-catalog;kind=navigation"  //NavigationType 导航 feed
+	AcquisitionType = "application/atom+xml;profile=opds-catalog;kind=acquisition" //AcquisitionType 获取 feed
+
+	RelImage     = "http://opds-spec.org/image"              //RelImage 封面
+	RelThumbnail = "http://opds-spec.org/image/thumbnail"    //RelThumbnail 封面缩略图
+	RelBorrow    = "http://opds-spec.org/acquisition/borrow" //RelBorrow 借阅
+	RelSortNew   = "http://opds-spec.org/sort/new"           //RelSortNew 最新
+	RelSortPop   = "http://opds-spec.org/sort/popular"       //RelSortPop 最受欢迎
+)
+
+//Link Atom 链接
+type Link struct {
+	XMLName xml.Name `xml:"link"`
+	Rel     string   `xml:"rel,attr,omitempty"`
+	Href    string   `xml:"href,attr"`
+	Type    string   `xml:"type,attr,omitempty"`
+	Title   string   `xml:"title,attr,omitempty"`
+}
+
+//Person Atom 作者
+type Person struct {
+	Name string `xml:"name"`
+}
+
+//Text Atom 文本内容
+type Text struct {
+	Type string `xml:"type,attr,omitempty"`
+	Body string `xml:",chardata"`
+}
+
+//Entry Atom 条目，dc 前缀在 feed 根节点声明
+type Entry struct {
+	XMLName     xml.Name  `xml:"entry"`
+	ID          string    `xml:"id"`
+	Title       string    `xml:"title"`
+	Updated     time.Time `xml:"updated"`
+	Authors     []Person  `xml:"author"`
+	Identifiers []string  `xml:"dc:identifier"`
+	Language    string    `xml:"dc:language,omitempty"`
+	Summary     *Text     `xml:"summary,omitempty"`
+	Content     *Text     `xml:"content,omitempty"`
+	Links       []Link    `xml:"link"`
+}
+
+//Feed feed 的头部信息，条目通过 Writer.WriteEntry 逐条写入
+type Feed struct {
+	ID      string
+	Title   string
+	Updated time.Time
+	Links   []Link
+}
+
+//Writer 流式写入 Atom feed，写入的条目不会在内存中保留
+type Writer struct {
+	enc  *xml.Encoder
+	root xml.StartElement
+}
+
+//NewWriter 写入 feed 的头部
+func NewWriter(w io.Writer, feed Feed) (*Writer, error) {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return nil, err
+	}
+	writer := &Writer{
+		enc: xml.NewEncoder(w),
+		root: xml.StartElement{
+			Name: xml.Name{Local: "feed"},
+			Attr: []xml.Attr{
+				{Name: xml.Name{Local: "xmlns"}, Value: AtomNamespace},
+				{Name: xml.Name{Local: "xmlns:opds"}, Value: OPDSNamespace},
+				{Name: xml.Name{Local: "xmlns:dc"}, Value: DCNamespace},
+			},
+		},
+	}
+	if err := writer.enc.EncodeToken(writer.root); err != nil {
+		return nil, err
+	}
+	header := []struct {
+		name  string
+		value interface{}
+	}{
+		{"id", feed.ID},
+		{"title", feed.Title},
+		{"updated", feed.Updated},
+	}
+	for _, element := range header {
+		if err := writer.enc.EncodeElement(element.value, xml.StartElement{Name: xml.Name{Local: element.name}}); err != nil {
+			return nil, err
+		}
+	}
+	for _, link := range feed.Links {
+		if err := writer.enc.Encode(link); err != nil {
+			return nil, err
+		}
+	}
+	return writer, writer.enc.Flush()
+}
+
+//WriteEntry 写入一个条目
+func (w *Writer) WriteEntry(entry *Entry) error {
+	if err := w.enc.Encode(entry); err != nil {
+		return err
+	}
+	return w.enc.Flush()
+}
+
+//Close 结束 feed，不会关闭底层的 io.Writer
+func (w *Writer) Close() error {
+	if err := w.enc.EncodeToken(w.root.End()); err != nil {
+		return err
+	}
+	return w.enc.Flush()
+}
+
+//BookID 返回 Book 在 feed 中的唯一标识，有 ISBN 时使用 urn:isbn
+func BookID(book *model.Book) string {
+	if book.ISBN13 != "" {
+		return "urn:isbn:" + string(book.ISBN13)
+	}
+	return fmt.Sprintf("urn:book:%d", book.ID)
+}
+
+//BookEntry 返回 Book 的获取条目，links 为 Book 详情、封面、借阅等链接
+func BookEntry(book *model.Book, links ...Link) *Entry {
+	entry := &Entry{
+		ID:       BookID(book),
+		Title:    book.Title,
+		Updated:  book.UpdatedAt,
+		Language: book.Language,
+		Links:    links,
+	}
+	if book.Author != "" {
+		entry.Authors = []Person{{Name: book.Author}}
+	}
+	for _, isbn := range []model.ISBN{book.ISBN13, book.ISBN10} {
+		if isbn != "" {
+			entry.Identifiers = append(entry.Identifiers, "urn:isbn:"+string(isbn))
+		}
+	}
+	if book.Description != "" {
+		entry.Summary = &Text{Type: "text", Body: book.Description}
+	}
+	return entry
+}
+
+//NavigationEntry 返回指向另一个 feed 的导航条目
+func NavigationEntry(id, title, content string, updated time.Time, link Link) *Entry {
+	return &Entry{
+		ID:      id,
+		Title:   title,
+		Updated: updated,
+		Content: &Text{Type: "text", Body: content},
+		Links:   []Link{link},
+	}
+}
@@ -0,0 +1,128 @@
+package gql
+
+import (
+	"context"
+	"errors"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/model"
+	"gorm.io/gorm"
+)
+
+const (
+	DefaultMaxDepth              = 8    //DefaultMaxDepth 默认允许的最大嵌套层数
+	DefaultMaxIntrospectionDepth = 15   //DefaultMaxIntrospectionDepth 默认允许的内省最大嵌套层数，足够执行常用工具的内省查询
+	DefaultMaxComplexity         = 1000 //DefaultMaxComplexity 默认允许的最大复杂度
+)
+
+//Store GraphQL 查询使用的数据，由 service.Manager 实现。
+//批量方法一次返回多个 Book 的数据，用于 dataloader 合并同一层字段的查询
+type Store interface {
+	GetBook(bookId uint) (*model.Book, error)
+	ListBooks(q model.BookQuery) ([]*model.Book, error)
+	AddBook(book *model.Book) error
+	UpdateBook(book *model.Book) error
+	DeleteBook(bookId uint) error
+	BooksByAuthors(authors []string, limit int) (map[string][]*model.Book, error)
+	ReviewsByBooks(bookIds []uint, limit int) (map[uint][]*model.Review, error)
+	RatingsByBooks(bookIds []uint) (map[uint]*model.BookRating, error)
+	StockByBooks(bookIds []uint) (map[uint][]*model.Inventory, error)
+}
+
+//Request GraphQL over HTTP 的请求
+type Request struct {
+	Query         string                 `json:"query" form:"query"`
+	OperationName string                 `json:"operationName" form:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+//Executor 校验查询的深度与复杂度后执行查询
+type Executor struct {
+	//MaxDepth 允许的最大嵌套层数，不计算内省字段
+	MaxDepth int
+	//MaxIntrospectionDepth 内省字段（__schema、__type）允许的最大嵌套层数
+	MaxIntrospectionDepth int
+	//MaxComplexity 允许的最大复杂度，列表字段的子字段按照 size/limit 倍数计算
+	MaxComplexity int
+
+	schema graphql.Schema
+}
+
+func NewExecutor() (*Executor, error) {
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{
+		Query:    queryType(),
+		Mutation: mutationType(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Executor{
+		MaxDepth:              DefaultMaxDepth,
+		MaxIntrospectionDepth: DefaultMaxIntrospectionDepth,
+		MaxComplexity:         DefaultMaxComplexity,
+		schema:                schema,
+	}, nil
+}
+
+//Operation 通过 Prepare 检查的请求，保存解析后的文档，执行时不需要再次解析
+type Operation struct {
+	//Type 要执行的操作类型：query 或 mutation
+	Type string
+
+	req Request
+	doc *ast.Document
+}
+
+//Prepare 解析查询并检查限制，返回可以通过 Run 执行的操作
+func (e *Executor) Prepare(req Request) (*Operation, error) {
+	doc, err := parser.Parse(parser.ParseParams{Source: source.NewSource(&source.Source{
+		Body: []byte(req.Query),
+		Name: "GraphQL request",
+	})})
+	if err != nil {
+		return nil, err
+	}
+	operation, c, err := analyze(doc, req.OperationName, req.Variables)
+	if err != nil {
+		return nil, err
+	}
+	if c.depth > e.MaxDepth || c.introspectionDepth > e.MaxIntrospectionDepth {
+		return nil, ErrTooDeep
+	}
+	if c.complexity > e.MaxComplexity {
+		return nil, ErrTooComplex
+	}
+	return &Operation{Type: operation.Operation, req: req, doc: doc}, nil
+}
+
+//Run 使用 store 执行 Prepare 返回的操作，按照 schema 校验之后执行，每次执行使用独立的 dataloader
+func (e *Executor) Run(ctx context.Context, store Store, op *Operation) *graphql.Result {
+	if validation := graphql.ValidateDocument(&e.schema, op.doc, nil); !validation.IsValid {
+		return &graphql.Result{Errors: validation.Errors}
+	}
+	return graphql.Execute(graphql.ExecuteParams{
+		Schema:        e.schema,
+		AST:           op.doc,
+		OperationName: op.req.OperationName,
+		Args:          op.req.Variables,
+		Context:       withLoaders(ctx, newLoaders(store)),
+	})
+}
+
+//Execute 检查并执行请求，相当于 Prepare 之后 Run
+func (e *Executor) Execute(ctx context.Context, store Store, req Request) *graphql.Result {
+	op, err := e.Prepare(req)
+	if err != nil {
+		return &graphql.Result{Errors: []gqlerrors.FormattedError{gqlerrors.FormatError(err)}}
+	}
+	return e.Run(ctx, store, op)
+}
+
+func isNotFound(err error) bool {
+	return errors.Is(err, gorm.ErrRecordNotFound)
+}
+
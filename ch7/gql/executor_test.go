@@ -0,0 +1,264 @@
+package gql_test
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/gql"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/model"
+	"gorm.io/gorm"
+)
+
+//memoryStore 测试用的 Store，记录每个批量方法的调用参数
+type memoryStore struct {
+	books   []*model.Book
+	reviews []*model.Review
+	calls   map[string][]interface{}
+}
+
+func (s *memoryStore) record(method string, arg interface{}) {
+	s.calls[method] = append(s.calls[method], arg)
+}
+
+func (s *memoryStore) GetBook(bookId uint) (*model.Book, error) {
+	s.record("GetBook", bookId)
+	for _, book := range s.books {
+		if book.ID == bookId {
+			copied := *book
+			return &copied, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (s *memoryStore) ListBooks(q model.BookQuery) ([]*model.Book, error) {
+	s.record("ListBooks", q)
+	if len(s.books) > q.PageSize {
+		return s.books[:q.PageSize], nil
+	}
+	return s.books, nil
+}
+
+func (s *memoryStore) AddBook(book *model.Book) error {
+	book.ID = uint(len(s.books) + 1)
+	s.books = append(s.books, book)
+	return nil
+}
+
+func (s *memoryStore) UpdateBook(book *model.Book) error {
+	for i, b := range s.books {
+		if b.ID == book.ID {
+			s.books[i] = book
+		}
+	}
+	return nil
+}
+
+func (s *memoryStore) DeleteBook(bookId uint) error {
+	s.record("DeleteBook", bookId)
+	return nil
+}
+
+func (s *memoryStore) BooksByAuthors(authors []string, limit int) (map[string][]*model.Book, error) {
+	s.record("BooksByAuthors", authors)
+	result := make(map[string][]*model.Book)
+	for _, book := range s.books {
+		if len(result[book.Author]) < limit {
+			result[book.Author] = append(result[book.Author], book)
+		}
+	}
+	return result, nil
+}
+
+func (s *memoryStore) ReviewsByBooks(bookIds []uint, limit int) (map[uint][]*model.Review, error) {
+	s.record("ReviewsByBooks", bookIds)
+	result := make(map[uint][]*model.Review)
+	for _, review := range s.reviews {
+		if len(result[review.BookID]) < limit {
+			result[review.BookID] = append(result[review.BookID], review)
+		}
+	}
+	return result, nil
+}
+
+func (s *memoryStore) RatingsByBooks(bookIds []uint) (map[uint]*model.BookRating, error) {
+	s.record("RatingsByBooks", bookIds)
+	result := make(map[uint]*model.BookRating)
+	for _, bookId := range bookIds {
+		result[bookId] = &model.BookRating{BookID: bookId}
+	}
+	for _, review := range s.reviews {
+		rating := result[review.BookID]
+		rating.ReviewCount++
+		rating.RatingSum += int64(review.Rating)
+		rating.AverageRating = float64(rating.RatingSum) / float64(rating.ReviewCount)
+	}
+	return result, nil
+}
+
+func (s *memoryStore) StockByBooks(bookIds []uint) (map[uint][]*model.Inventory, error) {
+	s.record("StockByBooks", bookIds)
+	return map[uint][]*model.Inventory{1: {{BookID: 1, Warehouse: "east", OnHand: 5, Reserved: 2}}}, nil
+}
+
+var _ = ginkgo.Describe("executor", func() {
+	var store *memoryStore
+	var executor *gql.Executor
+
+	execute := func(query string, variables map[string]interface{}) (map[string]interface{}, []string) {
+		result := executor.Execute(context.Background(), store, gql.Request{Query: query, Variables: variables})
+		var messages []string
+		for _, err := range result.Errors {
+			messages = append(messages, err.Message)
+		}
+		//通过 JSON 转换为与 HTTP 响应相同的结构
+		content, err := json.Marshal(result.Data)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		var data map[string]interface{}
+		gomega.Expect(json.Unmarshal(content, &data)).To(gomega.Succeed())
+		return data, messages
+	}
+
+	ginkgo.BeforeEach(func() {
+		store = &memoryStore{
+			books: []*model.Book{
+				{Model: gorm.Model{ID: 1}, Title: "Dune", Author: "Frank Herbert", Pages: 412},
+				{Model: gorm.Model{ID: 2}, Title: "Dune Messiah", Author: "Frank Herbert", Pages: 256},
+				{Model: gorm.Model{ID: 3}, Title: "Flowers for Algernon", Author: "Daniel Keyes", Pages: 311},
+			},
+			reviews: []*model.Review{
+				{ID: 1, BookID: 1, UserID: "alice", Rating: 5},
+				{ID: 2, BookID: 1, UserID: "bob", Rating: 4},
+				{ID: 3, BookID: 3, UserID: "alice", Rating: 3},
+			},
+			calls: make(map[string][]interface{}),
+		}
+		var err error
+		executor, err = gql.NewExecutor()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+	})
+
+	ginkgo.Describe("query nested fields of books", func() {
+		ginkgo.It("batch loads of the same level into one call", func() {
+			data, errs := execute(`{
+				books(size: 10) {
+					title catalog
+					author { lastName books(limit: 5) { title } }
+					rating { averageRating reviewCount }
+					reviews(limit: 1) { userId rating }
+					stock { warehouse available }
+				}
+			}`, nil)
+			gomega.Expect(errs).To(gomega.BeEmpty())
+			books := data["books"].([]interface{})
+			gomega.Expect(books).To(gomega.HaveLen(3))
+			dune := books[0].(map[string]interface{})
+			gomega.Expect(dune["catalog"]).To(gomega.Equal("NOVEL"))
+			gomega.Expect(dune["author"]).To(gomega.HaveKeyWithValue("lastName", "Herbert"))
+			gomega.Expect(dune["author"].(map[string]interface{})["books"]).To(gomega.HaveLen(2))
+			gomega.Expect(dune["rating"]).To(gomega.Equal(map[string]interface{}{"averageRating": 4.5, "reviewCount": float64(2)}))
+			gomega.Expect(dune["reviews"]).To(gomega.Equal([]interface{}{map[string]interface{}{"userId": "alice", "rating": float64(5)}}))
+			gomega.Expect(dune["stock"]).To(gomega.Equal([]interface{}{map[string]interface{}{"warehouse": "east", "available": float64(3)}}))
+			gomega.Expect(books[1].(map[string]interface{})["stock"]).To(gomega.BeEmpty())
+
+			gomega.Expect(store.calls["RatingsByBooks"]).To(gomega.Equal([]interface{}{[]uint{1, 2, 3}}))
+			gomega.Expect(store.calls["ReviewsByBooks"]).To(gomega.Equal([]interface{}{[]uint{1, 2, 3}}))
+			gomega.Expect(store.calls["StockByBooks"]).To(gomega.Equal([]interface{}{[]uint{1, 2, 3}}))
+			//重复的作者只查询一次
+			gomega.Expect(store.calls["BooksByAuthors"]).To(gomega.Equal([]interface{}{[]string{"Frank Herbert", "Daniel Keyes"}}))
+		})
+		ginkgo.It("return null for missing book", func() {
+			data, errs := execute(`query($id: ID!) { book(id: $id) { title } }`, map[string]interface{}{"id": "404"})
+			gomega.Expect(errs).To(gomega.BeEmpty())
+			gomega.Expect(data).To(gomega.HaveKeyWithValue("book", gomega.BeNil()))
+		})
+		ginkgo.It("reject page size over the limit", func() {
+			_, errs := execute(`{ books(size: 101) { title } }`, nil)
+			gomega.Expect(errs).To(gomega.ContainElement(gomega.ContainSubstring("size must be between 1 and 100")))
+		})
+	})
+
+	ginkgo.Describe("mutate books", func() {
+		ginkgo.It("update only fields in input", func() {
+			data, errs := execute(`mutation { updateBook(id: 2, input: {pages: 300}) { title pages } }`, nil)
+			gomega.Expect(errs).To(gomega.BeEmpty())
+			gomega.Expect(data["updateBook"]).To(gomega.Equal(map[string]interface{}{"title": "Dune Messiah", "pages": float64(300)}))
+		})
+		ginkgo.It("add a book", func() {
+			data, errs := execute(`mutation { addBook(input: {title: "Emma", author: "Jane Austen", pages: 474}) { id catalog } }`, nil)
+			gomega.Expect(errs).To(gomega.BeEmpty())
+			gomega.Expect(data["addBook"]).To(gomega.Equal(map[string]interface{}{"id": "4", "catalog": "NOVEL"}))
+		})
+		ginkgo.It("fail to delete missing book", func() {
+			_, errs := execute(`mutation { deleteBook(id: 404) }`, nil)
+			gomega.Expect(errs).To(gomega.ContainElement(gql.ErrBookNotFound.Error()))
+			gomega.Expect(store.calls["DeleteBook"]).To(gomega.BeEmpty())
+		})
+	})
+
+	ginkgo.Describe("prepare operations", func() {
+		ginkgo.It("return the operation type & run the prepared operation", func() {
+			op, err := executor.Prepare(gql.Request{Query: `mutation { deleteBook(id: 1) }`})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(op.Type).To(gomega.Equal("mutation"))
+			gomega.Expect(store.calls).To(gomega.BeEmpty())
+
+			result := executor.Run(context.Background(), store, op)
+			gomega.Expect(result.Errors).To(gomega.BeEmpty())
+			gomega.Expect(store.calls["DeleteBook"]).To(gomega.HaveLen(1))
+		})
+		ginkgo.It("validate the prepared operation against the schema", func() {
+			op, err := executor.Prepare(gql.Request{Query: `{ books { missing } }`})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			result := executor.Run(context.Background(), store, op)
+			gomega.Expect(result.Errors).To(gomega.HaveLen(1))
+			gomega.Expect(result.Errors[0].Message).To(gomega.ContainSubstring(`"missing"`))
+			gomega.Expect(store.calls).To(gomega.BeEmpty())
+		})
+	})
+
+	ginkgo.Describe("limit queries", func() {
+		ginkgo.It("reject deep queries", func() {
+			_, errs := execute(`{ books { author { books { author { books { author { books { author { books { title } } } } } } } } } }`, nil)
+			gomega.Expect(errs).To(gomega.Equal([]string{gql.ErrTooDeep.Error()}))
+			gomega.Expect(store.calls).To(gomega.BeEmpty())
+		})
+		ginkgo.It("multiply complexity of list fields by size", func() {
+			query := `query($size: Int) { books(size: $size) { title reviews(limit: 50) { text } } }`
+			_, errs := execute(query, map[string]interface{}{"size": 10})
+			gomega.Expect(errs).To(gomega.BeEmpty())
+			_, errs = execute(query, map[string]interface{}{"size": 100})
+			gomega.Expect(errs).To(gomega.Equal([]string{gql.ErrTooComplex.Error()}))
+		})
+		ginkgo.It("count fields of fragments", func() {
+			_, errs := execute(`{ books(size: 100) { ...full } } fragment full on Book { reviews(limit: 50) { text } }`, nil)
+			gomega.Expect(errs).To(gomega.Equal([]string{gql.ErrTooComplex.Error()}))
+			_, errs = execute(`{ books { ...loop } } fragment loop on Book { author { books { ...loop } } }`, nil)
+			gomega.Expect(errs).To(gomega.ContainElement(gomega.ContainSubstring("spreads itself")))
+		})
+		ginkgo.It("cost omitted variables by the default value or the maximum", func() {
+			query := `query($size: Int = 100) { books(size: $size) { title reviews(limit: 50) { text } } }`
+			_, errs := execute(query, nil)
+			gomega.Expect(errs).To(gomega.Equal([]string{gql.ErrTooComplex.Error()}))
+			_, errs = execute(query, map[string]interface{}{"size": 10})
+			gomega.Expect(errs).To(gomega.BeEmpty())
+
+			query = `query($limit: Int) { books(size: 30) { title reviews(limit: $limit) { text } } }`
+			_, errs = execute(query, nil)
+			gomega.Expect(errs).To(gomega.Equal([]string{gql.ErrTooComplex.Error()}))
+		})
+		ginkgo.It("limit nested introspection", func() {
+			query := "{ __schema { types { " + strings.Repeat("fields { type { ", 7) + "name" + strings.Repeat(" }", 16) + " }"
+			_, errs := execute(query, nil)
+			gomega.Expect(errs).To(gomega.Equal([]string{gql.ErrTooDeep.Error()}))
+		})
+		ginkgo.It("allow introspection", func() {
+			data, errs := execute(`{ __schema { types { name fields { name type { name ofType { name ofType { name ofType { name } } } } } } } }`, nil)
+			gomega.Expect(errs).To(gomega.BeEmpty())
+			gomega.Expect(data).To(gomega.HaveKey("__schema"))
+		})
+	})
+})
@@ -0,0 +1,192 @@
+package gql
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+var (
+	//ErrTooDeep 查询嵌套层数超过 MaxDepth
+	ErrTooDeep = errors.New("query is too deep")
+	//ErrTooComplex 查询复杂度超过 MaxComplexity
+	ErrTooComplex = errors.New("query is too complex")
+	//ErrUnknownOperation 文档中没有 operationName 指定的操作，或者有多个操作但没有指定
+	ErrUnknownOperation = errors.New("unknown operation")
+)
+
+//listMultipliers 列表字段没有 size/limit 参数时按照默认返回的数量计算复杂度
+var listMultipliers = map[string]int{
+	"books":   DefaultPageSize,
+	"reviews": DefaultListLimit,
+	"stock":   5,
+}
+
+//maxMultipliers 参数的值未知时按照 schema 允许的最大值计算复杂度
+var maxMultipliers = map[string]int{
+	"size":  MaxPageSize,
+	"limit": MaxListLimit,
+}
+
+//cost 查询的深度与复杂度。复杂度按照每个字段 1 计算，列表字段的子字段乘以可能返回的数量。
+//内省字段（__schema、__type）及其子字段的深度单独记录在 introspectionDepth 中，复杂度与其他字段一样计算
+type cost struct {
+	depth              int
+	introspectionDepth int
+	complexity         int
+}
+
+//analyzer 计算选中操作的 cost，fragments 用于展开片段，active 防止片段循环引用，
+//defaults 为变量定义中的默认值
+type analyzer struct {
+	fragments map[string]*ast.FragmentDefinition
+	variables map[string]interface{}
+	defaults  map[string]ast.Value
+	active    map[string]bool
+}
+
+//analyze 返回要执行的操作与它的 cost
+func analyze(doc *ast.Document, operationName string, variables map[string]interface{}) (*ast.OperationDefinition, cost, error) {
+	a := &analyzer{
+		fragments: make(map[string]*ast.FragmentDefinition),
+		variables: variables,
+		defaults:  make(map[string]ast.Value),
+		active:    make(map[string]bool),
+	}
+	var operation *ast.OperationDefinition
+	for _, definition := range doc.Definitions {
+		switch d := definition.(type) {
+		case *ast.FragmentDefinition:
+			a.fragments[d.Name.Value] = d
+		case *ast.OperationDefinition:
+			if operationName == "" {
+				if operation != nil {
+					return nil, cost{}, ErrUnknownOperation
+				}
+				operation = d
+			} else if d.Name != nil && d.Name.Value == operationName {
+				operation = d
+			}
+		}
+	}
+	if operation == nil {
+		return nil, cost{}, ErrUnknownOperation
+	}
+	for _, definition := range operation.VariableDefinitions {
+		if definition.DefaultValue != nil {
+			a.defaults[definition.Variable.Name.Value] = definition.DefaultValue
+		}
+	}
+	c, err := a.selectionSet(operation.SelectionSet)
+	return operation, c, err
+}
+
+func (a *analyzer) selectionSet(set *ast.SelectionSet) (cost, error) {
+	var total cost
+	if set == nil {
+		return total, nil
+	}
+	for _, selection := range set.Selections {
+		var c cost
+		var err error
+		switch s := selection.(type) {
+		case *ast.Field:
+			c, err = a.field(s)
+		case *ast.InlineFragment:
+			c, err = a.selectionSet(s.SelectionSet)
+		case *ast.FragmentSpread:
+			c, err = a.fragment(s.Name.Value)
+		}
+		if err != nil {
+			return cost{}, err
+		}
+		if c.depth > total.depth {
+			total.depth = c.depth
+		}
+		if c.introspectionDepth > total.introspectionDepth {
+			total.introspectionDepth = c.introspectionDepth
+		}
+		total.complexity += c.complexity
+	}
+	return total, nil
+}
+
+func (a *analyzer) fragment(name string) (cost, error) {
+	fragment, ok := a.fragments[name]
+	if !ok {
+		return cost{}, fmt.Errorf("unknown fragment %q", name)
+	}
+	if a.active[name] {
+		return cost{}, fmt.Errorf("fragment %q spreads itself", name)
+	}
+	a.active[name] = true
+	defer delete(a.active, name)
+	return a.selectionSet(fragment.SelectionSet)
+}
+
+func (a *analyzer) field(field *ast.Field) (cost, error) {
+	children, err := a.selectionSet(field.SelectionSet)
+	if err != nil {
+		return cost{}, err
+	}
+	complexity := 1 + a.multiplier(field)*children.complexity
+	if strings.HasPrefix(field.Name.Value, "__") {
+		//内省的子字段（types、fields、ofType 等）都计入内省的深度
+		depth := children.depth
+		if children.introspectionDepth > depth {
+			depth = children.introspectionDepth
+		}
+		return cost{introspectionDepth: depth + 1, complexity: complexity}, nil
+	}
+	return cost{
+		depth:              children.depth + 1,
+		introspectionDepth: children.introspectionDepth,
+		complexity:         complexity,
+	}, nil
+}
+
+//multiplier 返回列表字段可能返回的数量。参数是变量时读取变量的值，没有传入时使用变量的默认值，
+//仍然无法确定时按照 schema 允许的最大值计算
+func (a *analyzer) multiplier(field *ast.Field) int {
+	for _, argument := range field.Arguments {
+		max, ok := maxMultipliers[argument.Name.Value]
+		if !ok {
+			continue
+		}
+		value := argument.Value
+		if v, ok := value.(*ast.Variable); ok {
+			if n, ok := a.variables[v.Name.Value]; ok {
+				return positiveOr(n, max)
+			}
+			value = a.defaults[v.Name.Value]
+		}
+		if v, ok := value.(*ast.IntValue); ok {
+			if n, err := strconv.Atoi(v.Value); err == nil {
+				return positiveOr(n, max)
+			}
+		}
+		return max
+	}
+	if n, ok := listMultipliers[field.Name.Value]; ok {
+		return n
+	}
+	return 1
+}
+
+//positiveOr 返回变量中的正整数，其他值返回 max
+func positiveOr(value interface{}, max int) int {
+	switch n := value.(type) {
+	case int:
+		if n > 0 {
+			return n
+		}
+	case float64:
+		if n > 0 {
+			return int(n)
+		}
+	}
+	return max
+}
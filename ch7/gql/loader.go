@@ -0,0 +1,177 @@
+package gql
+
+import (
+	"context"
+	"sync"
+
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/model"
+)
+
+//thunk 延迟返回结果，graphql-go 先执行同一层的所有字段，再按照广度优先的顺序调用 thunk
+type thunk = func() (interface{}, error)
+
+//batch 类似 dataloader：同一层字段调用 load 登记 key，第一个 thunk 被调用时用一次查询获取所有登记的 key，
+//避免列表中每个元素各自查询一次（N+1 查询）
+type batch struct {
+	mu      sync.Mutex
+	fetch   func(keys []interface{}) (map[interface{}]interface{}, error)
+	pending []interface{}
+	waiting map[interface{}]bool
+	results map[interface{}]interface{}
+	errs    map[interface{}]error
+}
+
+func newBatch(fetch func(keys []interface{}) (map[interface{}]interface{}, error)) *batch {
+	return &batch{
+		fetch:   fetch,
+		waiting: make(map[interface{}]bool),
+		results: make(map[interface{}]interface{}),
+		errs:    make(map[interface{}]error),
+	}
+}
+
+//load 登记 key，返回读取结果的 thunk。已经查询过或正在等待的 key 不会重复查询
+func (b *batch) load(key interface{}) thunk {
+	b.mu.Lock()
+	if _, done := b.results[key]; !done {
+		if _, failed := b.errs[key]; !failed && !b.waiting[key] {
+			b.pending = append(b.pending, key)
+			b.waiting[key] = true
+		}
+	}
+	b.mu.Unlock()
+	return func() (interface{}, error) {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if b.waiting[key] {
+			b.dispatch()
+		}
+		if err, ok := b.errs[key]; ok {
+			return nil, err
+		}
+		return b.results[key], nil
+	}
+}
+
+//dispatch 查询所有等待的 key，调用时需要持有锁
+func (b *batch) dispatch() {
+	keys := b.pending
+	b.pending = nil
+	b.waiting = make(map[interface{}]bool)
+	results, err := b.fetch(keys)
+	for _, key := range keys {
+		if err != nil {
+			b.errs[key] = err
+			continue
+		}
+		b.results[key] = results[key]
+	}
+}
+
+//loaders 一次请求内共用的 batch，不同请求之间不共享，避免读到其他租户或过期的数据
+type loaders struct {
+	store       Store
+	ratings     *batch
+	stock       *batch
+	reviews     map[int]*batch
+	authorBooks map[int]*batch
+	mu          sync.Mutex
+}
+
+func newLoaders(store Store) *loaders {
+	l := &loaders{
+		store:       store,
+		reviews:     make(map[int]*batch),
+		authorBooks: make(map[int]*batch),
+	}
+	l.ratings = newBatch(func(keys []interface{}) (map[interface{}]interface{}, error) {
+		ratings, err := store.RatingsByBooks(bookIds(keys))
+		if err != nil {
+			return nil, err
+		}
+		results := make(map[interface{}]interface{}, len(ratings))
+		for bookId, rating := range ratings {
+			results[bookId] = rating
+		}
+		return results, nil
+	})
+	l.stock = newBatch(func(keys []interface{}) (map[interface{}]interface{}, error) {
+		stock, err := store.StockByBooks(bookIds(keys))
+		if err != nil {
+			return nil, err
+		}
+		results := make(map[interface{}]interface{}, len(keys))
+		for _, key := range keys {
+			//没有库存时返回空列表而不是 null
+			results[key] = append([]*model.Inventory{}, stock[key.(uint)]...)
+		}
+		return results, nil
+	})
+	return l
+}
+
+//reviewsOf 返回读取每个 Book 最新 limit 条评价的 batch，limit 不同的字段分别查询
+func (l *loaders) reviewsOf(limit int) *batch {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if b, ok := l.reviews[limit]; ok {
+		return b
+	}
+	b := newBatch(func(keys []interface{}) (map[interface{}]interface{}, error) {
+		reviews, err := l.store.ReviewsByBooks(bookIds(keys), limit)
+		if err != nil {
+			return nil, err
+		}
+		results := make(map[interface{}]interface{}, len(keys))
+		for _, key := range keys {
+			results[key] = append([]*model.Review{}, reviews[key.(uint)]...)
+		}
+		return results, nil
+	})
+	l.reviews[limit] = b
+	return b
+}
+
+//booksOf 返回读取每个作者 limit 本 Book 的 batch
+func (l *loaders) booksOf(limit int) *batch {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if b, ok := l.authorBooks[limit]; ok {
+		return b
+	}
+	b := newBatch(func(keys []interface{}) (map[interface{}]interface{}, error) {
+		authors := make([]string, 0, len(keys))
+		for _, key := range keys {
+			authors = append(authors, key.(string))
+		}
+		books, err := l.store.BooksByAuthors(authors, limit)
+		if err != nil {
+			return nil, err
+		}
+		results := make(map[interface{}]interface{}, len(keys))
+		for _, key := range keys {
+			results[key] = append([]*model.Book{}, books[key.(string)]...)
+		}
+		return results, nil
+	})
+	l.authorBooks[limit] = b
+	return b
+}
+
+func bookIds(keys []interface{}) []uint {
+	ids := make([]uint, 0, len(keys))
+	for _, key := range keys {
+		ids = append(ids, key.(uint))
+	}
+	return ids
+}
+
+type loadersKey struct{}
+
+func withLoaders(ctx context.Context, l *loaders) context.Context {
+	return context.WithValue(ctx, loadersKey{}, l)
+}
+
+func loadersFrom(ctx context.Context) *loaders {
+	return ctx.Value(loadersKey{}).(*loaders)
+}
@@ -0,0 +1,350 @@
+package gql
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/graphql-go/graphql"
+	"github.com/spf13/cast"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/model"
+)
+
+const (
+	DefaultPageSize  = 20  //DefaultPageSize books 默认每页数量
+	MaxPageSize      = 100 //MaxPageSize books 每页最多的数量
+	DefaultListLimit = 10  //DefaultListLimit reviews 与作者的 books 默认返回的数量
+	MaxListLimit     = 50  //MaxListLimit reviews 与作者的 books 最多返回的数量
+)
+
+//ErrBookNotFound Book 不存在
+var ErrBookNotFound = errors.New("book not found")
+
+var catalogEnum = graphql.NewEnum(graphql.EnumConfig{
+	Name: "Catalog",
+	Values: graphql.EnumValueConfigMap{
+		"NOVEL":       {Value: model.CategoryNovel},
+		"SHORT_STORY": {Value: model.CategoryShortStory},
+	},
+})
+
+var sortEnum = graphql.NewEnum(graphql.EnumConfig{
+	Name: "BookSort",
+	Values: graphql.EnumValueConfigMap{
+		"ID":      {Value: model.SortByID},
+		"RATING":  {Value: model.SortByRating},
+		"REVIEWS": {Value: model.SortByReviewCount},
+	},
+})
+
+var ratingType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Rating",
+	Fields: graphql.Fields{
+		"averageRating": {Type: graphql.NewNonNull(graphql.Float), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return p.Source.(*model.BookRating).AverageRating, nil
+		}},
+		"reviewCount": {Type: graphql.NewNonNull(graphql.Int), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return p.Source.(*model.BookRating).ReviewCount, nil
+		}},
+	},
+})
+
+var reviewType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Review",
+	Fields: graphql.Fields{
+		"id": {Type: graphql.NewNonNull(graphql.ID), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return p.Source.(*model.Review).ID, nil
+		}},
+		"userId": {Type: graphql.NewNonNull(graphql.String), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return p.Source.(*model.Review).UserID, nil
+		}},
+		"rating": {Type: graphql.NewNonNull(graphql.Int), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return p.Source.(*model.Review).Rating, nil
+		}},
+		"text": {Type: graphql.NewNonNull(graphql.String), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return p.Source.(*model.Review).Text, nil
+		}},
+		"createdAt": {Type: graphql.NewNonNull(graphql.DateTime), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return p.Source.(*model.Review).CreatedAt, nil
+		}},
+	},
+})
+
+var stockType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Stock",
+	Fields: graphql.Fields{
+		"warehouse": {Type: graphql.NewNonNull(graphql.String), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return p.Source.(*model.Inventory).Warehouse, nil
+		}},
+		"onHand": {Type: graphql.NewNonNull(graphql.Int), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return p.Source.(*model.Inventory).OnHand, nil
+		}},
+		"reserved": {Type: graphql.NewNonNull(graphql.Int), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return p.Source.(*model.Inventory).Reserved, nil
+		}},
+		"available": {Type: graphql.NewNonNull(graphql.Int), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return p.Source.(*model.Inventory).Available(), nil
+		}},
+	},
+})
+
+//bookType 与 authorType 互相引用，字段通过 FieldsThunk 延迟创建
+var bookType, authorType *graphql.Object
+
+func init() {
+	authorType = graphql.NewObject(graphql.ObjectConfig{
+		Name: "Author",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return graphql.Fields{
+				"name": {Type: graphql.NewNonNull(graphql.String), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(string), nil
+				}},
+				"firstName": {Type: graphql.NewNonNull(graphql.String), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return model.Book{Author: p.Source.(string)}.FirstName(), nil
+				}},
+				"middleName": {Type: graphql.NewNonNull(graphql.String), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return model.Book{Author: p.Source.(string)}.MiddleName(), nil
+				}},
+				"lastName": {Type: graphql.NewNonNull(graphql.String), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return model.Book{Author: p.Source.(string)}.LastName(), nil
+				}},
+				"books": {
+					Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(bookType))),
+					Description: "books of the author in the order they were added",
+					Args:        limitArgs(),
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						limit, err := listLimit(p.Args)
+						if err != nil {
+							return nil, err
+						}
+						return loadersFrom(p.Context).booksOf(limit).load(p.Source.(string)), nil
+					},
+				},
+			}
+		}),
+	})
+
+	bookType = graphql.NewObject(graphql.ObjectConfig{
+		Name: "Book",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return graphql.Fields{
+				"id": {Type: graphql.NewNonNull(graphql.ID), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(*model.Book).ID, nil
+				}},
+				"title": {Type: graphql.NewNonNull(graphql.String), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(*model.Book).Title, nil
+				}},
+				"author": {Type: graphql.NewNonNull(authorType), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(*model.Book).Author, nil
+				}},
+				"pages": {Type: graphql.NewNonNull(graphql.Int), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(*model.Book).Pages, nil
+				}},
+				"weight": {Type: graphql.NewNonNull(graphql.Int), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(*model.Book).Weight, nil
+				}},
+				"isbn10": {Type: graphql.String, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return nullable(string(p.Source.(*model.Book).ISBN10)), nil
+				}},
+				"isbn13": {Type: graphql.String, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return nullable(string(p.Source.(*model.Book).ISBN13)), nil
+				}},
+				"catalog": {Type: graphql.NewNonNull(catalogEnum), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(*model.Book).Catalog(), nil
+				}},
+				"createdAt": {Type: graphql.NewNonNull(graphql.DateTime), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(*model.Book).CreatedAt, nil
+				}},
+				"updatedAt": {Type: graphql.NewNonNull(graphql.DateTime), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(*model.Book).UpdatedAt, nil
+				}},
+				"rating": {Type: graphql.NewNonNull(ratingType), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return loadersFrom(p.Context).ratings.load(p.Source.(*model.Book).ID), nil
+				}},
+				"reviews": {
+					Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(reviewType))),
+					Description: "latest reviews of the book",
+					Args:        limitArgs(),
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						limit, err := listLimit(p.Args)
+						if err != nil {
+							return nil, err
+						}
+						return loadersFrom(p.Context).reviewsOf(limit).load(p.Source.(*model.Book).ID), nil
+					},
+				},
+				"stock": {Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(stockType))), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return loadersFrom(p.Context).stock.load(p.Source.(*model.Book).ID), nil
+				}},
+			}
+		}),
+	})
+}
+
+var bookInputType = graphql.NewInputObject(graphql.InputObjectConfig{
+	Name: "BookInput",
+	Fields: graphql.InputObjectConfigFieldMap{
+		"title":  {Type: graphql.String},
+		"author": {Type: graphql.String},
+		"pages":  {Type: graphql.Int},
+		"weight": {Type: graphql.Int},
+		"isbn":   {Type: graphql.String, Description: "isbn10 or isbn13"},
+	},
+})
+
+func queryType() *graphql.Object {
+	return graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"book": {
+				Type: bookType,
+				Args: graphql.FieldConfigArgument{"id": {Type: graphql.NewNonNull(graphql.ID)}},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					bookId, err := cast.ToUintE(p.Args["id"])
+					if err != nil {
+						return nil, fmt.Errorf("invalid book id %v", p.Args["id"])
+					}
+					book, err := loadersFrom(p.Context).store.GetBook(bookId)
+					if isNotFound(err) {
+						return nil, nil
+					}
+					return book, err
+				},
+			},
+			"books": {
+				Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(bookType))),
+				Args: graphql.FieldConfigArgument{
+					"page":    {Type: graphql.Int, DefaultValue: 0},
+					"size":    {Type: graphql.Int, DefaultValue: DefaultPageSize},
+					"sort":    {Type: sortEnum, DefaultValue: model.SortByID},
+					"tag":     {Type: graphql.String},
+					"subject": {Type: graphql.ID},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					q := model.BookQuery{
+						PageOptions: model.PageOptions{PageNumber: p.Args["page"].(int), PageSize: p.Args["size"].(int)},
+						Sort:        p.Args["sort"].(model.BookSort),
+					}
+					if q.PageNumber < 0 || q.PageSize <= 0 || q.PageSize > MaxPageSize {
+						return nil, fmt.Errorf("size must be between 1 and %d", MaxPageSize)
+					}
+					if tag, ok := p.Args["tag"].(string); ok {
+						q.Tag = tag
+					}
+					if subject, ok := p.Args["subject"]; ok {
+						subjectId, err := cast.ToUintE(subject)
+						if err != nil {
+							return nil, fmt.Errorf("invalid subject id %v", subject)
+						}
+						q.SubjectID = subjectId
+					}
+					return loadersFrom(p.Context).store.ListBooks(q)
+				},
+			},
+		},
+	})
+}
+
+func mutationType() *graphql.Object {
+	return graphql.NewObject(graphql.ObjectConfig{
+		Name: "Mutation",
+		Fields: graphql.Fields{
+			"addBook": {
+				Type: graphql.NewNonNull(bookType),
+				Args: graphql.FieldConfigArgument{"input": {Type: graphql.NewNonNull(bookInputType)}},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					var book model.Book
+					applyInput(&book, p.Args["input"].(map[string]interface{}))
+					if !book.IsValid() {
+						return nil, errors.New("author is required")
+					}
+					if err := loadersFrom(p.Context).store.AddBook(&book); err != nil {
+						return nil, err
+					}
+					return &book, nil
+				},
+			},
+			"updateBook": {
+				Type: graphql.NewNonNull(bookType),
+				Args: graphql.FieldConfigArgument{
+					"id":    {Type: graphql.NewNonNull(graphql.ID)},
+					"input": {Type: graphql.NewNonNull(bookInputType)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					store := loadersFrom(p.Context).store
+					book, err := getBook(store, p.Args["id"])
+					if err != nil {
+						return nil, err
+					}
+					applyInput(book, p.Args["input"].(map[string]interface{}))
+					if err := store.UpdateBook(book); err != nil {
+						return nil, err
+					}
+					return store.GetBook(book.ID)
+				},
+			},
+			"deleteBook": {
+				Type: graphql.NewNonNull(graphql.Boolean),
+				Args: graphql.FieldConfigArgument{"id": {Type: graphql.NewNonNull(graphql.ID)}},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					store := loadersFrom(p.Context).store
+					book, err := getBook(store, p.Args["id"])
+					if err != nil {
+						return nil, err
+					}
+					return true, store.DeleteBook(book.ID)
+				},
+			},
+		},
+	})
+}
+
+//applyInput 只修改 input 中出现的字段
+func applyInput(book *model.Book, input map[string]interface{}) {
+	for name, value := range input {
+		switch name {
+		case "title":
+			book.Title = cast.ToString(value)
+		case "author":
+			book.Author = cast.ToString(value)
+		case "pages":
+			book.Pages = cast.ToInt32(value)
+		case "weight":
+			book.Weight = cast.ToInt32(value)
+		case "isbn":
+			//NormalizeISBN 会将 ISBN-10 转换为 ISBN-13 并补全 ISBN10
+			book.ISBN10, book.ISBN13 = "", model.ISBN(cast.ToString(value))
+		}
+	}
+}
+
+func getBook(store Store, id interface{}) (*model.Book, error) {
+	bookId, err := cast.ToUintE(id)
+	if err != nil {
+		return nil, fmt.Errorf("invalid book id %v", id)
+	}
+	book, err := store.GetBook(bookId)
+	if isNotFound(err) {
+		return nil, ErrBookNotFound
+	}
+	return book, err
+}
+
+func limitArgs() graphql.FieldConfigArgument {
+	return graphql.FieldConfigArgument{"limit": {Type: graphql.Int, DefaultValue: DefaultListLimit}}
+}
+
+func listLimit(args map[string]interface{}) (int, error) {
+	limit := args["limit"].(int)
+	if limit <= 0 || limit > MaxListLimit {
+		return 0, fmt.Errorf("limit must be between 1 and %d", MaxListLimit)
+	}
+	return limit, nil
+}
+
+//nullable 空字符串返回 nil，在响应中输出 null
+func nullable(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
@@ -0,0 +1,114 @@
+package loadgen
+
+import (
+	"math"
+	"math/bits"
+	"time"
+)
+
+const (
+	//subBucketBits 每个 2 的幂区间分为 64 个子桶，记录的值与真实值的相对误差不超过 1/64
+	subBucketBits  = 7
+	subBucketCount = 1 << subBucketBits
+	subBucketHalf  = subBucketCount / 2
+	//maxExponent 可以记录的最大值约为 2^43 微秒，超过时记为最大值
+	maxExponent = 43 - subBucketBits
+)
+
+//Histogram 以微秒记录延迟的 HDR 风格直方图，内存占用固定，百分位的相对误差不超过 2%。
+//不是并发安全的
+type Histogram struct {
+	counts   []int64
+	total    int64
+	min, max int64
+	sum      float64
+}
+
+//NewHistogram 创建空的 Histogram
+func NewHistogram() *Histogram {
+	return &Histogram{counts: make([]int64, (maxExponent+1)*subBucketHalf+subBucketHalf)}
+}
+
+//Record 记录一个延迟，小于 0 时记为 0
+func (h *Histogram) Record(d time.Duration) {
+	v := d.Microseconds()
+	if v < 0 {
+		v = 0
+	}
+	if v > valueAt(len(h.counts)-1) {
+		v = valueAt(len(h.counts) - 1)
+	}
+	h.counts[indexOf(v)]++
+	if h.total == 0 || v < h.min {
+		h.min = v
+	}
+	if v > h.max {
+		h.max = v
+	}
+	h.total++
+	h.sum += float64(v)
+}
+
+//indexOf 小于 subBucketCount 的值每个值一个桶，之后每个 2 的幂区间 subBucketHalf 个桶
+func indexOf(v int64) int {
+	if v < subBucketCount {
+		return int(v)
+	}
+	exponent := bits.Len64(uint64(v)) - subBucketBits
+	return exponent*subBucketHalf + int(v>>exponent)
+}
+
+//valueAt 返回桶中的最大值
+func valueAt(index int) int64 {
+	if index < subBucketCount {
+		return int64(index)
+	}
+	exponent := index/subBucketHalf - 1
+	sub := int64(index%subBucketHalf + subBucketHalf)
+	return (sub+1)<<exponent - 1
+}
+
+//Count 记录的数量
+func (h *Histogram) Count() int64 {
+	return h.total
+}
+
+//Percentile 返回 q 百分位的延迟，q 在 0 到 100 之间，没有记录时返回 0
+func (h *Histogram) Percentile(q float64) time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	rank := int64(math.Ceil(q / 100 * float64(h.total)))
+	if rank < 1 {
+		rank = 1
+	}
+	var seen int64
+	for i, count := range h.counts {
+		if seen += count; seen >= rank {
+			v := valueAt(i)
+			if v > h.max {
+				v = h.max
+			}
+			return time.Duration(v) * time.Microsecond
+		}
+	}
+	return time.Duration(h.max) * time.Microsecond
+}
+
+//Min 最小延迟
+func (h *Histogram) Min() time.Duration {
+	return time.Duration(h.min) * time.Microsecond
+}
+
+//Max 最大延迟
+func (h *Histogram) Max() time.Duration {
+	return time.Duration(h.max) * time.Microsecond
+}
+
+//Mean 平均延迟
+func (h *Histogram) Mean() time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	return time.Duration(h.sum/float64(h.total)) * time.Microsecond
+}
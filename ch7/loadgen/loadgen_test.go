@@ -0,0 +1,149 @@
+package loadgen_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"time"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/loadgen"
+)
+
+//fakeServer 模拟 Book 接口，每个请求等待 delay，status 不为 0 时 get 返回该状态码
+type fakeServer struct {
+	delay    time.Duration
+	status   int
+	requests map[string]*int64
+	nextId   int64
+}
+
+func newFakeServer(delay time.Duration) (*fakeServer, *httptest.Server) {
+	f := &fakeServer{delay: delay, requests: map[string]*int64{}}
+	for _, method := range []string{http.MethodGet, http.MethodPost, http.MethodPatch} {
+		f.requests[method] = new(int64)
+	}
+	server := httptest.NewServer(http.HandlerFunc(f.serve))
+	ginkgo.DeferCleanup(server.Close)
+	return f, server
+}
+
+func (f *fakeServer) serve(w http.ResponseWriter, r *http.Request) {
+	atomic.AddInt64(f.requests[r.Method], 1)
+	time.Sleep(f.delay)
+	switch {
+	case r.Method == http.MethodPost:
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]int64{"ID": atomic.AddInt64(&f.nextId, 1)}})
+	case r.Method == http.MethodGet && r.URL.Path != "/books/" && f.status != 0:
+		w.WriteHeader(f.status)
+	default:
+		_, _ = w.Write([]byte(`{"data":{"books":[]}}`))
+	}
+}
+
+var _ = ginkgo.Describe("loadgen", func() {
+	ginkgo.Describe("histogram", func() {
+		ginkgo.It("report percentiles within the precision", func() {
+			h := loadgen.NewHistogram()
+			for i := 1; i <= 10000; i++ {
+				h.Record(time.Duration(i) * time.Millisecond)
+			}
+			gomega.Expect(h.Count()).To(gomega.Equal(int64(10000)))
+			gomega.Expect(h.Min()).To(gomega.Equal(time.Millisecond))
+			gomega.Expect(h.Max()).To(gomega.Equal(10 * time.Second))
+			gomega.Expect(h.Mean()).To(gomega.BeNumerically("~", 5000500*time.Microsecond, time.Millisecond))
+			for q, expected := range map[float64]time.Duration{50: 5 * time.Second, 99: 9900 * time.Millisecond, 99.9: 9990 * time.Millisecond} {
+				gomega.Expect(h.Percentile(q)).To(gomega.BeNumerically("~", expected, expected/64))
+				gomega.Expect(h.Percentile(q)).To(gomega.BeNumerically(">=", expected))
+			}
+			gomega.Expect(h.Percentile(100)).To(gomega.Equal(10 * time.Second))
+		})
+		ginkgo.It("record small values exactly", func() {
+			h := loadgen.NewHistogram()
+			for _, us := range []int{3, 1, 2, 100} {
+				h.Record(time.Duration(us) * time.Microsecond)
+			}
+			gomega.Expect(h.Percentile(50)).To(gomega.Equal(2 * time.Microsecond))
+			gomega.Expect(h.Percentile(75)).To(gomega.Equal(3 * time.Microsecond))
+			gomega.Expect(loadgen.NewHistogram().Percentile(99)).To(gomega.BeZero())
+		})
+	})
+
+	ginkgo.Describe("mix", func() {
+		ginkgo.It("parse weights", func() {
+			mix, err := loadgen.ParseMix(" create=1, get = 3,list=0")
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(mix).To(gomega.Equal(loadgen.Mix{loadgen.OpCreate: 1, loadgen.OpGet: 3, loadgen.OpList: 0}))
+		})
+		ginkgo.It("reject invalid mix", func() {
+			for _, value := range []string{"", "delete=1", "get", "get=-1", "get=1,get=2", "get=0"} {
+				_, err := loadgen.ParseMix(value)
+				gomega.Expect(err).To(gomega.MatchError(loadgen.ErrInvalidMix), value)
+			}
+		})
+	})
+
+	ginkgo.Describe("run", func() {
+		ginkgo.It("send requests on schedule without waiting for slow responses", func() {
+			f, server := newFakeServer(100 * time.Millisecond)
+			mix, _ := loadgen.ParseMix("create=1,get=2,list=1,update=1")
+			report, err := loadgen.Run(context.Background(), loadgen.Config{
+				BaseURL: server.URL, RPS: 100, Duration: 500 * time.Millisecond, Mix: mix, Seed: 1, Prefill: 2,
+			})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(report.Total.Requests).To(gomega.Equal(int64(50)))
+			gomega.Expect(report.Total.Errors).To(gomega.BeZero())
+			gomega.Expect(report.Total.Latency.P50).To(gomega.BeNumerically(">=", 100))
+			//每个请求 100ms，串行发送最多只能完成 5 个
+			gomega.Expect(report.Duration).To(gomega.BeNumerically("<", 1))
+			var sum int64
+			for _, op := range report.Operations {
+				sum += op.Requests
+			}
+			gomega.Expect(sum).To(gomega.Equal(int64(50)))
+			gomega.Expect(atomic.LoadInt64(f.requests[http.MethodPatch])).To(gomega.Equal(report.Operations[loadgen.OpUpdate].Requests))
+			//prefill 的请求不计入结果
+			gomega.Expect(atomic.LoadInt64(f.requests[http.MethodPost])).To(gomega.Equal(report.Operations[loadgen.OpCreate].Requests + 2))
+		})
+
+		ginkgo.It("count error responses & dropped requests", func() {
+			f, server := newFakeServer(200 * time.Millisecond)
+			f.status = http.StatusNotFound
+			mix, _ := loadgen.ParseMix("get=1")
+			report, err := loadgen.Run(context.Background(), loadgen.Config{
+				BaseURL: server.URL, RPS: 50, Duration: 100 * time.Millisecond, Mix: mix, Prefill: 1, MaxInFlight: 2,
+			})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			get := report.Operations[loadgen.OpGet]
+			gomega.Expect(get.Requests).To(gomega.Equal(int64(5)))
+			gomega.Expect(get.Status).To(gomega.Equal(map[string]int64{"404": 2, loadgen.StatusDropped: 3}))
+			gomega.Expect(get.ErrorRate).To(gomega.Equal(1.0))
+
+			var buf bytes.Buffer
+			gomega.Expect(report.WriteText(&buf)).To(gomega.Succeed())
+			gomega.Expect(buf.String()).To(gomega.ContainSubstring("get        5"))
+			buf.Reset()
+			gomega.Expect(report.WriteJSON(&buf)).To(gomega.Succeed())
+			gomega.Expect(buf.String()).To(gomega.ContainSubstring(`"p99_ms"`))
+		})
+
+		ginkgo.It("keep as many connections as requests in flight", func() {
+			client := loadgen.NewClient(50, time.Second)
+			transport := client.Transport.(*http.Transport)
+			gomega.Expect(transport.MaxIdleConnsPerHost).To(gomega.Equal(50))
+			gomega.Expect(transport.MaxConnsPerHost).To(gomega.Equal(50))
+			gomega.Expect(client.Timeout).To(gomega.Equal(time.Second))
+		})
+
+		ginkgo.It("require books for get and update", func() {
+			_, server := newFakeServer(0)
+			mix, _ := loadgen.ParseMix("get=1")
+			_, err := loadgen.Run(context.Background(), loadgen.Config{BaseURL: server.URL, RPS: 1, Duration: time.Second, Mix: mix})
+			gomega.Expect(err).To(gomega.MatchError(loadgen.ErrNoBooks))
+		})
+	})
+})
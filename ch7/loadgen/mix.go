@@ -0,0 +1,94 @@
+package loadgen
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//Operation 压测发送的请求类型
+type Operation string
+
+const (
+	OpCreate Operation = "create" //OpCreate POST /books/
+	OpGet    Operation = "get"    //OpGet GET /books/:book_id
+	OpList   Operation = "list"   //OpList GET /books/
+	OpUpdate Operation = "update" //OpUpdate PATCH /books/:book_id
+)
+
+//DefaultMix 默认的请求比例，以读为主
+const DefaultMix = "create=10,get=60,list=20,update=10"
+
+//ErrInvalidMix 请求比例格式错误
+var ErrInvalidMix = errors.New("invalid mix, expect 'create=10,get=60,list=20,update=10'")
+
+//Mix 各类请求的权重
+type Mix map[Operation]int
+
+//ParseMix 解析 op=weight 逗号分隔的请求比例，权重为 0 的请求不发送
+func ParseMix(value string) (Mix, error) {
+	mix := Mix{}
+	total := 0
+	for _, part := range strings.Split(value, ",") {
+		name, weight, ok := strings.Cut(strings.TrimSpace(part), "=")
+		op := Operation(strings.TrimSpace(name))
+		switch op {
+		case OpCreate, OpGet, OpList, OpUpdate:
+		default:
+			return nil, fmt.Errorf("%w: unknown operation %q", ErrInvalidMix, name)
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(weight))
+		if !ok || err != nil || n < 0 {
+			return nil, fmt.Errorf("%w: invalid weight of %s", ErrInvalidMix, op)
+		}
+		if _, ok := mix[op]; ok {
+			return nil, fmt.Errorf("%w: duplicate operation %s", ErrInvalidMix, op)
+		}
+		mix[op] = n
+		total += n
+	}
+	if total == 0 {
+		return nil, fmt.Errorf("%w: all weights are zero", ErrInvalidMix)
+	}
+	return mix, nil
+}
+
+//needBooks 是否需要已经存在的 Book
+func (m Mix) needBooks() bool {
+	return m[OpGet] > 0 || m[OpUpdate] > 0
+}
+
+//picker 按照权重随机选择请求类型，同一个种子选择的顺序相同
+type picker struct {
+	ops     []Operation
+	weights []int
+	total   int
+}
+
+func newPicker(mix Mix) *picker {
+	p := &picker{}
+	for op := range mix {
+		p.ops = append(p.ops, op)
+	}
+	//map 的遍历顺序随机，排序之后才能由种子决定选择的顺序
+	sort.Slice(p.ops, func(i, j int) bool { return p.ops[i] < p.ops[j] })
+	for _, op := range p.ops {
+		p.weights = append(p.weights, mix[op])
+		p.total += mix[op]
+	}
+	return p
+}
+
+func (p *picker) pick(rng *rand.Rand) Operation {
+	n := rng.Intn(p.total)
+	for i, weight := range p.weights {
+		if n < weight {
+			return p.ops[i]
+		}
+		n -= weight
+	}
+	return p.ops[len(p.ops)-1]
+}
@@ -0,0 +1,133 @@
+package loadgen
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	StatusError   = "error"   //StatusError 请求没有收到响应，例如连接失败或超时
+	StatusDropped = "dropped" //StatusDropped 进行中的请求达到上限，没有发送
+)
+
+//Report 一次压测的结果，JSON 格式便于比较多次压测
+type Report struct {
+	Start       time.Time `json:"start"`
+	Duration    float64   `json:"duration_seconds"`
+	TargetRPS   float64   `json:"target_rps"`
+	AchievedRPS float64   `json:"achieved_rps"`
+	Seed        int64     `json:"seed"`
+	Mix         Mix       `json:"mix"`
+	//Total 所有请求的汇总
+	Total      *OperationReport               `json:"total"`
+	Operations map[Operation]*OperationReport `json:"operations"`
+}
+
+//OperationReport 一类请求的结果，状态码大于等于 400、没有响应与没有发送的请求都是错误
+type OperationReport struct {
+	Requests  int64            `json:"requests"`
+	Errors    int64            `json:"errors"`
+	ErrorRate float64          `json:"error_rate"`
+	Status    map[string]int64 `json:"status"`
+	Latency   Latency          `json:"latency"`
+}
+
+//Latency 延迟的统计，单位为毫秒，从计划发送的时间开始计算，包含了客户端排队的时间
+type Latency struct {
+	Min  float64 `json:"min_ms"`
+	Mean float64 `json:"mean_ms"`
+	P50  float64 `json:"p50_ms"`
+	P90  float64 `json:"p90_ms"`
+	P95  float64 `json:"p95_ms"`
+	P99  float64 `json:"p99_ms"`
+	P999 float64 `json:"p99_9_ms"`
+	Max  float64 `json:"max_ms"`
+}
+
+//collector 记录一类请求的结果
+type collector struct {
+	histogram *Histogram
+	requests  int64
+	errors    int64
+	status    map[string]int64
+}
+
+func newCollector() *collector {
+	return &collector{histogram: NewHistogram(), status: make(map[string]int64)}
+}
+
+//record code 为 0 时请求没有收到响应，dropped 为 true 时没有发送，都不记录延迟
+func (c *collector) record(code int, dropped bool, latency time.Duration) {
+	c.requests++
+	switch {
+	case dropped:
+		c.errors++
+		c.status[StatusDropped]++
+		return
+	case code == 0:
+		c.errors++
+		c.status[StatusError]++
+		return
+	case code >= 400:
+		c.errors++
+	}
+	c.status[strconv.Itoa(code)]++
+	c.histogram.Record(latency)
+}
+
+func (c *collector) report() *OperationReport {
+	report := &OperationReport{Requests: c.requests, Errors: c.errors, Status: c.status}
+	if c.requests > 0 {
+		report.ErrorRate = float64(c.errors) / float64(c.requests)
+	}
+	h := c.histogram
+	report.Latency = Latency{
+		Min:  milliseconds(h.Min()),
+		Mean: milliseconds(h.Mean()),
+		P50:  milliseconds(h.Percentile(50)),
+		P90:  milliseconds(h.Percentile(90)),
+		P95:  milliseconds(h.Percentile(95)),
+		P99:  milliseconds(h.Percentile(99)),
+		P999: milliseconds(h.Percentile(99.9)),
+		Max:  milliseconds(h.Max()),
+	}
+	return report
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+//WriteJSON 以缩进的 JSON 写入报告
+func (r *Report) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
+
+//WriteText 以表格写入报告的摘要
+func (r *Report) WriteText(w io.Writer) error {
+	fmt.Fprintf(w, "duration %.1fs, target %.1f rps, achieved %.1f rps\n", r.Duration, r.TargetRPS, r.AchievedRPS)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "OPERATION\tREQUESTS\tERRORS\tP50\tP90\tP99\tP99.9\tMAX")
+	ops := make([]Operation, 0, len(r.Operations))
+	for op := range r.Operations {
+		ops = append(ops, op)
+	}
+	sort.Slice(ops, func(i, j int) bool { return ops[i] < ops[j] })
+	row := func(name string, report *OperationReport) {
+		fmt.Fprintf(tw, "%s\t%d\t%.2f%%\t%.1fms\t%.1fms\t%.1fms\t%.1fms\t%.1fms\n", name,
+			report.Requests, report.ErrorRate*100, report.Latency.P50, report.Latency.P90,
+			report.Latency.P99, report.Latency.P999, report.Latency.Max)
+	}
+	for _, op := range ops {
+		row(string(op), r.Operations[op])
+	}
+	row("total", r.Total)
+	return tw.Flush()
+}
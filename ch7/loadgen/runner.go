@@ -0,0 +1,296 @@
+package loadgen
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/model"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/seed"
+)
+
+//tenantHeader 与 api.TenantHeader 相同，压测工具只依赖 HTTP 接口
+const tenantHeader = "X-Tenant-ID"
+
+//listPages 列表请求随机访问前几页
+const listPages = 5
+
+//defaultMaxInFlight MaxInFlight 不大于 0 时进行中的请求数量上限
+const defaultMaxInFlight = 1000
+
+//ErrNoBooks 请求比例中有 get 或 update，但是没有可以访问的 Book
+var ErrNoBooks = errors.New("no books to get or update, prefill some books or add create to the mix")
+
+//Config 压测的配置
+type Config struct {
+	//BaseURL 服务地址，例如 http://127.0.0.1:8080
+	BaseURL string
+	//Tenant 不为空时通过请求头指定租户
+	Tenant string
+	//RPS 每秒发送的请求数量，按照固定的间隔发送，不等待之前的请求完成
+	RPS      float64
+	Duration time.Duration
+	Mix      Mix
+	//Seed 决定请求的顺序与创建的 Book，相同的种子发送相同的请求
+	Seed int64
+	//MaxInFlight 进行中的请求达到上限时不再发送，记为 dropped，避免服务变慢时客户端耗尽资源
+	MaxInFlight int
+	//Prefill 开始计时之前创建的 Book 数量，用于 get 与 update，不计入结果
+	Prefill int
+	//Client 为 nil 时使用 NewClient 创建，不设置超时
+	Client *http.Client
+}
+
+//NewClient 创建压测使用的 http.Client。默认的 Transport 每个 host 只保留 2 个空闲连接，
+//并发请求完成后多余的连接被关闭，下一批请求需要重新建立连接，因此连接池按照 maxInFlight 设置
+func NewClient(maxInFlight int, timeout time.Duration) *http.Client {
+	if maxInFlight <= 0 {
+		maxInFlight = defaultMaxInFlight
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConns = maxInFlight
+	transport.MaxIdleConnsPerHost = maxInFlight
+	transport.MaxConnsPerHost = maxInFlight
+	return &http.Client{Transport: transport, Timeout: timeout}
+}
+
+//Run 按照配置发送请求并返回报告。请求的发送时间是固定的（开环），
+//延迟从计划发送的时间开始计算，服务变慢时排队的时间也计入延迟，不会因为客户端等待而低估延迟
+func Run(ctx context.Context, cfg Config) (*Report, error) {
+	if cfg.RPS <= 0 || cfg.Duration <= 0 {
+		return nil, errors.New("rps and duration must be positive")
+	}
+	if cfg.Client == nil {
+		cfg.Client = NewClient(cfg.MaxInFlight, 0)
+	}
+	r := &runner{
+		cfg:        cfg,
+		rng:        rand.New(rand.NewSource(cfg.Seed)),
+		generator:  seed.NewGenerator(cfg.Seed),
+		picker:     newPicker(cfg.Mix),
+		total:      newCollector(),
+		operations: make(map[Operation]*collector),
+	}
+	for op, weight := range cfg.Mix {
+		if weight > 0 {
+			r.operations[op] = newCollector()
+		}
+	}
+	if err := r.prefill(ctx); err != nil {
+		return nil, err
+	}
+	return r.run(ctx), nil
+}
+
+type runner struct {
+	cfg       Config
+	rng       *rand.Rand
+	generator *seed.Generator
+	picker    *picker
+
+	mu         sync.Mutex
+	bookIds    []uint
+	total      *collector
+	operations map[Operation]*collector
+}
+
+//request 调度时生成的请求，rng 不是并发安全的，请求的内容都在调度的协程中生成
+type request struct {
+	op     Operation
+	method string
+	path   string
+	body   []byte
+	//collect 为 true 时响应中的 Book 加入 get 与 update 的候选
+	collect bool
+}
+
+//prefill 创建 Prefill 个 Book，并读取第一页已有的 Book
+func (r *runner) prefill(ctx context.Context) error {
+	for i := 0; i < r.cfg.Prefill; i++ {
+		code, err := r.do(ctx, r.create())
+		if err != nil {
+			return fmt.Errorf("prefill books failed: %w", err)
+		}
+		if code != http.StatusOK {
+			return fmt.Errorf("prefill books failed: status %d", code)
+		}
+	}
+	if _, err := r.do(ctx, request{op: OpList, method: http.MethodGet, path: "/books/?page_size=100", collect: true}); err != nil {
+		return fmt.Errorf("list books failed: %w", err)
+	}
+	if r.cfg.Mix.needBooks() && len(r.bookIds) == 0 {
+		return ErrNoBooks
+	}
+	return nil
+}
+
+func (r *runner) run(ctx context.Context) *Report {
+	interval := time.Duration(float64(time.Second) / r.cfg.RPS)
+	start := time.Now()
+	end := start.Add(r.cfg.Duration)
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	var wg sync.WaitGroup
+	inFlight := make(chan struct{}, r.maxInFlight())
+schedule:
+	for i := 0; ; i++ {
+		due := start.Add(time.Duration(i) * interval)
+		if !due.Before(end) {
+			break
+		}
+		if wait := time.Until(due); wait > 0 {
+			timer.Reset(wait)
+			select {
+			case <-ctx.Done():
+				break schedule
+			case <-timer.C:
+			}
+		}
+		req := r.next()
+		select {
+		case inFlight <- struct{}{}:
+		default:
+			r.record(req.op, 0, true, 0)
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			code, _ := r.do(ctx, req)
+			<-inFlight
+			r.record(req.op, code, false, time.Since(due))
+		}()
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	report := &Report{
+		Start:      start,
+		Duration:   elapsed.Seconds(),
+		TargetRPS:  r.cfg.RPS,
+		Seed:       r.cfg.Seed,
+		Mix:        r.cfg.Mix,
+		Total:      r.total.report(),
+		Operations: make(map[Operation]*OperationReport, len(r.operations)),
+	}
+	report.AchievedRPS = float64(r.total.requests-r.total.status[StatusDropped]) / elapsed.Seconds()
+	for op, c := range r.operations {
+		report.Operations[op] = c.report()
+	}
+	return report
+}
+
+func (r *runner) maxInFlight() int {
+	if r.cfg.MaxInFlight > 0 {
+		return r.cfg.MaxInFlight
+	}
+	return defaultMaxInFlight
+}
+
+func (r *runner) record(op Operation, code int, dropped bool, latency time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.operations[op].record(code, dropped, latency)
+	r.total.record(code, dropped, latency)
+}
+
+//next 按照比例生成下一个请求
+func (r *runner) next() request {
+	op := r.picker.pick(r.rng)
+	switch op {
+	case OpCreate:
+		return r.create()
+	case OpGet:
+		return request{op: op, method: http.MethodGet, path: fmt.Sprintf("/books/%d", r.bookId())}
+	case OpUpdate:
+		book := r.generator.Next()
+		body, _ := json.Marshal(&model.Book{Title: book.Title, Weight: book.Weight})
+		return request{op: op, method: http.MethodPatch, path: fmt.Sprintf("/books/%d", r.bookId()), body: body}
+	default:
+		return request{op: op, method: http.MethodGet,
+			path: fmt.Sprintf("/books/?page_number=%d&page_size=20", r.rng.Intn(listPages))}
+	}
+}
+
+//create 生成新增 Book 的请求，不指定 ISBN，多次压测同一个库时不会因为 ISBN 重复而失败
+func (r *runner) create() request {
+	book := r.generator.Next()
+	book.ISBN10, book.ISBN13 = "", ""
+	body, _ := json.Marshal(book)
+	return request{op: OpCreate, method: http.MethodPost, path: "/books/", body: body, collect: true}
+}
+
+func (r *runner) bookId() uint {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.bookIds[r.rng.Intn(len(r.bookIds))]
+}
+
+//do 发送请求并返回状态码，没有收到响应时返回错误
+func (r *runner) do(ctx context.Context, req request) (int, error) {
+	var body io.Reader
+	if req.body != nil {
+		body = bytes.NewReader(req.body)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, req.method, strings.TrimSuffix(r.cfg.BaseURL, "/")+req.path, body)
+	if err != nil {
+		return 0, err
+	}
+	if req.body != nil {
+		httpReq.Header.Set("Content-Type", "application/json")
+	}
+	if r.cfg.Tenant != "" {
+		httpReq.Header.Set(tenantHeader, r.cfg.Tenant)
+	}
+	resp, err := r.cfg.Client.Do(httpReq)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != http.StatusOK || !req.collect {
+		_, err = io.Copy(io.Discard, resp.Body)
+		return resp.StatusCode, err
+	}
+	var response struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return resp.StatusCode, err
+	}
+	r.collectIds(req.op, response.Data)
+	return resp.StatusCode, nil
+}
+
+func (r *runner) collectIds(op Operation, data json.RawMessage) {
+	var ids []uint
+	if op == OpCreate {
+		var book model.Book
+		if json.Unmarshal(data, &book) == nil && book.ID > 0 {
+			ids = append(ids, book.ID)
+		}
+	} else {
+		var list struct {
+			Books []model.Book `json:"books"`
+		}
+		if json.Unmarshal(data, &list) == nil {
+			for _, book := range list.Books {
+				ids = append(ids, book.ID)
+			}
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.bookIds = append(r.bookIds, ids...)
+}
@@ -28,6 +28,19 @@ type Book struct {
 	Author string `json:"author,omitempty" json:"author,omitempty"`
 	Pages  int32  `json:"pages" json:"pages,omitempty"`
 	Weight int32  `json:"weight,omitempty" json:"weight,omitempty"` // 存储时使用g
+	ISBN10 ISBN   `gorm:"size:10" json:"isbn10,omitempty"`
+	//ISBN13 唯一索引包含软删除的行，删除 Book 时清空 ISBN，之后可以再次添加
+	ISBN13 ISBN   `gorm:"size:13;uniqueIndex:idx_books_tenant_isbn,priority:2" json:"isbn13,omitempty"`
+	//TenantID 所属租户，ISBN 在租户内未删除的 Book 中唯一
+	TenantID string `gorm:"size:64;uniqueIndex:idx_books_tenant_isbn,priority:1" json:"-"`
+	//Covers 封面各尺寸的访问地址，不保存在 books 表中
+	Covers map[string]string `gorm:"-" json:"covers,omitempty"`
+	//Language 与 Description 来自按照 Accept-Language 选择的翻译，不保存在 books 表中
+	Language    string `gorm:"-" json:"language,omitempty"`
+	Description string `gorm:"-" json:"description,omitempty"`
+	//AverageRating 与 ReviewCount 来自 book_ratings，只在按照评价排序查询时读取
+	AverageRating float64 `gorm:"->;-:migration" json:"average_rating,omitempty"`
+	ReviewCount   int64   `gorm:"->;-:migration" json:"review_count,omitempty"`
 }
 
 //NewBookFromJSON 通过json创建 Book 对象
@@ -39,6 +52,31 @@ func NewBookFromJSON(data string) (*Book, error) {
 	return &b, nil
 }
 
+//NormalizeISBN 规范化 ISBN10 与 ISBN13，只提供其中一个时自动补全另一个，
+//两个都提供时必须是同一本书
+func (b *Book) NormalizeISBN() error {
+	if b.ISBN10 == "" && b.ISBN13 == "" {
+		return nil
+	}
+	var isbn13 ISBN
+	for _, isbn := range []ISBN{b.ISBN13, b.ISBN10} {
+		if isbn == "" {
+			continue
+		}
+		normalized, err := NormalizeISBN(string(isbn))
+		if err != nil {
+			return err
+		}
+		if isbn13 != "" && isbn13 != normalized {
+			return fmt.Errorf("isbn10 %s and isbn13 %s mismatch", b.ISBN10, b.ISBN13)
+		}
+		isbn13 = normalized
+	}
+	b.ISBN13 = isbn13
+	b.ISBN10, _ = ISBN13To10(isbn13)
+	return nil
+}
+
 //Catalog 返回 Book 类型
 func (b Book) Catalog() Catalog {
 	if b.Pages < MaxShortStoryPages {
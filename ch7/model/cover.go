@@ -0,0 +1,16 @@
+package model
+
+import "time"
+
+//Cover Book 封面的一个尺寸，原图的 Size 为 "original"
+type Cover struct {
+	ID          uint      `gorm:"primarykey" json:"-"`
+	CreatedAt   time.Time `json:"created_at"`
+	TenantID    string    `gorm:"size:64;index" json:"-"`
+	BookID      uint      `gorm:"uniqueIndex:idx_cover_book_size" json:"book_id"`
+	Size        string    `gorm:"size:32;uniqueIndex:idx_cover_book_size" json:"size"`
+	Key         string    `gorm:"size:255" json:"-"`
+	ContentType string    `gorm:"size:64" json:"content_type"`
+	Width       int       `json:"width"`
+	Height      int       `json:"height"`
+}
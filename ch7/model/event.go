@@ -0,0 +1,60 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+//EventType 领域事件类型
+type EventType string
+
+const (
+	EventBookCreated EventType = "book.created" //EventBookCreated 新增 Book
+	EventBookUpdated EventType = "book.updated" //EventBookUpdated 更新 Book
+	EventBookDeleted EventType = "book.deleted" //EventBookDeleted 删除 Book
+
+	EventReviewSaved   EventType = "review.saved"   //EventReviewSaved 创建或替换评价，Payload 为 Review
+	EventReviewDeleted EventType = "review.deleted" //EventReviewDeleted 删除评价，Payload 为删除的 Review
+	EventLoanCreated   EventType = "loan.created"   //EventLoanCreated 借出 Book，Payload 为 Loan
+)
+
+//IsBookEvent 返回是否是 Book 自身的事件，只有 Book 事件的 Payload 是 Book
+func (t EventType) IsBookEvent() bool {
+	switch t {
+	case EventBookCreated, EventBookUpdated, EventBookDeleted:
+		return true
+	default:
+		return false
+	}
+}
+
+//OutboxEvent 与业务数据在同一个事务中写入的领域事件，由 relay 异步投递
+type OutboxEvent struct {
+	ID          uint            `gorm:"primarykey" json:"id"`
+	CreatedAt   time.Time       `json:"created_at"`
+	TenantID    string          `gorm:"size:64;index" json:"tenant_id,omitempty"`
+	Type        EventType       `gorm:"size:64;index" json:"type"`
+	AggregateID uint            `gorm:"index" json:"aggregate_id"`
+	Payload     json.RawMessage `gorm:"type:text" json:"payload"`
+	PublishedAt *time.Time      `gorm:"index" json:"published_at,omitempty"`
+	Attempts    int             `json:"-"`
+	LastError   string          `gorm:"type:text" json:"-"`
+}
+
+//NewBookEvent 创建 Book 相关的事件
+func NewBookEvent(eventType EventType, book *Book) (*OutboxEvent, error) {
+	return NewEvent(eventType, book.ID, book)
+}
+
+//NewEvent 创建事件，aggregateId 为事件所属的 Book
+func NewEvent(eventType EventType, aggregateId uint, payload interface{}) (*OutboxEvent, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	return &OutboxEvent{
+		Type:        eventType,
+		AggregateID: aggregateId,
+		Payload:     data,
+	}, nil
+}
@@ -0,0 +1,110 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+//ErrUnknownField fields 参数中包含不支持的字段
+var ErrUnknownField = errors.New("unknown field")
+
+//bookField 可以通过 fields 参数选择的 Book 字段，columns 为计算该字段需要读取的列
+type bookField struct {
+	columns []string
+	value   func(b *Book) (interface{}, error)
+}
+
+//bookFields fields 参数支持的字段，包括 books 表的列、handler 填充的字段与计算字段
+var bookFields = map[string]bookField{
+	"id":         {[]string{"id"}, func(b *Book) (interface{}, error) { return b.ID, nil }},
+	"created_at": {[]string{"created_at"}, func(b *Book) (interface{}, error) { return b.CreatedAt, nil }},
+	"updated_at": {[]string{"updated_at"}, func(b *Book) (interface{}, error) { return b.UpdatedAt, nil }},
+	"title":      {[]string{"title"}, func(b *Book) (interface{}, error) { return b.Title, nil }},
+	"author":     {[]string{"author"}, func(b *Book) (interface{}, error) { return b.Author, nil }},
+	"pages":      {[]string{"pages"}, func(b *Book) (interface{}, error) { return b.Pages, nil }},
+	"weight":     {[]string{"weight"}, func(b *Book) (interface{}, error) { return b.Weight, nil }},
+	"isbn10":     {[]string{"isbn10"}, func(b *Book) (interface{}, error) { return b.ISBN10, nil }},
+	"isbn13":     {[]string{"isbn13"}, func(b *Book) (interface{}, error) { return b.ISBN13, nil }},
+	//不保存在 books 表中，由 handler 或者排序条件填充
+	"covers":         {nil, func(b *Book) (interface{}, error) { return b.Covers, nil }},
+	"language":       {nil, func(b *Book) (interface{}, error) { return b.Language, nil }},
+	"description":    {nil, func(b *Book) (interface{}, error) { return b.Description, nil }},
+	"average_rating": {nil, func(b *Book) (interface{}, error) { return b.AverageRating, nil }},
+	"review_count":   {nil, func(b *Book) (interface{}, error) { return b.ReviewCount, nil }},
+	//计算字段
+	"catalog":      {[]string{"pages"}, func(b *Book) (interface{}, error) { return b.Catalog(), nil }},
+	"first_name":   {[]string{"author"}, func(b *Book) (interface{}, error) { return b.FirstName(), nil }},
+	"human_weight": {[]string{"weight"}, func(b *Book) (interface{}, error) { return b.HumanReadableWeight() }},
+}
+
+//BookFields 客户端选择的 Book 字段，为空时返回完整的 Book
+type BookFields []string
+
+//ParseBookFields 解析逗号分隔的字段列表，例如 title,author,pages，忽略重复的字段
+func ParseBookFields(s string) (BookFields, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+	var fields BookFields
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		if _, ok := bookFields[name]; !ok {
+			return nil, fmt.Errorf("%w: %q", ErrUnknownField, name)
+		}
+		if !seen[name] {
+			seen[name] = true
+			fields = append(fields, name)
+		}
+	}
+	return fields, nil
+}
+
+//Has 返回是否选择了字段 name，没有选择任何字段时表示选择所有字段
+func (f BookFields) Has(name string) bool {
+	if len(f) == 0 {
+		return true
+	}
+	for _, field := range f {
+		if field == name {
+			return true
+		}
+	}
+	return false
+}
+
+//Columns 返回需要从 books 表读取的列，始终包括读取封面、翻译等关联数据需要的 id，
+//以及生成 Last-Modified 需要的 updated_at。没有选择字段时返回 nil，表示读取所有列
+func (f BookFields) Columns() []string {
+	if len(f) == 0 {
+		return nil
+	}
+	columns := []string{"id", "updated_at"}
+	seen := map[string]bool{"id": true, "updated_at": true}
+	for _, name := range f {
+		for _, column := range bookFields[name].columns {
+			if !seen[column] {
+				seen[column] = true
+				columns = append(columns, column)
+			}
+		}
+	}
+	return columns
+}
+
+//Project 返回只包含选择字段的 Book，没有选择字段时返回 b
+func (f BookFields) Project(b *Book) (interface{}, error) {
+	if len(f) == 0 {
+		return b, nil
+	}
+	projected := make(map[string]interface{}, len(f))
+	for _, name := range f {
+		value, err := bookFields[name].value(b)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		projected[name] = value
+	}
+	return projected, nil
+}
@@ -0,0 +1,47 @@
+package model_test
+
+import (
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/model"
+)
+
+var _ = ginkgo.Describe("book fields", func() {
+	ginkgo.It("return nil when no field is selected", func() {
+		fields, err := model.ParseBookFields(" ")
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(fields).To(gomega.BeNil())
+		gomega.Expect(fields.Columns()).To(gomega.BeNil())
+		gomega.Expect(fields.Has("title")).To(gomega.BeTrue())
+	})
+
+	ginkgo.It("reject unknown fields", func() {
+		_, err := model.ParseBookFields("title,tenant_id")
+		gomega.Expect(err).To(gomega.MatchError(model.ErrUnknownField))
+		gomega.Expect(err.Error()).To(gomega.ContainSubstring("tenant_id"))
+	})
+
+	ginkgo.It("read the columns that computed fields depend on", func() {
+		fields, err := model.ParseBookFields("title, first_name,catalog,human_weight,covers,title")
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(fields).To(gomega.Equal(model.BookFields{"title", "first_name", "catalog", "human_weight", "covers"}))
+		gomega.Expect(fields.Columns()).To(gomega.Equal([]string{"id", "updated_at", "title", "author", "pages", "weight"}))
+		gomega.Expect(fields.Has("author")).To(gomega.BeFalse())
+	})
+
+	ginkgo.It("project only selected fields", func() {
+		fields, err := model.ParseBookFields("title,first_name,catalog,human_weight")
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		book := &model.Book{Title: "Les Miserables", Author: "Victor Hugo", Pages: 2783, Weight: 1200}
+
+		projected, err := fields.Project(book)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(projected).To(gomega.Equal(map[string]interface{}{
+			"title":        "Les Miserables",
+			"first_name":   "Victor",
+			"catalog":      model.CategoryNovel,
+			"human_weight": "1200g",
+		}))
+	})
+})
@@ -0,0 +1,50 @@
+package model
+
+import "time"
+
+//MovementType 库存变动类型
+type MovementType string
+
+const (
+	MovementReserve MovementType = "reserve" //MovementReserve 预留库存，例如下单未发货
+	MovementRelease MovementType = "release" //MovementRelease 释放预留，例如取消订单
+	MovementFulfill MovementType = "fulfill" //MovementFulfill 预留的库存出库
+	MovementAdjust  MovementType = "adjust"  //MovementAdjust 盘点、入库等直接调整在库数量
+)
+
+//Inventory Book 在某个仓库中的库存，Reserved 为已经预留但还未出库的数量
+type Inventory struct {
+	ID                uint      `gorm:"primarykey" json:"-"`
+	CreatedAt         time.Time `json:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at"`
+	TenantID          string    `gorm:"size:64;index" json:"-"`
+	BookID            uint      `gorm:"uniqueIndex:idx_inventory_book_warehouse" json:"book_id"`
+	Warehouse         string    `gorm:"size:64;uniqueIndex:idx_inventory_book_warehouse" json:"warehouse"`
+	OnHand            int64     `json:"on_hand"`
+	Reserved          int64     `json:"reserved"`
+	LowStockThreshold int64     `json:"low_stock_threshold"`
+}
+
+//Available 返回可以预留的数量
+func (i Inventory) Available() int64 {
+	return i.OnHand - i.Reserved
+}
+
+//IsLowStock 返回可用库存是否低于阈值
+func (i Inventory) IsLowStock() bool {
+	return i.Available() <= i.LowStockThreshold
+}
+
+//StockMovement 库存流水，每次变动记录变动数量与变动后的库存
+type StockMovement struct {
+	ID        uint         `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time    `json:"created_at"`
+	TenantID  string       `gorm:"size:64;index" json:"-"`
+	BookID    uint         `gorm:"index:idx_movement_book_warehouse" json:"book_id"`
+	Warehouse string       `gorm:"size:64;index:idx_movement_book_warehouse" json:"warehouse"`
+	Type      MovementType `gorm:"size:16" json:"type"`
+	Quantity  int64        `json:"quantity"`
+	OnHand    int64        `json:"on_hand"`
+	Reserved  int64        `json:"reserved"`
+	Reason    string       `gorm:"size:255" json:"reason,omitempty"`
+}
@@ -0,0 +1,116 @@
+package model
+
+import (
+	"database/sql/driver"
+	"errors"
+	"strings"
+)
+
+//ErrInvalidISBN ISBN 格式或校验位错误
+var ErrInvalidISBN = errors.New("invalid isbn")
+
+//ISBN 规范化后的 ISBN，不包含连字符；空值在数据库中保存为 NULL，
+//因此没有 ISBN 的 Book 不会违反唯一索引
+type ISBN string
+
+//Value 实现 driver.Valuer
+func (i ISBN) Value() (driver.Value, error) {
+	if i == "" {
+		return nil, nil
+	}
+	return string(i), nil
+}
+
+//Scan 实现 sql.Scanner
+func (i *ISBN) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case []byte:
+		*i = ISBN(v)
+	case string:
+		*i = ISBN(v)
+	default:
+		*i = ""
+	}
+	return nil
+}
+
+//NormalizeISBN 去掉连字符与空格并校验，ISBN-10 会转换为 ISBN-13
+func NormalizeISBN(isbn string) (ISBN, error) {
+	digits := strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(isbn))
+	switch len(digits) {
+	case 10:
+		if !validISBN10(digits) {
+			return "", ErrInvalidISBN
+		}
+		return ISBN10To13(ISBN(digits)), nil
+	case 13:
+		if !validISBN13(digits) {
+			return "", ErrInvalidISBN
+		}
+		return ISBN(digits), nil
+	default:
+		return "", ErrInvalidISBN
+	}
+}
+
+//ISBN10To13 将合法的 ISBN-10 转换为 978 开头的 ISBN-13
+func ISBN10To13(isbn10 ISBN) ISBN {
+	body := "978" + string(isbn10[:9])
+	return ISBN(body + string(isbn13CheckDigit(body)))
+}
+
+//ISBN13To10 将 978 开头的 ISBN-13 转换为 ISBN-10，979 开头的没有对应的 ISBN-10
+func ISBN13To10(isbn13 ISBN) (ISBN, bool) {
+	if !strings.HasPrefix(string(isbn13), "978") {
+		return "", false
+	}
+	body := string(isbn13[3:12])
+	return ISBN(body + string(isbn10CheckDigit(body))), true
+}
+
+//validISBN10 校验位为 0-10，10 用 X 表示
+func validISBN10(isbn string) bool {
+	for i := 0; i < 9; i++ {
+		if isbn[i] < '0' || isbn[i] > '9' {
+			return false
+		}
+	}
+	return isbn[9] == isbn10CheckDigit(isbn[:9])
+}
+
+func isbn10CheckDigit(body string) byte {
+	sum := 0
+	for i := 0; i < 9; i++ {
+		sum += int(body[i]-'0') * (10 - i)
+	}
+	check := (11 - sum%11) % 11
+	if check == 10 {
+		return 'X'
+	}
+	return byte('0' + check)
+}
+
+//validISBN13 奇数位权重为1，偶数位权重为3
+func validISBN13(isbn string) bool {
+	for i := 0; i < 13; i++ {
+		if isbn[i] < '0' || isbn[i] > '9' {
+			return false
+		}
+	}
+	if !strings.HasPrefix(isbn, "978") && !strings.HasPrefix(isbn, "979") {
+		return false
+	}
+	return isbn[12] == isbn13CheckDigit(isbn[:12])
+}
+
+func isbn13CheckDigit(body string) byte {
+	sum := 0
+	for i := 0; i < 12; i++ {
+		weight := 1
+		if i%2 == 1 {
+			weight = 3
+		}
+		sum += int(body[i]-'0') * weight
+	}
+	return byte('0' + (10-sum%10)%10)
+}
@@ -0,0 +1,54 @@
+package model_test
+
+import (
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/model"
+)
+
+var _ = ginkgo.Describe("isbn", func() {
+	ginkgo.DescribeTable("normalize isbn",
+		func(isbn string, expect model.ISBN, valid bool) {
+			normalized, err := model.NormalizeISBN(isbn)
+			if !valid {
+				gomega.Expect(err).To(gomega.MatchError(model.ErrInvalidISBN))
+				return
+			}
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(normalized).To(gomega.Equal(expect))
+		},
+		ginkgo.Entry("isbn-13 with hyphens", "978-0-306-40615-7", model.ISBN("9780306406157"), true),
+		ginkgo.Entry("isbn-10 is converted to isbn-13", "0-306-40615-2", model.ISBN("9780306406157"), true),
+		ginkgo.Entry("isbn-10 with X check digit", "0-8044-2957-x", model.ISBN("9780804429573"), true),
+		ginkgo.Entry("isbn-13 starts with 979", "979-10-90636-07-1", model.ISBN("9791090636071"), true),
+		ginkgo.Entry("isbn-13 with bad check digit", "978-0-306-40615-8", model.ISBN(""), false),
+		ginkgo.Entry("isbn-10 with bad check digit", "0-306-40615-3", model.ISBN(""), false),
+		ginkgo.Entry("isbn-13 with bad prefix", "123-0-306-40615-7", model.ISBN(""), false),
+		ginkgo.Entry("letters", "abcdefghij", model.ISBN(""), false),
+		ginkgo.Entry("wrong length", "12345", model.ISBN(""), false),
+	)
+
+	ginkgo.Describe("normalize book isbn", func() {
+		ginkgo.Context("only isbn-10 is given", func() {
+			ginkgo.It("fill isbn-13", func() {
+				b := &model.Book{ISBN10: "0-306-40615-2"}
+				gomega.Expect(b.NormalizeISBN()).To(gomega.Succeed())
+				gomega.Expect(b.ISBN13).To(gomega.Equal(model.ISBN("9780306406157")))
+				gomega.Expect(b.ISBN10).To(gomega.Equal(model.ISBN("0306406152")))
+			})
+		})
+		ginkgo.Context("isbn-13 starts with 979", func() {
+			ginkgo.It("leave isbn-10 empty", func() {
+				b := &model.Book{ISBN13: "9791090636071"}
+				gomega.Expect(b.NormalizeISBN()).To(gomega.Succeed())
+				gomega.Expect(b.ISBN10).To(gomega.BeEmpty())
+			})
+		})
+		ginkgo.Context("isbn-10 and isbn-13 mismatch", func() {
+			ginkgo.It("return error", func() {
+				b := &model.Book{ISBN10: "0-306-40615-2", ISBN13: "9780804429573"}
+				gomega.Expect(b.NormalizeISBN()).NotTo(gomega.Succeed())
+			})
+		})
+	})
+})
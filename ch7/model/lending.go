@@ -0,0 +1,181 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+//ErrInvalidTransition 当前状态不允许该操作
+var ErrInvalidTransition = errors.New("invalid state transition")
+
+//LendingPolicy 借阅规则
+type LendingPolicy struct {
+	LoanPeriod   time.Duration //LoanPeriod 每次借出或续借的期限
+	MaxRenewals  int           //MaxRenewals 最多续借次数
+	MaxLoans     int           //MaxLoans 每个会员同时借阅的最大数量
+	PickupWindow time.Duration //PickupWindow 预约的书到馆后保留的时间
+}
+
+//DefaultLendingPolicy 默认借阅规则
+var DefaultLendingPolicy = LendingPolicy{
+	LoanPeriod:   21 * 24 * time.Hour,
+	MaxRenewals:  2,
+	MaxLoans:     5,
+	PickupWindow: 3 * 24 * time.Hour,
+}
+
+//Member 图书馆会员
+type Member struct {
+	gorm.Model
+	TenantID string `gorm:"size:64;index" json:"-"`
+	Name     string `gorm:"size:255" json:"name"`
+	Email    string `gorm:"size:255" json:"email"`
+}
+
+//Holding 图书馆持有的 Book 副本数量，只有设置了 Holding 的 Book 可以借阅
+type Holding struct {
+	ID        uint      `gorm:"primarykey" json:"-"`
+	UpdatedAt time.Time `json:"updated_at"`
+	TenantID  string    `gorm:"size:64;index" json:"-"`
+	BookID    uint      `gorm:"uniqueIndex" json:"book_id"`
+	Copies    int       `json:"copies"`
+}
+
+//LoanStatus 借阅状态，逾期由 DueAt 计算，不单独作为状态
+type LoanStatus string
+
+const (
+	LoanActive   LoanStatus = "active"   //LoanActive 借出中
+	LoanReturned LoanStatus = "returned" //LoanReturned 已归还
+)
+
+//Loan 一次借阅
+type Loan struct {
+	ID           uint       `gorm:"primarykey" json:"id"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+	TenantID     string     `gorm:"size:64;index" json:"-"`
+	BookID       uint       `gorm:"index" json:"book_id"`
+	MemberID     uint       `gorm:"index" json:"member_id"`
+	Status       LoanStatus `gorm:"size:16;index" json:"status"`
+	CheckedOutAt time.Time  `json:"checked_out_at"`
+	DueAt        time.Time  `gorm:"index" json:"due_at"`
+	ReturnedAt   *time.Time `json:"returned_at,omitempty"`
+	Renewals     int        `json:"renewals"`
+}
+
+//NewLoan 借出 Book
+func NewLoan(bookId, memberId uint, now time.Time, policy LendingPolicy) *Loan {
+	return &Loan{
+		BookID:       bookId,
+		MemberID:     memberId,
+		Status:       LoanActive,
+		CheckedOutAt: now,
+		DueAt:        now.Add(policy.LoanPeriod),
+	}
+}
+
+//IsOverdue 返回是否逾期未还
+func (l Loan) IsOverdue(now time.Time) bool {
+	return l.Status == LoanActive && now.After(l.DueAt)
+}
+
+//Renew 续借，从当前到期时间顺延一个借阅期限，逾期后不能续借
+func (l *Loan) Renew(now time.Time, policy LendingPolicy) error {
+	if l.Status != LoanActive || l.IsOverdue(now) {
+		return fmt.Errorf("%w: can not renew %s loan", ErrInvalidTransition, l.Status)
+	}
+	if l.Renewals >= policy.MaxRenewals {
+		return fmt.Errorf("%w: renewed %d times", ErrInvalidTransition, l.Renewals)
+	}
+	l.Renewals++
+	l.DueAt = l.DueAt.Add(policy.LoanPeriod)
+	return nil
+}
+
+//Return 归还
+func (l *Loan) Return(now time.Time) error {
+	if l.Status != LoanActive {
+		return fmt.Errorf("%w: loan is %s", ErrInvalidTransition, l.Status)
+	}
+	l.Status = LoanReturned
+	l.ReturnedAt = &now
+	return nil
+}
+
+//HoldStatus 预约状态
+type HoldStatus string
+
+const (
+	HoldWaiting   HoldStatus = "waiting"   //HoldWaiting 排队中
+	HoldReady     HoldStatus = "ready"     //HoldReady 已为会员保留副本，等待取书
+	HoldFulfilled HoldStatus = "fulfilled" //HoldFulfilled 会员已借出
+	HoldCancelled HoldStatus = "cancelled" //HoldCancelled 会员取消
+	HoldExpired   HoldStatus = "expired"   //HoldExpired 超过保留时间未取书
+)
+
+//holdTransitions 预约允许的状态变化
+var holdTransitions = map[HoldStatus][]HoldStatus{
+	HoldWaiting: {HoldReady, HoldCancelled},
+	HoldReady:   {HoldFulfilled, HoldCancelled, HoldExpired},
+}
+
+//Hold 预约，同一本书的预约按照 ID 先到先得
+type Hold struct {
+	ID        uint       `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	TenantID  string     `gorm:"size:64;index" json:"-"`
+	BookID    uint       `gorm:"index:idx_hold_book_status" json:"book_id"`
+	MemberID  uint       `gorm:"index" json:"member_id"`
+	Status    HoldStatus `gorm:"size:16;index:idx_hold_book_status" json:"status"`
+	ReadyAt   *time.Time `json:"ready_at,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+//IsOpen 返回预约是否还在等待或保留中
+func (h Hold) IsOpen() bool {
+	return h.Status == HoldWaiting || h.Status == HoldReady
+}
+
+func (h *Hold) transition(to HoldStatus) error {
+	for _, allowed := range holdTransitions[h.Status] {
+		if allowed == to {
+			h.Status = to
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: hold from %s to %s", ErrInvalidTransition, h.Status, to)
+}
+
+//MarkReady 为会员保留副本
+func (h *Hold) MarkReady(now time.Time, policy LendingPolicy) error {
+	if err := h.transition(HoldReady); err != nil {
+		return err
+	}
+	expiresAt := now.Add(policy.PickupWindow)
+	h.ReadyAt = &now
+	h.ExpiresAt = &expiresAt
+	return nil
+}
+
+//Fulfill 会员借出保留的副本
+func (h *Hold) Fulfill() error {
+	return h.transition(HoldFulfilled)
+}
+
+//Cancel 会员取消预约
+func (h *Hold) Cancel() error {
+	return h.transition(HoldCancelled)
+}
+
+//Expire 保留时间已过时使预约失效
+func (h *Hold) Expire(now time.Time) error {
+	if h.Status != HoldReady || h.ExpiresAt == nil || !now.After(*h.ExpiresAt) {
+		return fmt.Errorf("%w: hold is not expired", ErrInvalidTransition)
+	}
+	return h.transition(HoldExpired)
+}
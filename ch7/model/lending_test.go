@@ -0,0 +1,86 @@
+package model_test
+
+import (
+	"time"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/model"
+)
+
+var _ = ginkgo.Describe("lending", func() {
+	policy := model.LendingPolicy{
+		LoanPeriod:   7 * 24 * time.Hour,
+		MaxRenewals:  1,
+		MaxLoans:     2,
+		PickupWindow: 24 * time.Hour,
+	}
+	now := time.Date(2022, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	ginkgo.Describe("loan", func() {
+		ginkgo.It("is due after the loan period", func() {
+			loan := model.NewLoan(1, 2, now, policy)
+			gomega.Expect(loan.Status).To(gomega.Equal(model.LoanActive))
+			gomega.Expect(loan.DueAt).To(gomega.Equal(now.Add(7 * 24 * time.Hour)))
+			gomega.Expect(loan.IsOverdue(loan.DueAt)).To(gomega.BeFalse())
+			gomega.Expect(loan.IsOverdue(loan.DueAt.Add(time.Second))).To(gomega.BeTrue())
+		})
+
+		ginkgo.It("renew extends from the due date until the renewal limit", func() {
+			loan := model.NewLoan(1, 2, now, policy)
+			gomega.Expect(loan.Renew(now.Add(time.Hour), policy)).To(gomega.Succeed())
+			gomega.Expect(loan.DueAt).To(gomega.Equal(now.Add(14 * 24 * time.Hour)))
+			gomega.Expect(loan.Renewals).To(gomega.Equal(1))
+			gomega.Expect(loan.Renew(now.Add(time.Hour), policy)).To(gomega.MatchError(model.ErrInvalidTransition))
+		})
+
+		ginkgo.It("can not renew an overdue loan", func() {
+			loan := model.NewLoan(1, 2, now, policy)
+			gomega.Expect(loan.Renew(loan.DueAt.Add(time.Hour), policy)).To(gomega.MatchError(model.ErrInvalidTransition))
+		})
+
+		ginkgo.It("return only once & never overdue after returned", func() {
+			loan := model.NewLoan(1, 2, now, policy)
+			returnedAt := loan.DueAt.Add(time.Hour)
+			gomega.Expect(loan.Return(returnedAt)).To(gomega.Succeed())
+			gomega.Expect(loan.Status).To(gomega.Equal(model.LoanReturned))
+			gomega.Expect(*loan.ReturnedAt).To(gomega.Equal(returnedAt))
+			gomega.Expect(loan.IsOverdue(returnedAt.Add(time.Hour))).To(gomega.BeFalse())
+			gomega.Expect(loan.Return(returnedAt)).To(gomega.MatchError(model.ErrInvalidTransition))
+			gomega.Expect(loan.Renew(returnedAt, policy)).To(gomega.MatchError(model.ErrInvalidTransition))
+		})
+	})
+
+	ginkgo.Describe("hold", func() {
+		ginkgo.It("ready holds expire after the pickup window", func() {
+			hold := &model.Hold{Status: model.HoldWaiting}
+			gomega.Expect(hold.Expire(now)).To(gomega.MatchError(model.ErrInvalidTransition))
+			gomega.Expect(hold.MarkReady(now, policy)).To(gomega.Succeed())
+			gomega.Expect(*hold.ExpiresAt).To(gomega.Equal(now.Add(24 * time.Hour)))
+			gomega.Expect(hold.Expire(now.Add(time.Hour))).To(gomega.MatchError(model.ErrInvalidTransition))
+			gomega.Expect(hold.Expire(now.Add(25 * time.Hour))).To(gomega.Succeed())
+			gomega.Expect(hold.Status).To(gomega.Equal(model.HoldExpired))
+			gomega.Expect(hold.IsOpen()).To(gomega.BeFalse())
+		})
+
+		ginkgo.DescribeTable("transitions",
+			func(from model.HoldStatus, transition func(h *model.Hold) error, to model.HoldStatus) {
+				hold := &model.Hold{Status: from}
+				err := transition(hold)
+				if to == "" {
+					gomega.Expect(err).To(gomega.MatchError(model.ErrInvalidTransition))
+					gomega.Expect(hold.Status).To(gomega.Equal(from))
+					return
+				}
+				gomega.Expect(err).NotTo(gomega.HaveOccurred())
+				gomega.Expect(hold.Status).To(gomega.Equal(to))
+			},
+			ginkgo.Entry("waiting to cancelled", model.HoldWaiting, (*model.Hold).Cancel, model.HoldCancelled),
+			ginkgo.Entry("waiting can not be fulfilled", model.HoldWaiting, (*model.Hold).Fulfill, model.HoldStatus("")),
+			ginkgo.Entry("ready to fulfilled", model.HoldReady, (*model.Hold).Fulfill, model.HoldFulfilled),
+			ginkgo.Entry("ready to cancelled", model.HoldReady, (*model.Hold).Cancel, model.HoldCancelled),
+			ginkgo.Entry("fulfilled can not be cancelled", model.HoldFulfilled, (*model.Hold).Cancel, model.HoldStatus("")),
+			ginkgo.Entry("cancelled can not be fulfilled", model.HoldCancelled, (*model.Hold).Fulfill, model.HoldStatus("")),
+		)
+	})
+})
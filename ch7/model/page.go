@@ -4,3 +4,17 @@ type PageOptions struct {
 	PageNumber int `json:"page_number"`
 	PageSize   int `json:"page_size"`
 }
+
+//BookQuery ListBooks 的查询条件
+type BookQuery struct {
+	PageOptions
+	Sort BookSort `json:"sort"`
+	//Tag 只返回带有该标签的 Book
+	Tag string `json:"tag"`
+	//SubjectID 只返回属于该主题或其子主题的 Book
+	SubjectID uint `json:"subject_id"`
+	//AfterID 只返回 ID 大于该值的 Book，按照 ID 顺序遍历大量数据时代替 PageNumber
+	AfterID uint `json:"after_id"`
+	//Columns 只读取 books 表的这些列，为空时读取所有列，见 BookFields.Columns
+	Columns []string `json:"-"`
+}
@@ -0,0 +1,41 @@
+package model
+
+import "time"
+
+//LikedRating 评分不低于该值的评价视为喜欢
+const LikedRating = 4
+
+//RecommendReason 推荐理由
+type RecommendReason string
+
+const (
+	ReasonCooccurrence RecommendReason = "also_liked"   //ReasonCooccurrence 喜欢该书的读者也喜欢
+	ReasonSameAuthor   RecommendReason = "same_author"  //ReasonSameAuthor 同一作者
+	ReasonSameCatalog  RecommendReason = "same_catalog" //ReasonSameCatalog 同一类型
+)
+
+//BookInteraction 读者喜欢或借阅过 Book，同一读者与同一本书只记录一次。
+//UserKey 区分来源，例如 "user:alice" 与 "member:3"
+type BookInteraction struct {
+	ID        uint      `gorm:"primarykey"`
+	CreatedAt time.Time
+	TenantID  string `gorm:"size:64;index"`
+	UserKey   string `gorm:"size:128;uniqueIndex:idx_interaction_user_book,priority:1"`
+	BookID    uint   `gorm:"uniqueIndex:idx_interaction_user_book,priority:2;index"`
+}
+
+//BookCooccurrence 同时与 BookID 和 OtherID 有交互的读者数量，每对 Book 双向各保存一条
+type BookCooccurrence struct {
+	ID          uint   `gorm:"primarykey"`
+	TenantID    string `gorm:"size:64;index"`
+	BookID      uint   `gorm:"uniqueIndex:idx_cooccurrence_pair,priority:1"`
+	OtherID     uint   `gorm:"uniqueIndex:idx_cooccurrence_pair,priority:2"`
+	Occurrences int64
+}
+
+//Recommendation 推荐的 Book，Score 只在按照共现推荐时有意义
+type Recommendation struct {
+	Book   *Book           `json:"book"`
+	Score  float64         `json:"score"`
+	Reason RecommendReason `json:"reason"`
+}
@@ -0,0 +1,67 @@
+package model
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	MinRating = 1 //MinRating 最低评分
+	MaxRating = 5 //MaxRating 最高评分
+)
+
+//ErrInvalidRating 评分不在 MinRating 与 MaxRating 之间
+var ErrInvalidRating = errors.New("rating must be between 1 and 5")
+
+//Review 用户对 Book 的评价，每个用户对同一本书只能有一条评价
+type Review struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	TenantID  string    `gorm:"size:64;index" json:"-"`
+	BookID    uint      `gorm:"uniqueIndex:idx_review_book_user,priority:1" json:"book_id"`
+	UserID    string    `gorm:"size:64;uniqueIndex:idx_review_book_user,priority:2" json:"user_id"`
+	Rating    int       `json:"rating"`
+	Text      string    `gorm:"type:text" json:"text"`
+}
+
+//Validate 检查评分
+func (r Review) Validate() error {
+	if r.Rating < MinRating || r.Rating > MaxRating {
+		return ErrInvalidRating
+	}
+	return nil
+}
+
+//BookRating Book 评价的汇总，在写入评价时增量维护
+type BookRating struct {
+	ID            uint      `gorm:"primarykey" json:"-"`
+	UpdatedAt     time.Time `json:"updated_at"`
+	TenantID      string    `gorm:"size:64;index" json:"-"`
+	BookID        uint      `gorm:"uniqueIndex" json:"book_id"`
+	ReviewCount   int64     `gorm:"index" json:"review_count"`
+	RatingSum     int64     `json:"-"`
+	AverageRating float64   `gorm:"index" json:"average_rating"`
+}
+
+//BookSort ListBooks 的排序方式
+type BookSort string
+
+const (
+	SortByID          BookSort = ""        //SortByID 按照创建顺序
+	SortByRating      BookSort = "rating"  //SortByRating 按照平均评分从高到低
+	SortByReviewCount BookSort = "reviews" //SortByReviewCount 按照评价数量从多到少
+)
+
+//ErrInvalidSort 不支持的排序方式
+var ErrInvalidSort = errors.New("invalid sort")
+
+//ParseBookSort 解析排序方式
+func ParseBookSort(s string) (BookSort, error) {
+	switch sort := BookSort(s); sort {
+	case SortByID, SortByRating, SortByReviewCount:
+		return sort, nil
+	default:
+		return "", ErrInvalidSort
+	}
+}
@@ -0,0 +1,69 @@
+package model
+
+import (
+	"errors"
+	"time"
+)
+
+//ErrNameRequired 名称不能为空
+var ErrNameRequired = errors.New("name is required")
+
+//Series 丛书，丛书中的 Book 按照 Position 排序
+type Series struct {
+	ID          uint           `gorm:"primarykey" json:"id"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	TenantID    string         `gorm:"size:64;index" json:"-"`
+	Name        string         `gorm:"size:255" json:"name"`
+	Description string         `gorm:"type:text" json:"description,omitempty"`
+	Entries     []*SeriesEntry `gorm:"-" json:"entries,omitempty"`
+}
+
+//Validate 检查丛书名称
+func (s Series) Validate() error {
+	if s.Name == "" {
+		return ErrNameRequired
+	}
+	return nil
+}
+
+//SeriesEntry Book 在丛书中的位置，一本 Book 只能属于一套丛书
+type SeriesEntry struct {
+	ID        uint      `gorm:"primarykey" json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+	TenantID  string    `gorm:"size:64;index" json:"-"`
+	SeriesID  uint      `gorm:"uniqueIndex:idx_series_entry_position,priority:1" json:"series_id"`
+	Position  int       `gorm:"uniqueIndex:idx_series_entry_position,priority:2" json:"position"`
+	BookID    uint      `gorm:"uniqueIndex" json:"book_id"`
+	Book      *Book     `gorm:"-" json:"book,omitempty"`
+}
+
+//Work 作品，同一作品的不同版本（精装、平装、修订版等）是不同的 Book
+type Work struct {
+	ID        uint       `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	TenantID  string     `gorm:"size:64;index" json:"-"`
+	Title     string     `gorm:"size:255" json:"title"`
+	Author    string     `gorm:"size:255" json:"author,omitempty"`
+	Editions  []*Edition `gorm:"-" json:"editions,omitempty"`
+}
+
+//Validate 检查作品名称
+func (w Work) Validate() error {
+	if w.Title == "" {
+		return ErrNameRequired
+	}
+	return nil
+}
+
+//Edition Book 是某个作品的一个版本，一本 Book 只能属于一个作品
+type Edition struct {
+	ID        uint      `gorm:"primarykey" json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+	TenantID  string    `gorm:"size:64;index" json:"-"`
+	WorkID    uint      `gorm:"index" json:"work_id"`
+	BookID    uint      `gorm:"uniqueIndex" json:"book_id"`
+	Label     string    `gorm:"size:128" json:"label,omitempty"`
+	Book      *Book     `gorm:"-" json:"book,omitempty"`
+}
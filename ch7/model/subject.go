@@ -0,0 +1,48 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+//Subject 主题分类，例如 Fiction > Fantasy > Epic。
+//Path 保存从根节点到自身的 ID，例如 "/1/4/9/"，使用前缀匹配查询子树
+type Subject struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	TenantID  string    `gorm:"size:64;index" json:"-"`
+	ParentID  *uint     `gorm:"index" json:"parent_id,omitempty"`
+	Name      string    `gorm:"size:255" json:"name"`
+	Path      string    `gorm:"size:512;index" json:"path"`
+}
+
+//Validate 检查主题名称
+func (s Subject) Validate() error {
+	if strings.TrimSpace(s.Name) == "" {
+		return ErrNameRequired
+	}
+	return nil
+}
+
+//SubjectPath 返回父节点路径为 parentPath 的主题的路径，根节点的 parentPath 为空
+func SubjectPath(parentPath string, id uint) string {
+	if parentPath == "" {
+		parentPath = "/"
+	}
+	return fmt.Sprintf("%s%d/", parentPath, id)
+}
+
+//Depth 返回主题的层级，根节点为 1
+func (s Subject) Depth() int {
+	return strings.Count(s.Path, "/") - 1
+}
+
+//BookSubject Book 与 Subject 的关联，一本 Book 可以属于多个主题
+type BookSubject struct {
+	ID        uint   `gorm:"primarykey"`
+	TenantID  string `gorm:"size:64;index"`
+	BookID    uint   `gorm:"uniqueIndex:idx_book_subject,priority:1"`
+	SubjectID uint   `gorm:"uniqueIndex:idx_book_subject,priority:2;index"`
+}
@@ -0,0 +1,62 @@
+package model
+
+import (
+	"errors"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+//MaxTagLength 标签的最大长度
+const MaxTagLength = 64
+
+//ErrInvalidTag 标签为空或者过长
+var ErrInvalidTag = errors.New("invalid tag")
+
+//Tag 编辑自由添加的标签，同一租户内名称唯一
+type Tag struct {
+	ID        uint      `gorm:"primarykey" json:"-"`
+	CreatedAt time.Time `json:"-"`
+	TenantID  string    `gorm:"size:64;uniqueIndex:idx_tag_tenant_name,priority:1" json:"-"`
+	Name      string    `gorm:"size:64;uniqueIndex:idx_tag_tenant_name,priority:2" json:"name"`
+}
+
+//BookTag Book 与 Tag 的关联
+type BookTag struct {
+	ID       uint   `gorm:"primarykey"`
+	TenantID string `gorm:"size:64;index"`
+	BookID   uint   `gorm:"uniqueIndex:idx_book_tag,priority:1"`
+	TagID    uint   `gorm:"uniqueIndex:idx_book_tag,priority:2;index"`
+}
+
+//TagCount 标签以及使用该标签的 Book 数量
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Count int64  `json:"count"`
+}
+
+//NormalizeTag 去掉首尾空白、合并连续空白并转换为小写，使 "Epic  Fantasy" 与 "epic fantasy" 是同一个标签
+func NormalizeTag(name string) (string, error) {
+	tag := strings.ToLower(strings.Join(strings.Fields(name), " "))
+	if tag == "" || utf8.RuneCountInString(tag) > MaxTagLength {
+		return "", ErrInvalidTag
+	}
+	return tag, nil
+}
+
+//NormalizeTags 规范化并去重，保持原有顺序
+func NormalizeTags(names []string) ([]string, error) {
+	tags := make([]string, 0, len(names))
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		tag, err := NormalizeTag(name)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+	return tags, nil
+}
@@ -0,0 +1,47 @@
+package model_test
+
+import (
+	"strings"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/model"
+)
+
+var _ = ginkgo.Describe("tag", func() {
+	ginkgo.DescribeTable("normalize",
+		func(name string, tag string) {
+			normalized, err := model.NormalizeTag(name)
+			if tag == "" {
+				gomega.Expect(err).To(gomega.MatchError(model.ErrInvalidTag))
+				return
+			}
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(normalized).To(gomega.Equal(tag))
+		},
+		ginkgo.Entry("lower case", "Fantasy", "fantasy"),
+		ginkgo.Entry("collapse spaces", "  Epic \t Fantasy ", "epic fantasy"),
+		ginkgo.Entry("keep unicode", "科幻", "科幻"),
+		ginkgo.Entry("empty", "   ", ""),
+		ginkgo.Entry("too long", strings.Repeat("a", model.MaxTagLength+1), ""),
+	)
+
+	ginkgo.It("deduplicate normalized tags in order", func() {
+		tags, err := model.NormalizeTags([]string{"Epic", "fantasy", "epic "})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(tags).To(gomega.Equal([]string{"epic", "fantasy"}))
+	})
+})
+
+var _ = ginkgo.Describe("subject", func() {
+	ginkgo.It("path contains ids from the root", func() {
+		root := model.Subject{Path: model.SubjectPath("", 1)}
+		gomega.Expect(root.Path).To(gomega.Equal("/1/"))
+		gomega.Expect(root.Depth()).To(gomega.Equal(1))
+
+		child := model.Subject{Path: model.SubjectPath(root.Path, 4)}
+		gomega.Expect(child.Path).To(gomega.Equal("/1/4/"))
+		gomega.Expect(child.Depth()).To(gomega.Equal(2))
+		gomega.Expect(strings.HasPrefix(child.Path, root.Path)).To(gomega.BeTrue())
+	})
+})
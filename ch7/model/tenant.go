@@ -0,0 +1,12 @@
+package model
+
+import "time"
+
+//Tenant 共享部署中的一个租户，各租户的数据通过 TenantID 隔离
+type Tenant struct {
+	ID        string    `gorm:"primarykey;size:64" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Name      string    `gorm:"size:255" json:"name"`
+	MaxBooks  int64     `json:"max_books"` //MaxBooks 租户最多可以创建的 Book 数量，0 表示不限制
+}
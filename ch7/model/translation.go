@@ -0,0 +1,61 @@
+package model
+
+import (
+	"time"
+
+	"golang.org/x/text/language"
+)
+
+//BookTranslation Book 某种语言的标题与简介，Language 为规范化后的 BCP 47 标签，例如 "zh-Hans"
+type BookTranslation struct {
+	ID          uint      `gorm:"primarykey" json:"-"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	TenantID    string    `gorm:"size:64;index" json:"-"`
+	BookID      uint      `gorm:"uniqueIndex:idx_translation_book_language" json:"book_id"`
+	Language    string    `gorm:"size:35;uniqueIndex:idx_translation_book_language" json:"language"`
+	Title       string    `gorm:"size:255" json:"title"`
+	Description string    `gorm:"type:text" json:"description,omitempty"`
+}
+
+//CanonicalLanguage 校验并规范化 BCP 47 标签，例如 "en-us" 返回 "en-US"
+func CanonicalLanguage(tag string) (string, error) {
+	t, err := language.Parse(tag)
+	if err != nil {
+		return "", err
+	}
+	return t.String(), nil
+}
+
+//NegotiateTranslation 按照 Accept-Language 选择最合适的翻译。
+//语言匹配使用 CLDR 的回退规则，例如 "pt-BR" 可以匹配 "pt"，"zh-TW" 可以匹配 "zh-Hant"；
+//没有可接受的翻译时返回 nil，此时使用 Book 原始的标题
+func NegotiateTranslation(translations []*BookTranslation, acceptLanguage string) *BookTranslation {
+	if len(translations) == 0 || acceptLanguage == "" {
+		return nil
+	}
+	desired, _, err := language.ParseAcceptLanguage(acceptLanguage)
+	if err != nil || len(desired) == 0 {
+		return nil
+	}
+	//第一个候选为默认值，匹配失败时返回，用 Und 表示原始标题
+	supported := []language.Tag{language.Und}
+	for _, t := range translations {
+		supported = append(supported, language.Make(t.Language))
+	}
+	_, index, confidence := language.NewMatcher(supported).Match(desired...)
+	if index == 0 || confidence == language.No {
+		return nil
+	}
+	return translations[index-1]
+}
+
+//Localize 使用翻译替换 Book 的标题与简介
+func (b *Book) Localize(t *BookTranslation) {
+	if t == nil {
+		return
+	}
+	b.Title = t.Title
+	b.Description = t.Description
+	b.Language = t.Language
+}
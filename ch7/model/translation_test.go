@@ -0,0 +1,57 @@
+package model_test
+
+import (
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/model"
+)
+
+var _ = ginkgo.Describe("translation", func() {
+	translations := []*model.BookTranslation{
+		{Language: "fr", Title: "Les Misérables"},
+		{Language: "pt-BR", Title: "Os Miseráveis"},
+		{Language: "zh-Hant", Title: "悲慘世界"},
+	}
+
+	ginkgo.DescribeTable("negotiate by Accept-Language",
+		func(acceptLanguage string, title string) {
+			t := model.NegotiateTranslation(translations, acceptLanguage)
+			if title == "" {
+				gomega.Expect(t).To(gomega.BeNil())
+				return
+			}
+			gomega.Expect(t).NotTo(gomega.BeNil())
+			gomega.Expect(t.Title).To(gomega.Equal(title))
+		},
+		ginkgo.Entry("exact match", "fr", "Les Misérables"),
+		ginkgo.Entry("region falls back to language", "fr-CA", "Les Misérables"),
+		ginkgo.Entry("language matches regional translation", "pt", "Os Miseráveis"),
+		ginkgo.Entry("region implies script", "zh-TW", "悲慘世界"),
+		ginkgo.Entry("first acceptable language by quality", "de;q=0.9, pt-BR;q=0.8, fr;q=0.5", "Os Miseráveis"),
+		ginkgo.Entry("no acceptable translation", "de, ja", ""),
+		ginkgo.Entry("invalid header", "!!", ""),
+		ginkgo.Entry("empty header", "", ""),
+	)
+
+	ginkgo.Describe("canonical language", func() {
+		ginkgo.It("normalize case", func() {
+			tag, err := model.CanonicalLanguage("en-us")
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(tag).To(gomega.Equal("en-US"))
+		})
+		ginkgo.It("reject invalid tags", func() {
+			_, err := model.CanonicalLanguage("not a tag")
+			gomega.Expect(err).To(gomega.HaveOccurred())
+		})
+	})
+
+	ginkgo.Describe("localize book", func() {
+		ginkgo.It("replace title with translation", func() {
+			b := &model.Book{Title: "Les Miserables", Author: "Victor Hugo"}
+			b.Localize(&model.BookTranslation{Language: "zh-Hant", Title: "悲慘世界", Description: "雨果"})
+			gomega.Expect(b.Title).To(gomega.Equal("悲慘世界"))
+			gomega.Expect(b.Language).To(gomega.Equal("zh-Hant"))
+			gomega.Expect(b.Description).To(gomega.Equal("雨果"))
+		})
+	})
+})
@@ -0,0 +1,162 @@
+package model
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+//EventTypes 逗号分隔存储的事件类型列表
+type EventTypes []EventType
+
+//Value 实现 driver.Valuer
+func (t EventTypes) Value() (driver.Value, error) {
+	parts := make([]string, 0, len(t))
+	for _, e := range t {
+		parts = append(parts, string(e))
+	}
+	return strings.Join(parts, ","), nil
+}
+
+//Scan 实现 sql.Scanner
+func (t *EventTypes) Scan(value interface{}) error {
+	*t = nil
+	for _, part := range splitColumn(value) {
+		*t = append(*t, EventType(part))
+	}
+	return nil
+}
+
+//Catalogs 逗号分隔存储的 Catalog 列表
+type Catalogs []Catalog
+
+//Value 实现 driver.Valuer
+func (c Catalogs) Value() (driver.Value, error) {
+	parts := make([]string, 0, len(c))
+	for _, catalog := range c {
+		parts = append(parts, strconv.Itoa(int(catalog)))
+	}
+	return strings.Join(parts, ","), nil
+}
+
+//Scan 实现 sql.Scanner
+func (c *Catalogs) Scan(value interface{}) error {
+	*c = nil
+	for _, part := range splitColumn(value) {
+		catalog, err := strconv.Atoi(part)
+		if err != nil {
+			return err
+		}
+		*c = append(*c, Catalog(catalog))
+	}
+	return nil
+}
+
+func splitColumn(value interface{}) []string {
+	var content string
+	switch v := value.(type) {
+	case []byte:
+		content = string(v)
+	case string:
+		content = v
+	}
+	if content == "" {
+		return nil
+	}
+	return strings.Split(content, ",")
+}
+
+//WebhookSubscription 订阅 Book 变更的 webhook，Events 与 Catalogs 为空时表示不过滤
+type WebhookSubscription struct {
+	gorm.Model
+	TenantID            string     `gorm:"size:64;index" json:"-"`
+	URL                 string     `gorm:"size:1024" json:"url"`
+	Secret              string     `gorm:"size:128" json:"secret,omitempty"`
+	Events              EventTypes `gorm:"size:255" json:"events"`
+	Catalogs            Catalogs   `gorm:"size:64" json:"catalogs"`
+	Active              bool       `json:"active"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	DisabledAt          *time.Time `json:"disabled_at,omitempty"`
+}
+
+//Validate 检查订阅参数
+func (s WebhookSubscription) Validate() error {
+	u, err := url.Parse(s.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid url %q", s.URL)
+	}
+	for _, e := range s.Events {
+		if !e.IsBookEvent() {
+			return fmt.Errorf("invalid event %q", e)
+		}
+	}
+	for _, c := range s.Catalogs {
+		if c != CategoryNovel && c != CategoryShortStory {
+			return fmt.Errorf("invalid catalog %d", c)
+		}
+	}
+	return nil
+}
+
+//Matches 返回事件是否需要投递给该订阅，订阅只接收本租户的事件
+func (s WebhookSubscription) Matches(event *OutboxEvent, book *Book) bool {
+	if !s.Active || s.TenantID != event.TenantID {
+		return false
+	}
+	if len(s.Events) > 0 && !containsEvent(s.Events, event.Type) {
+		return false
+	}
+	if len(s.Catalogs) > 0 && !containsCatalog(s.Catalogs, book.Catalog()) {
+		return false
+	}
+	return true
+}
+
+func containsEvent(events EventTypes, e EventType) bool {
+	for _, item := range events {
+		if item == e {
+			return true
+		}
+	}
+	return false
+}
+
+func containsCatalog(catalogs Catalogs, c Catalog) bool {
+	for _, item := range catalogs {
+		if item == c {
+			return true
+		}
+	}
+	return false
+}
+
+//WebhookDelivery 一个事件对一个订阅的投递，同时作为待投递的队列。
+//NextAttemptAt 不为空时等待投递或重试，投递成功或者重试次数用完之后清空；
+//投递前订阅已经停用或删除时 Skipped 为 true，不发送请求也不计入订阅的失败次数
+type WebhookDelivery struct {
+	ID             uint       `gorm:"primarykey" json:"id"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+	TenantID       string     `gorm:"size:64;index" json:"-"`
+	SubscriptionID uint       `gorm:"uniqueIndex:idx_webhook_deliveries_event,priority:1" json:"subscription_id"`
+	EventID        uint       `gorm:"uniqueIndex:idx_webhook_deliveries_event,priority:2" json:"event_id"`
+	EventType      EventType  `gorm:"size:64" json:"event_type"`
+	Payload        []byte     `json:"-"` //Payload 投递的请求体，重试时不需要再读取事件
+	Attempts       int        `json:"attempts"`
+	NextAttemptAt  *time.Time `gorm:"index" json:"next_attempt_at,omitempty"`
+	StatusCode     int        `json:"status_code"`
+	Success        bool       `json:"success"`
+	Skipped        bool       `json:"skipped"`
+	Error          string     `gorm:"type:text" json:"error,omitempty"`
+	DurationMs     int64      `json:"duration_ms"`
+}
+
+//Pending 是否还需要投递
+func (d WebhookDelivery) Pending() bool {
+	return d.NextAttemptAt != nil
+}
@@ -0,0 +1,220 @@
+package outbox
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/model"
+)
+
+//Store 保存 outbox 事件，service.Manager 实现了该接口
+type Store interface {
+	PendingEvents(limit int) ([]*model.OutboxEvent, error)
+	EventsAfter(afterId uint, limit int) ([]*model.OutboxEvent, error)
+	MarkEventPublished(eventId uint) error
+	MarkEventFailed(eventId uint, cause error) error
+}
+
+//Relay 轮询 outbox 表并将事件投递给所有 Sink。
+//每个 Sink 单独记录投递进度并按照写入顺序投递，一个 Sink 失败时只有它停在失败的事件上，
+//其他 Sink 继续投递。所有 Sink 都投递成功后事件才会被标记为已投递，
+//进度只保存在内存中，重启后从最早的未投递事件开始重新投递，因此是至少一次(at-least-once)语义
+type Relay struct {
+	Store        Store
+	Sinks        []Sink
+	BatchSize    int
+	PollInterval time.Duration
+	MaxRetries   int           //单次投递失败后的重试次数
+	Backoff      time.Duration //第一次重试前的等待时间，之后每次翻倍
+	Timeout      time.Duration //每次投递的超时时间，避免没有响应的 Sink 阻塞投递
+
+	//cursors 每个 Sink 已经投递的最后一个事件 ID，第一次 Flush 时初始化
+	cursors []uint
+}
+
+//NewRelay 使用默认参数创建 Relay
+func NewRelay(store Store, sinks ...Sink) *Relay {
+	return &Relay{
+		Store:        store,
+		Sinks:        sinks,
+		BatchSize:    100,
+		PollInterval: time.Second,
+		MaxRetries:   3,
+		Backoff:      100 * time.Millisecond,
+		Timeout:      10 * time.Second,
+	}
+}
+
+//Run 持续投递事件，直到 ctx 结束
+func (r *Relay) Run(ctx context.Context) error {
+	ticker := time.NewTicker(r.PollInterval)
+	defer ticker.Stop()
+	for {
+		if _, err := r.Flush(ctx); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			log.Printf("outbox relay flush failed: %s", err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+//sinkFailure 一个 Sink 投递失败的事件，读取事件失败时 eventId 为 0
+type sinkFailure struct {
+	eventId uint
+	err     error
+}
+
+//Flush 每个 Sink 同时从自己的进度开始投递一批事件，返回所有 Sink 都投递成功、被标记为已投递的事件数量。
+//Sink 遇到投递失败的事件时停止，下次 Flush 时从该事件重新开始，保证每个 Sink 按照写入顺序收到事件
+func (r *Relay) Flush(ctx context.Context) (int, error) {
+	if r.cursors == nil {
+		pending, err := r.Store.PendingEvents(1)
+		if err != nil || len(pending) == 0 {
+			return 0, err
+		}
+		r.cursors = make([]uint, len(r.Sinks))
+		for i := range r.cursors {
+			r.cursors[i] = pending[0].ID - 1
+		}
+	}
+
+	failures := make([]*sinkFailure, len(r.Sinks))
+	var wg sync.WaitGroup
+	for i := range r.Sinks {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			failures[i] = r.flushSink(ctx, i)
+		}(i)
+	}
+	wg.Wait()
+
+	var firstErr error
+	for _, failure := range failures {
+		if failure == nil {
+			continue
+		}
+		if firstErr == nil {
+			firstErr = failure.err
+		}
+		if failure.eventId == 0 {
+			continue
+		}
+		if err := r.Store.MarkEventFailed(failure.eventId, failure.err); err != nil {
+			return 0, err
+		}
+	}
+	count, err := r.markPublished()
+	if err != nil {
+		return count, err
+	}
+	return count, firstErr
+}
+
+//flushSink 从第 i 个 Sink 的进度开始投递一批事件，返回第一个投递失败的事件
+func (r *Relay) flushSink(ctx context.Context, i int) *sinkFailure {
+	events, err := r.Store.EventsAfter(r.cursors[i], r.BatchSize)
+	if err != nil {
+		return &sinkFailure{err: err}
+	}
+	for _, event := range events {
+		if err := r.publishTo(ctx, r.Sinks[i], event); err != nil {
+			return &sinkFailure{eventId: event.ID, err: err}
+		}
+		r.cursors[i] = event.ID
+	}
+	return nil
+}
+
+//markPublished 标记所有 Sink 都已经投递的事件
+func (r *Relay) markPublished() (int, error) {
+	low := r.cursors[0]
+	for _, cursor := range r.cursors[1:] {
+		if cursor < low {
+			low = cursor
+		}
+	}
+	events, err := r.Store.PendingEvents(r.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, event := range events {
+		if event.ID > low {
+			break
+		}
+		if err := r.Store.MarkEventPublished(event.ID); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+//Replay 将 id 大于 afterId 的事件重新投递给所有 Sink，不修改事件的投递状态
+func (r *Relay) Replay(ctx context.Context, afterId uint) (int, error) {
+	count := 0
+	for {
+		events, err := r.Store.EventsAfter(afterId, r.BatchSize)
+		if err != nil {
+			return count, err
+		}
+		if len(events) == 0 {
+			return count, nil
+		}
+		for _, event := range events {
+			if err := r.publish(ctx, event); err != nil {
+				return count, err
+			}
+			afterId = event.ID
+			count++
+		}
+	}
+}
+
+//publish 投递给所有 Sink
+func (r *Relay) publish(ctx context.Context, event *model.OutboxEvent) error {
+	for _, sink := range r.Sinks {
+		if err := r.publishTo(ctx, sink, event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//publishTo 投递给一个 Sink，每次投递最多等待 Timeout，失败时按照指数退避重试
+func (r *Relay) publishTo(ctx context.Context, sink Sink, event *model.OutboxEvent) error {
+	backoff := r.Backoff
+	var err error
+	for attempt := 0; attempt <= r.MaxRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+		}
+		if err = r.publishOnce(ctx, sink, event); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+func (r *Relay) publishOnce(ctx context.Context, sink Sink, event *model.OutboxEvent) error {
+	if r.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.Timeout)
+		defer cancel()
+	}
+	return sink.Publish(ctx, event)
+}
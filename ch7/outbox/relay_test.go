@@ -0,0 +1,264 @@
+package outbox_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/model"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/outbox"
+)
+
+//memoryStore 测试用的 outbox.Store
+type memoryStore struct {
+	events    []*model.OutboxEvent
+	published map[uint]bool
+	failed    map[uint]int
+}
+
+func newMemoryStore(count int) *memoryStore {
+	s := &memoryStore{published: map[uint]bool{}, failed: map[uint]int{}}
+	for i := 1; i <= count; i++ {
+		s.events = append(s.events, &model.OutboxEvent{
+			ID:          uint(i),
+			Type:        model.EventBookCreated,
+			AggregateID: uint(i),
+			Payload:     json.RawMessage(`{"title":"test"}`),
+		})
+	}
+	return s
+}
+
+func (s *memoryStore) PendingEvents(limit int) ([]*model.OutboxEvent, error) {
+	var events []*model.OutboxEvent
+	for _, e := range s.events {
+		if !s.published[e.ID] && len(events) < limit {
+			events = append(events, e)
+		}
+	}
+	return events, nil
+}
+
+func (s *memoryStore) EventsAfter(afterId uint, limit int) ([]*model.OutboxEvent, error) {
+	var events []*model.OutboxEvent
+	for _, e := range s.events {
+		if e.ID > afterId && len(events) < limit {
+			events = append(events, e)
+		}
+	}
+	return events, nil
+}
+
+func (s *memoryStore) MarkEventPublished(eventId uint) error {
+	s.published[eventId] = true
+	return nil
+}
+
+func (s *memoryStore) MarkEventFailed(eventId uint, _ error) error {
+	s.failed[eventId]++
+	return nil
+}
+
+//flakySink 前 failures 次投递失败
+type flakySink struct {
+	failures int
+	received []uint
+}
+
+func (s *flakySink) Publish(_ context.Context, event *model.OutboxEvent) error {
+	if s.failures > 0 {
+		s.failures--
+		return errors.New("unavailable")
+	}
+	s.received = append(s.received, event.ID)
+	return nil
+}
+
+//hungSink 不响应，直到 ctx 结束
+type hungSink struct{}
+
+func (hungSink) Publish(ctx context.Context, _ *model.OutboxEvent) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+var _ = ginkgo.Describe("relay", func() {
+	var store *memoryStore
+	var sink *flakySink
+	var relay *outbox.Relay
+
+	ginkgo.BeforeEach(func() {
+		store = newMemoryStore(3)
+		sink = &flakySink{}
+		relay = outbox.NewRelay(store, sink)
+		relay.Backoff = time.Millisecond
+		relay.BatchSize = 2
+	})
+
+	ginkgo.Context("sink is available", func() {
+		ginkgo.It("publish events in order & mark them published", func() {
+			count, err := relay.Flush(context.Background())
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(count).To(gomega.Equal(2))
+			count, err = relay.Flush(context.Background())
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(count).To(gomega.Equal(1))
+			gomega.Expect(sink.received).To(gomega.Equal([]uint{1, 2, 3}))
+			gomega.Expect(store.published).To(gomega.HaveLen(3))
+		})
+	})
+
+	ginkgo.Context("sink fails less than max retries", func() {
+		ginkgo.It("retry & publish the event", func() {
+			sink.failures = relay.MaxRetries
+			_, err := relay.Flush(context.Background())
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(sink.received).To(gomega.Equal([]uint{1, 2}))
+		})
+	})
+
+	ginkgo.Context("sink keeps failing", func() {
+		ginkgo.It("stop at the failed event & keep it pending", func() {
+			sink.failures = relay.MaxRetries + 1
+			count, err := relay.Flush(context.Background())
+			gomega.Expect(err).To(gomega.HaveOccurred())
+			gomega.Expect(count).To(gomega.Equal(0))
+			gomega.Expect(store.failed[1]).To(gomega.Equal(1))
+			gomega.Expect(store.published).To(gomega.BeEmpty())
+
+			_, err = relay.Flush(context.Background())
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(sink.received).To(gomega.Equal([]uint{1, 2}))
+		})
+	})
+
+	ginkgo.Context("one of the sinks keeps failing", func() {
+		ginkgo.It("keep publishing to other sinks & resume the failed sink in order", func() {
+			broken := &flakySink{failures: 2 * (relay.MaxRetries + 1)}
+			relay = outbox.NewRelay(store, broken, sink)
+			relay.Backoff = time.Millisecond
+			relay.BatchSize = 2
+
+			for i := 0; i < 2; i++ {
+				count, err := relay.Flush(context.Background())
+				gomega.Expect(err).To(gomega.HaveOccurred())
+				gomega.Expect(count).To(gomega.BeZero())
+			}
+			gomega.Expect(sink.received).To(gomega.Equal([]uint{1, 2, 3}))
+			gomega.Expect(broken.received).To(gomega.BeEmpty())
+			gomega.Expect(store.failed[1]).To(gomega.Equal(2))
+			gomega.Expect(store.published).To(gomega.BeEmpty())
+
+			count, err := relay.Flush(context.Background())
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(count).To(gomega.Equal(2))
+			count, err = relay.Flush(context.Background())
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(count).To(gomega.Equal(1))
+			gomega.Expect(broken.received).To(gomega.Equal([]uint{1, 2, 3}))
+			gomega.Expect(sink.received).To(gomega.Equal([]uint{1, 2, 3}))
+			gomega.Expect(store.published).To(gomega.HaveLen(3))
+		})
+	})
+
+	ginkgo.Context("sink does not respond", func() {
+		ginkgo.It("give up after the timeout", func() {
+			relay = outbox.NewRelay(store, hungSink{}, sink)
+			relay.MaxRetries = 0
+			relay.Timeout = 10 * time.Millisecond
+			relay.BatchSize = 2
+
+			start := time.Now()
+			_, err := relay.Flush(context.Background())
+			gomega.Expect(err).To(gomega.MatchError(context.DeadlineExceeded))
+			gomega.Expect(time.Since(start)).To(gomega.BeNumerically("<", time.Second))
+			gomega.Expect(sink.received).To(gomega.Equal([]uint{1, 2}))
+		})
+	})
+
+	ginkgo.Context("replay", func() {
+		ginkgo.It("publish published events again", func() {
+			_, _ = relay.Flush(context.Background())
+			count, err := relay.Replay(context.Background(), 1)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(count).To(gomega.Equal(2))
+			gomega.Expect(sink.received).To(gomega.Equal([]uint{1, 2, 2, 3}))
+		})
+	})
+})
+
+var _ = ginkgo.Describe("sinks", func() {
+	event := &model.OutboxEvent{
+		ID:          7,
+		Type:        model.EventBookDeleted,
+		AggregateID: 3,
+		Payload:     json.RawMessage(`{"ID":3}`),
+	}
+
+	ginkgo.Context("webhook", func() {
+		ginkgo.It("post event as json", func() {
+			var got model.OutboxEvent
+			var eventType string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				eventType = r.Header.Get("X-Event-Type")
+				gomega.Expect(json.NewDecoder(r.Body).Decode(&got)).To(gomega.Succeed())
+				w.WriteHeader(http.StatusNoContent)
+			}))
+			defer server.Close()
+
+			gomega.Expect(outbox.NewWebhookSink(server.URL).Publish(context.Background(), event)).To(gomega.Succeed())
+			gomega.Expect(eventType).To(gomega.Equal("book.deleted"))
+			gomega.Expect(got.ID).To(gomega.Equal(uint(7)))
+			gomega.Expect(got.Payload).To(gomega.MatchJSON(`{"ID":3}`))
+		})
+		ginkgo.It("time out by default", func() {
+			gomega.Expect(outbox.NewWebhookSink("http://127.0.0.1/hook").Client.Timeout).To(gomega.Equal(outbox.DefaultWebhookTimeout))
+		})
+		ginkgo.It("return error when receiver fails", func() {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusInternalServerError)
+			}))
+			defer server.Close()
+			gomega.Expect(outbox.NewWebhookSink(server.URL).Publish(context.Background(), event)).NotTo(gomega.Succeed())
+		})
+	})
+
+	ginkgo.Context("file", func() {
+		ginkgo.It("append one line per event", func() {
+			path := filepath.Join(ginkgo.GinkgoT().TempDir(), "events.ndjson")
+			sink, err := outbox.NewFileSink(path)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(sink.Publish(context.Background(), event)).To(gomega.Succeed())
+			gomega.Expect(sink.Publish(context.Background(), event)).To(gomega.Succeed())
+			gomega.Expect(sink.Close()).To(gomega.Succeed())
+
+			content, err := os.ReadFile(path)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+			gomega.Expect(lines).To(gomega.HaveLen(2))
+			gomega.Expect(lines[0]).To(gomega.ContainSubstring(`"type":"book.deleted"`))
+		})
+	})
+
+	ginkgo.Context("channel", func() {
+		ginkgo.It("deliver event to consumer", func() {
+			sink := outbox.NewChannelSink(1)
+			gomega.Expect(sink.Publish(context.Background(), event)).To(gomega.Succeed())
+			gomega.Expect(<-sink.Events()).To(gomega.Equal(event))
+		})
+		ginkgo.It("give up when buffer is full & context is done", func() {
+			sink := outbox.NewChannelSink(0)
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			gomega.Expect(sink.Publish(ctx, event)).To(gomega.MatchError(context.Canceled))
+		})
+	})
+})
@@ -0,0 +1,117 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/model"
+)
+
+//Sink 事件的投递目标，同一个事件可能被投递多次，消费方需要按照事件ID去重
+type Sink interface {
+	Publish(ctx context.Context, event *model.OutboxEvent) error
+}
+
+//DefaultWebhookTimeout WebhookSink 默认的请求超时时间
+const DefaultWebhookTimeout = 10 * time.Second
+
+//WebhookSink 通过 HTTP POST 投递事件，返回 2xx 视为成功
+type WebhookSink struct {
+	URL    string
+	Client *http.Client
+}
+
+//NewWebhookSink 创建 WebhookSink，请求超过 DefaultWebhookTimeout 时失败，避免接收方没有响应时阻塞投递
+func NewWebhookSink(url string) *WebhookSink {
+	return &WebhookSink{URL: url, Client: &http.Client{Timeout: DefaultWebhookTimeout}}
+}
+
+//Publish 投递事件
+func (s *WebhookSink) Publish(ctx context.Context, event *model.OutboxEvent) error {
+	content, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(content))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Event-ID", strconv.FormatUint(uint64(event.ID), 10))
+	req.Header.Set("X-Event-Type", string(event.Type))
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook %s returned %d", s.URL, resp.StatusCode)
+	}
+	return nil
+}
+
+//FileSink 将事件以 NDJSON 格式追加到文件中
+type FileSink struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+//NewFileSink 以追加方式打开文件
+func NewFileSink(path string) (*FileSink, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &FileSink{file: file}, nil
+}
+
+//Publish 写入一行事件
+func (s *FileSink) Publish(_ context.Context, event *model.OutboxEvent) error {
+	content, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.file.Write(append(content, '\n'))
+	return err
+}
+
+//Close 关闭文件
+func (s *FileSink) Close() error {
+	return s.file.Close()
+}
+
+//ChannelSink 进程内投递，消费方从 Events 中读取事件
+type ChannelSink struct {
+	events chan *model.OutboxEvent
+}
+
+//NewChannelSink 创建带缓冲的 ChannelSink
+func NewChannelSink(size int) *ChannelSink {
+	return &ChannelSink{events: make(chan *model.OutboxEvent, size)}
+}
+
+//Publish 缓冲区满时阻塞，直到消费方读取或 ctx 结束
+func (s *ChannelSink) Publish(ctx context.Context, event *model.OutboxEvent) error {
+	select {
+	case s.events <- event:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+//Events 返回事件通道
+func (s *ChannelSink) Events() <-chan *model.OutboxEvent {
+	return s.events
+}
@@ -0,0 +1,63 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+//sweepInterval 清理空闲令牌桶的间隔
+const sweepInterval = time.Minute
+
+//MemoryStore 进程内的令牌桶存储
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	limits    map[string]Limit
+	lastSweep time.Time
+}
+
+//NewMemoryStore 创建 MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets: make(map[string]*bucket),
+		limits:  make(map[string]Limit),
+	}
+}
+
+//Take 从 key 对应的令牌桶中取出一个令牌
+func (s *MemoryStore) Take(key string, limit Limit, now time.Time) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if now.Sub(s.lastSweep) > sweepInterval {
+		s.sweep(now)
+	}
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), last: now}
+		s.buckets[key] = b
+	}
+	s.limits[key] = limit
+	return b.take(limit, now), nil
+}
+
+//Len 返回当前保存的令牌桶数量
+func (s *MemoryStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.buckets)
+}
+
+//sweep 删除已经补满的令牌桶，补满的桶与新建的桶没有区别
+func (s *MemoryStore) sweep(now time.Time) {
+	for key, b := range s.buckets {
+		limit := s.limits[key]
+		b.refill(limit, now)
+		if b.tokens >= float64(limit.Burst) {
+			delete(s.buckets, key)
+			delete(s.limits, key)
+		}
+	}
+	s.lastSweep = now
+}
@@ -0,0 +1,96 @@
+package ratelimit_test
+
+import (
+	"time"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/ratelimit"
+)
+
+var _ = ginkgo.Describe("memory store", func() {
+	var store *ratelimit.MemoryStore
+	var now time.Time
+	limit := ratelimit.Limit{Rate: 1, Burst: 2}
+
+	ginkgo.BeforeEach(func() {
+		store = ratelimit.NewMemoryStore()
+		now = time.Date(2022, 5, 1, 0, 0, 0, 0, time.UTC)
+	})
+
+	ginkgo.Context("bucket is full", func() {
+		ginkgo.It("allow requests until burst is used up", func() {
+			r, err := store.Take("client", limit, now)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(r.Allowed).To(gomega.BeTrue())
+			gomega.Expect(r.Remaining).To(gomega.Equal(1))
+
+			r, _ = store.Take("client", limit, now)
+			gomega.Expect(r.Allowed).To(gomega.BeTrue())
+			gomega.Expect(r.Remaining).To(gomega.Equal(0))
+			gomega.Expect(r.Reset).To(gomega.Equal(2 * time.Second))
+
+			r, _ = store.Take("client", limit, now)
+			gomega.Expect(r.Allowed).To(gomega.BeFalse())
+			gomega.Expect(r.RetryAfter).To(gomega.Equal(time.Second))
+		})
+	})
+
+	ginkgo.Context("time passed", func() {
+		ginkgo.It("refill tokens by rate", func() {
+			store.Take("client", limit, now)
+			store.Take("client", limit, now)
+			r, _ := store.Take("client", limit, now.Add(500*time.Millisecond))
+			gomega.Expect(r.Allowed).To(gomega.BeFalse())
+			gomega.Expect(r.RetryAfter).To(gomega.Equal(500 * time.Millisecond))
+
+			r, _ = store.Take("client", limit, now.Add(time.Second))
+			gomega.Expect(r.Allowed).To(gomega.BeTrue())
+		})
+	})
+
+	ginkgo.Context("different keys", func() {
+		ginkgo.It("use separate buckets", func() {
+			store.Take("a", limit, now)
+			store.Take("a", limit, now)
+			r, _ := store.Take("b", limit, now)
+			gomega.Expect(r.Allowed).To(gomega.BeTrue())
+		})
+	})
+
+	ginkgo.Context("bucket is idle", func() {
+		ginkgo.It("be removed after refilled", func() {
+			store.Take("a", limit, now)
+			store.Take("b", limit, now.Add(2*time.Minute))
+			gomega.Expect(store.Len()).To(gomega.Equal(1))
+		})
+	})
+})
+
+var _ = ginkgo.Describe("config", func() {
+	config := ratelimit.Config{
+		Default: ratelimit.Limit{Rate: 10, Burst: 20},
+		Routes: map[string]ratelimit.Limit{
+			"POST /books/": {Rate: 1, Burst: 1},
+			"GET /books/:book_id": {},
+		},
+		APIKeys: []string{"key"},
+	}
+	ginkgo.DescribeTable("limit for route",
+		func(route string, limit ratelimit.Limit, unlimited bool) {
+			gomega.Expect(config.LimitFor(route)).To(gomega.Equal(limit))
+			gomega.Expect(config.LimitFor(route).Unlimited()).To(gomega.Equal(unlimited))
+		},
+		ginkgo.Entry("route configured", "POST /books/", ratelimit.Limit{Rate: 1, Burst: 1}, false),
+		ginkgo.Entry("route disabled", "GET /books/:book_id", ratelimit.Limit{}, true),
+		ginkgo.Entry("route not configured", "GET /books/", ratelimit.Limit{Rate: 10, Burst: 20}, false),
+	)
+	ginkgo.DescribeTable("authenticated api key",
+		func(key string, authenticated bool) {
+			gomega.Expect(config.Authenticated(key)).To(gomega.Equal(authenticated))
+		},
+		ginkgo.Entry("key configured", "key", true),
+		ginkgo.Entry("key not configured", "other", false),
+		ginkgo.Entry("no key", "", false),
+	)
+})
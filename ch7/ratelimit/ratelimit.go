@@ -0,0 +1,109 @@
+package ratelimit
+
+import (
+	"encoding/json"
+	"math"
+	"os"
+	"time"
+)
+
+//Limit 令牌桶参数，Rate 为每秒补充的令牌数，Burst 为桶容量
+type Limit struct {
+	Rate  float64 `json:"rate"`
+	Burst int     `json:"burst"`
+}
+
+//Unlimited 返回是否不做限流
+func (l Limit) Unlimited() bool {
+	return l.Rate <= 0 || l.Burst <= 0
+}
+
+//Config 限流配置，Routes 的 key 为 "METHOD /path"，例如 "GET /books/:book_id"
+//APIKeys 为已认证的 API Key，只有这些 key 单独计数，其余请求按照客户端IP计数
+type Config struct {
+	Default Limit            `json:"default"`
+	Routes  map[string]Limit `json:"routes"`
+	APIKeys []string         `json:"api_keys"`
+}
+
+//Authenticated 返回 key 是否为配置中的 API Key
+func (c Config) Authenticated(key string) bool {
+	if key == "" {
+		return false
+	}
+	for _, k := range c.APIKeys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+//LimitFor 返回路由对应的限流参数，没有单独配置时使用 Default
+func (c Config) LimitFor(route string) Limit {
+	if l, ok := c.Routes[route]; ok {
+		return l
+	}
+	return c.Default
+}
+
+//LoadConfig 从json文件中读取限流配置
+func LoadConfig(path string) (*Config, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var c Config
+	if err := json.Unmarshal(content, &c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+//Result 一次取令牌的结果
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration //桶重新填满需要的时间
+	RetryAfter time.Duration //被拒绝时，下一个令牌可用需要等待的时间
+}
+
+//Store 保存令牌桶状态，默认使用 MemoryStore，多实例部署时可以替换为共享存储
+type Store interface {
+	Take(key string, limit Limit, now time.Time) (Result, error)
+}
+
+//bucket 令牌桶状态
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+//refill 按照流逝的时间补充令牌
+func (b *bucket) refill(limit Limit, now time.Time) {
+	elapsed := now.Sub(b.last).Seconds()
+	if elapsed > 0 {
+		b.tokens = math.Min(float64(limit.Burst), b.tokens+elapsed*limit.Rate)
+		b.last = now
+	}
+}
+
+//take 尝试取出一个令牌
+func (b *bucket) take(limit Limit, now time.Time) Result {
+	b.refill(limit, now)
+	r := Result{Limit: limit.Burst}
+	if b.tokens >= 1 {
+		b.tokens--
+		r.Allowed = true
+	} else {
+		r.RetryAfter = seconds((1 - b.tokens) / limit.Rate)
+	}
+	r.Remaining = int(math.Floor(b.tokens))
+	r.Reset = seconds((float64(limit.Burst) - b.tokens) / limit.Rate)
+	return r
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
@@ -0,0 +1,58 @@
+package recommend
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/model"
+)
+
+//Store 交互与共现存储，service.Manager 实现了该接口
+type Store interface {
+	RecordInteraction(userKey string, bookId uint) error
+}
+
+//Consumer 将评价与借阅事件转换为读者与 Book 的交互，实现了 outbox.Sink。
+//Stores 返回事件所属租户的 Store，共现只在同一租户内计算
+type Consumer struct {
+	Stores    func(tenantId string) Store
+	MinRating int //MinRating 评分不低于该值的评价才视为喜欢
+}
+
+//NewConsumer 使用默认参数创建 Consumer
+func NewConsumer(stores func(tenantId string) Store) *Consumer {
+	return &Consumer{Stores: stores, MinRating: model.LikedRating}
+}
+
+//Publish 记录事件对应的交互，与推荐无关的事件直接忽略
+func (c *Consumer) Publish(ctx context.Context, event *model.OutboxEvent) error {
+	userKey, bookId, ok, err := c.interaction(event)
+	if err != nil || !ok {
+		return err
+	}
+	return c.Stores(event.TenantID).RecordInteraction(userKey, bookId)
+}
+
+//interaction 解析事件中的读者与 Book，ok 为 false 时事件不构成交互
+func (c *Consumer) interaction(event *model.OutboxEvent) (userKey string, bookId uint, ok bool, err error) {
+	switch event.Type {
+	case model.EventReviewSaved:
+		var review model.Review
+		if err := json.Unmarshal(event.Payload, &review); err != nil {
+			return "", 0, false, err
+		}
+		if review.Rating < c.MinRating || review.UserID == "" {
+			return "", 0, false, nil
+		}
+		return "user:" + review.UserID, review.BookID, true, nil
+	case model.EventLoanCreated:
+		var loan model.Loan
+		if err := json.Unmarshal(event.Payload, &loan); err != nil {
+			return "", 0, false, err
+		}
+		return fmt.Sprintf("member:%d", loan.MemberID), loan.BookID, true, nil
+	default:
+		return "", 0, false, nil
+	}
+}
@@ -0,0 +1,68 @@
+package recommend_test
+
+import (
+	"context"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/model"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/recommend"
+	"gorm.io/gorm"
+)
+
+//interaction 记录的交互
+type interaction struct {
+	tenantId string
+	userKey  string
+	bookId   uint
+}
+
+//memoryStore 测试用的交互存储
+type memoryStore struct {
+	tenantId     string
+	interactions *[]interaction
+}
+
+func (s memoryStore) RecordInteraction(userKey string, bookId uint) error {
+	*s.interactions = append(*s.interactions, interaction{s.tenantId, userKey, bookId})
+	return nil
+}
+
+var _ = ginkgo.Describe("consumer", func() {
+	var interactions []interaction
+	var consumer *recommend.Consumer
+
+	ginkgo.BeforeEach(func() {
+		interactions = nil
+		consumer = recommend.NewConsumer(func(tenantId string) recommend.Store {
+			return memoryStore{tenantId: tenantId, interactions: &interactions}
+		})
+	})
+
+	publish := func(eventType model.EventType, tenantId string, payload interface{}) {
+		event, err := model.NewEvent(eventType, 1, payload)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		event.TenantID = tenantId
+		gomega.Expect(consumer.Publish(context.Background(), event)).To(gomega.Succeed())
+	}
+
+	ginkgo.It("record liked reviews of the tenant", func() {
+		publish(model.EventReviewSaved, "acme", &model.Review{BookID: 3, UserID: "alice", Rating: 5})
+		gomega.Expect(interactions).To(gomega.Equal([]interaction{{"acme", "user:alice", 3}}))
+	})
+
+	ginkgo.It("ignore reviews below the liked rating", func() {
+		publish(model.EventReviewSaved, "", &model.Review{BookID: 3, UserID: "alice", Rating: 3})
+		gomega.Expect(interactions).To(gomega.BeEmpty())
+	})
+
+	ginkgo.It("record loans by member", func() {
+		publish(model.EventLoanCreated, "", &model.Loan{BookID: 4, MemberID: 7})
+		gomega.Expect(interactions).To(gomega.Equal([]interaction{{"", "member:7", 4}}))
+	})
+
+	ginkgo.It("ignore book events", func() {
+		publish(model.EventBookCreated, "", &model.Book{Model: gorm.Model{ID: 1}})
+		gomega.Expect(interactions).To(gomega.BeEmpty())
+	})
+})
@@ -0,0 +1,86 @@
+package seed
+
+import (
+	"math/rand"
+	"strconv"
+	"strings"
+
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/model"
+)
+
+//Anonymizer 将导出的 Book 中的书名、作者与 ISBN 替换为生成的值，保留页数与重量，
+//相同的种子下同一个作者总是替换为同一个名字，匿名化之后仍然可以按照作者聚合
+type Anonymizer struct {
+	seed int64
+	//used 已经生成的 ISBN，哈希冲突时顺延，保证匿名化之后 ISBN 仍然唯一
+	used map[model.ISBN]struct{}
+	//isbns 原始 ISBN 对应的匿名 ISBN，同一个 ISBN 出现多次时替换为同一个值
+	isbns map[model.ISBN]model.ISBN
+}
+
+//NewAnonymizer 创建使用种子 seed 的 Anonymizer
+func NewAnonymizer(seed int64) *Anonymizer {
+	return &Anonymizer{
+		seed:  seed,
+		used:  make(map[model.ISBN]struct{}),
+		isbns: make(map[model.ISBN]model.ISBN),
+	}
+}
+
+//Anonymize 返回匿名化的 Book，不修改 book，ID 等由数据库生成的字段保持不变
+func (a *Anonymizer) Anonymize(book *model.Book) *model.Book {
+	anonymized := *book
+	anonymized.Covers, anonymized.Language, anonymized.Description = nil, "", ""
+	anonymized.Title = title(a.rng("title", book.Title))
+	anonymized.Author = author(a.rng("author", book.Author))
+	anonymized.ISBN10, anonymized.ISBN13 = "", ""
+	original := book.ISBN13
+	if original == "" {
+		original = book.ISBN10
+	}
+	if original != "" {
+		anonymized.ISBN13 = a.isbn(original)
+		anonymized.ISBN10, _ = model.ISBN13To10(anonymized.ISBN13)
+	}
+	return &anonymized
+}
+
+func (a *Anonymizer) isbn(original model.ISBN) model.ISBN {
+	if normalized, err := model.NormalizeISBN(string(original)); err == nil {
+		original = normalized
+	}
+	if isbn, ok := a.isbns[original]; ok {
+		return isbn
+	}
+	n := hashSeed(a.seed, "isbn", string(original))
+	anonymized := isbn(n)
+	for {
+		if _, ok := a.used[anonymized]; !ok {
+			break
+		}
+		n++
+		anonymized = isbn(n)
+	}
+	a.used[anonymized] = struct{}{}
+	a.isbns[original] = anonymized
+	return anonymized
+}
+
+func (a *Anonymizer) rng(kind, value string) *rand.Rand {
+	return rand.New(rand.NewSource(hashSeed(a.seed, kind, value)))
+}
+
+//hashSeed 将种子与原始值组合为新的种子，同一个原始值总是得到同一个结果，忽略大小写与首尾空白
+func hashSeed(seed int64, kind, value string) int64 {
+	//FNV-1a
+	h := uint64(14695981039346656037)
+	for _, s := range []string{strconv.FormatInt(seed, 10), kind, strings.ToLower(strings.TrimSpace(value))} {
+		for i := 0; i < len(s); i++ {
+			h ^= uint64(s[i])
+			h *= 1099511628211
+		}
+		h ^= 0xff
+		h *= 1099511628211
+	}
+	return int64(h >> 1)
+}
@@ -0,0 +1,104 @@
+package seed
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/model"
+)
+
+//ShortStoryRatio 生成的 Book 中短故事的比例，其余为小说
+const ShortStoryRatio = 0.4
+
+//isbnSpace ISBN 中可以自由分配的九位数字的取值个数
+const isbnSpace = 1000000000
+
+//Generator 按照种子确定性地生成 Book，相同的种子生成相同的序列
+type Generator struct {
+	rng *rand.Rand
+	//next 下一个 Book 的序号，用于生成不重复的 ISBN
+	next int64
+	//isbnStart 第一个 Book 的 ISBN 序号，由种子散列到整个 ISBN 空间。
+	//每个种子使用一段连续的序号，两个种子各生成 n 本时区间重叠的概率约为 2n/isbnSpace
+	isbnStart int64
+}
+
+//NewGenerator 创建使用种子 seed 的 Generator
+func NewGenerator(seed int64) *Generator {
+	return &Generator{rng: rand.New(rand.NewSource(seed)), isbnStart: hashSeed(seed, "isbn", "") % isbnSpace}
+}
+
+//Next 生成下一个 Book，每个 Generator 生成的 ISBN 不重复，最多十亿个
+func (g *Generator) Next() *model.Book {
+	book := &model.Book{
+		Title:  title(g.rng),
+		Author: author(g.rng),
+		Pages:  pages(g.rng),
+	}
+	book.Weight = weight(g.rng, book.Pages)
+	book.ISBN13 = isbn((g.isbnStart + g.next) % isbnSpace)
+	book.ISBN10, _ = model.ISBN13To10(book.ISBN13)
+	g.next++
+	return book
+}
+
+//title 按照几种常见的书名模式组合词表
+func title(rng *rand.Rand) string {
+	adjective, noun := pick(rng, adjectives), pick(rng, nouns)
+	switch rng.Intn(6) {
+	case 0:
+		return "The " + adjective + " " + noun
+	case 1:
+		return "The " + noun + " of " + pick(rng, places)
+	case 2:
+		return adjective + " " + noun + "s"
+	case 3:
+		return "A " + noun + " in " + pick(rng, places)
+	case 4:
+		return "The " + noun + " and the " + pick(rng, nouns)
+	default:
+		return fmt.Sprintf("%s %s, Book %d", adjective, noun, rng.Intn(7)+1)
+	}
+}
+
+//author 生成两段、三段或者带中间名缩写的作者名，FirstName 与 LastName 都可以解析
+func author(rng *rand.Rand) string {
+	first, last := pick(rng, firstNames), pick(rng, lastNames)
+	switch n := rng.Intn(100); {
+	case n < 60:
+		return first + " " + last
+	case n < 80:
+		return first + " " + pick(rng, middleNames) + " " + last
+	default:
+		return first + " " + pick(rng, middleNames)[:1] + ". " + last
+	}
+}
+
+//pages 短故事在 [24, MaxShortStoryPages) 之间均匀分布，小说集中在 300 到 500 页，少数超过 1000 页
+func pages(rng *rand.Rand) int32 {
+	if rng.Float64() < ShortStoryRatio {
+		return int32(24 + rng.Intn(model.MaxShortStoryPages-24))
+	}
+	p := model.MaxShortStoryPages + int(math.Abs(rng.NormFloat64())*150)
+	if p > 1800 {
+		p = 1800
+	}
+	return int32(p)
+}
+
+//weight 每页约 1.2g 加上 40-160g 的封面，单位为 g
+func weight(rng *rand.Rand, pages int32) int32 {
+	return int32(float64(pages)*(1.1+rng.Float64()*0.2)) + int32(40+rng.Intn(120))
+}
+
+//isbn 用 n 生成 978 开头的合法 ISBN-13
+func isbn(n int64) model.ISBN {
+	body := "978" + fmt.Sprintf("%09d", n%isbnSpace)
+	//ISBN10To13 只使用 ISBN-10 的前 9 位，补齐第 10 位即可
+	return model.ISBN10To13(model.ISBN(body[3:] + "0"))
+}
+
+func pick(rng *rand.Rand, words []string) string {
+	return words[rng.Intn(len(words))]
+}
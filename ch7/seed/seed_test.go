@@ -0,0 +1,114 @@
+package seed_test
+
+import (
+	"strings"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/model"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/seed"
+)
+
+func generate(seedValue int64, n int) []*model.Book {
+	generator := seed.NewGenerator(seedValue)
+	books := make([]*model.Book, n)
+	for i := range books {
+		books[i] = generator.Next()
+	}
+	return books
+}
+
+var _ = ginkgo.Describe("seed", func() {
+	ginkgo.Describe("generator", func() {
+		ginkgo.It("generate the same books from the same seed", func() {
+			gomega.Expect(generate(42, 100)).To(gomega.Equal(generate(42, 100)))
+			gomega.Expect(generate(42, 100)).NotTo(gomega.Equal(generate(43, 100)))
+		})
+
+		ginkgo.It("generate different isbns from different seeds", func() {
+			isbns := map[model.ISBN]int64{}
+			for seedValue := int64(1); seedValue <= 20; seedValue++ {
+				for _, book := range generate(seedValue, 1000) {
+					previous, ok := isbns[book.ISBN13]
+					gomega.Expect(ok).To(gomega.BeFalse(), "seed %d and %d", previous, seedValue)
+					isbns[book.ISBN13] = seedValue
+				}
+			}
+		})
+
+		ginkgo.It("generate valid books of both catalogs", func() {
+			catalogs := map[model.Catalog]int{}
+			isbns := map[model.ISBN]bool{}
+			for _, book := range generate(1, 5000) {
+				gomega.Expect(book.IsValid()).To(gomega.BeTrue(), book.Author)
+				gomega.Expect(book.Title).NotTo(gomega.BeEmpty())
+				gomega.Expect(book.FirstName()).NotTo(gomega.BeEmpty())
+				gomega.Expect(book.LastName()).NotTo(gomega.BeEmpty())
+				gomega.Expect(book.Weight).To(gomega.BeNumerically(">", book.Pages))
+
+				normalized, err := model.NormalizeISBN(string(book.ISBN13))
+				gomega.Expect(err).NotTo(gomega.HaveOccurred())
+				gomega.Expect(normalized).To(gomega.Equal(book.ISBN13))
+				gomega.Expect(isbns).NotTo(gomega.HaveKey(book.ISBN13))
+				isbns[book.ISBN13] = true
+				catalogs[book.Catalog()]++
+			}
+			gomega.Expect(catalogs[model.CategoryShortStory]).To(gomega.BeNumerically("~", 2000, 200))
+			gomega.Expect(catalogs[model.CategoryNovel]).To(gomega.BeNumerically("~", 3000, 200))
+		})
+
+		ginkgo.It("generate multi-part author names", func() {
+			parts := map[int]bool{}
+			for _, book := range generate(1, 1000) {
+				parts[len(strings.Fields(book.Author))] = true
+			}
+			gomega.Expect(parts).To(gomega.HaveKey(2))
+			gomega.Expect(parts).To(gomega.HaveKey(3))
+		})
+	})
+
+	ginkgo.Describe("anonymizer", func() {
+		books := []*model.Book{
+			{Title: "Dune", Author: "Frank Herbert", Pages: 412, Weight: 500, ISBN13: "9780441172719"},
+			{Title: "Dune Messiah", Author: "Frank Herbert", Pages: 256, Weight: 300, ISBN10: "0441172695"},
+			{Title: "Flowers for Algernon", Author: "Daniel Keyes", Pages: 311},
+		}
+
+		ginkgo.It("replace titles, authors and isbns & keep pages and weights", func() {
+			anonymizer := seed.NewAnonymizer(7)
+			for _, book := range books {
+				anonymized := anonymizer.Anonymize(book)
+				gomega.Expect(anonymized.Title).NotTo(gomega.Equal(book.Title))
+				gomega.Expect(anonymized.Author).NotTo(gomega.Equal(book.Author))
+				gomega.Expect(anonymized.Pages).To(gomega.Equal(book.Pages))
+				gomega.Expect(anonymized.Weight).To(gomega.Equal(book.Weight))
+				if book.ISBN10 == "" && book.ISBN13 == "" {
+					gomega.Expect(anonymized.ISBN13).To(gomega.BeEmpty())
+					continue
+				}
+				gomega.Expect(anonymized.ISBN13).NotTo(gomega.Equal(book.ISBN13))
+				gomega.Expect(anonymized.NormalizeISBN()).To(gomega.Succeed())
+			}
+			gomega.Expect(books[0].Title).To(gomega.Equal("Dune"))
+		})
+
+		ginkgo.It("map the same value to the same pseudonym", func() {
+			anonymizer := seed.NewAnonymizer(7)
+			first, second := anonymizer.Anonymize(books[0]), anonymizer.Anonymize(books[1])
+			gomega.Expect(first.Author).To(gomega.Equal(second.Author))
+			gomega.Expect(anonymizer.Anonymize(books[0]).ISBN13).To(gomega.Equal(first.ISBN13))
+			gomega.Expect(seed.NewAnonymizer(7).Anonymize(books[0])).To(gomega.Equal(first))
+			gomega.Expect(seed.NewAnonymizer(8).Anonymize(books[0]).Author).NotTo(gomega.Equal(first.Author))
+		})
+
+		ginkgo.It("keep isbns unique", func() {
+			anonymizer := seed.NewAnonymizer(7)
+			isbns := map[model.ISBN]bool{}
+			for _, book := range generate(3, 2000) {
+				anonymized := anonymizer.Anonymize(book)
+				gomega.Expect(isbns).NotTo(gomega.HaveKey(anonymized.ISBN13))
+				isbns[anonymized.ISBN13] = true
+			}
+		})
+	})
+})
@@ -0,0 +1,42 @@
+package seed
+
+//生成书名与作者名使用的词表，组合后足以生成数百万个不同的书名
+
+var adjectives = []string{
+	"Silent", "Hidden", "Broken", "Golden", "Last", "Lost", "Secret", "Distant", "Burning", "Frozen",
+	"Forgotten", "Crimson", "Endless", "Wild", "Quiet", "Bitter", "Hollow", "Ancient", "Shattered", "Bright",
+	"Restless", "Wandering", "Invisible", "Fallen", "Electric", "Gentle", "Savage", "Midnight", "Northern", "Paper",
+	"Glass", "Iron", "Velvet", "Little", "Great", "Second", "Final", "Strange", "Empty", "Radiant",
+}
+
+var nouns = []string{
+	"River", "Garden", "House", "Road", "Kingdom", "Winter", "Summer", "Ocean", "Mountain", "City",
+	"Forest", "Island", "Harbor", "Machine", "Letter", "Mirror", "Shadow", "Storm", "Clock", "Bridge",
+	"Lantern", "Orchard", "Desert", "Empire", "Voyage", "Daughter", "Stranger", "Witness", "Promise", "Library",
+	"Sky", "Fire", "Wolf", "Crown", "Song", "Map", "Tide", "Station", "Valley", "Star",
+}
+
+var places = []string{
+	"Paris", "the North", "the Sea", "Venice", "the Valley", "the Desert", "Kyoto", "the Moor", "Avalon", "Lisbon",
+	"the Old Town", "the Frontier", "Prague", "the Coast", "the Hills", "Samarkand", "the Delta", "Dublin", "the Steppe", "Havana",
+}
+
+var firstNames = []string{
+	"James", "Mary", "John", "Patricia", "Robert", "Jennifer", "Michael", "Linda", "William", "Elizabeth",
+	"David", "Barbara", "Richard", "Susan", "Joseph", "Jessica", "Thomas", "Sarah", "Charles", "Karen",
+	"Daniel", "Nancy", "Matthew", "Lisa", "Anthony", "Margaret", "Mark", "Sandra", "Paul", "Ashley",
+	"Haruki", "Chimamanda", "Gabriel", "Isabel", "Orhan", "Elena", "Kazuo", "Olga", "Jorge", "Yiyun",
+}
+
+var middleNames = []string{
+	"Lee", "Ann", "Marie", "James", "Rose", "Louise", "Edward", "Grace", "Allen", "Jean",
+	"Ray", "Lynn", "Francis", "May", "Scott", "Jane", "Wayne", "Dean", "Mae", "Paul",
+}
+
+var lastNames = []string{
+	"Smith", "Johnson", "Williams", "Brown", "Jones", "Garcia", "Miller", "Davis", "Rodriguez", "Martinez",
+	"Hernandez", "Lopez", "Gonzalez", "Wilson", "Anderson", "Taylor", "Moore", "Jackson", "Martin", "Thompson",
+	"White", "Harris", "Clark", "Lewis", "Walker", "Young", "Allen", "King", "Wright", "Scott",
+	"Murakami", "Adichie", "Marquez", "Allende", "Pamuk", "Ferrante", "Ishiguro", "Tokarczuk", "Borges", "Li",
+	"Du Maurier", "Le Guin", "Van Dyke", "De Luca", "O'Brien", "McCarthy", "Fitzgerald", "Hemingway", "Woolf", "Austen",
+}
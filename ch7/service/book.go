@@ -1,39 +1,212 @@
 package service
 
-import "github.com/weenxin/ulitmate_go_notebook_reading/ch7/model"
+import (
+	"errors"
+	"strings"
+
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/model"
+	"gorm.io/gorm"
+)
 
 func (m *Manager) AddBook(book *model.Book) error {
-	if err := m.db.Create(book).Error; err != nil {
-		return err
+	return m.db.Transaction(func(tx *gorm.DB) error {
+		if err := checkQuota(tx); err != nil {
+			return err
+		}
+		if err := checkISBN(tx, book); err != nil {
+			return err
+		}
+		if err := tx.Create(book).Error; err != nil {
+			if isDuplicateKey(err) {
+				return ErrDuplicateISBN
+			}
+			return err
+		}
+		return addEvent(tx, model.EventBookCreated, book)
+	})
+}
+
+//AddBooks 在一个事务中批量添加 Book 并写入事件，用于生成测试数据等大量写入的场景。
+//不逐个查询 ISBN 是否已经被使用，由唯一索引检查，ISBN 重复时整批都不会写入
+func (m *Manager) AddBooks(books []*model.Book) error {
+	if len(books) == 0 {
+		return nil
 	}
-	return nil
+	return m.db.Transaction(func(tx *gorm.DB) error {
+		if err := checkQuotaFor(tx, len(books)); err != nil {
+			return err
+		}
+		for _, book := range books {
+			if err := book.NormalizeISBN(); err != nil {
+				return err
+			}
+		}
+		if err := tx.Create(books).Error; err != nil {
+			if isDuplicateKey(err) {
+				return ErrDuplicateISBN
+			}
+			return err
+		}
+		events := make([]*model.OutboxEvent, 0, len(books))
+		for _, book := range books {
+			event, err := model.NewBookEvent(model.EventBookCreated, book)
+			if err != nil {
+				return err
+			}
+			events = append(events, event)
+		}
+		return tx.Create(events).Error
+	})
 }
 
 func (m *Manager) DeleteBook(bookId uint) error {
-	if err := m.db.Delete(&model.Book{}, bookId).Error; err != nil {
-		return err
-	}
-	return nil
+	return m.db.Transaction(func(tx *gorm.DB) error {
+		//删除事件中携带完整的 Book，便于下游按照 Catalog 等条件过滤
+		var book model.Book
+		if err := tx.First(&book, bookId).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil
+			}
+			return err
+		}
+		//唯一索引包含软删除的行，清空 ISBN 之后同一个 ISBN 才能再次添加，事件中仍然携带原来的 ISBN
+		if book.ISBN10 != "" || book.ISBN13 != "" {
+			err := tx.Model(&model.Book{}).Where("id = ?", book.ID).
+				UpdateColumns(map[string]interface{}{"isbn10": nil, "isbn13": nil}).Error
+			if err != nil {
+				return err
+			}
+		}
+		if err := tx.Delete(&book).Error; err != nil {
+			return err
+		}
+		if err := unlinkBook(tx, book.ID); err != nil {
+			return err
+		}
+		return addEvent(tx, model.EventBookDeleted, &book)
+	})
 }
 
 func (m *Manager) UpdateBook(book *model.Book) error {
-	if err := m.db.Updates(book).Error; err != nil {
-		return err
-	}
-	return nil
+	return m.db.Transaction(func(tx *gorm.DB) error {
+		if err := checkISBN(tx, book); err != nil {
+			return err
+		}
+		result := tx.Updates(book)
+		if isDuplicateKey(result.Error) {
+			return ErrDuplicateISBN
+		}
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		//Updates 会忽略零值字段，重新读取更新后的完整数据写入事件
+		var updated model.Book
+		if err := tx.First(&updated, book.ID).Error; err != nil {
+			return err
+		}
+		return addEvent(tx, model.EventBookUpdated, &updated)
+	})
 }
 
-func (m *Manager) ListBooks(pageNumber, pageSize int) ([]*model.Book, error) {
+//ListBooks 分页返回符合条件的 Book，按照评价排序时同时返回平均评分与评价数量，没有评价的 Book 排在最后。
+//配置了只读副本时从副本读取
+func (m *Manager) ListBooks(q model.BookQuery) ([]*model.Book, error) {
+	switch q.Sort {
+	case model.SortByID, model.SortByRating, model.SortByReviewCount:
+	default:
+		return nil, model.ErrInvalidSort
+	}
 	var books []*model.Book
-	if err := m.db.Limit(pageNumber).Offset(pageSize).Find(&books).Error; err != nil {
+	err := m.read(func(db *gorm.DB) error {
+		books = nil
+		query, err := filterBooks(db, q)
+		if err != nil {
+			return err
+		}
+		columns := "books.*"
+		if len(q.Columns) > 0 {
+			columns = "books." + strings.Join(q.Columns, ", books.")
+		}
+		switch q.Sort {
+		case model.SortByID:
+			if len(q.Columns) > 0 {
+				query = query.Select(columns)
+			}
+		case model.SortByRating, model.SortByReviewCount:
+			query = query.Select(columns + ", COALESCE(book_ratings.average_rating, 0) AS average_rating, " +
+				"COALESCE(book_ratings.review_count, 0) AS review_count").
+				Joins("LEFT JOIN book_ratings ON book_ratings.book_id = books.id")
+			if q.Sort == model.SortByRating {
+				query = query.Order("average_rating DESC").Order("review_count DESC")
+			} else {
+				query = query.Order("review_count DESC").Order("average_rating DESC")
+			}
+		}
+		return query.Order("books.id").Limit(q.PageSize).Offset(q.PageNumber * q.PageSize).Find(&books).Error
+	})
+	if err != nil {
 		return nil, err
 	}
 	return books, nil
 }
 
+//EachBook 按照 ID 顺序遍历符合条件的所有 Book，每次读取 batchSize 条，忽略分页与排序条件。
+//使用 AfterID 翻页，遍历大量数据时不会因为 OFFSET 越来越慢；fn 返回错误时停止遍历
+func (m *Manager) EachBook(q model.BookQuery, batchSize int, fn func(book *model.Book) error) error {
+	q.Sort = model.SortByID
+	q.PageOptions = model.PageOptions{PageSize: batchSize}
+	for {
+		books, err := m.ListBooks(q)
+		if err != nil {
+			return err
+		}
+		for _, book := range books {
+			if err := fn(book); err != nil {
+				return err
+			}
+		}
+		if len(books) < batchSize {
+			return nil
+		}
+		q.AfterID = books[len(books)-1].ID
+	}
+}
+
+//BooksByAuthors 批量返回每个作者最早添加的 limit 本 Book，一次查询代替逐个作者查询
+func (m *Manager) BooksByAuthors(authors []string, limit int) (map[string][]*model.Book, error) {
+	result := make(map[string][]*model.Book, len(authors))
+	if len(authors) == 0 {
+		return result, nil
+	}
+	var books []*model.Book
+	err := m.db.Where("author IN ?", authors).
+		Where("(SELECT COUNT(*) FROM books AS earlier WHERE earlier.author = books.author "+
+			"AND earlier.tenant_id = books.tenant_id AND earlier.deleted_at IS NULL AND earlier.id < books.id) < ?", limit).
+		Order("books.id").Find(&books).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, book := range books {
+		result[book.Author] = append(result[book.Author], book)
+	}
+	return result, nil
+}
+
+//GetBook 返回 Book，配置了只读副本时从副本读取
 func (m *Manager) GetBook(bookId uint) (*model.Book, error) {
+	return m.GetBookColumns(bookId, nil)
+}
+
+//GetBookColumns 只读取 Book 的 columns 列，columns 为空时读取所有列
+func (m *Manager) GetBookColumns(bookId uint, columns []string) (*model.Book, error) {
 	var book model.Book
-	if err := m.db.First(&book, bookId).Error; err != nil {
+	err := m.read(func(db *gorm.DB) error {
+		if len(columns) > 0 {
+			db = db.Select(columns)
+		}
+		return db.First(&book, bookId).Error
+	})
+	if err != nil {
 		return nil, err
 	}
 	return &book, nil
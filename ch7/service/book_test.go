@@ -50,8 +50,11 @@ var _ = ginkgo.Describe("manager to get book", func() {
 				result := sqlmock.NewResult(1, 1)
 				mock.ExpectBegin()
 				mock.ExpectExec("^INSERT INTO `books`").
-					WithArgs(sqlmock.AnyArg(),sqlmock.AnyArg(),sqlmock.AnyArg(),b.Title, b.Author, b.Pages, b.Weight).
+					WithArgs(sqlmock.AnyArg(),sqlmock.AnyArg(),sqlmock.AnyArg(),b.Title, b.Author, b.Pages, b.Weight, nil, nil, "").
 					WillReturnResult(result)
+				mock.ExpectExec("^INSERT INTO `outbox_events`").
+					WithArgs(sqlmock.AnyArg(), "", model.EventBookCreated, uint(1), sqlmock.AnyArg(), nil, 0, "").
+					WillReturnResult(sqlmock.NewResult(1, 1))
 				mock.ExpectCommit()
 
 				err = manager.AddBook(b)
@@ -113,9 +116,27 @@ var _ = ginkgo.Describe("manager to get book", func() {
 				//删除结果
 				result := sqlmock.NewResult(0, 1)
 				mock.ExpectBegin()
+				mock.ExpectQuery("SELECT \\* FROM `books` WHERE `books`\\.`id` = \\? AND `books`\\.`deleted_at` IS NULL").
+					WithArgs(b.ID).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "title"}).AddRow(b.ID, "test title"))
 				mock.ExpectExec("UPDATE `books` SET `deleted_at`=\\? WHERE `books`.`id` = \\? AND `books`.`deleted_at` IS NULL").
 					WithArgs(sqlmock.AnyArg(),b.ID).
 					WillReturnResult(result)
+				mock.ExpectExec("DELETE FROM `series_entries` WHERE book_id = \\?").
+					WithArgs(b.ID).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec("DELETE FROM `editions` WHERE book_id = \\?").
+					WithArgs(b.ID).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec("DELETE FROM `book_tags` WHERE book_id = \\?").
+					WithArgs(b.ID).
+					WillReturnResult(sqlmock.NewResult(0, 2))
+				mock.ExpectExec("DELETE FROM `book_subjects` WHERE book_id = \\?").
+					WithArgs(b.ID).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec("^INSERT INTO `outbox_events`").
+					WithArgs(sqlmock.AnyArg(), "", model.EventBookDeleted, b.ID, sqlmock.AnyArg(), nil, 0, "").
+					WillReturnResult(sqlmock.NewResult(1, 1))
 				mock.ExpectCommit()
 				err = manager.DeleteBook(b.ID)
 				gomega.Expect(err).To(gomega.BeNil())
@@ -144,6 +165,13 @@ var _ = ginkgo.Describe("manager to get book", func() {
 				mock.ExpectExec("^UPDATE `books` (.+)WHERE `books`.`deleted_at` IS NULL AND `id` = \\?").
 					WithArgs(sqlmock.AnyArg(),b.Title, b.Author, b.Pages, b.Weight, b.ID).
 					WillReturnResult(result)
+				mock.ExpectQuery("SELECT \\* FROM `books` WHERE `books`\\.`id` = \\? AND `books`\\.`deleted_at` IS NULL").
+					WithArgs(b.ID).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "title", "author", "pages", "weight"}).
+						AddRow(b.ID, b.Title, b.Author, b.Pages, b.Weight))
+				mock.ExpectExec("^INSERT INTO `outbox_events`").
+					WithArgs(sqlmock.AnyArg(), "", model.EventBookUpdated, b.ID, sqlmock.AnyArg(), nil, 0, "").
+					WillReturnResult(sqlmock.NewResult(1, 1))
 				mock.ExpectCommit()
 				err = manager.UpdateBook(b)
 				gomega.Expect(err).To(gomega.BeNil())
@@ -152,4 +180,63 @@ var _ = ginkgo.Describe("manager to get book", func() {
 			})
 		})
 	})
+
+	ginkgo.Describe("delete books not in database", func() {
+		ginkgo.It("return no error & write no event", func() {
+			mock.ExpectBegin()
+			mock.ExpectQuery("SELECT \\* FROM `books` WHERE `books`\\.`id` = \\? AND `books`\\.`deleted_at` IS NULL").
+				WithArgs(404).
+				WillReturnRows(sqlmock.NewRows([]string{"id"}))
+			mock.ExpectCommit()
+			err = manager.DeleteBook(404)
+			gomega.Expect(err).To(gomega.BeNil())
+
+			gomega.Expect(mock.ExpectationsWereMet()).To(gomega.BeNil())
+		})
+	})
+})
+
+var _ = ginkgo.Describe("manager to read selected columns", func() {
+	var manager *service.Manager
+	var mock sqlmock.Sqlmock
+
+	ginkgo.BeforeEach(func() {
+		manager, mock = newMockManager()
+	})
+
+	ginkgo.It("select only the columns of a book", func() {
+		mock.ExpectQuery("SELECT `id`,`title` FROM `books` WHERE `books`.`id` = \\?").
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "title"}).AddRow(1, "Go"))
+
+		book, err := manager.GetBookColumns(1, []string{"id", "title"})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(book.Title).To(gomega.Equal("Go"))
+		gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+	})
+
+	ginkgo.It("select only the columns of listed books", func() {
+		mock.ExpectQuery("SELECT books.id, books.title FROM `books` WHERE `books`.`deleted_at` IS NULL ORDER BY books.id LIMIT 10").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "title"}).AddRow(1, "Go"))
+
+		books, err := manager.ListBooks(model.BookQuery{PageOptions: model.PageOptions{PageSize: 10}, Columns: []string{"id", "title"}})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(books).To(gomega.HaveLen(1))
+		gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+	})
+
+	ginkgo.It("keep the rating aggregate when sorting by rating", func() {
+		mock.ExpectQuery("SELECT books.id, books.title, COALESCE\\(book_ratings.average_rating, 0\\) AS average_rating, " +
+			"COALESCE\\(book_ratings.review_count, 0\\) AS review_count FROM `books` LEFT JOIN book_ratings").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "title", "average_rating", "review_count"}).AddRow(1, "Go", 4.5, 2))
+
+		books, err := manager.ListBooks(model.BookQuery{
+			PageOptions: model.PageOptions{PageSize: 10},
+			Sort:        model.SortByRating,
+			Columns:     []string{"id", "title"},
+		})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(books[0].AverageRating).To(gomega.Equal(4.5))
+		gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+	})
 })
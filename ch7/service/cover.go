@@ -0,0 +1,51 @@
+package service
+
+import (
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/model"
+	"gorm.io/gorm"
+)
+
+//SaveCovers 替换 Book 的所有封面记录
+func (m *Manager) SaveCovers(bookId uint, covers []*model.Cover) error {
+	return m.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("book_id = ?", bookId).Delete(&model.Cover{}).Error; err != nil {
+			return err
+		}
+		for _, cover := range covers {
+			cover.BookID = bookId
+		}
+		return tx.Create(covers).Error
+	})
+}
+
+func (m *Manager) ListCovers(bookId uint) ([]*model.Cover, error) {
+	var covers []*model.Cover
+	if err := m.db.Where("book_id = ?", bookId).Order("id").Find(&covers).Error; err != nil {
+		return nil, err
+	}
+	return covers, nil
+}
+
+//CoversByBooks 批量返回 Book 的封面记录
+func (m *Manager) CoversByBooks(bookIds []uint) (map[uint][]*model.Cover, error) {
+	result := make(map[uint][]*model.Cover, len(bookIds))
+	if len(bookIds) == 0 {
+		return result, nil
+	}
+	var covers []*model.Cover
+	if err := m.db.Where("book_id IN ?", bookIds).Order("book_id").Order("id").Find(&covers).Error; err != nil {
+		return nil, err
+	}
+	for _, cover := range covers {
+		result[cover.BookID] = append(result[cover.BookID], cover)
+	}
+	return result, nil
+}
+
+func (m *Manager) GetCover(bookId uint, size string) (*model.Cover, error) {
+	var cover model.Cover
+	if err := m.db.Where("book_id = ? AND size = ?", bookId, size).First(&cover).Error; err != nil {
+		return nil, err
+	}
+	return &cover, nil
+}
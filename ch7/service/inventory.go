@@ -0,0 +1,182 @@
+package service
+
+import (
+	"errors"
+
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/model"
+	"gorm.io/gorm"
+)
+
+var (
+	//ErrInsufficientStock 可用库存不足，或者释放、出库的数量超过预留数量
+	ErrInsufficientStock = errors.New("insufficient stock")
+	//ErrInvalidQuantity 数量必须为正数
+	ErrInvalidQuantity = errors.New("quantity must be positive")
+)
+
+//库存的变更都使用带条件的 UPDATE，由数据库保证并发请求下不会超卖：
+//条件不满足时影响行数为 0，此时返回 ErrInsufficientStock
+
+//ReserveStock 预留库存
+func (m *Manager) ReserveStock(bookId uint, warehouse string, quantity int64, reason string) (*model.Inventory, error) {
+	if quantity <= 0 {
+		return nil, ErrInvalidQuantity
+	}
+	return m.changeStock(bookId, warehouse, model.MovementReserve, quantity, reason,
+		map[string]interface{}{"reserved": gorm.Expr("reserved + ?", quantity)},
+		"on_hand - reserved >= ?", quantity)
+}
+
+//ReleaseStock 释放预留的库存
+func (m *Manager) ReleaseStock(bookId uint, warehouse string, quantity int64, reason string) (*model.Inventory, error) {
+	if quantity <= 0 {
+		return nil, ErrInvalidQuantity
+	}
+	return m.changeStock(bookId, warehouse, model.MovementRelease, -quantity, reason,
+		map[string]interface{}{"reserved": gorm.Expr("reserved - ?", quantity)},
+		"reserved >= ?", quantity)
+}
+
+//FulfillStock 预留的库存出库，在库数量与预留数量同时减少
+func (m *Manager) FulfillStock(bookId uint, warehouse string, quantity int64, reason string) (*model.Inventory, error) {
+	if quantity <= 0 {
+		return nil, ErrInvalidQuantity
+	}
+	return m.changeStock(bookId, warehouse, model.MovementFulfill, -quantity, reason,
+		map[string]interface{}{
+			"on_hand":  gorm.Expr("on_hand - ?", quantity),
+			"reserved": gorm.Expr("reserved - ?", quantity),
+		},
+		"reserved >= ?", quantity)
+}
+
+//AdjustStock 调整在库数量，delta 可以为负数，但调整后在库数量不能少于预留数量。
+//仓库中还没有该 Book 的库存记录时自动创建
+func (m *Manager) AdjustStock(bookId uint, warehouse string, delta int64, reason string) (*model.Inventory, error) {
+	if delta == 0 {
+		return nil, ErrInvalidQuantity
+	}
+	inventory, err := m.changeStock(bookId, warehouse, model.MovementAdjust, delta, reason,
+		map[string]interface{}{"on_hand": gorm.Expr("on_hand + ?", delta)},
+		"on_hand + ? >= reserved", delta)
+	if !errors.Is(err, gorm.ErrRecordNotFound) || delta < 0 {
+		return inventory, err
+	}
+
+	err = m.db.Transaction(func(tx *gorm.DB) error {
+		inventory = &model.Inventory{BookID: bookId, Warehouse: warehouse, OnHand: delta}
+		if err := tx.Create(inventory).Error; err != nil {
+			return err
+		}
+		return addMovement(tx, inventory, model.MovementAdjust, delta, reason)
+	})
+	if isDuplicateKey(err) {
+		//并发创建了同一条库存记录，重新按照更新处理
+		return m.AdjustStock(bookId, warehouse, delta, reason)
+	}
+	return inventory, err
+}
+
+//changeStock 在事务中执行带条件的更新并记录流水，库存记录不存在时返回 gorm.ErrRecordNotFound
+func (m *Manager) changeStock(bookId uint, warehouse string, movementType model.MovementType, quantity int64,
+	reason string, values map[string]interface{}, condition string, args ...interface{}) (*model.Inventory, error) {
+	var inventory model.Inventory
+	err := m.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&model.Inventory{}).
+			Where("book_id = ? AND warehouse = ?", bookId, warehouse).
+			Where(condition, args...).
+			Updates(values)
+		if result.Error != nil {
+			return result.Error
+		}
+		err := tx.Where("book_id = ? AND warehouse = ?", bookId, warehouse).First(&inventory).Error
+		if err != nil {
+			return err
+		}
+		if result.RowsAffected == 0 {
+			return ErrInsufficientStock
+		}
+		return addMovement(tx, &inventory, movementType, quantity, reason)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &inventory, nil
+}
+
+func addMovement(tx *gorm.DB, inventory *model.Inventory, movementType model.MovementType, quantity int64, reason string) error {
+	return tx.Create(&model.StockMovement{
+		BookID:    inventory.BookID,
+		Warehouse: inventory.Warehouse,
+		Type:      movementType,
+		Quantity:  quantity,
+		OnHand:    inventory.OnHand,
+		Reserved:  inventory.Reserved,
+		Reason:    reason,
+	}).Error
+}
+
+//ListStock 返回 Book 在所有仓库中的库存
+func (m *Manager) ListStock(bookId uint) ([]*model.Inventory, error) {
+	var inventories []*model.Inventory
+	if err := m.db.Where("book_id = ?", bookId).Order("warehouse").Find(&inventories).Error; err != nil {
+		return nil, err
+	}
+	return inventories, nil
+}
+
+//StockByBooks 批量返回 Book 在所有仓库中的库存
+func (m *Manager) StockByBooks(bookIds []uint) (map[uint][]*model.Inventory, error) {
+	result := make(map[uint][]*model.Inventory, len(bookIds))
+	if len(bookIds) == 0 {
+		return result, nil
+	}
+	var inventories []*model.Inventory
+	if err := m.db.Where("book_id IN ?", bookIds).Order("book_id").Order("warehouse").Find(&inventories).Error; err != nil {
+		return nil, err
+	}
+	for _, inventory := range inventories {
+		result[inventory.BookID] = append(result[inventory.BookID], inventory)
+	}
+	return result, nil
+}
+
+//SetLowStockThreshold 设置低库存提醒的阈值
+func (m *Manager) SetLowStockThreshold(bookId uint, warehouse string, threshold int64) error {
+	result := m.db.Model(&model.Inventory{}).
+		Where("book_id = ? AND warehouse = ?", bookId, warehouse).
+		Update("low_stock_threshold", threshold)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+//ListLowStock 返回可用库存不高于阈值的记录，warehouse 为空时查询所有仓库
+func (m *Manager) ListLowStock(warehouse string, pageNumber, pageSize int) ([]*model.Inventory, error) {
+	var inventories []*model.Inventory
+	query := m.db.Where("on_hand - reserved <= low_stock_threshold")
+	if warehouse != "" {
+		query = query.Where("warehouse = ?", warehouse)
+	}
+	err := query.Order("on_hand - reserved").Order("id").
+		Limit(pageSize).Offset(pageNumber * pageSize).Find(&inventories).Error
+	if err != nil {
+		return nil, err
+	}
+	return inventories, nil
+}
+
+//ListStockMovements 按照时间倒序返回 Book 的库存流水
+func (m *Manager) ListStockMovements(bookId uint, pageNumber, pageSize int) ([]*model.StockMovement, error) {
+	var movements []*model.StockMovement
+	err := m.db.Where("book_id = ?", bookId).Order("id DESC").
+		Limit(pageSize).Offset(pageNumber * pageSize).Find(&movements).Error
+	if err != nil {
+		return nil, err
+	}
+	return movements, nil
+}
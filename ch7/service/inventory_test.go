@@ -0,0 +1,124 @@
+package service_test
+
+import (
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/model"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/service"
+)
+
+var _ = ginkgo.Describe("manager to track inventory", func() {
+	var manager *service.Manager
+	var mock sqlmock.Sqlmock
+	inventoryColumns := []string{"id", "book_id", "warehouse", "on_hand", "reserved", "low_stock_threshold"}
+
+	ginkgo.BeforeEach(func() {
+		manager, mock = newMockManager()
+	})
+
+	ginkgo.Describe("reserve stock", func() {
+		ginkgo.Context("enough stock available", func() {
+			ginkgo.It("increase reserved with a conditional update & record a movement", func() {
+				mock.ExpectBegin()
+				mock.ExpectExec("UPDATE `inventories` SET `reserved`=reserved \\+ \\?,`updated_at`=\\? WHERE \\(book_id = \\? AND warehouse = \\?\\) AND on_hand - reserved >= \\?").
+					WithArgs(2, sqlmock.AnyArg(), 1, "bj", 2).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery("SELECT \\* FROM `inventories` WHERE book_id = \\? AND warehouse = \\?").
+					WithArgs(1, "bj").
+					WillReturnRows(sqlmock.NewRows(inventoryColumns).AddRow(1, 1, "bj", 10, 2, 0))
+				mock.ExpectExec("INSERT INTO `stock_movements`").
+					WithArgs(sqlmock.AnyArg(), "", 1, "bj", model.MovementReserve, 2, 10, 2, "order 1").
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
+
+				inventory, err := manager.ReserveStock(1, "bj", 2, "order 1")
+				gomega.Expect(err).NotTo(gomega.HaveOccurred())
+				gomega.Expect(inventory.Available()).To(gomega.Equal(int64(8)))
+				gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+			})
+		})
+
+		ginkgo.Context("not enough stock available", func() {
+			ginkgo.It("return ErrInsufficientStock without movement", func() {
+				mock.ExpectBegin()
+				mock.ExpectExec("UPDATE `inventories`").
+					WithArgs(20, sqlmock.AnyArg(), 1, "bj", 20).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery("SELECT \\* FROM `inventories`").
+					WithArgs(1, "bj").
+					WillReturnRows(sqlmock.NewRows(inventoryColumns).AddRow(1, 1, "bj", 10, 2, 0))
+				mock.ExpectRollback()
+
+				_, err := manager.ReserveStock(1, "bj", 20, "order 1")
+				gomega.Expect(err).To(gomega.MatchError(service.ErrInsufficientStock))
+				gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+			})
+		})
+
+		ginkgo.Context("quantity is not positive", func() {
+			ginkgo.It("return ErrInvalidQuantity", func() {
+				_, err := manager.ReserveStock(1, "bj", 0, "")
+				gomega.Expect(err).To(gomega.MatchError(service.ErrInvalidQuantity))
+			})
+		})
+	})
+
+	ginkgo.Describe("adjust stock", func() {
+		ginkgo.Context("warehouse has no inventory of the book", func() {
+			ginkgo.It("create the inventory", func() {
+				mock.ExpectBegin()
+				mock.ExpectExec("UPDATE `inventories` SET `on_hand`=on_hand \\+ \\?").
+					WithArgs(5, sqlmock.AnyArg(), 1, "sh", 5).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery("SELECT \\* FROM `inventories`").
+					WithArgs(1, "sh").
+					WillReturnRows(sqlmock.NewRows(inventoryColumns))
+				mock.ExpectRollback()
+				mock.ExpectBegin()
+				mock.ExpectExec("INSERT INTO `inventories`").
+					WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), "", 1, "sh", 5, 0, 0).
+					WillReturnResult(sqlmock.NewResult(3, 1))
+				mock.ExpectExec("INSERT INTO `stock_movements`").
+					WithArgs(sqlmock.AnyArg(), "", 1, "sh", model.MovementAdjust, 5, 5, 0, "purchase").
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
+
+				inventory, err := manager.AdjustStock(1, "sh", 5, "purchase")
+				gomega.Expect(err).NotTo(gomega.HaveOccurred())
+				gomega.Expect(inventory.OnHand).To(gomega.Equal(int64(5)))
+				gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+			})
+		})
+
+		ginkgo.Context("decrease below reserved", func() {
+			ginkgo.It("return ErrInsufficientStock", func() {
+				mock.ExpectBegin()
+				mock.ExpectExec("UPDATE `inventories` SET `on_hand`=on_hand \\+ \\?,`updated_at`=\\? WHERE \\(book_id = \\? AND warehouse = \\?\\) AND on_hand \\+ \\? >= reserved").
+					WithArgs(-9, sqlmock.AnyArg(), 1, "bj", -9).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery("SELECT \\* FROM `inventories`").
+					WithArgs(1, "bj").
+					WillReturnRows(sqlmock.NewRows(inventoryColumns).AddRow(1, 1, "bj", 10, 2, 0))
+				mock.ExpectRollback()
+
+				_, err := manager.AdjustStock(1, "bj", -9, "lost")
+				gomega.Expect(err).To(gomega.MatchError(service.ErrInsufficientStock))
+				gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+			})
+		})
+	})
+
+	ginkgo.Describe("low stock", func() {
+		ginkgo.It("query inventories at or below threshold", func() {
+			mock.ExpectQuery("SELECT \\* FROM `inventories` WHERE on_hand - reserved <= low_stock_threshold AND warehouse = \\? ORDER BY on_hand - reserved,id LIMIT 20").
+				WithArgs("bj").
+				WillReturnRows(sqlmock.NewRows(inventoryColumns).AddRow(1, 1, "bj", 3, 1, 5))
+			inventories, err := manager.ListLowStock("bj", 0, 20)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(inventories).To(gomega.HaveLen(1))
+			gomega.Expect(inventories[0].IsLowStock()).To(gomega.BeTrue())
+			gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+		})
+	})
+})
@@ -0,0 +1,59 @@
+package service
+
+import (
+	"errors"
+	"strings"
+
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/model"
+	"gorm.io/gorm"
+)
+
+//ErrDuplicateISBN ISBN 已经被其他 Book 使用
+var ErrDuplicateISBN = errors.New("duplicate isbn")
+
+//GetBookByISBN 通过 ISBN-10 或 ISBN-13 查询 Book
+func (m *Manager) GetBookByISBN(isbn string) (*model.Book, error) {
+	isbn13, err := model.NormalizeISBN(isbn)
+	if err != nil {
+		return nil, err
+	}
+	var book model.Book
+	if err := m.db.Where("isbn13 = ?", isbn13).First(&book).Error; err != nil {
+		return nil, err
+	}
+	return &book, nil
+}
+
+//checkISBN 规范化 ISBN 并检查是否已经被其他 Book 使用。
+//并发写入时仍然可能冲突，由唯一索引兜底，见 isDuplicateKey
+func checkISBN(tx *gorm.DB, book *model.Book) error {
+	if err := book.NormalizeISBN(); err != nil {
+		return err
+	}
+	if book.ISBN13 == "" {
+		return nil
+	}
+	var count int64
+	query := tx.Model(&model.Book{}).Where("isbn13 = ?", book.ISBN13)
+	if book.ID != 0 {
+		query = query.Where("id <> ?", book.ID)
+	}
+	if err := query.Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrDuplicateISBN
+	}
+	return nil
+}
+
+//isDuplicateKey 返回是否为唯一索引冲突，支持 MySQL 与 SQLite。
+//SQLite 驱动的错误类型不在依赖中，通过错误信息识别
+func isDuplicateKey(err error) bool {
+	var mysqlErr *mysqldriver.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return mysqlErr.Number == 1062
+	}
+	return err != nil && strings.Contains(err.Error(), "UNIQUE constraint failed")
+}
@@ -0,0 +1,73 @@
+package service_test
+
+import (
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/model"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/service"
+)
+
+var _ = ginkgo.Describe("manager to handle isbn", func() {
+	var manager *service.Manager
+	var mock sqlmock.Sqlmock
+
+	ginkgo.BeforeEach(func() {
+		manager, mock = newMockManager()
+	})
+
+	ginkgo.Describe("save books with isbn", func() {
+		ginkgo.Context("isbn is used by another book", func() {
+			ginkgo.It("return ErrDuplicateISBN", func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery("SELECT count\\(\\*\\) FROM `books` WHERE isbn13 = \\?").
+					WithArgs("9780306406157").
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+				mock.ExpectRollback()
+
+				b := &model.Book{Title: "test", Author: "test author", ISBN10: "0-306-40615-2"}
+				gomega.Expect(manager.AddBook(b)).To(gomega.MatchError(service.ErrDuplicateISBN))
+				gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+			})
+		})
+		ginkgo.Context("isbn is invalid", func() {
+			ginkgo.It("return ErrInvalidISBN", func() {
+				mock.ExpectBegin()
+				mock.ExpectRollback()
+				b := &model.Book{Title: "test", Author: "test author", ISBN13: "978-0-306-40615-8"}
+				gomega.Expect(manager.AddBook(b)).To(gomega.MatchError(model.ErrInvalidISBN))
+				gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+			})
+		})
+		ginkgo.Context("isbn is new", func() {
+			ginkgo.It("save normalized isbn", func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery("SELECT count\\(\\*\\) FROM `books` WHERE isbn13 = \\?").
+					WithArgs("9780306406157").
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+				mock.ExpectExec("^INSERT INTO `books`").
+					WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), "test", "test author", 0, 0, "0306406152", "9780306406157", "").
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec("^INSERT INTO `outbox_events`").
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
+
+				b := &model.Book{Title: "test", Author: "test author", ISBN13: "978-0-306-40615-7"}
+				gomega.Expect(manager.AddBook(b)).To(gomega.Succeed())
+				gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+			})
+		})
+	})
+
+	ginkgo.Describe("get book by isbn", func() {
+		ginkgo.It("query by normalized isbn-13", func() {
+			mock.ExpectQuery("SELECT \\* FROM `books` WHERE isbn13 = \\? AND `books`.`deleted_at` IS NULL").
+				WithArgs("9780306406157").
+				WillReturnRows(sqlmock.NewRows([]string{"id", "title", "isbn13"}).AddRow(1, "test", "9780306406157"))
+			book, err := manager.GetBookByISBN("0306406152")
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(book.ISBN13).To(gomega.Equal(model.ISBN("9780306406157")))
+			gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+		})
+	})
+})
@@ -0,0 +1,362 @@
+package service
+
+import (
+	"errors"
+	"time"
+
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	//ErrNotLendable Book 没有设置馆藏副本，不能借阅
+	ErrNotLendable = errors.New("book is not lendable")
+	//ErrNoCopyAvailable 所有副本都已借出或为预约保留
+	ErrNoCopyAvailable = errors.New("no copy available")
+	//ErrLoanLimit 会员同时借阅的数量已达上限
+	ErrLoanLimit = errors.New("loan limit reached")
+	//ErrHoldsWaiting 有其他会员在排队，不能续借
+	ErrHoldsWaiting = errors.New("other members are waiting for this book")
+	//ErrDuplicateHold 会员已经借出或预约了该 Book
+	ErrDuplicateHold = errors.New("member already holds or borrows this book")
+)
+
+//同一本书的借出、归还和预约都先锁定 Holding 记录（SELECT ... FOR UPDATE），
+//可借副本数量和预约队列在事务内计算，不会因为并发请求借出超过副本数量的书。
+//副本归还或预约取消后，按照预约的先后顺序为排队的会员保留副本
+
+//lendingPolicyKey Manager 使用的借阅规则
+const lendingPolicyKey = "lending:policy"
+
+//WithLendingPolicy 返回使用 policy 借阅的 Manager，没有设置时使用 model.DefaultLendingPolicy
+func (m *Manager) WithLendingPolicy(policy model.LendingPolicy) *Manager {
+	return &Manager{db: m.db.Set(lendingPolicyKey, policy).Session(&gorm.Session{})}
+}
+
+func lendingPolicyOf(db *gorm.DB) model.LendingPolicy {
+	if v, ok := db.Get(lendingPolicyKey); ok {
+		return v.(model.LendingPolicy)
+	}
+	return model.DefaultLendingPolicy
+}
+
+//CreateMember 创建会员
+func (m *Manager) CreateMember(member *model.Member) error {
+	return m.db.Create(member).Error
+}
+
+//GetMember 获取会员
+func (m *Manager) GetMember(memberId uint) (*model.Member, error) {
+	var member model.Member
+	if err := m.db.First(&member, memberId).Error; err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+//SetHoldings 设置 Book 的馆藏副本数量，增加副本时为排队的预约保留副本
+func (m *Manager) SetHoldings(bookId uint, copies int) (*model.Holding, error) {
+	if copies < 0 {
+		return nil, ErrInvalidQuantity
+	}
+	holding := &model.Holding{BookID: bookId, Copies: copies}
+	err := m.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "book_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"copies", "updated_at"}),
+		}).Create(holding).Error
+		if err != nil {
+			return err
+		}
+		_, err = promoteHolds(tx, bookId, copies, time.Now())
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return holding, nil
+}
+
+//Checkout 会员借出 Book，会员有已保留的预约时使用保留的副本
+func (m *Manager) Checkout(bookId, memberId uint) (*model.Loan, error) {
+	now := time.Now()
+	policy := lendingPolicyOf(m.db)
+	loan := model.NewLoan(bookId, memberId, now, policy)
+	err := m.db.Transaction(func(tx *gorm.DB) error {
+		holding, err := lockHolding(tx, bookId)
+		if err != nil {
+			return err
+		}
+		if _, err := getMember(tx, memberId); err != nil {
+			return err
+		}
+		var loans int64
+		err = tx.Model(&model.Loan{}).Where("member_id = ? AND status = ?", memberId, model.LoanActive).
+			Count(&loans).Error
+		if err != nil {
+			return err
+		}
+		if loans >= int64(policy.MaxLoans) {
+			return ErrLoanLimit
+		}
+		available, err := promoteHolds(tx, bookId, holding.Copies, now)
+		if err != nil {
+			return err
+		}
+
+		var hold model.Hold
+		err = tx.Where("book_id = ? AND member_id = ? AND status = ?", bookId, memberId, model.HoldReady).
+			First(&hold).Error
+		switch {
+		case err == nil:
+			if err := hold.Fulfill(); err != nil {
+				return err
+			}
+			if err := tx.Save(&hold).Error; err != nil {
+				return err
+			}
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			if available <= 0 {
+				return ErrNoCopyAvailable
+			}
+		default:
+			return err
+		}
+		if err := tx.Create(loan).Error; err != nil {
+			return err
+		}
+		return addPayloadEvent(tx, model.EventLoanCreated, bookId, loan)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return loan, nil
+}
+
+//RenewLoan 续借，有其他会员排队时不能续借
+func (m *Manager) RenewLoan(loanId uint) (*model.Loan, error) {
+	var loan model.Loan
+	err := m.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&loan, loanId).Error; err != nil {
+			return err
+		}
+		var waiting int64
+		err := tx.Model(&model.Hold{}).Where("book_id = ? AND status = ?", loan.BookID, model.HoldWaiting).
+			Count(&waiting).Error
+		if err != nil {
+			return err
+		}
+		if waiting > 0 {
+			return ErrHoldsWaiting
+		}
+		if err := loan.Renew(time.Now(), lendingPolicyOf(tx)); err != nil {
+			return err
+		}
+		return tx.Save(&loan).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &loan, nil
+}
+
+//ReturnLoan 归还，归还的副本保留给排在最前面的预约
+func (m *Manager) ReturnLoan(loanId uint) (*model.Loan, error) {
+	now := time.Now()
+	var loan model.Loan
+	err := m.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&loan, loanId).Error; err != nil {
+			return err
+		}
+		holding, err := lockHolding(tx, loan.BookID)
+		if err != nil {
+			return err
+		}
+		if err := loan.Return(now); err != nil {
+			return err
+		}
+		if err := tx.Save(&loan).Error; err != nil {
+			return err
+		}
+		_, err = promoteHolds(tx, loan.BookID, holding.Copies, now)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &loan, nil
+}
+
+//PlaceHold 预约 Book，有可借副本时预约立即变为保留状态
+func (m *Manager) PlaceHold(bookId, memberId uint) (*model.Hold, error) {
+	hold := &model.Hold{BookID: bookId, MemberID: memberId, Status: model.HoldWaiting}
+	err := m.db.Transaction(func(tx *gorm.DB) error {
+		holding, err := lockHolding(tx, bookId)
+		if err != nil {
+			return err
+		}
+		if _, err := getMember(tx, memberId); err != nil {
+			return err
+		}
+		var loans, holds int64
+		err = tx.Model(&model.Loan{}).
+			Where("book_id = ? AND member_id = ? AND status = ?", bookId, memberId, model.LoanActive).
+			Count(&loans).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Model(&model.Hold{}).
+			Where("book_id = ? AND member_id = ? AND status IN ?", bookId, memberId,
+				[]model.HoldStatus{model.HoldWaiting, model.HoldReady}).
+			Count(&holds).Error
+		if err != nil {
+			return err
+		}
+		if loans > 0 || holds > 0 {
+			return ErrDuplicateHold
+		}
+		if err := tx.Create(hold).Error; err != nil {
+			return err
+		}
+		if _, err := promoteHolds(tx, bookId, holding.Copies, time.Now()); err != nil {
+			return err
+		}
+		return tx.First(hold, hold.ID).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return hold, nil
+}
+
+//CancelHold 取消预约，已保留的副本转给下一个预约
+func (m *Manager) CancelHold(holdId uint) (*model.Hold, error) {
+	var hold model.Hold
+	err := m.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&hold, holdId).Error; err != nil {
+			return err
+		}
+		holding, err := lockHolding(tx, hold.BookID)
+		if err != nil {
+			return err
+		}
+		//锁定 Holding 之后重新读取，预约状态可能已被并发请求修改
+		if err := tx.First(&hold, holdId).Error; err != nil {
+			return err
+		}
+		if err := hold.Cancel(); err != nil {
+			return err
+		}
+		if err := tx.Save(&hold).Error; err != nil {
+			return err
+		}
+		_, err = promoteHolds(tx, hold.BookID, holding.Copies, time.Now())
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &hold, nil
+}
+
+//ListHolds 按照排队顺序返回 Book 未完成的预约
+func (m *Manager) ListHolds(bookId uint) ([]*model.Hold, error) {
+	var holds []*model.Hold
+	err := m.db.Where("book_id = ? AND status IN ?", bookId,
+		[]model.HoldStatus{model.HoldWaiting, model.HoldReady}).
+		Order("id").Find(&holds).Error
+	if err != nil {
+		return nil, err
+	}
+	return holds, nil
+}
+
+//ListMemberLoans 按照时间倒序返回会员的借阅记录
+func (m *Manager) ListMemberLoans(memberId uint, pageNumber, pageSize int) ([]*model.Loan, error) {
+	var loans []*model.Loan
+	err := m.db.Where("member_id = ?", memberId).Order("id DESC").
+		Limit(pageSize).Offset(pageNumber * pageSize).Find(&loans).Error
+	if err != nil {
+		return nil, err
+	}
+	return loans, nil
+}
+
+//ListOverdueLoans 返回在 now 时已逾期未还的借阅，最早到期的排在前面
+func (m *Manager) ListOverdueLoans(now time.Time, pageNumber, pageSize int) ([]*model.Loan, error) {
+	var loans []*model.Loan
+	err := m.db.Where("status = ? AND due_at < ?", model.LoanActive, now).Order("due_at").Order("id").
+		Limit(pageSize).Offset(pageNumber * pageSize).Find(&loans).Error
+	if err != nil {
+		return nil, err
+	}
+	return loans, nil
+}
+
+func lockHolding(tx *gorm.DB, bookId uint) (*model.Holding, error) {
+	var holding model.Holding
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("book_id = ?", bookId).First(&holding).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotLendable
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &holding, nil
+}
+
+func getMember(tx *gorm.DB, memberId uint) (*model.Member, error) {
+	var member model.Member
+	if err := tx.First(&member, memberId).Error; err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+//promoteHolds 使超过取书时间的预约失效，并按照排队顺序为预约保留空闲的副本，
+//返回保留之后剩余的可借副本数量。调用前必须已经锁定 Holding
+func promoteHolds(tx *gorm.DB, bookId uint, copies int, now time.Time) (int, error) {
+	var ready []*model.Hold
+	if err := tx.Where("book_id = ? AND status = ?", bookId, model.HoldReady).Find(&ready).Error; err != nil {
+		return 0, err
+	}
+	reserved := 0
+	for _, hold := range ready {
+		if hold.Expire(now) != nil {
+			reserved++
+			continue
+		}
+		if err := tx.Save(hold).Error; err != nil {
+			return 0, err
+		}
+	}
+
+	var loans int64
+	err := tx.Model(&model.Loan{}).Where("book_id = ? AND status = ?", bookId, model.LoanActive).
+		Count(&loans).Error
+	if err != nil {
+		return 0, err
+	}
+	available := copies - int(loans) - reserved
+	if available <= 0 {
+		return available, nil
+	}
+
+	var waiting []*model.Hold
+	err = tx.Where("book_id = ? AND status = ?", bookId, model.HoldWaiting).Order("id").
+		Limit(available).Find(&waiting).Error
+	if err != nil {
+		return 0, err
+	}
+	for _, hold := range waiting {
+		if err := hold.MarkReady(now, lendingPolicyOf(tx)); err != nil {
+			return 0, err
+		}
+		if err := tx.Save(hold).Error; err != nil {
+			return 0, err
+		}
+		available--
+	}
+	return available, nil
+}
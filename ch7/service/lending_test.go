@@ -0,0 +1,191 @@
+package service_test
+
+import (
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/model"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/service"
+)
+
+var _ = ginkgo.Describe("manager to lend books", func() {
+	var manager *service.Manager
+	var mock sqlmock.Sqlmock
+	holdingColumns := []string{"id", "book_id", "copies"}
+	holdColumns := []string{"id", "book_id", "member_id", "status", "expires_at"}
+	loanColumns := []string{"id", "book_id", "member_id", "status", "due_at", "renewals"}
+
+	ginkgo.BeforeEach(func() {
+		manager, mock = newMockManager()
+	})
+
+	//expectCheckoutPrelude 锁定 Holding、检查会员与借阅数量
+	expectCheckoutPrelude := func(copies int, memberLoans int) {
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT \\* FROM `holdings` WHERE book_id = \\? ORDER BY `holdings`.`id` LIMIT 1 FOR UPDATE").
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows(holdingColumns).AddRow(1, 1, copies))
+		mock.ExpectQuery("SELECT \\* FROM `members`").
+			WithArgs(2).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(2, "Alice"))
+		mock.ExpectQuery("SELECT count\\(\\*\\) FROM `loans` WHERE member_id = \\? AND status = \\?").
+			WithArgs(2, model.LoanActive).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(memberLoans))
+	}
+
+	ginkgo.Describe("checkout", func() {
+		ginkgo.Context("a copy is free", func() {
+			ginkgo.It("create an active loan", func() {
+				expectCheckoutPrelude(2, 0)
+				mock.ExpectQuery("SELECT \\* FROM `holds` WHERE book_id = \\? AND status = \\?").
+					WithArgs(1, model.HoldReady).
+					WillReturnRows(sqlmock.NewRows(holdColumns))
+				mock.ExpectQuery("SELECT count\\(\\*\\) FROM `loans` WHERE book_id = \\? AND status = \\?").
+					WithArgs(1, model.LoanActive).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+				mock.ExpectQuery("SELECT \\* FROM `holds` WHERE book_id = \\? AND status = \\? ORDER BY id LIMIT 1").
+					WithArgs(1, model.HoldWaiting).
+					WillReturnRows(sqlmock.NewRows(holdColumns))
+				mock.ExpectQuery("SELECT \\* FROM `holds` WHERE book_id = \\? AND member_id = \\? AND status = \\?").
+					WithArgs(1, 2, model.HoldReady).
+					WillReturnRows(sqlmock.NewRows(holdColumns))
+				mock.ExpectExec("INSERT INTO `loans`").
+					WillReturnResult(sqlmock.NewResult(5, 1))
+				mock.ExpectExec("^INSERT INTO `outbox_events`").
+					WithArgs(sqlmock.AnyArg(), "", model.EventLoanCreated, 1, sqlmock.AnyArg(), nil, 0, "").
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
+
+				loan, err := manager.Checkout(1, 2)
+				gomega.Expect(err).NotTo(gomega.HaveOccurred())
+				gomega.Expect(loan.ID).To(gomega.Equal(uint(5)))
+				gomega.Expect(loan.Status).To(gomega.Equal(model.LoanActive))
+				gomega.Expect(loan.DueAt).To(gomega.BeTemporally("~",
+					time.Now().Add(model.DefaultLendingPolicy.LoanPeriod), time.Minute))
+				gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+			})
+		})
+
+		ginkgo.Context("the only free copy is kept for another member", func() {
+			ginkgo.It("return ErrNoCopyAvailable", func() {
+				expiresAt := time.Now().Add(time.Hour)
+				expectCheckoutPrelude(1, 0)
+				mock.ExpectQuery("SELECT \\* FROM `holds` WHERE book_id = \\? AND status = \\?").
+					WithArgs(1, model.HoldReady).
+					WillReturnRows(sqlmock.NewRows(holdColumns).AddRow(7, 1, 3, model.HoldReady, expiresAt))
+				mock.ExpectQuery("SELECT count\\(\\*\\) FROM `loans` WHERE book_id = \\? AND status = \\?").
+					WithArgs(1, model.LoanActive).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+				mock.ExpectQuery("SELECT \\* FROM `holds` WHERE book_id = \\? AND member_id = \\? AND status = \\?").
+					WithArgs(1, 2, model.HoldReady).
+					WillReturnRows(sqlmock.NewRows(holdColumns))
+				mock.ExpectRollback()
+
+				_, err := manager.Checkout(1, 2)
+				gomega.Expect(err).To(gomega.MatchError(service.ErrNoCopyAvailable))
+				gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+			})
+		})
+
+		ginkgo.Context("member reached the loan limit", func() {
+			ginkgo.It("return ErrLoanLimit", func() {
+				expectCheckoutPrelude(1, model.DefaultLendingPolicy.MaxLoans)
+				mock.ExpectRollback()
+
+				_, err := manager.Checkout(1, 2)
+				gomega.Expect(err).To(gomega.MatchError(service.ErrLoanLimit))
+				gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+			})
+			ginkgo.It("use the loan limit of the manager's policy", func() {
+				policy := model.DefaultLendingPolicy
+				policy.MaxLoans = 1
+				expectCheckoutPrelude(1, 1)
+				mock.ExpectRollback()
+
+				_, err := manager.WithLendingPolicy(policy).Checkout(1, 2)
+				gomega.Expect(err).To(gomega.MatchError(service.ErrLoanLimit))
+				gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+			})
+		})
+
+		ginkgo.Context("book has no holdings", func() {
+			ginkgo.It("return ErrNotLendable", func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery("SELECT \\* FROM `holdings`").
+					WithArgs(1).
+					WillReturnRows(sqlmock.NewRows(holdingColumns))
+				mock.ExpectRollback()
+
+				_, err := manager.Checkout(1, 2)
+				gomega.Expect(err).To(gomega.MatchError(service.ErrNotLendable))
+				gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+			})
+		})
+	})
+
+	ginkgo.Describe("return", func() {
+		ginkgo.It("keep the copy for the first waiting hold", func() {
+			mock.ExpectBegin()
+			mock.ExpectQuery("SELECT \\* FROM `loans` WHERE `loans`.`id` = \\? ORDER BY `loans`.`id` LIMIT 1 FOR UPDATE").
+				WithArgs(5).
+				WillReturnRows(sqlmock.NewRows(loanColumns).AddRow(5, 1, 2, model.LoanActive, time.Now(), 0))
+			mock.ExpectQuery("SELECT \\* FROM `holdings`").
+				WithArgs(1).
+				WillReturnRows(sqlmock.NewRows(holdingColumns).AddRow(1, 1, 1))
+			mock.ExpectExec("UPDATE `loans` SET").
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectQuery("SELECT \\* FROM `holds` WHERE book_id = \\? AND status = \\?").
+				WithArgs(1, model.HoldReady).
+				WillReturnRows(sqlmock.NewRows(holdColumns))
+			mock.ExpectQuery("SELECT count\\(\\*\\) FROM `loans`").
+				WithArgs(1, model.LoanActive).
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+			mock.ExpectQuery("SELECT \\* FROM `holds` WHERE book_id = \\? AND status = \\? ORDER BY id LIMIT 1").
+				WithArgs(1, model.HoldWaiting).
+				WillReturnRows(sqlmock.NewRows(holdColumns).AddRow(7, 1, 3, model.HoldWaiting, nil))
+			mock.ExpectExec("UPDATE `holds` SET .*`status`=\\?").
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectCommit()
+
+			loan, err := manager.ReturnLoan(5)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(loan.Status).To(gomega.Equal(model.LoanReturned))
+			gomega.Expect(loan.ReturnedAt).NotTo(gomega.BeNil())
+			gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+		})
+	})
+
+	ginkgo.Describe("renew", func() {
+		ginkgo.It("refuse when other members are waiting", func() {
+			mock.ExpectBegin()
+			mock.ExpectQuery("SELECT \\* FROM `loans`").
+				WithArgs(5).
+				WillReturnRows(sqlmock.NewRows(loanColumns).AddRow(5, 1, 2, model.LoanActive, time.Now().Add(time.Hour), 0))
+			mock.ExpectQuery("SELECT count\\(\\*\\) FROM `holds` WHERE book_id = \\? AND status = \\?").
+				WithArgs(1, model.HoldWaiting).
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+			mock.ExpectRollback()
+
+			_, err := manager.RenewLoan(5)
+			gomega.Expect(err).To(gomega.MatchError(service.ErrHoldsWaiting))
+			gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+		})
+	})
+
+	ginkgo.Describe("overdue report", func() {
+		ginkgo.It("list active loans due before now, earliest first", func() {
+			now := time.Now()
+			mock.ExpectQuery("SELECT \\* FROM `loans` WHERE status = \\? AND due_at < \\? ORDER BY due_at,id LIMIT 20 OFFSET 20").
+				WithArgs(model.LoanActive, now).
+				WillReturnRows(sqlmock.NewRows(loanColumns).AddRow(5, 1, 2, model.LoanActive, now.Add(-time.Hour), 0))
+
+			loans, err := manager.ListOverdueLoans(now, 1, 20)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(loans).To(gomega.HaveLen(1))
+			gomega.Expect(loans[0].IsOverdue(now)).To(gomega.BeTrue())
+			gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+		})
+	})
+})
@@ -1,6 +1,10 @@
 package service
 
 import (
+	"database/sql"
+	"fmt"
+
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/model"
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
 )
@@ -12,6 +16,9 @@ type Manager struct {
 }
 
 func NewManager(db *gorm.DB) *Manager {
+	registerTenantCallbacks(db)
+	registerReplicaCallbacks(db)
+	registerTraceCallbacks(db)
 	return &Manager{db: db}
 }
 
@@ -19,11 +26,85 @@ func GetManager() *Manager {
 	return manager
 }
 
-func InitManagerFromDsn(dsn string) error {
+//SetManager 设置全局的 Manager，用于不通过 dsn 连接数据库的场景，例如进程内的端到端测试
+func SetManager(m *Manager) {
+	manager = m
+}
+
+//InitManagerFromDsn 连接主库 dsn 与只读副本 replicaDsns，并设置为全局的 Manager
+func InitManagerFromDsn(dsn string, replicaDsns ...string) error {
 	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{})
 	if err != nil {
 		return err
 	}
-	manager = &Manager{db: db}
+	replicas := make([]*sql.DB, 0, len(replicaDsns))
+	for _, replicaDsn := range replicaDsns {
+		pool, err := sql.Open("mysql", replicaDsn)
+		if err != nil {
+			return fmt.Errorf("open replica failed: %w", err)
+		}
+		replicas = append(replicas, pool)
+	}
+	manager = NewReplicatedManager(db, replicas...)
+	return nil
+}
+
+//Ping 检查数据库连接是否可用
+func (m *Manager) Ping() error {
+	db, err := m.db.DB()
+	if err != nil {
+		return err
+	}
+	return db.Ping()
+}
+
+//legacyIndexes 需要删除的旧索引，ISBN 改为租户内唯一后不再需要全局唯一索引
+var legacyIndexes = []struct {
+	model interface{}
+	name  string
+}{
+	{&model.Book{}, "idx_books_isbn13"},
+}
+
+//Migrate 创建或更新 Manager 使用的表
+func (m *Manager) Migrate() error {
+	err := m.db.AutoMigrate(
+		&model.Tenant{},
+		&model.Book{},
+		&model.OutboxEvent{},
+		&model.WebhookSubscription{},
+		&model.WebhookDelivery{},
+		&model.Cover{},
+		&model.BookTranslation{},
+		&model.Inventory{},
+		&model.StockMovement{},
+		&model.Member{},
+		&model.Holding{},
+		&model.Loan{},
+		&model.Hold{},
+		&model.Review{},
+		&model.BookRating{},
+		&model.Series{},
+		&model.SeriesEntry{},
+		&model.Work{},
+		&model.Edition{},
+		&model.Tag{},
+		&model.BookTag{},
+		&model.Subject{},
+		&model.BookSubject{},
+		&model.BookInteraction{},
+		&model.BookCooccurrence{},
+	)
+	if err != nil {
+		return err
+	}
+	migrator := m.db.Migrator()
+	for _, index := range legacyIndexes {
+		if migrator.HasIndex(index.model, index.name) {
+			if err := migrator.DropIndex(index.model, index.name); err != nil {
+				return err
+			}
+		}
+	}
 	return nil
 }
@@ -0,0 +1,54 @@
+package service
+
+import (
+	"time"
+
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/model"
+	"gorm.io/gorm"
+)
+
+//addEvent 在事务 tx 中写入事件
+func addEvent(tx *gorm.DB, eventType model.EventType, book *model.Book) error {
+	return addPayloadEvent(tx, eventType, book.ID, book)
+}
+
+//addPayloadEvent 在事务 tx 中写入 Payload 不是 Book 的事件
+func addPayloadEvent(tx *gorm.DB, eventType model.EventType, bookId uint, payload interface{}) error {
+	event, err := model.NewEvent(eventType, bookId, payload)
+	if err != nil {
+		return err
+	}
+	return tx.Create(event).Error
+}
+
+//PendingEvents 按写入顺序返回尚未投递的事件
+func (m *Manager) PendingEvents(limit int) ([]*model.OutboxEvent, error) {
+	var events []*model.OutboxEvent
+	if err := m.db.Where("published_at IS NULL").Order("id").Limit(limit).Find(&events).Error; err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+//EventsAfter 返回 id 大于 afterId 的事件，不论是否已经投递，用于重放
+func (m *Manager) EventsAfter(afterId uint, limit int) ([]*model.OutboxEvent, error) {
+	var events []*model.OutboxEvent
+	if err := m.db.Where("id > ?", afterId).Order("id").Limit(limit).Find(&events).Error; err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+//MarkEventPublished 标记事件已经投递
+func (m *Manager) MarkEventPublished(eventId uint) error {
+	return m.db.Model(&model.OutboxEvent{}).Where("id = ?", eventId).
+		Update("published_at", time.Now()).Error
+}
+
+//MarkEventFailed 记录投递失败的次数与原因
+func (m *Manager) MarkEventFailed(eventId uint, cause error) error {
+	return m.db.Model(&model.OutboxEvent{}).Where("id = ?", eventId).Updates(map[string]interface{}{
+		"attempts":   gorm.Expr("attempts + 1"),
+		"last_error": cause.Error(),
+	}).Error
+}
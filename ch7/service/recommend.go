@@ -0,0 +1,151 @@
+package service
+
+import (
+	"math"
+	"sort"
+
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	//MaxInteractionHistory 记录新交互时最多与读者最近交互过的多少本书计算共现
+	MaxInteractionHistory = 200
+	//cooccurrenceCandidates 计算相似度时每个推荐位读取的共现候选数量
+	cooccurrenceCandidates = 4
+)
+
+//RecordInteraction 记录读者与 Book 的交互，并增量更新该 Book 与读者交互过的其他 Book 的共现次数。
+//重复的交互不会重复计数
+func (m *Manager) RecordInteraction(userKey string, bookId uint) error {
+	return m.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&model.BookInteraction{UserKey: userKey, BookID: bookId})
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		var others []uint
+		err := tx.Model(&model.BookInteraction{}).
+			Where("user_key = ? AND book_id <> ?", userKey, bookId).
+			Order("id DESC").Limit(MaxInteractionHistory).Pluck("book_id", &others).Error
+		if err != nil || len(others) == 0 {
+			return err
+		}
+		pairs := make([]*model.BookCooccurrence, 0, 2*len(others))
+		for _, other := range others {
+			pairs = append(pairs,
+				&model.BookCooccurrence{BookID: bookId, OtherID: other, Occurrences: 1},
+				&model.BookCooccurrence{BookID: other, OtherID: bookId, Occurrences: 1})
+		}
+		return tx.Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "book_id"}, {Name: "other_id"}},
+			DoUpdates: clause.Set{
+				{Column: clause.Column{Name: "occurrences"}, Value: gorm.Expr("occurrences + 1")},
+			},
+		}).Create(&pairs).Error
+	})
+}
+
+//SimilarBooks 返回与 Book 相似的 Book。优先按照共现的余弦相似度推荐，
+//数据不足时依次使用同一作者、同一类型的 Book 补足
+func (m *Manager) SimilarBooks(bookId uint, limit int) ([]*model.Recommendation, error) {
+	book, err := m.GetBook(bookId)
+	if err != nil {
+		return nil, err
+	}
+	recommendations, err := m.cooccurringBooks(bookId, limit)
+	if err != nil {
+		return nil, err
+	}
+	exclude := []uint{bookId}
+	for _, r := range recommendations {
+		exclude = append(exclude, r.Book.ID)
+	}
+
+	fallbacks := []struct {
+		reason model.RecommendReason
+		query  func(db *gorm.DB) *gorm.DB
+	}{
+		{model.ReasonSameAuthor, func(db *gorm.DB) *gorm.DB {
+			return db.Where("author = ?", book.Author)
+		}},
+		{model.ReasonSameCatalog, func(db *gorm.DB) *gorm.DB {
+			if book.Catalog() == model.CategoryShortStory {
+				return db.Where("pages < ?", model.MaxShortStoryPages)
+			}
+			return db.Where("pages >= ?", model.MaxShortStoryPages)
+		}},
+	}
+	for _, fallback := range fallbacks {
+		if len(recommendations) >= limit {
+			break
+		}
+		if fallback.reason == model.ReasonSameAuthor && book.Author == "" {
+			continue
+		}
+		var books []*model.Book
+		err := fallback.query(m.db).Where("id NOT IN ?", exclude).
+			Order("id DESC").Limit(limit - len(recommendations)).Find(&books).Error
+		if err != nil {
+			return nil, err
+		}
+		for _, b := range books {
+			recommendations = append(recommendations, &model.Recommendation{Book: b, Reason: fallback.reason})
+			exclude = append(exclude, b.ID)
+		}
+	}
+	return recommendations, nil
+}
+
+//cooccurringBooks 按照余弦相似度 occurrences / sqrt(n(a) * n(b)) 返回共现的 Book，
+//n 为与 Book 有交互的读者数量
+func (m *Manager) cooccurringBooks(bookId uint, limit int) ([]*model.Recommendation, error) {
+	var pairs []*model.BookCooccurrence
+	err := m.db.Where("book_id = ?", bookId).Order("occurrences DESC").Order("other_id").
+		Limit(limit * cooccurrenceCandidates).Find(&pairs).Error
+	if err != nil || len(pairs) == 0 {
+		return nil, err
+	}
+	ids := []uint{bookId}
+	for _, pair := range pairs {
+		ids = append(ids, pair.OtherID)
+	}
+	var counts []struct {
+		BookID uint
+		N      int64
+	}
+	err = m.db.Model(&model.BookInteraction{}).Select("book_id, COUNT(*) AS n").
+		Where("book_id IN ?", ids).Group("book_id").Scan(&counts).Error
+	if err != nil {
+		return nil, err
+	}
+	n := make(map[uint]int64, len(counts))
+	for _, count := range counts {
+		n[count.BookID] = count.N
+	}
+	books, err := findBooks(m.db, ids[1:])
+	if err != nil {
+		return nil, err
+	}
+
+	recommendations := make([]*model.Recommendation, 0, len(pairs))
+	for _, pair := range pairs {
+		book, ok := books[pair.OtherID]
+		if !ok || n[bookId] == 0 || n[pair.OtherID] == 0 {
+			continue
+		}
+		recommendations = append(recommendations, &model.Recommendation{
+			Book:   book,
+			Score:  float64(pair.Occurrences) / math.Sqrt(float64(n[bookId]*n[pair.OtherID])),
+			Reason: model.ReasonCooccurrence,
+		})
+	}
+	sort.SliceStable(recommendations, func(i, j int) bool {
+		return recommendations[i].Score > recommendations[j].Score
+	})
+	if len(recommendations) > limit {
+		recommendations = recommendations[:limit]
+	}
+	return recommendations, nil
+}
@@ -0,0 +1,87 @@
+package service_test
+
+import (
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/model"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/service"
+)
+
+var _ = ginkgo.Describe("manager to recommend books", func() {
+	var manager *service.Manager
+	var mock sqlmock.Sqlmock
+	bookColumns := []string{"id", "title", "author", "pages"}
+
+	ginkgo.BeforeEach(func() {
+		manager, mock = newMockManager()
+	})
+
+	ginkgo.Describe("record interaction", func() {
+		ginkgo.It("increase co-occurrence with the other books of the reader in both directions", func() {
+			mock.ExpectBegin()
+			mock.ExpectExec("INSERT INTO `book_interactions` .* ON DUPLICATE KEY UPDATE").
+				WithArgs(sqlmock.AnyArg(), "", "user:alice", 3).
+				WillReturnResult(sqlmock.NewResult(1, 1))
+			mock.ExpectQuery("SELECT `book_id` FROM `book_interactions` WHERE user_key = \\? AND book_id <> \\? ORDER BY id DESC LIMIT 200").
+				WithArgs("user:alice", 3).
+				WillReturnRows(sqlmock.NewRows([]string{"book_id"}).AddRow(1))
+			mock.ExpectExec("INSERT INTO `book_cooccurrences` .* ON DUPLICATE KEY UPDATE `occurrences`=occurrences \\+ 1").
+				WithArgs("", 3, 1, 1, "", 1, 3, 1).
+				WillReturnResult(sqlmock.NewResult(1, 2))
+			mock.ExpectCommit()
+
+			gomega.Expect(manager.RecordInteraction("user:alice", 3)).To(gomega.Succeed())
+			gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+		})
+
+		ginkgo.It("count a repeated interaction only once", func() {
+			mock.ExpectBegin()
+			mock.ExpectExec("INSERT INTO `book_interactions`").
+				WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectCommit()
+
+			gomega.Expect(manager.RecordInteraction("user:alice", 3)).To(gomega.Succeed())
+			gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+		})
+	})
+
+	ginkgo.Describe("similar books", func() {
+		ginkgo.It("rank by cosine similarity & fill with same author and catalog", func() {
+			mock.ExpectQuery("SELECT \\* FROM `books` WHERE `books`.`id` = \\?").
+				WithArgs(1).
+				WillReturnRows(sqlmock.NewRows(bookColumns).AddRow(1, "Dune", "Frank Herbert", 600))
+			mock.ExpectQuery("SELECT \\* FROM `book_cooccurrences` WHERE book_id = \\? ORDER BY occurrences DESC,other_id LIMIT 16").
+				WithArgs(1).
+				WillReturnRows(sqlmock.NewRows([]string{"book_id", "other_id", "occurrences"}).
+					AddRow(1, 2, 2).
+					AddRow(1, 3, 1))
+			mock.ExpectQuery("SELECT book_id, COUNT\\(\\*\\) AS n FROM `book_interactions` WHERE book_id IN \\(\\?,\\?,\\?\\) GROUP BY `book_id`").
+				WithArgs(1, 2, 3).
+				WillReturnRows(sqlmock.NewRows([]string{"book_id", "n"}).AddRow(1, 4).AddRow(2, 16).AddRow(3, 1))
+			mock.ExpectQuery("SELECT \\* FROM `books` WHERE id IN \\(\\?,\\?\\)").
+				WithArgs(2, 3).
+				WillReturnRows(sqlmock.NewRows(bookColumns).
+					AddRow(2, "Foundation", "Isaac Asimov", 300).
+					AddRow(3, "Hyperion", "Dan Simmons", 500))
+			mock.ExpectQuery("SELECT \\* FROM `books` WHERE author = \\? AND id NOT IN \\(\\?,\\?,\\?\\) .* ORDER BY id DESC LIMIT 2").
+				WithArgs("Frank Herbert", 1, 3, 2).
+				WillReturnRows(sqlmock.NewRows(bookColumns).AddRow(4, "Dune Messiah", "Frank Herbert", 350))
+			mock.ExpectQuery("SELECT \\* FROM `books` WHERE pages >= \\? AND id NOT IN \\(\\?,\\?,\\?,\\?\\) .* ORDER BY id DESC LIMIT 1").
+				WithArgs(model.MaxShortStoryPages, 1, 3, 2, 4).
+				WillReturnRows(sqlmock.NewRows(bookColumns).AddRow(5, "Anathem", "Neal Stephenson", 900))
+
+			recommendations, err := manager.SimilarBooks(1, 4)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(recommendations).To(gomega.HaveLen(4))
+			//Hyperion: 1/sqrt(4*1) = 0.5，Foundation: 2/sqrt(4*16) = 0.25
+			gomega.Expect(recommendations[0].Book.Title).To(gomega.Equal("Hyperion"))
+			gomega.Expect(recommendations[0].Score).To(gomega.Equal(0.5))
+			gomega.Expect(recommendations[1].Book.Title).To(gomega.Equal("Foundation"))
+			gomega.Expect(recommendations[1].Score).To(gomega.Equal(0.25))
+			gomega.Expect(recommendations[2].Reason).To(gomega.Equal(model.ReasonSameAuthor))
+			gomega.Expect(recommendations[3].Reason).To(gomega.Equal(model.ReasonSameCatalog))
+			gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+		})
+	})
+})
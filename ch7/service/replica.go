@@ -0,0 +1,190 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"log"
+	"net"
+	"sync/atomic"
+	"time"
+
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"gorm.io/gorm"
+)
+
+const (
+	replicasKey = "replica:set"     //replicasKey Manager 可以使用的只读副本
+	writesKey   = "replica:writes"  //writesKey 记录 Manager 是否写入过数据，用于读己之写
+	primaryKey  = "replica:primary" //primaryKey 所有读取都使用主库
+)
+
+//DefaultReplicaCheckTimeout 健康检查时单个副本 Ping 的超时时间
+var DefaultReplicaCheckTimeout = time.Second
+
+//replica 一个只读副本，down 不为 0 时不再分配读取，直到健康检查成功
+type replica struct {
+	pool *sql.DB
+	down int32
+}
+
+func (r *replica) healthy() bool {
+	return atomic.LoadInt32(&r.down) == 0
+}
+
+func (r *replica) setHealthy(healthy bool) {
+	var down int32
+	if !healthy {
+		down = 1
+	}
+	atomic.StoreInt32(&r.down, down)
+}
+
+//replicaSet 按照轮询的方式在健康的副本之间分配读取
+type replicaSet struct {
+	replicas []*replica
+	next     uint32
+}
+
+//pick 返回下一个健康的副本，全部不可用时返回 nil
+func (s *replicaSet) pick() *replica {
+	n := uint32(len(s.replicas))
+	start := atomic.AddUint32(&s.next, 1) - 1
+	for i := uint32(0); i < n; i++ {
+		if r := s.replicas[(start+i)%n]; r.healthy() {
+			return r
+		}
+	}
+	return nil
+}
+
+//writeTracker 记录 Manager 是否写入过数据
+type writeTracker struct {
+	wrote int32
+}
+
+//NewReplicatedManager 创建写入使用 primary、GetBook 与 ListBooks 等读取使用 replicas 的 Manager。
+//副本初始为可用，之后由 CheckReplicas 或 WatchReplicas 更新状态
+func NewReplicatedManager(primary *gorm.DB, replicas ...*sql.DB) *Manager {
+	m := NewManager(primary)
+	if len(replicas) == 0 {
+		return m
+	}
+	set := &replicaSet{}
+	for _, pool := range replicas {
+		set.replicas = append(set.replicas, &replica{pool: pool})
+	}
+	return &Manager{db: m.db.Set(replicasKey, set).Session(&gorm.Session{})}
+}
+
+//TrackWrites 返回一个 Manager，通过它写入数据之后的读取都使用主库，避免副本延迟导致读不到刚写入的数据。
+//每个请求使用一个，请求结束后丢弃
+func (m *Manager) TrackWrites() *Manager {
+	return &Manager{db: m.db.Set(writesKey, &writeTracker{}).Session(&gorm.Session{})}
+}
+
+//Primary 返回所有读取都使用主库的 Manager，用于读取后需要立即更新的场景
+func (m *Manager) Primary() *Manager {
+	return &Manager{db: m.db.Set(primaryKey, true).Session(&gorm.Session{})}
+}
+
+//registerReplicaCallbacks 注册记录写入的回调，同一个 gorm.DB 只注册一次
+func registerReplicaCallbacks(db *gorm.DB) {
+	if db.Callback().Create().Get("replica:create") != nil {
+		return
+	}
+	_ = db.Callback().Create().Before("gorm:create").Register("replica:create", trackWrite)
+	_ = db.Callback().Update().Before("gorm:update").Register("replica:update", trackWrite)
+	_ = db.Callback().Delete().Before("gorm:delete").Register("replica:delete", trackWrite)
+	_ = db.Callback().Raw().Before("gorm:raw").Register("replica:raw", trackWrite)
+}
+
+//trackWrite 在执行写入之前记录，写入失败时主库中也可能已经有部分数据，按照写入过处理
+func trackWrite(db *gorm.DB) {
+	if v, ok := db.Get(writesKey); ok {
+		atomic.StoreInt32(&v.(*writeTracker).wrote, 1)
+	}
+}
+
+//reader 返回执行读取的 gorm.DB，以及使用的副本。
+//事务中、要求使用主库、已经写入过数据或者没有可用的副本时使用主库，返回的副本为 nil
+func (m *Manager) reader() (*gorm.DB, *replica) {
+	v, ok := m.db.Get(replicasKey)
+	if !ok || m.inTx() {
+		return m.db, nil
+	}
+	if _, ok := m.db.Get(primaryKey); ok {
+		return m.db, nil
+	}
+	if tracker, ok := m.db.Get(writesKey); ok && atomic.LoadInt32(&tracker.(*writeTracker).wrote) == 1 {
+		return m.db, nil
+	}
+	r := v.(*replicaSet).pick()
+	if r == nil {
+		return m.db, nil
+	}
+	//Session 指定 Context 时会复制 Statement，修改 ConnPool 不会影响 m.db
+	db := m.db.Session(&gorm.Session{Context: m.db.Statement.Context})
+	db.Statement.ConnPool = r.pool
+	return db, r
+}
+
+//read 优先在副本上执行读取，副本连接失败时标记为不可用，并改为在主库上重新执行
+func (m *Manager) read(fn func(db *gorm.DB) error) error {
+	db, r := m.reader()
+	err := fn(db)
+	if r != nil && isConnError(err) {
+		log.Printf("read from replica failed, fall back to primary: %s", err)
+		r.setHealthy(false)
+		return fn(m.db)
+	}
+	return err
+}
+
+//isConnError 返回错误是否由连接不可用导致，其他错误在主库上执行也会失败，不需要切换
+func isConnError(err error) bool {
+	if err == nil {
+		return false
+	}
+	var netErr net.Error
+	return errors.Is(err, driver.ErrBadConn) || errors.Is(err, mysqldriver.ErrInvalidConn) || errors.As(err, &netErr)
+}
+
+//CheckReplicas Ping 所有副本并更新可用状态，返回可用的副本数量
+func (m *Manager) CheckReplicas(ctx context.Context) int {
+	v, ok := m.db.Get(replicasKey)
+	if !ok {
+		return 0
+	}
+	healthy := 0
+	for i, r := range v.(*replicaSet).replicas {
+		pingCtx, cancel := context.WithTimeout(ctx, DefaultReplicaCheckTimeout)
+		err := r.pool.PingContext(pingCtx)
+		cancel()
+		if err != nil && r.healthy() {
+			log.Printf("replica %d is down: %s", i, err)
+		} else if err == nil && !r.healthy() {
+			log.Printf("replica %d is up", i)
+		}
+		r.setHealthy(err == nil)
+		if err == nil {
+			healthy++
+		}
+	}
+	return healthy
+}
+
+//WatchReplicas 每隔 interval 检查一次副本，直到 ctx 结束
+func (m *Manager) WatchReplicas(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		m.CheckReplicas(ctx)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package service_test
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/model"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/service"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+var _ = ginkgo.Describe("manager with read replicas", func() {
+	var manager *service.Manager
+	var primary sqlmock.Sqlmock
+	var replicas []sqlmock.Sqlmock
+	bookColumns := []string{"id", "title"}
+
+	newMock := func(monitorPings bool) (*sql.DB, sqlmock.Sqlmock) {
+		client, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(monitorPings))
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		ginkgo.DeferCleanup(func() {
+			_ = client.Close()
+		})
+		return client, mock
+	}
+
+	ginkgo.BeforeEach(func() {
+		//gorm.Open 会 Ping 主库，只检查副本的 Ping
+		client, mock := newMock(false)
+		primary = mock
+		db, err := gorm.Open(mysql.New(mysql.Config{SkipInitializeWithVersion: true, Conn: client}), &gorm.Config{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		var pools []*sql.DB
+		replicas = nil
+		for i := 0; i < 2; i++ {
+			pool, mock := newMock(true)
+			pools = append(pools, pool)
+			replicas = append(replicas, mock)
+		}
+		manager = service.NewReplicatedManager(db, pools...)
+	})
+
+	expectGetBook := func(mock sqlmock.Sqlmock, id int) {
+		mock.ExpectQuery("SELECT \\* FROM `books` WHERE `books`.`id` = \\?").
+			WithArgs(id).
+			WillReturnRows(sqlmock.NewRows(bookColumns).AddRow(id, "Go"))
+	}
+
+	expectationsWereMet := func() {
+		gomega.Expect(primary.ExpectationsWereMet()).To(gomega.Succeed())
+		for _, mock := range replicas {
+			gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+		}
+	}
+
+	ginkgo.It("spread reads over replicas by round-robin", func() {
+		expectGetBook(replicas[0], 1)
+		expectGetBook(replicas[1], 2)
+		replicas[0].ExpectQuery("SELECT \\* FROM `books` WHERE `books`.`deleted_at` IS NULL ORDER BY books.id LIMIT 10").
+			WillReturnRows(sqlmock.NewRows(bookColumns).AddRow(1, "Go"))
+
+		for _, id := range []uint{1, 2} {
+			book, err := manager.GetBook(id)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(book.ID).To(gomega.Equal(id))
+		}
+		books, err := manager.ListBooks(model.BookQuery{PageOptions: model.PageOptions{PageSize: 10}})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(books).To(gomega.HaveLen(1))
+		expectationsWereMet()
+	})
+
+	ginkgo.It("keep the tenant condition on replicas", func() {
+		replicas[0].ExpectQuery("SELECT \\* FROM `books` WHERE `books`.`id` = \\? AND `books`.`tenant_id` = \\?").
+			WithArgs(1, "acme").
+			WillReturnRows(sqlmock.NewRows(bookColumns).AddRow(1, "Go"))
+
+		_, err := manager.ForTenant("acme").GetBook(1)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		expectationsWereMet()
+	})
+
+	ginkgo.It("read from primary after writing through a tracked manager", func() {
+		tracked := manager.TrackWrites()
+		expectGetBook(replicas[0], 1)
+		primary.ExpectBegin()
+		primary.ExpectExec("^INSERT INTO `books`").WillReturnResult(sqlmock.NewResult(2, 1))
+		primary.ExpectExec("^INSERT INTO `outbox_events`").WillReturnResult(sqlmock.NewResult(1, 1))
+		primary.ExpectCommit()
+		expectGetBook(primary, 2)
+		expectGetBook(replicas[1], 2)
+
+		_, err := tracked.GetBook(1)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(tracked.AddBook(&model.Book{Title: "Go"})).To(gomega.Succeed())
+		_, err = tracked.GetBook(2)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		//其他请求不受影响
+		_, err = manager.GetBook(2)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		expectationsWereMet()
+	})
+
+	ginkgo.It("read from primary in transactions", func() {
+		primary.ExpectBegin()
+		expectGetBook(primary, 1)
+		primary.ExpectCommit()
+
+		err := manager.InTx(context.Background(), func(tx *service.Manager) error {
+			_, err := tx.GetBook(1)
+			return err
+		})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		expectationsWereMet()
+	})
+
+	ginkgo.It("fall back to primary when a replica connection fails", func() {
+		replicas[0].ExpectQuery("SELECT \\* FROM `books`").WillReturnError(mysqldriver.ErrInvalidConn)
+		expectGetBook(primary, 1)
+		expectGetBook(replicas[1], 1)
+		expectGetBook(replicas[1], 1)
+
+		for i := 0; i < 3; i++ {
+			_, err := manager.GetBook(1)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		}
+		expectationsWereMet()
+	})
+
+	ginkgo.It("not fall back for query errors", func() {
+		replicas[0].ExpectQuery("SELECT \\* FROM `books`").
+			WillReturnRows(sqlmock.NewRows(bookColumns))
+
+		_, err := manager.GetBook(1)
+		gomega.Expect(err).To(gomega.MatchError(gorm.ErrRecordNotFound))
+		expectationsWereMet()
+	})
+
+	ginkgo.It("skip unhealthy replicas until they recover", func() {
+		replicas[0].ExpectPing().WillReturnError(mysqldriver.ErrInvalidConn)
+		replicas[1].ExpectPing().WillReturnError(mysqldriver.ErrInvalidConn)
+		gomega.Expect(manager.CheckReplicas(context.Background())).To(gomega.Equal(0))
+		expectGetBook(primary, 1)
+		_, err := manager.GetBook(1)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		replicas[0].ExpectPing()
+		replicas[1].ExpectPing().WillReturnError(mysqldriver.ErrInvalidConn)
+		gomega.Expect(manager.CheckReplicas(context.Background())).To(gomega.Equal(1))
+		expectGetBook(replicas[0], 1)
+		expectGetBook(replicas[0], 1)
+		for i := 0; i < 2; i++ {
+			_, err = manager.GetBook(1)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		}
+		expectationsWereMet()
+	})
+})
@@ -0,0 +1,164 @@
+package service
+
+import (
+	"errors"
+	"time"
+
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+//SaveReview 创建或者替换用户对 Book 的评价，并在同一个事务中更新评价汇总
+func (m *Manager) SaveReview(review *model.Review) error {
+	if err := review.Validate(); err != nil {
+		return err
+	}
+	err := m.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Select("id").First(&model.Book{}, review.BookID).Error; err != nil {
+			return err
+		}
+		var existing model.Review
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("book_id = ? AND user_id = ?", review.BookID, review.UserID).
+			First(&existing).Error
+		switch {
+		case err == nil:
+			delta := review.Rating - existing.Rating
+			existing.Rating = review.Rating
+			existing.Text = review.Text
+			if err := tx.Save(&existing).Error; err != nil {
+				return err
+			}
+			*review = existing
+			if err := applyRating(tx, review.BookID, 0, delta); err != nil {
+				return err
+			}
+			return addPayloadEvent(tx, model.EventReviewSaved, review.BookID, review)
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			if err := tx.Create(review).Error; err != nil {
+				return err
+			}
+			if err := applyRating(tx, review.BookID, 1, review.Rating); err != nil {
+				return err
+			}
+			return addPayloadEvent(tx, model.EventReviewSaved, review.BookID, review)
+		default:
+			return err
+		}
+	})
+	if isDuplicateKey(err) {
+		//同一个用户并发创建了评价，重新按照替换处理
+		return m.SaveReview(review)
+	}
+	return err
+}
+
+//DeleteReview 删除用户对 Book 的评价，并在同一个事务中更新评价汇总
+func (m *Manager) DeleteReview(bookId uint, userId string) error {
+	return m.db.Transaction(func(tx *gorm.DB) error {
+		var review model.Review
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("book_id = ? AND user_id = ?", bookId, userId).
+			First(&review).Error
+		if err != nil {
+			return err
+		}
+		if err := tx.Delete(&review).Error; err != nil {
+			return err
+		}
+		if err := applyRating(tx, bookId, -1, -review.Rating); err != nil {
+			return err
+		}
+		return addPayloadEvent(tx, model.EventReviewDeleted, bookId, &review)
+	})
+}
+
+//ListReviews 按照时间倒序返回 Book 的评价
+func (m *Manager) ListReviews(bookId uint, pageNumber, pageSize int) ([]*model.Review, error) {
+	var reviews []*model.Review
+	err := m.db.Where("book_id = ?", bookId).Order("id DESC").
+		Limit(pageSize).Offset(pageNumber * pageSize).Find(&reviews).Error
+	if err != nil {
+		return nil, err
+	}
+	return reviews, nil
+}
+
+//ReviewsByBooks 批量返回每个 Book 最新的 limit 条评价，一次查询代替逐个 Book 调用 ListReviews。
+//用关联子查询统计更新的评价数量实现每组取前 N 条，不依赖窗口函数
+func (m *Manager) ReviewsByBooks(bookIds []uint, limit int) (map[uint][]*model.Review, error) {
+	result := make(map[uint][]*model.Review, len(bookIds))
+	if len(bookIds) == 0 {
+		return result, nil
+	}
+	var reviews []*model.Review
+	err := m.db.Where("book_id IN ?", bookIds).
+		Where("(SELECT COUNT(*) FROM reviews AS newer WHERE newer.book_id = reviews.book_id AND newer.id > reviews.id) < ?", limit).
+		Order("book_id").Order("id DESC").Find(&reviews).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, review := range reviews {
+		result[review.BookID] = append(result[review.BookID], review)
+	}
+	return result, nil
+}
+
+//RatingsByBooks 批量返回 Book 的评价汇总，没有评价的 Book 返回零值
+func (m *Manager) RatingsByBooks(bookIds []uint) (map[uint]*model.BookRating, error) {
+	result := make(map[uint]*model.BookRating, len(bookIds))
+	if len(bookIds) > 0 {
+		var ratings []*model.BookRating
+		if err := m.db.Where("book_id IN ?", bookIds).Find(&ratings).Error; err != nil {
+			return nil, err
+		}
+		for _, rating := range ratings {
+			result[rating.BookID] = rating
+		}
+	}
+	for _, bookId := range bookIds {
+		if _, ok := result[bookId]; !ok {
+			result[bookId] = &model.BookRating{BookID: bookId}
+		}
+	}
+	return result, nil
+}
+
+//GetRating 返回 Book 的评价汇总，没有评价时返回零值
+func (m *Manager) GetRating(bookId uint) (*model.BookRating, error) {
+	var rating model.BookRating
+	err := m.db.Where("book_id = ?", bookId).First(&rating).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &model.BookRating{BookID: bookId}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &rating, nil
+}
+
+//applyRating 增量更新评价汇总。MySQL 按照从左到右的顺序执行赋值，SQLite 等数据库所有赋值都使用更新前的值，
+//average_rating 放在最前面并且只使用更新前的值计算，两种顺序的结果一致
+func applyRating(tx *gorm.DB, bookId uint, count, sum int) error {
+	rating := &model.BookRating{
+		BookID:      bookId,
+		ReviewCount: int64(count),
+		RatingSum:   int64(sum),
+		UpdatedAt:   time.Now(),
+	}
+	if count > 0 {
+		rating.AverageRating = float64(sum) / float64(count)
+	}
+	return tx.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "book_id"}},
+		DoUpdates: clause.Set{
+			{Column: clause.Column{Name: "average_rating"},
+				Value: gorm.Expr("CASE WHEN review_count + ? > 0 THEN (rating_sum + ?) * 1.0 / (review_count + ?) ELSE 0 END",
+					count, sum, count)},
+			{Column: clause.Column{Name: "review_count"}, Value: gorm.Expr("review_count + ?", count)},
+			{Column: clause.Column{Name: "rating_sum"}, Value: gorm.Expr("rating_sum + ?", sum)},
+			{Column: clause.Column{Name: "updated_at"}, Value: rating.UpdatedAt},
+		},
+	}).Create(rating).Error
+}
@@ -0,0 +1,162 @@
+package service_test
+
+import (
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/model"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/service"
+)
+
+var _ = ginkgo.Describe("manager to review books", func() {
+	var manager *service.Manager
+	var mock sqlmock.Sqlmock
+	reviewColumns := []string{"id", "book_id", "user_id", "rating", "text"}
+
+	ginkgo.BeforeEach(func() {
+		manager, mock = newMockManager()
+	})
+
+	expectBook := func() {
+		mock.ExpectQuery("SELECT `id` FROM `books` WHERE `books`.`id` = \\?").
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	}
+
+	ginkgo.Describe("save review", func() {
+		ginkgo.Context("user has not reviewed the book", func() {
+			ginkgo.It("create the review & add it to the aggregate", func() {
+				mock.ExpectBegin()
+				expectBook()
+				mock.ExpectQuery("SELECT \\* FROM `reviews` WHERE book_id = \\? AND user_id = \\? ORDER BY `reviews`.`id` LIMIT 1 FOR UPDATE").
+					WithArgs(1, "alice").
+					WillReturnRows(sqlmock.NewRows(reviewColumns))
+				mock.ExpectExec("INSERT INTO `reviews`").
+					WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), "", 1, "alice", 4, "good").
+					WillReturnResult(sqlmock.NewResult(3, 1))
+				mock.ExpectExec("INSERT INTO `book_ratings` .* ON DUPLICATE KEY UPDATE " +
+					"`average_rating`=CASE WHEN review_count \\+ \\? > 0 THEN \\(rating_sum \\+ \\?\\) \\* 1.0 / \\(review_count \\+ \\?\\) ELSE 0 END," +
+					"`review_count`=review_count \\+ \\?,`rating_sum`=rating_sum \\+ \\?,`updated_at`=\\?").
+					WithArgs(sqlmock.AnyArg(), "", 1, 1, 4, float64(4), 1, 4, 1, 1, 4, sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec("^INSERT INTO `outbox_events`").
+					WithArgs(sqlmock.AnyArg(), "", model.EventReviewSaved, 1, sqlmock.AnyArg(), nil, 0, "").
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
+
+				review := &model.Review{BookID: 1, UserID: "alice", Rating: 4, Text: "good"}
+				gomega.Expect(manager.SaveReview(review)).To(gomega.Succeed())
+				gomega.Expect(review.ID).To(gomega.Equal(uint(3)))
+				gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+			})
+		})
+
+		ginkgo.Context("user has reviewed the book", func() {
+			ginkgo.It("replace the review & apply the rating difference", func() {
+				mock.ExpectBegin()
+				expectBook()
+				mock.ExpectQuery("SELECT \\* FROM `reviews`").
+					WithArgs(1, "alice").
+					WillReturnRows(sqlmock.NewRows(reviewColumns).AddRow(3, 1, "alice", 4, "good"))
+				mock.ExpectExec("UPDATE `reviews` SET").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec("INSERT INTO `book_ratings`").
+					WithArgs(sqlmock.AnyArg(), "", 1, 0, -2, float64(0), 0, -2, 0, 0, -2, sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(0, 2))
+				mock.ExpectExec("^INSERT INTO `outbox_events`").
+					WithArgs(sqlmock.AnyArg(), "", model.EventReviewSaved, 1, sqlmock.AnyArg(), nil, 0, "").
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
+
+				review := &model.Review{BookID: 1, UserID: "alice", Rating: 2, Text: "changed my mind"}
+				gomega.Expect(manager.SaveReview(review)).To(gomega.Succeed())
+				gomega.Expect(review.ID).To(gomega.Equal(uint(3)))
+				gomega.Expect(review.Text).To(gomega.Equal("changed my mind"))
+				gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+			})
+		})
+
+		ginkgo.Context("rating out of range", func() {
+			ginkgo.It("return ErrInvalidRating", func() {
+				review := &model.Review{BookID: 1, UserID: "alice", Rating: 6}
+				gomega.Expect(manager.SaveReview(review)).To(gomega.MatchError(model.ErrInvalidRating))
+			})
+		})
+	})
+
+	ginkgo.Describe("delete review", func() {
+		ginkgo.It("remove the review from the aggregate & save an event", func() {
+			mock.ExpectBegin()
+			mock.ExpectQuery("SELECT \\* FROM `reviews`").
+				WithArgs(1, "alice").
+				WillReturnRows(sqlmock.NewRows(reviewColumns).AddRow(3, 1, "alice", 4, "good"))
+			mock.ExpectExec("DELETE FROM `reviews` WHERE `reviews`.`id` = \\?").
+				WithArgs(3).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec("INSERT INTO `book_ratings`").
+				WithArgs(sqlmock.AnyArg(), "", 1, -1, -4, float64(0), -1, -4, -1, -1, -4, sqlmock.AnyArg()).
+				WillReturnResult(sqlmock.NewResult(0, 2))
+			mock.ExpectExec("^INSERT INTO `outbox_events`").
+				WithArgs(sqlmock.AnyArg(), "", model.EventReviewDeleted, 1, sqlmock.AnyArg(), nil, 0, "").
+				WillReturnResult(sqlmock.NewResult(1, 1))
+			mock.ExpectCommit()
+
+			gomega.Expect(manager.DeleteReview(1, "alice")).To(gomega.Succeed())
+			gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+		})
+	})
+
+	ginkgo.Describe("list books", func() {
+		ginkgo.It("page by page_size & page_number", func() {
+			mock.ExpectQuery("SELECT \\* FROM `books` WHERE `books`.`deleted_at` IS NULL ORDER BY books.id LIMIT 10 OFFSET 20").
+				WillReturnRows(sqlmock.NewRows([]string{"id", "title"}).AddRow(21, "Go"))
+
+			books, err := manager.ListBooks(model.BookQuery{PageOptions: model.PageOptions{PageNumber: 2, PageSize: 10}})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(books).To(gomega.HaveLen(1))
+			gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+		})
+
+		ginkgo.It("sort by average rating with the aggregate", func() {
+			mock.ExpectQuery("SELECT books.\\*, COALESCE\\(book_ratings.average_rating, 0\\) AS average_rating, " +
+				"COALESCE\\(book_ratings.review_count, 0\\) AS review_count FROM `books` " +
+				"LEFT JOIN book_ratings ON book_ratings.book_id = books.id WHERE `books`.`deleted_at` IS NULL " +
+				"ORDER BY average_rating DESC,review_count DESC,books.id LIMIT 10").
+				WillReturnRows(sqlmock.NewRows([]string{"id", "title", "average_rating", "review_count"}).
+					AddRow(2, "Go", 4.5, 2).
+					AddRow(1, "Java", 0, 0))
+
+			books, err := manager.ListBooks(model.BookQuery{PageOptions: model.PageOptions{PageSize: 10}, Sort: model.SortByRating})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(books).To(gomega.HaveLen(2))
+			gomega.Expect(books[0].AverageRating).To(gomega.Equal(4.5))
+			gomega.Expect(books[0].ReviewCount).To(gomega.Equal(int64(2)))
+			gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+		})
+
+		ginkgo.It("reject unknown sort", func() {
+			_, err := manager.ListBooks(model.BookQuery{PageOptions: model.PageOptions{PageSize: 10}, Sort: "title"})
+			gomega.Expect(err).To(gomega.MatchError(model.ErrInvalidSort))
+		})
+	})
+
+	ginkgo.Describe("load reviews of many books", func() {
+		ginkgo.It("take latest reviews of each book in one query", func() {
+			mock.ExpectQuery("SELECT \\* FROM `reviews` WHERE book_id IN \\(\\?,\\?\\) AND " +
+				"\\(\\(SELECT COUNT\\(\\*\\) FROM reviews AS newer WHERE newer.book_id = reviews.book_id AND newer.id > reviews.id\\) < \\?\\) " +
+				"ORDER BY book_id,id DESC").
+				WithArgs(1, 2, 2).
+				WillReturnRows(sqlmock.NewRows(reviewColumns).
+					AddRow(5, 1, "carol", 3, "").
+					AddRow(4, 1, "bob", 4, "").
+					AddRow(3, 2, "alice", 5, ""))
+
+			reviews, err := manager.ReviewsByBooks([]uint{1, 2}, 2)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(reviews[1]).To(gomega.HaveLen(2))
+			gomega.Expect(reviews[1][0].UserID).To(gomega.Equal("carol"))
+			gomega.Expect(reviews[2]).To(gomega.HaveLen(1))
+			gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+		})
+	})
+})
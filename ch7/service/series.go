@@ -0,0 +1,245 @@
+package service
+
+import (
+	"errors"
+
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+//ErrPositionTaken 丛书中该位置已经有其他 Book
+var ErrPositionTaken = errors.New("position is taken by another book")
+
+//Series 与 Work 只通过关联表引用 Book，删除 Book 时同时删除关联，
+//删除 Series 或 Work 时删除关联但保留 Book
+
+//CreateSeries 创建丛书
+func (m *Manager) CreateSeries(series *model.Series) error {
+	if err := series.Validate(); err != nil {
+		return err
+	}
+	return m.db.Create(series).Error
+}
+
+//GetSeries 返回丛书以及按照位置排序的 Book
+func (m *Manager) GetSeries(seriesId uint) (*model.Series, error) {
+	var series model.Series
+	if err := m.db.First(&series, seriesId).Error; err != nil {
+		return nil, err
+	}
+	if err := m.db.Where("series_id = ?", seriesId).Order("position").Find(&series.Entries).Error; err != nil {
+		return nil, err
+	}
+	books, err := findBooks(m.db, seriesBookIds(series.Entries))
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range series.Entries {
+		entry.Book = books[entry.BookID]
+	}
+	return &series, nil
+}
+
+//DeleteSeries 删除丛书以及丛书与 Book 的关联
+func (m *Manager) DeleteSeries(seriesId uint) error {
+	return m.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("series_id = ?", seriesId).Delete(&model.SeriesEntry{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&model.Series{}, seriesId).Error
+	})
+}
+
+//AddToSeries 将 Book 放到丛书的指定位置，Book 已经属于其他丛书时移动到该丛书
+func (m *Manager) AddToSeries(seriesId, bookId uint, position int) (*model.SeriesEntry, error) {
+	entry := &model.SeriesEntry{SeriesID: seriesId, BookID: bookId, Position: position}
+	err := m.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Select("id").First(&model.Series{}, seriesId).Error; err != nil {
+			return err
+		}
+		if err := tx.Select("id").First(&model.Book{}, bookId).Error; err != nil {
+			return err
+		}
+		//(series_id, position) 与 book_id 都是唯一索引，不能使用 ON DUPLICATE KEY UPDATE
+		if err := tx.Where("book_id = ?", bookId).Delete(&model.SeriesEntry{}).Error; err != nil {
+			return err
+		}
+		err := tx.Create(entry).Error
+		if isDuplicateKey(err) {
+			return ErrPositionTaken
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+//RemoveFromSeries 将 Book 移出丛书
+func (m *Manager) RemoveFromSeries(seriesId, bookId uint) error {
+	result := m.db.Where("series_id = ? AND book_id = ?", seriesId, bookId).Delete(&model.SeriesEntry{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+//NextInSeries 返回丛书中排在 Book 之后的下一本，Book 不属于任何丛书或者已经是最后一本时返回 gorm.ErrRecordNotFound
+func (m *Manager) NextInSeries(bookId uint) (*model.SeriesEntry, error) {
+	var current, next model.SeriesEntry
+	if err := m.db.Where("book_id = ?", bookId).First(&current).Error; err != nil {
+		return nil, err
+	}
+	err := m.db.Where("series_id = ? AND position > ?", current.SeriesID, current.Position).
+		Order("position").First(&next).Error
+	if err != nil {
+		return nil, err
+	}
+	book, err := m.GetBook(next.BookID)
+	if err != nil {
+		return nil, err
+	}
+	next.Book = book
+	return &next, nil
+}
+
+//CreateWork 创建作品
+func (m *Manager) CreateWork(work *model.Work) error {
+	if err := work.Validate(); err != nil {
+		return err
+	}
+	return m.db.Create(work).Error
+}
+
+//GetWork 返回作品以及作品的所有版本
+func (m *Manager) GetWork(workId uint) (*model.Work, error) {
+	var work model.Work
+	if err := m.db.First(&work, workId).Error; err != nil {
+		return nil, err
+	}
+	editions, err := m.listWorkEditions(workId)
+	if err != nil {
+		return nil, err
+	}
+	work.Editions = editions
+	return &work, nil
+}
+
+//DeleteWork 删除作品以及作品与 Book 的关联
+func (m *Manager) DeleteWork(workId uint) error {
+	return m.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("work_id = ?", workId).Delete(&model.Edition{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&model.Work{}, workId).Error
+	})
+}
+
+//AddEdition 将 Book 作为作品的一个版本，Book 已经属于其他作品时移动到该作品
+func (m *Manager) AddEdition(workId, bookId uint, label string) (*model.Edition, error) {
+	edition := &model.Edition{WorkID: workId, BookID: bookId, Label: label}
+	err := m.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Select("id").First(&model.Work{}, workId).Error; err != nil {
+			return err
+		}
+		if err := tx.Select("id").First(&model.Book{}, bookId).Error; err != nil {
+			return err
+		}
+		return tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "book_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"work_id", "label"}),
+		}).Create(edition).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return edition, nil
+}
+
+//RemoveEdition 将 Book 从作品中移除
+func (m *Manager) RemoveEdition(workId, bookId uint) error {
+	result := m.db.Where("work_id = ? AND book_id = ?", workId, bookId).Delete(&model.Edition{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+//ListEditions 返回与 Book 属于同一作品的所有版本（包括 Book 自身），
+//Book 不属于任何作品时返回 gorm.ErrRecordNotFound
+func (m *Manager) ListEditions(bookId uint) ([]*model.Edition, error) {
+	var edition model.Edition
+	if err := m.db.Where("book_id = ?", bookId).First(&edition).Error; err != nil {
+		return nil, err
+	}
+	return m.listWorkEditions(edition.WorkID)
+}
+
+func (m *Manager) listWorkEditions(workId uint) ([]*model.Edition, error) {
+	var editions []*model.Edition
+	if err := m.db.Where("work_id = ?", workId).Order("id").Find(&editions).Error; err != nil {
+		return nil, err
+	}
+	bookIds := make([]uint, 0, len(editions))
+	for _, edition := range editions {
+		bookIds = append(bookIds, edition.BookID)
+	}
+	books, err := findBooks(m.db, bookIds)
+	if err != nil {
+		return nil, err
+	}
+	for _, edition := range editions {
+		edition.Book = books[edition.BookID]
+	}
+	return editions, nil
+}
+
+//bookLinks 通过 book_id 引用 Book 的关联表
+var bookLinks = []interface{}{
+	&model.SeriesEntry{},
+	&model.Edition{},
+	&model.BookTag{},
+	&model.BookSubject{},
+}
+
+//unlinkBook 删除 Book 与丛书、作品、标签和主题的关联，在删除 Book 的事务中调用
+func unlinkBook(tx *gorm.DB, bookId uint) error {
+	for _, link := range bookLinks {
+		if err := tx.Where("book_id = ?", bookId).Delete(link).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func seriesBookIds(entries []*model.SeriesEntry) []uint {
+	bookIds := make([]uint, 0, len(entries))
+	for _, entry := range entries {
+		bookIds = append(bookIds, entry.BookID)
+	}
+	return bookIds
+}
+
+//findBooks 按照 ID 批量读取 Book
+func findBooks(db *gorm.DB, bookIds []uint) (map[uint]*model.Book, error) {
+	books := make(map[uint]*model.Book, len(bookIds))
+	if len(bookIds) == 0 {
+		return books, nil
+	}
+	var found []*model.Book
+	if err := db.Where("id IN ?", bookIds).Find(&found).Error; err != nil {
+		return nil, err
+	}
+	for _, book := range found {
+		books[book.ID] = book
+	}
+	return books, nil
+}
@@ -0,0 +1,131 @@
+package service_test
+
+import (
+	"github.com/DATA-DOG/go-sqlmock"
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/service"
+	"gorm.io/gorm"
+)
+
+var _ = ginkgo.Describe("manager to relate books", func() {
+	var manager *service.Manager
+	var mock sqlmock.Sqlmock
+	entryColumns := []string{"id", "series_id", "position", "book_id"}
+
+	ginkgo.BeforeEach(func() {
+		manager, mock = newMockManager()
+	})
+
+	ginkgo.Describe("add book to series", func() {
+		expectLink := func() {
+			mock.ExpectBegin()
+			mock.ExpectQuery("SELECT `id` FROM `series` WHERE `series`.`id` = \\?").
+				WithArgs(1).
+				WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+			mock.ExpectQuery("SELECT `id` FROM `books` WHERE `books`.`id` = \\?").
+				WithArgs(2).
+				WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+			mock.ExpectExec("DELETE FROM `series_entries` WHERE book_id = \\?").
+				WithArgs(2).
+				WillReturnResult(sqlmock.NewResult(0, 0))
+		}
+
+		ginkgo.It("move the book to the position", func() {
+			expectLink()
+			mock.ExpectExec("INSERT INTO `series_entries`").
+				WithArgs(sqlmock.AnyArg(), "", 1, 3, 2).
+				WillReturnResult(sqlmock.NewResult(1, 1))
+			mock.ExpectCommit()
+
+			entry, err := manager.AddToSeries(1, 2, 3)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(entry.Position).To(gomega.Equal(3))
+			gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+		})
+
+		ginkgo.It("return ErrPositionTaken when another book is at the position", func() {
+			expectLink()
+			mock.ExpectExec("INSERT INTO `series_entries`").
+				WillReturnError(&mysqldriver.MySQLError{Number: 1062, Message: "Duplicate entry"})
+			mock.ExpectRollback()
+
+			_, err := manager.AddToSeries(1, 2, 3)
+			gomega.Expect(err).To(gomega.MatchError(service.ErrPositionTaken))
+			gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+		})
+	})
+
+	ginkgo.Describe("next in series", func() {
+		ginkgo.It("return the book at the following position", func() {
+			mock.ExpectQuery("SELECT \\* FROM `series_entries` WHERE book_id = \\?").
+				WithArgs(2).
+				WillReturnRows(sqlmock.NewRows(entryColumns).AddRow(1, 1, 3, 2))
+			mock.ExpectQuery("SELECT \\* FROM `series_entries` WHERE series_id = \\? AND position > \\? ORDER BY position").
+				WithArgs(1, 3).
+				WillReturnRows(sqlmock.NewRows(entryColumns).AddRow(2, 1, 5, 7))
+			mock.ExpectQuery("SELECT \\* FROM `books` WHERE `books`.`id` = \\?").
+				WithArgs(7).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "title"}).AddRow(7, "Book 2"))
+
+			entry, err := manager.NextInSeries(2)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(entry.Position).To(gomega.Equal(5))
+			gomega.Expect(entry.Book.Title).To(gomega.Equal("Book 2"))
+			gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+		})
+
+		ginkgo.It("return not found for the last book", func() {
+			mock.ExpectQuery("SELECT \\* FROM `series_entries` WHERE book_id = \\?").
+				WithArgs(2).
+				WillReturnRows(sqlmock.NewRows(entryColumns).AddRow(1, 1, 3, 2))
+			mock.ExpectQuery("SELECT \\* FROM `series_entries` WHERE series_id = \\? AND position > \\?").
+				WithArgs(1, 3).
+				WillReturnRows(sqlmock.NewRows(entryColumns))
+
+			_, err := manager.NextInSeries(2)
+			gomega.Expect(err).To(gomega.MatchError(gorm.ErrRecordNotFound))
+		})
+	})
+
+	ginkgo.Describe("delete series", func() {
+		ginkgo.It("delete the entries but keep the books", func() {
+			mock.ExpectBegin()
+			mock.ExpectExec("DELETE FROM `series_entries` WHERE series_id = \\?").
+				WithArgs(1).
+				WillReturnResult(sqlmock.NewResult(0, 3))
+			mock.ExpectExec("DELETE FROM `series` WHERE `series`.`id` = \\?").
+				WithArgs(1).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectCommit()
+
+			gomega.Expect(manager.DeleteSeries(1)).To(gomega.Succeed())
+			gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+		})
+	})
+
+	ginkgo.Describe("list editions", func() {
+		ginkgo.It("return all editions of the work of the book", func() {
+			editionColumns := []string{"id", "work_id", "book_id", "label"}
+			mock.ExpectQuery("SELECT \\* FROM `editions` WHERE book_id = \\?").
+				WithArgs(2).
+				WillReturnRows(sqlmock.NewRows(editionColumns).AddRow(2, 9, 2, "paperback"))
+			mock.ExpectQuery("SELECT \\* FROM `editions` WHERE work_id = \\? ORDER BY id").
+				WithArgs(9).
+				WillReturnRows(sqlmock.NewRows(editionColumns).
+					AddRow(1, 9, 1, "hardcover").
+					AddRow(2, 9, 2, "paperback"))
+			mock.ExpectQuery("SELECT \\* FROM `books` WHERE id IN \\(\\?,\\?\\)").
+				WithArgs(1, 2).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "title"}).AddRow(1, "Dune").AddRow(2, "Dune"))
+
+			editions, err := manager.ListEditions(2)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(editions).To(gomega.HaveLen(2))
+			gomega.Expect(editions[0].Label).To(gomega.Equal("hardcover"))
+			gomega.Expect(editions[0].Book.ID).To(gomega.Equal(uint(1)))
+			gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+		})
+	})
+})
@@ -1,10 +1,15 @@
 package service_test
 
 import (
+	"database/sql"
 	"testing"
 
+	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/service"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
 )
 
 func TestService(t *testing.T) {
@@ -15,3 +20,18 @@ func TestService(t *testing.T) {
 var _ = ginkgo.BeforeSuite(func() {
 
 })
+
+//newMockManager 创建使用 sqlmock 的 Manager，在 BeforeEach 中调用
+func newMockManager() (*service.Manager, sqlmock.Sqlmock) {
+	client, mock, err := sqlmock.New()
+	Expect(err).NotTo(HaveOccurred())
+	ginkgo.DeferCleanup(func() {
+		defer func(db *sql.DB) {
+			_ = db.Close()
+		}(client)
+	})
+
+	db, err := gorm.Open(mysql.New(mysql.Config{SkipInitializeWithVersion: true, Conn: client}), &gorm.Config{})
+	Expect(err).NotTo(HaveOccurred())
+	return service.NewManager(db), mock
+}
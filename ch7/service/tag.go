@@ -0,0 +1,209 @@
+package service
+
+import (
+	"errors"
+
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+//ErrSubjectHasChildren 主题下还有子主题，不能删除
+var ErrSubjectHasChildren = errors.New("subject has children")
+
+//MaxTagFacets 列表中返回的标签统计数量
+const MaxTagFacets = 20
+
+//SetBookTags 替换 Book 的所有标签，不存在的标签自动创建
+func (m *Manager) SetBookTags(bookId uint, names []string) ([]string, error) {
+	tags, err := model.NormalizeTags(names)
+	if err != nil {
+		return nil, err
+	}
+	err = m.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Select("id").First(&model.Book{}, bookId).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("book_id = ?", bookId).Delete(&model.BookTag{}).Error; err != nil {
+			return err
+		}
+		if len(tags) == 0 {
+			return nil
+		}
+		records := make([]*model.Tag, 0, len(tags))
+		for _, tag := range tags {
+			records = append(records, &model.Tag{Name: tag})
+		}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&records).Error; err != nil {
+			return err
+		}
+		var tagIds []uint
+		if err := tx.Model(&model.Tag{}).Where("name IN ?", tags).Pluck("id", &tagIds).Error; err != nil {
+			return err
+		}
+		links := make([]*model.BookTag, 0, len(tagIds))
+		for _, tagId := range tagIds {
+			links = append(links, &model.BookTag{BookID: bookId, TagID: tagId})
+		}
+		return tx.Create(&links).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+//ListBookTags 返回 Book 的标签
+func (m *Manager) ListBookTags(bookId uint) ([]string, error) {
+	var tags []string
+	err := m.db.Model(&model.Tag{}).
+		Joins("JOIN book_tags ON book_tags.tag_id = tags.id").
+		Where("book_tags.book_id = ?", bookId).
+		Order("tags.name").Pluck("tags.name", &tags).Error
+	if err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+//TagFacets 返回符合查询条件的 Book 中使用最多的标签以及使用次数，忽略分页与排序
+func (m *Manager) TagFacets(q model.BookQuery) ([]model.TagCount, error) {
+	books, err := filterBooks(m.db, q)
+	if err != nil {
+		return nil, err
+	}
+	var counts []model.TagCount
+	err = m.db.Model(&model.BookTag{}).
+		Select("tags.name AS tag, COUNT(*) AS count").
+		Joins("JOIN tags ON tags.id = book_tags.tag_id").
+		Where("book_tags.book_id IN (?)", books.Select("books.id")).
+		Group("tags.name").Order("count DESC").Order("tags.name").
+		Limit(MaxTagFacets).Scan(&counts).Error
+	if err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
+//CreateSubject 创建主题，ParentID 为空时创建根主题
+func (m *Manager) CreateSubject(subject *model.Subject) error {
+	if err := subject.Validate(); err != nil {
+		return err
+	}
+	return m.db.Transaction(func(tx *gorm.DB) error {
+		parentPath := ""
+		if subject.ParentID != nil {
+			var parent model.Subject
+			if err := tx.First(&parent, *subject.ParentID).Error; err != nil {
+				return err
+			}
+			parentPath = parent.Path
+		}
+		if err := tx.Create(subject).Error; err != nil {
+			return err
+		}
+		//路径包含自身的 ID，只能在插入之后生成
+		subject.Path = model.SubjectPath(parentPath, subject.ID)
+		return tx.Model(subject).Update("path", subject.Path).Error
+	})
+}
+
+//ListSubjects 按照树的先序遍历顺序返回所有主题
+func (m *Manager) ListSubjects() ([]*model.Subject, error) {
+	var subjects []*model.Subject
+	if err := m.db.Order("path").Find(&subjects).Error; err != nil {
+		return nil, err
+	}
+	return subjects, nil
+}
+
+//DeleteSubject 删除没有子主题的主题，以及主题与 Book 的关联
+func (m *Manager) DeleteSubject(subjectId uint) error {
+	return m.db.Transaction(func(tx *gorm.DB) error {
+		var children int64
+		if err := tx.Model(&model.Subject{}).Where("parent_id = ?", subjectId).Count(&children).Error; err != nil {
+			return err
+		}
+		if children > 0 {
+			return ErrSubjectHasChildren
+		}
+		if err := tx.Where("subject_id = ?", subjectId).Delete(&model.BookSubject{}).Error; err != nil {
+			return err
+		}
+		result := tx.Delete(&model.Subject{}, subjectId)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+}
+
+//AssignSubject 将 Book 归入主题，重复归入时不报错
+func (m *Manager) AssignSubject(bookId, subjectId uint) error {
+	return m.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Select("id").First(&model.Book{}, bookId).Error; err != nil {
+			return err
+		}
+		if err := tx.Select("id").First(&model.Subject{}, subjectId).Error; err != nil {
+			return err
+		}
+		return tx.Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&model.BookSubject{BookID: bookId, SubjectID: subjectId}).Error
+	})
+}
+
+//UnassignSubject 将 Book 移出主题
+func (m *Manager) UnassignSubject(bookId, subjectId uint) error {
+	result := m.db.Where("book_id = ? AND subject_id = ?", bookId, subjectId).Delete(&model.BookSubject{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+//ListBookSubjects 返回 Book 所属的主题
+func (m *Manager) ListBookSubjects(bookId uint) ([]*model.Subject, error) {
+	var subjects []*model.Subject
+	err := m.db.Joins("JOIN book_subjects ON book_subjects.subject_id = subjects.id").
+		Where("book_subjects.book_id = ?", bookId).
+		Order("subjects.path").Find(&subjects).Error
+	if err != nil {
+		return nil, err
+	}
+	return subjects, nil
+}
+
+//filterBooks 返回在 db 上按照 AfterID、标签与主题过滤 Book 的查询，主题包括其所有子主题
+func filterBooks(db *gorm.DB, q model.BookQuery) (*gorm.DB, error) {
+	query := db.Model(&model.Book{})
+	if q.AfterID != 0 {
+		query = query.Where("books.id > ?", q.AfterID)
+	}
+	if q.Tag != "" {
+		tag, err := model.NormalizeTag(q.Tag)
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where("books.id IN (?)", db.Model(&model.BookTag{}).
+			Select("book_tags.book_id").
+			Joins("JOIN tags ON tags.id = book_tags.tag_id").
+			Where("tags.name = ?", tag))
+	}
+	if q.SubjectID != 0 {
+		var subject model.Subject
+		if err := db.First(&subject, q.SubjectID).Error; err != nil {
+			return nil, err
+		}
+		query = query.Where("books.id IN (?)", db.Model(&model.BookSubject{}).
+			Select("book_subjects.book_id").
+			Joins("JOIN subjects ON subjects.id = book_subjects.subject_id").
+			Where("subjects.path LIKE ?", subject.Path+"%"))
+	}
+	return query, nil
+}
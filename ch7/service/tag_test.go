@@ -0,0 +1,140 @@
+package service_test
+
+import (
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/model"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/service"
+)
+
+var _ = ginkgo.Describe("manager to classify books", func() {
+	var manager *service.Manager
+	var mock sqlmock.Sqlmock
+	subjectColumns := []string{"id", "parent_id", "name", "path"}
+
+	ginkgo.BeforeEach(func() {
+		manager, mock = newMockManager()
+	})
+
+	ginkgo.Describe("set book tags", func() {
+		ginkgo.It("replace links & create missing tags", func() {
+			mock.ExpectBegin()
+			mock.ExpectQuery("SELECT `id` FROM `books`").
+				WithArgs(1).
+				WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+			mock.ExpectExec("DELETE FROM `book_tags` WHERE book_id = \\?").
+				WithArgs(1).
+				WillReturnResult(sqlmock.NewResult(0, 3))
+			mock.ExpectExec("INSERT INTO `tags` .* ON DUPLICATE KEY UPDATE").
+				WithArgs(sqlmock.AnyArg(), "", "epic", sqlmock.AnyArg(), "", "fantasy").
+				WillReturnResult(sqlmock.NewResult(1, 1))
+			mock.ExpectQuery("SELECT `id` FROM `tags` WHERE name IN \\(\\?,\\?\\)").
+				WithArgs("epic", "fantasy").
+				WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(5))
+			mock.ExpectExec("INSERT INTO `book_tags`").
+				WithArgs("", 1, 1, "", 1, 5).
+				WillReturnResult(sqlmock.NewResult(1, 2))
+			mock.ExpectCommit()
+
+			tags, err := manager.SetBookTags(1, []string{"Epic", "Fantasy", "epic"})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(tags).To(gomega.Equal([]string{"epic", "fantasy"}))
+			gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+		})
+
+		ginkgo.It("reject invalid tags", func() {
+			_, err := manager.SetBookTags(1, []string{" "})
+			gomega.Expect(err).To(gomega.MatchError(model.ErrInvalidTag))
+		})
+	})
+
+	ginkgo.Describe("create subject", func() {
+		ginkgo.It("build the path from the parent", func() {
+			parentId := uint(4)
+			mock.ExpectBegin()
+			mock.ExpectQuery("SELECT \\* FROM `subjects` WHERE `subjects`.`id` = \\?").
+				WithArgs(4).
+				WillReturnRows(sqlmock.NewRows(subjectColumns).AddRow(4, 1, "Fantasy", "/1/4/"))
+			mock.ExpectExec("INSERT INTO `subjects`").
+				WillReturnResult(sqlmock.NewResult(9, 1))
+			mock.ExpectExec("UPDATE `subjects` SET `path`=\\?,`updated_at`=\\? WHERE `id` = \\?").
+				WithArgs("/1/4/9/", sqlmock.AnyArg(), 9).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectCommit()
+
+			subject := &model.Subject{ParentID: &parentId, Name: "Epic"}
+			gomega.Expect(manager.CreateSubject(subject)).To(gomega.Succeed())
+			gomega.Expect(subject.Path).To(gomega.Equal("/1/4/9/"))
+			gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+		})
+	})
+
+	ginkgo.Describe("delete subject", func() {
+		ginkgo.It("refuse when the subject has children", func() {
+			mock.ExpectBegin()
+			mock.ExpectQuery("SELECT count\\(\\*\\) FROM `subjects` WHERE parent_id = \\?").
+				WithArgs(4).
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+			mock.ExpectRollback()
+
+			gomega.Expect(manager.DeleteSubject(4)).To(gomega.MatchError(service.ErrSubjectHasChildren))
+			gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+		})
+	})
+
+	ginkgo.Describe("filter books", func() {
+		ginkgo.It("list books with the tag in the subject subtree", func() {
+			mock.ExpectQuery("SELECT \\* FROM `subjects` WHERE `subjects`.`id` = \\?").
+				WithArgs(1).
+				WillReturnRows(sqlmock.NewRows(subjectColumns).AddRow(1, nil, "Fiction", "/1/"))
+			mock.ExpectQuery("SELECT \\* FROM `books` WHERE books.id IN " +
+				"\\(SELECT book_tags.book_id FROM `book_tags` JOIN tags ON tags.id = book_tags.tag_id WHERE tags.name = \\?\\) " +
+				"AND books.id IN " +
+				"\\(SELECT book_subjects.book_id FROM `book_subjects` JOIN subjects ON subjects.id = book_subjects.subject_id WHERE subjects.path LIKE \\?\\) " +
+				"AND `books`.`deleted_at` IS NULL ORDER BY books.id LIMIT 20").
+				WithArgs("epic fantasy", "/1/%").
+				WillReturnRows(sqlmock.NewRows([]string{"id", "title"}).AddRow(3, "The Way of Kings"))
+
+			books, err := manager.ListBooks(model.BookQuery{
+				PageOptions: model.PageOptions{PageSize: 20},
+				Tag:         "Epic Fantasy",
+				SubjectID:   1,
+			})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(books).To(gomega.HaveLen(1))
+			gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+		})
+
+		ginkgo.It("count tags of the matching books", func() {
+			mock.ExpectQuery("SELECT tags.name AS tag, COUNT\\(\\*\\) AS count FROM `book_tags` " +
+				"JOIN tags ON tags.id = book_tags.tag_id WHERE book_tags.book_id IN " +
+				"\\(SELECT books.id FROM `books` WHERE books.id IN \\(SELECT book_tags.book_id FROM `book_tags` .*\\) " +
+				"AND `books`.`deleted_at` IS NULL\\) GROUP BY `tags`.`name` ORDER BY count DESC,tags.name LIMIT 20").
+				WithArgs("fantasy").
+				WillReturnRows(sqlmock.NewRows([]string{"tag", "count"}).AddRow("fantasy", 3).AddRow("epic", 2))
+
+			counts, err := manager.TagFacets(model.BookQuery{Tag: "fantasy"})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(counts).To(gomega.Equal([]model.TagCount{{Tag: "fantasy", Count: 3}, {Tag: "epic", Count: 2}}))
+			gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+		})
+
+		ginkgo.It("iterate books in batches by id", func() {
+			mock.ExpectQuery("SELECT \\* FROM `books` WHERE `books`.`deleted_at` IS NULL ORDER BY books.id LIMIT 2$").
+				WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(4))
+			mock.ExpectQuery("SELECT \\* FROM `books` WHERE books.id > \\? AND `books`.`deleted_at` IS NULL ORDER BY books.id LIMIT 2$").
+				WithArgs(4).
+				WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+
+			var ids []uint
+			err := manager.EachBook(model.BookQuery{PageOptions: model.PageOptions{PageNumber: 3}}, 2, func(book *model.Book) error {
+				ids = append(ids, book.ID)
+				return nil
+			})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(ids).To(gomega.Equal([]uint{1, 4, 7}))
+			gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+		})
+	})
+})
@@ -0,0 +1,181 @@
+package service
+
+import (
+	"errors"
+	"reflect"
+	"sync/atomic"
+
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	tenantKey     = "tenant:id"  //tenantKey 当前租户
+	allTenantsKey = "tenant:all" //allTenantsKey 跨租户访问，只用于后台任务
+	tenantField   = "TenantID"   //tenantField 包含该字段的表按照租户隔离
+)
+
+var (
+	//ErrTenantRequired 开启 SetTenantRequired 后，没有指定租户访问租户数据
+	ErrTenantRequired = errors.New("tenant is required")
+	//ErrUnknownTenant 租户不存在
+	ErrUnknownTenant = errors.New("unknown tenant")
+	//ErrQuotaExceeded 超出租户配额
+	ErrQuotaExceeded = errors.New("tenant quota exceeded")
+)
+
+//tenantRequired 是否要求访问租户数据时必须指定租户
+var tenantRequired int32
+
+//SetTenantRequired 多租户部署时开启，此后没有通过 ForTenant 或 AllTenants 指定范围的
+//Manager 访问租户数据都会返回 ErrTenantRequired，避免遗漏租户条件导致数据泄漏
+func SetTenantRequired(required bool) {
+	var v int32
+	if required {
+		v = 1
+	}
+	atomic.StoreInt32(&tenantRequired, v)
+}
+
+//ForTenant 返回只能访问租户 tenantId 数据的 Manager。
+//查询、更新、删除自动增加 tenant_id 条件，创建时自动设置 TenantID
+func (m *Manager) ForTenant(tenantId string) *Manager {
+	return &Manager{db: m.db.Set(tenantKey, tenantId).Session(&gorm.Session{})}
+}
+
+//AllTenants 返回可以访问所有租户数据的 Manager，用于事件投递等后台任务
+func (m *Manager) AllTenants() *Manager {
+	return &Manager{db: m.db.Set(allTenantsKey, true).Session(&gorm.Session{})}
+}
+
+//TenantID 返回 Manager 所属的租户
+func (m *Manager) TenantID() (string, bool) {
+	return tenantOf(m.db)
+}
+
+func tenantOf(db *gorm.DB) (string, bool) {
+	if v, ok := db.Get(tenantKey); ok {
+		return v.(string), true
+	}
+	return "", false
+}
+
+//registerTenantCallbacks 注册租户隔离的回调，同一个 gorm.DB 只注册一次
+func registerTenantCallbacks(db *gorm.DB) {
+	if db.Callback().Query().Get("tenant:query") != nil {
+		return
+	}
+	_ = db.Callback().Create().Before("gorm:create").Register("tenant:create", assignTenant)
+	_ = db.Callback().Query().Before("gorm:query").Register("tenant:query", scopeTenant)
+	_ = db.Callback().Row().Before("gorm:row").Register("tenant:row", scopeTenant)
+	_ = db.Callback().Update().Before("gorm:update").Register("tenant:update", scopeTenant)
+	_ = db.Callback().Delete().Before("gorm:delete").Register("tenant:delete", scopeTenant)
+}
+
+//tenantScope 返回当前语句的租户，ok 为 false 时不需要处理
+func tenantScope(db *gorm.DB) (tenantId string, ok bool) {
+	if db.Statement.Schema == nil || db.Statement.Schema.LookUpField(tenantField) == nil {
+		return "", false
+	}
+	if _, all := db.Get(allTenantsKey); all {
+		return "", false
+	}
+	tenantId, ok = tenantOf(db)
+	if !ok && atomic.LoadInt32(&tenantRequired) == 1 {
+		_ = db.AddError(ErrTenantRequired)
+	}
+	return tenantId, ok
+}
+
+func scopeTenant(db *gorm.DB) {
+	tenantId, ok := tenantScope(db)
+	if !ok {
+		return
+	}
+	db.Statement.AddClause(clause.Where{Exprs: []clause.Expression{
+		clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: "tenant_id"}, Value: tenantId},
+	}})
+}
+
+func assignTenant(db *gorm.DB) {
+	tenantId, ok := tenantScope(db)
+	if !ok {
+		return
+	}
+	field := db.Statement.Schema.LookUpField(tenantField)
+	rv := db.Statement.ReflectValue
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			if err := field.Set(db.Statement.Context, reflect.Indirect(rv.Index(i)), tenantId); err != nil {
+				_ = db.AddError(err)
+			}
+		}
+	case reflect.Struct:
+		if err := field.Set(db.Statement.Context, rv, tenantId); err != nil {
+			_ = db.AddError(err)
+		}
+	}
+}
+
+//checkQuota 检查租户是否还可以创建 Book
+func checkQuota(tx *gorm.DB) error {
+	return checkQuotaFor(tx, 1)
+}
+
+//checkQuotaFor 检查租户是否还可以创建 adding 个 Book。租户行加锁到事务结束，
+//同一个租户并发创建时依次计数，不会一起超过配额
+func checkQuotaFor(tx *gorm.DB, adding int) error {
+	tenantId, ok := tenantOf(tx)
+	if !ok {
+		return nil
+	}
+	var tenant model.Tenant
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", tenantId).First(&tenant).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrUnknownTenant
+		}
+		return err
+	}
+	if tenant.MaxBooks <= 0 {
+		return nil
+	}
+	var count int64
+	if err := tx.Model(&model.Book{}).Count(&count).Error; err != nil {
+		return err
+	}
+	if count+int64(adding) > tenant.MaxBooks {
+		return ErrQuotaExceeded
+	}
+	return nil
+}
+
+func (m *Manager) CreateTenant(tenant *model.Tenant) error {
+	return m.db.Create(tenant).Error
+}
+
+//GetTenant 查询租户，不存在时返回 ErrUnknownTenant
+func (m *Manager) GetTenant(tenantId string) (*model.Tenant, error) {
+	var tenant model.Tenant
+	if err := m.db.Where("id = ?", tenantId).First(&tenant).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUnknownTenant
+		}
+		return nil, err
+	}
+	return &tenant, nil
+}
+
+func (m *Manager) ListTenants() ([]*model.Tenant, error) {
+	var tenants []*model.Tenant
+	if err := m.db.Order("id").Find(&tenants).Error; err != nil {
+		return nil, err
+	}
+	return tenants, nil
+}
+
+//UpdateTenantQuota 修改租户配额
+func (m *Manager) UpdateTenantQuota(tenantId string, maxBooks int64) error {
+	return m.db.Model(&model.Tenant{}).Where("id = ?", tenantId).Update("max_books", maxBooks).Error
+}
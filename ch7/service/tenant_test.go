@@ -0,0 +1,197 @@
+package service_test
+
+import (
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/model"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/service"
+)
+
+var _ = ginkgo.Describe("manager to isolate tenants", func() {
+	var manager *service.Manager
+	var mock sqlmock.Sqlmock
+
+	ginkgo.BeforeEach(func() {
+		manager, mock = newMockManager()
+	})
+
+	ginkgo.Describe("query books of a tenant", func() {
+		ginkgo.It("add tenant condition automatically", func() {
+			mock.ExpectQuery("SELECT \\* FROM `books` WHERE `books`.`id` = \\? AND `books`.`tenant_id` = \\? AND `books`.`deleted_at` IS NULL").
+				WithArgs(1, "acme").
+				WillReturnRows(sqlmock.NewRows([]string{"id", "title", "tenant_id"}).AddRow(1, "test", "acme"))
+			book, err := manager.ForTenant("acme").GetBook(1)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(book.TenantID).To(gomega.Equal("acme"))
+			gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+		})
+		ginkgo.It("not leak tenant condition to other managers", func() {
+			scoped := manager.ForTenant("acme")
+			mock.ExpectQuery("`books`.`tenant_id` = \\?").
+				WithArgs(1, "acme").
+				WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+			mock.ExpectQuery("SELECT \\* FROM `books` WHERE `books`.`id` = \\? AND `books`.`deleted_at` IS NULL ORDER BY").
+				WithArgs(2).
+				WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+			_, err := scoped.GetBook(1)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			_, err = manager.GetBook(2)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+		})
+	})
+
+	ginkgo.Describe("delete books of a tenant", func() {
+		ginkgo.It("add tenant condition to update & delete", func() {
+			mock.ExpectBegin()
+			mock.ExpectQuery("SELECT \\* FROM `books` WHERE `books`.`id` = \\? AND `books`.`tenant_id` = \\? AND `books`.`deleted_at` IS NULL").
+				WithArgs(1, "acme").
+				WillReturnRows(sqlmock.NewRows([]string{"id", "tenant_id"}).AddRow(1, "acme"))
+			mock.ExpectExec("UPDATE `books` SET `deleted_at`=\\? WHERE `books`.`tenant_id` = \\? AND `books`.`id` = \\? AND `books`.`deleted_at` IS NULL").
+				WithArgs(sqlmock.AnyArg(), "acme", 1).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec("DELETE FROM `series_entries` WHERE book_id = \\? AND `series_entries`.`tenant_id` = \\?").
+				WithArgs(1, "acme").
+				WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec("DELETE FROM `editions` WHERE book_id = \\? AND `editions`.`tenant_id` = \\?").
+				WithArgs(1, "acme").
+				WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec("DELETE FROM `book_tags` WHERE book_id = \\? AND `book_tags`.`tenant_id` = \\?").
+				WithArgs(1, "acme").
+				WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec("DELETE FROM `book_subjects` WHERE book_id = \\? AND `book_subjects`.`tenant_id` = \\?").
+				WithArgs(1, "acme").
+				WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec("^INSERT INTO `outbox_events`").
+				WithArgs(sqlmock.AnyArg(), "acme", model.EventBookDeleted, 1, sqlmock.AnyArg(), nil, 0, "").
+				WillReturnResult(sqlmock.NewResult(1, 1))
+			mock.ExpectCommit()
+			gomega.Expect(manager.ForTenant("acme").DeleteBook(1)).To(gomega.Succeed())
+			gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+		})
+	})
+
+	ginkgo.Describe("save books of a tenant", func() {
+		var b *model.Book
+		ginkgo.BeforeEach(func() {
+			b = &model.Book{Title: "test", Author: "test author", Pages: 10, Weight: 20}
+		})
+
+		ginkgo.Context("tenant has quota", func() {
+			ginkgo.It("save book & event with tenant id", func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery("SELECT \\* FROM `tenants` WHERE id = \\? .* FOR UPDATE$").
+					WithArgs("acme").
+					WillReturnRows(sqlmock.NewRows([]string{"id", "max_books"}).AddRow("acme", 2))
+				mock.ExpectQuery("SELECT count\\(\\*\\) FROM `books` WHERE `books`.`tenant_id` = \\? AND `books`.`deleted_at` IS NULL").
+					WithArgs("acme").
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+				mock.ExpectExec("^INSERT INTO `books`").
+					WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), b.Title, b.Author, b.Pages, b.Weight, nil, nil, "acme").
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec("^INSERT INTO `outbox_events`").
+					WithArgs(sqlmock.AnyArg(), "acme", model.EventBookCreated, 1, sqlmock.AnyArg(), nil, 0, "").
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
+				gomega.Expect(manager.ForTenant("acme").AddBook(b)).To(gomega.Succeed())
+				gomega.Expect(b.TenantID).To(gomega.Equal("acme"))
+				gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+			})
+		})
+
+		ginkgo.Context("tenant reached quota", func() {
+			ginkgo.It("return ErrQuotaExceeded", func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery("SELECT \\* FROM `tenants` WHERE id = \\?").
+					WithArgs("acme").
+					WillReturnRows(sqlmock.NewRows([]string{"id", "max_books"}).AddRow("acme", 2))
+				mock.ExpectQuery("SELECT count\\(\\*\\) FROM `books`").
+					WithArgs("acme").
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+				mock.ExpectRollback()
+				gomega.Expect(manager.ForTenant("acme").AddBook(b)).To(gomega.MatchError(service.ErrQuotaExceeded))
+				gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+			})
+		})
+
+		ginkgo.Context("add books in batch", func() {
+			ginkgo.It("save books & events in one transaction", func() {
+				books := []*model.Book{b, {Title: "second", Author: "test author", Pages: 400, Weight: 500, ISBN10: "0441172695"}}
+				mock.ExpectBegin()
+				mock.ExpectQuery("SELECT \\* FROM `tenants` WHERE id = \\?").
+					WithArgs("acme").
+					WillReturnRows(sqlmock.NewRows([]string{"id", "max_books"}).AddRow("acme", 3))
+				mock.ExpectQuery("SELECT count\\(\\*\\) FROM `books`").
+					WithArgs("acme").
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+				mock.ExpectExec("^INSERT INTO `books` .* VALUES \\(.*\\),\\(.*\\)").
+					WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), b.Title, b.Author, b.Pages, b.Weight, nil, nil, "acme",
+						sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), "second", "test author", 400, 500, "0441172695", "9780441172696", "acme").
+					WillReturnResult(sqlmock.NewResult(1, 2))
+				mock.ExpectExec("^INSERT INTO `outbox_events` .* VALUES \\(.*\\),\\(.*\\)").
+					WithArgs(sqlmock.AnyArg(), "acme", model.EventBookCreated, 1, sqlmock.AnyArg(), nil, 0, "",
+						sqlmock.AnyArg(), "acme", model.EventBookCreated, 2, sqlmock.AnyArg(), nil, 0, "").
+					WillReturnResult(sqlmock.NewResult(1, 2))
+				mock.ExpectCommit()
+				gomega.Expect(manager.ForTenant("acme").AddBooks(books)).To(gomega.Succeed())
+				gomega.Expect(books[1].ISBN13).To(gomega.Equal(model.ISBN("9780441172696")))
+				gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+			})
+
+			ginkgo.It("reject the batch exceeding quota", func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery("SELECT \\* FROM `tenants` WHERE id = \\?").
+					WithArgs("acme").
+					WillReturnRows(sqlmock.NewRows([]string{"id", "max_books"}).AddRow("acme", 2))
+				mock.ExpectQuery("SELECT count\\(\\*\\) FROM `books`").
+					WithArgs("acme").
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+				mock.ExpectRollback()
+				books := []*model.Book{b, {Title: "second", Author: "test author", Pages: 400}}
+				gomega.Expect(manager.ForTenant("acme").AddBooks(books)).To(gomega.MatchError(service.ErrQuotaExceeded))
+				gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+			})
+		})
+
+		ginkgo.Context("tenant does not exist", func() {
+			ginkgo.It("return ErrUnknownTenant", func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery("SELECT \\* FROM `tenants` WHERE id = \\?").
+					WithArgs("nobody").
+					WillReturnRows(sqlmock.NewRows([]string{"id"}))
+				mock.ExpectRollback()
+				gomega.Expect(manager.ForTenant("nobody").AddBook(b)).To(gomega.MatchError(service.ErrUnknownTenant))
+				gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+			})
+		})
+	})
+
+	ginkgo.Describe("tenant is required", func() {
+		ginkgo.BeforeEach(func() {
+			service.SetTenantRequired(true)
+			ginkgo.DeferCleanup(func() {
+				service.SetTenantRequired(false)
+			})
+		})
+		ginkgo.It("reject queries without tenant", func() {
+			_, err := manager.GetBook(1)
+			gomega.Expect(err).To(gomega.MatchError(service.ErrTenantRequired))
+			gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+		})
+		ginkgo.It("allow background jobs to access all tenants", func() {
+			mock.ExpectQuery("SELECT \\* FROM `outbox_events` WHERE published_at IS NULL ORDER BY id LIMIT 10").
+				WillReturnRows(sqlmock.NewRows([]string{"id"}))
+			_, err := manager.AllTenants().PendingEvents(10)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+		})
+		ginkgo.It("allow tables not owned by tenants", func() {
+			mock.ExpectQuery("SELECT \\* FROM `tenants` WHERE id = \\?").
+				WithArgs("acme").
+				WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("acme"))
+			_, err := manager.GetTenant("acme")
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		})
+	})
+})
@@ -0,0 +1,65 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/trace"
+	"gorm.io/gorm"
+)
+
+//spanKey 当前语句的 Span
+const spanKey = "trace:span"
+
+//WithContext 返回使用 ctx 执行 SQL 的 Manager，ctx 中有 Span 时每条 SQL 都会创建子 Span
+func (m *Manager) WithContext(ctx context.Context) *Manager {
+	return &Manager{db: m.db.WithContext(ctx)}
+}
+
+//registerTraceCallbacks 注册为每条 SQL 创建 Span 的回调，同一个 gorm.DB 只注册一次
+func registerTraceCallbacks(db *gorm.DB) {
+	if db.Callback().Query().Get("trace:before_query") != nil {
+		return
+	}
+	callback := db.Callback()
+	_ = callback.Create().Before("*").Register("trace:before_create", startSpan("db.create"))
+	_ = callback.Create().After("*").Register("trace:after_create", finishSpan)
+	_ = callback.Query().Before("*").Register("trace:before_query", startSpan("db.query"))
+	_ = callback.Query().After("*").Register("trace:after_query", finishSpan)
+	_ = callback.Update().Before("*").Register("trace:before_update", startSpan("db.update"))
+	_ = callback.Update().After("*").Register("trace:after_update", finishSpan)
+	_ = callback.Delete().Before("*").Register("trace:before_delete", startSpan("db.delete"))
+	_ = callback.Delete().After("*").Register("trace:after_delete", finishSpan)
+	_ = callback.Row().Before("*").Register("trace:before_row", startSpan("db.row"))
+	_ = callback.Row().After("*").Register("trace:after_row", finishSpan)
+	_ = callback.Raw().Before("*").Register("trace:before_raw", startSpan("db.raw"))
+	_ = callback.Raw().After("*").Register("trace:after_raw", finishSpan)
+}
+
+//startSpan 只在调用方已经有 Span 时创建，后台任务等没有调用链的 SQL 不记录
+func startSpan(name string) func(db *gorm.DB) {
+	return func(db *gorm.DB) {
+		ctx := db.Statement.Context
+		if ctx == nil || trace.FromContext(ctx) == nil {
+			return
+		}
+		_, span := trace.Start(ctx, name)
+		db.InstanceSet(spanKey, span)
+	}
+}
+
+func finishSpan(db *gorm.DB) {
+	v, ok := db.InstanceGet(spanKey)
+	if !ok {
+		return
+	}
+	span := v.(*trace.Span)
+	span.SetAttribute("db.table", db.Statement.Table)
+	span.SetAttribute("db.statement", db.Statement.SQL.String())
+	span.SetAttribute("db.rows_affected", strconv.FormatInt(db.Statement.RowsAffected, 10))
+	if !errors.Is(db.Error, gorm.ErrRecordNotFound) {
+		span.SetError(db.Error)
+	}
+	span.Finish()
+}
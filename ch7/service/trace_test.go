@@ -0,0 +1,72 @@
+package service_test
+
+import (
+	"context"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/service"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/trace"
+)
+
+var _ = ginkgo.Describe("manager to trace sql", func() {
+	var manager *service.Manager
+	var mock sqlmock.Sqlmock
+	var exporter *trace.MemoryExporter
+
+	ginkgo.BeforeEach(func() {
+		manager, mock = newMockManager()
+		exporter = trace.NewMemoryExporter()
+		trace.SetExporter(exporter)
+		ginkgo.DeferCleanup(func() {
+			trace.SetExporter(nil)
+		})
+	})
+
+	ginkgo.It("create a child span for each sql of a traced context", func() {
+		mock.ExpectQuery("SELECT \\* FROM `books`").
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "title"}).AddRow(1, "Go"))
+
+		ctx, root := trace.Start(context.Background(), "GET /books/:book_id")
+		_, err := manager.WithContext(ctx).GetBook(1)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		root.Finish()
+
+		spans := exporter.Spans()
+		gomega.Expect(spans).To(gomega.HaveLen(2))
+		gomega.Expect(spans[0].Name).To(gomega.Equal("db.query"))
+		gomega.Expect(spans[0].ParentID).To(gomega.Equal(root.SpanID))
+		gomega.Expect(spans[0].Attributes).To(gomega.HaveKeyWithValue("db.table", "books"))
+		gomega.Expect(spans[0].Attributes).To(gomega.HaveKeyWithValue("db.rows_affected", "1"))
+		gomega.Expect(spans[0].Attributes["db.statement"]).To(gomega.HavePrefix("SELECT * FROM `books` WHERE `books`.`id` = ?"))
+		gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+	})
+
+	ginkgo.It("record the error of failed sql but not missing records", func() {
+		mock.ExpectQuery("SELECT \\* FROM `books`").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+		mock.ExpectQuery("SELECT \\* FROM `books`").WillReturnError(sqlmock.ErrCancelled)
+
+		ctx, root := trace.Start(context.Background(), "root")
+		_, err := manager.WithContext(ctx).GetBook(1)
+		gomega.Expect(err).To(gomega.HaveOccurred())
+		_, err = manager.WithContext(ctx).GetBook(2)
+		gomega.Expect(err).To(gomega.HaveOccurred())
+		root.Finish()
+
+		spans := exporter.Spans()
+		gomega.Expect(spans).To(gomega.HaveLen(3))
+		gomega.Expect(spans[0].Error).To(gomega.BeEmpty())
+		gomega.Expect(spans[1].Error).To(gomega.Equal(sqlmock.ErrCancelled.Error()))
+	})
+
+	ginkgo.It("not trace sql without a span", func() {
+		mock.ExpectQuery("SELECT \\* FROM `books`").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "title"}).AddRow(1, "Go"))
+
+		_, err := manager.GetBook(1)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(exporter.Spans()).To(gomega.BeEmpty())
+	})
+})
@@ -0,0 +1,50 @@
+package service
+
+import (
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/model"
+	"gorm.io/gorm/clause"
+)
+
+//SaveTranslation 新增或替换 Book 某种语言的翻译
+func (m *Manager) SaveTranslation(translation *model.BookTranslation) error {
+	tag, err := model.CanonicalLanguage(translation.Language)
+	if err != nil {
+		return err
+	}
+	translation.Language = tag
+	return m.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "book_id"}, {Name: "language"}},
+		DoUpdates: clause.AssignmentColumns([]string{"updated_at", "title", "description"}),
+	}).Create(translation).Error
+}
+
+//ListTranslations 返回 Book 的所有翻译
+func (m *Manager) ListTranslations(bookId uint) ([]*model.BookTranslation, error) {
+	var translations []*model.BookTranslation
+	if err := m.db.Where("book_id = ?", bookId).Order("language").Find(&translations).Error; err != nil {
+		return nil, err
+	}
+	return translations, nil
+}
+
+func (m *Manager) DeleteTranslation(bookId uint, tag string) error {
+	tag, err := model.CanonicalLanguage(tag)
+	if err != nil {
+		return err
+	}
+	return m.db.Where("book_id = ? AND language = ?", bookId, tag).Delete(&model.BookTranslation{}).Error
+}
+
+//GetLocalizedBook 查询 Book 的 columns 列，并按照 Accept-Language 使用最合适的翻译，columns 为空时读取所有列
+func (m *Manager) GetLocalizedBook(bookId uint, acceptLanguage string, columns []string) (*model.Book, error) {
+	book, err := m.GetBookColumns(bookId, columns)
+	if err != nil || acceptLanguage == "" {
+		return book, err
+	}
+	translations, err := m.ListTranslations(bookId)
+	if err != nil {
+		return nil, err
+	}
+	book.Localize(model.NegotiateTranslation(translations, acceptLanguage))
+	return book, nil
+}
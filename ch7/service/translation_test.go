@@ -0,0 +1,48 @@
+package service_test
+
+import (
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/model"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/service"
+)
+
+var _ = ginkgo.Describe("manager to localize books", func() {
+	var manager *service.Manager
+	var mock sqlmock.Sqlmock
+
+	ginkgo.BeforeEach(func() {
+		manager, mock = newMockManager()
+	})
+
+	ginkgo.Describe("save translation", func() {
+		ginkgo.It("upsert by book & canonical language", func() {
+			mock.ExpectBegin()
+			mock.ExpectExec("INSERT INTO `book_translations` (.+) ON DUPLICATE KEY UPDATE `updated_at`=VALUES\\(`updated_at`\\),`title`=VALUES\\(`title`\\),`description`=VALUES\\(`description`\\)").
+				WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), "", 1, "zh-Hant", "悲慘世界", "").
+				WillReturnResult(sqlmock.NewResult(1, 1))
+			mock.ExpectCommit()
+			translation := &model.BookTranslation{BookID: 1, Language: "zh-hant", Title: "悲慘世界"}
+			gomega.Expect(manager.SaveTranslation(translation)).To(gomega.Succeed())
+			gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+		})
+	})
+
+	ginkgo.Describe("get localized book", func() {
+		ginkgo.It("use the negotiated translation", func() {
+			mock.ExpectQuery("SELECT \\* FROM `books`").
+				WithArgs(1).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "title", "author"}).AddRow(1, "Les Miserables", "Victor Hugo"))
+			mock.ExpectQuery("SELECT \\* FROM `book_translations` WHERE book_id = \\? ORDER BY language").
+				WithArgs(1).
+				WillReturnRows(sqlmock.NewRows([]string{"book_id", "language", "title"}).
+					AddRow(1, "fr", "Les Misérables").
+					AddRow(1, "zh-Hant", "悲慘世界"))
+			book, err := manager.GetLocalizedBook(1, "zh-TW,zh;q=0.9", nil)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(book.Title).To(gomega.Equal("悲慘世界"))
+			gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+		})
+	})
+})
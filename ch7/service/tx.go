@@ -0,0 +1,111 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync/atomic"
+	"time"
+
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"gorm.io/gorm"
+)
+
+//TxRetryPolicy InTx 遇到死锁等可重试错误时的重试规则
+type TxRetryPolicy struct {
+	//MaxRetries 最多重试的次数，0 表示不重试
+	MaxRetries int
+	//Backoff 第一次重试前等待的时间，之后每次加倍并增加随机抖动
+	Backoff time.Duration
+}
+
+//DefaultTxRetryPolicy 默认的重试规则
+var DefaultTxRetryPolicy = TxRetryPolicy{MaxRetries: 3, Backoff: 10 * time.Millisecond}
+
+//txRetryPolicyKey Manager 使用的重试规则
+const txRetryPolicyKey = "tx:retry_policy"
+
+//WithTxRetryPolicy 返回 InTx 使用 policy 重试的 Manager，没有设置时使用 DefaultTxRetryPolicy
+func (m *Manager) WithTxRetryPolicy(policy TxRetryPolicy) *Manager {
+	return &Manager{db: m.db.Set(txRetryPolicyKey, policy).Session(&gorm.Session{})}
+}
+
+func (m *Manager) txRetryPolicy() TxRetryPolicy {
+	if policy, ok := m.db.Get(txRetryPolicyKey); ok {
+		return policy.(TxRetryPolicy)
+	}
+	return DefaultTxRetryPolicy
+}
+
+//savepointSeq 生成嵌套事务的保存点名称
+var savepointSeq uint64
+
+//InTx 在一个事务中执行 fn，fn 通过 tx 调用的所有方法都属于这个事务，fn 返回错误时全部回滚。
+//tx 的方法内部的事务以及在 tx 上再次调用 InTx 都使用保存点，失败时只回滚到保存点。
+//最外层的事务遇到死锁或锁等待超时时按照 WithTxRetryPolicy 设置的规则重新执行 fn，fn 可能执行多次，
+//不能有事务之外的副作用
+func (m *Manager) InTx(ctx context.Context, fn func(tx *Manager) error) error {
+	if m.inTx() {
+		return m.WithContext(ctx).savepoint(fn)
+	}
+	policy := m.txRetryPolicy()
+	for attempt := 0; ; attempt++ {
+		err := m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			return fn(&Manager{db: tx})
+		})
+		if err == nil || !isRetryable(err) || attempt >= policy.MaxRetries {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(retryDelay(policy.Backoff, attempt)):
+		}
+	}
+}
+
+//inTx 返回 Manager 是否属于一个事务
+func (m *Manager) inTx() bool {
+	committer, ok := m.db.Statement.ConnPool.(gorm.TxCommitter)
+	return ok && committer != nil
+}
+
+//savepoint 在当前事务中创建保存点后执行 fn，fn 返回错误时回滚到保存点，外层事务可以继续
+func (m *Manager) savepoint(fn func(tx *Manager) error) error {
+	name := fmt.Sprintf("intx_%d", atomic.AddUint64(&savepointSeq, 1))
+	if err := m.db.SavePoint(name).Error; err != nil {
+		return err
+	}
+	if err := fn(m); err != nil {
+		if rollbackErr := m.db.RollbackTo(name).Error; rollbackErr != nil {
+			return fmt.Errorf("%w (rollback to savepoint failed: %s)", err, rollbackErr)
+		}
+		return err
+	}
+	return nil
+}
+
+//isRetryable 死锁与锁等待超时时整个事务已经或应该回滚，重新执行通常可以成功。
+//MySQL 在可串行化隔离级别下的冲突也以死锁返回
+func isRetryable(err error) bool {
+	var mysqlErr *mysqldriver.MySQLError
+	if !errors.As(err, &mysqlErr) {
+		return false
+	}
+	switch mysqlErr.Number {
+	case 1213, 1205: //ER_LOCK_DEADLOCK, ER_LOCK_WAIT_TIMEOUT
+		return true
+	default:
+		return false
+	}
+}
+
+//retryDelay 第 attempt 次重试前等待的时间，在 [d/2, d) 之间随机，避免冲突的事务同时重试
+func retryDelay(backoff time.Duration, attempt int) time.Duration {
+	d := backoff << attempt
+	if d <= 1 {
+		return d
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)))
+}
@@ -0,0 +1,190 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/model"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/service"
+)
+
+var _ = ginkgo.Describe("manager to run transactions", func() {
+	var manager *service.Manager
+	var mock sqlmock.Sqlmock
+	deadlock := &mysqldriver.MySQLError{Number: 1213, Message: "Deadlock found when trying to get lock"}
+
+	ginkgo.BeforeEach(func() {
+		manager, mock = newMockManager()
+		manager = manager.WithTxRetryPolicy(service.TxRetryPolicy{MaxRetries: 2, Backoff: time.Millisecond})
+	})
+
+	expectAddBook := func(id int64) {
+		mock.ExpectExec("^SAVEPOINT sp").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("^INSERT INTO `books`").WillReturnResult(sqlmock.NewResult(id, 1))
+		mock.ExpectExec("^INSERT INTO `outbox_events`").WillReturnResult(sqlmock.NewResult(id, 1))
+	}
+
+	ginkgo.It("commit all changes made through tx", func() {
+		mock.ExpectBegin()
+		expectAddBook(1)
+		expectAddBook(2)
+		mock.ExpectCommit()
+
+		err := manager.InTx(context.Background(), func(tx *service.Manager) error {
+			if err := tx.AddBook(&model.Book{Title: "Go"}); err != nil {
+				return err
+			}
+			return tx.AddBook(&model.Book{Title: "Rust"})
+		})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+	})
+
+	ginkgo.It("roll back all changes when fn fails", func() {
+		failed := errors.New("stock is not enough")
+		mock.ExpectBegin()
+		expectAddBook(1)
+		mock.ExpectRollback()
+
+		err := manager.InTx(context.Background(), func(tx *service.Manager) error {
+			if err := tx.AddBook(&model.Book{Title: "Go"}); err != nil {
+				return err
+			}
+			return failed
+		})
+		gomega.Expect(err).To(gomega.MatchError(failed))
+		gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+	})
+
+	ginkgo.It("roll back a nested InTx to its savepoint only", func() {
+		failed := errors.New("optional step failed")
+		mock.ExpectBegin()
+		expectAddBook(1)
+		mock.ExpectExec("^SAVEPOINT intx_\\d+$").WillReturnResult(sqlmock.NewResult(0, 0))
+		expectAddBook(2)
+		mock.ExpectExec("^ROLLBACK TO SAVEPOINT intx_\\d+$").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectCommit()
+
+		var nestedErr error
+		err := manager.InTx(context.Background(), func(tx *service.Manager) error {
+			if err := tx.AddBook(&model.Book{Title: "Go"}); err != nil {
+				return err
+			}
+			nestedErr = tx.InTx(context.Background(), func(tx *service.Manager) error {
+				if err := tx.AddBook(&model.Book{Title: "Rust"}); err != nil {
+					return err
+				}
+				return failed
+			})
+			return nil
+		})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(nestedErr).To(gomega.MatchError(failed))
+		gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+	})
+
+	ginkgo.It("run a nested InTx with its own context", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		mock.ExpectBegin()
+		mock.ExpectRollback()
+
+		calls := 0
+		err := manager.InTx(context.Background(), func(tx *service.Manager) error {
+			return tx.InTx(ctx, func(tx *service.Manager) error {
+				calls++
+				return nil
+			})
+		})
+		gomega.Expect(err).To(gomega.MatchError(context.Canceled))
+		gomega.Expect(calls).To(gomega.BeZero())
+		gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+	})
+
+	ginkgo.It("keep the default retry policy of other managers", func() {
+		other, mock := newMockManager()
+		for i := 0; i <= service.DefaultTxRetryPolicy.MaxRetries; i++ {
+			mock.ExpectBegin()
+			mock.ExpectRollback()
+		}
+
+		calls := 0
+		err := other.InTx(context.Background(), func(tx *service.Manager) error {
+			calls++
+			return deadlock
+		})
+		gomega.Expect(err).To(gomega.MatchError(deadlock))
+		gomega.Expect(calls).To(gomega.Equal(service.DefaultTxRetryPolicy.MaxRetries + 1))
+		gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+	})
+
+	ginkgo.It("retry the whole transaction after a deadlock", func() {
+		mock.ExpectBegin()
+		mock.ExpectExec("^SAVEPOINT sp").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("^INSERT INTO `books`").WillReturnError(deadlock)
+		mock.ExpectExec("^ROLLBACK TO SAVEPOINT sp").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectRollback()
+		mock.ExpectBegin()
+		expectAddBook(1)
+		mock.ExpectCommit()
+
+		calls := 0
+		err := manager.InTx(context.Background(), func(tx *service.Manager) error {
+			calls++
+			return tx.AddBook(&model.Book{Title: "Go"})
+		})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(calls).To(gomega.Equal(2))
+		gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+	})
+
+	ginkgo.It("give up after MaxRetries", func() {
+		for i := 0; i < 3; i++ {
+			mock.ExpectBegin()
+			mock.ExpectRollback()
+		}
+
+		calls := 0
+		err := manager.InTx(context.Background(), func(tx *service.Manager) error {
+			calls++
+			return deadlock
+		})
+		gomega.Expect(err).To(gomega.MatchError(deadlock))
+		gomega.Expect(calls).To(gomega.Equal(3))
+		gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+	})
+
+	ginkgo.It("not retry other errors", func() {
+		duplicate := &mysqldriver.MySQLError{Number: 1062, Message: "Duplicate entry"}
+		mock.ExpectBegin()
+		mock.ExpectRollback()
+
+		calls := 0
+		err := manager.InTx(context.Background(), func(tx *service.Manager) error {
+			calls++
+			return duplicate
+		})
+		gomega.Expect(err).To(gomega.MatchError(duplicate))
+		gomega.Expect(calls).To(gomega.Equal(1))
+		gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+	})
+
+	ginkgo.It("stop retrying when the context is done", func() {
+		manager = manager.WithTxRetryPolicy(service.TxRetryPolicy{MaxRetries: 2, Backoff: time.Hour})
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		mock.ExpectBegin()
+		mock.ExpectRollback()
+
+		err := manager.InTx(ctx, func(tx *service.Manager) error {
+			return deadlock
+		})
+		gomega.Expect(err).To(gomega.MatchError(context.DeadlineExceeded))
+		gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+	})
+})
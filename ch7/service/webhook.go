@@ -0,0 +1,135 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+//CreateWebhook 创建订阅，没有指定 Secret 时随机生成
+func (m *Manager) CreateWebhook(subscription *model.WebhookSubscription) error {
+	if subscription.Secret == "" {
+		secret := make([]byte, 16)
+		if _, err := rand.Read(secret); err != nil {
+			return err
+		}
+		subscription.Secret = hex.EncodeToString(secret)
+	}
+	return m.db.Create(subscription).Error
+}
+
+func (m *Manager) GetWebhook(subscriptionId uint) (*model.WebhookSubscription, error) {
+	var subscription model.WebhookSubscription
+	if err := m.db.First(&subscription, subscriptionId).Error; err != nil {
+		return nil, err
+	}
+	return &subscription, nil
+}
+
+func (m *Manager) ListWebhooks() ([]*model.WebhookSubscription, error) {
+	var subscriptions []*model.WebhookSubscription
+	if err := m.db.Order("id").Find(&subscriptions).Error; err != nil {
+		return nil, err
+	}
+	return subscriptions, nil
+}
+
+//ActiveWebhooks 返回所有启用中的订阅
+func (m *Manager) ActiveWebhooks() ([]*model.WebhookSubscription, error) {
+	var subscriptions []*model.WebhookSubscription
+	if err := m.db.Where("active = ?", true).Order("id").Find(&subscriptions).Error; err != nil {
+		return nil, err
+	}
+	return subscriptions, nil
+}
+
+//UpdateWebhook 更新订阅，重新启用时清空失败计数
+func (m *Manager) UpdateWebhook(subscription *model.WebhookSubscription) error {
+	values := map[string]interface{}{
+		"url":      subscription.URL,
+		"events":   subscription.Events,
+		"catalogs": subscription.Catalogs,
+		"active":   subscription.Active,
+	}
+	if subscription.Secret != "" {
+		values["secret"] = subscription.Secret
+	}
+	if subscription.Active {
+		values["consecutive_failures"] = 0
+		values["disabled_at"] = nil
+	}
+	return m.db.Model(&model.WebhookSubscription{}).Where("id = ?", subscription.ID).Updates(values).Error
+}
+
+func (m *Manager) DeleteWebhook(subscriptionId uint) error {
+	return m.db.Delete(&model.WebhookSubscription{}, subscriptionId).Error
+}
+
+//ListWebhookDeliveries 按照时间倒序返回订阅的投递记录
+func (m *Manager) ListWebhookDeliveries(subscriptionId uint, pageNumber, pageSize int) ([]*model.WebhookDelivery, error) {
+	var deliveries []*model.WebhookDelivery
+	err := m.db.Where("subscription_id = ?", subscriptionId).Order("id DESC").
+		Limit(pageSize).Offset(pageNumber * pageSize).Find(&deliveries).Error
+	if err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+//EnqueueWebhookDelivery 保存待投递的记录，同一个事件已经加入订阅的队列时忽略，outbox 重复投递时不会重复推送
+func (m *Manager) EnqueueWebhookDelivery(delivery *model.WebhookDelivery) error {
+	return m.db.Clauses(clause.OnConflict{DoNothing: true}).Create(delivery).Error
+}
+
+//DueWebhookDeliveries 按照计划时间返回 now 之前需要投递的记录，最多 limit 条
+func (m *Manager) DueWebhookDeliveries(now time.Time, limit int) ([]*model.WebhookDelivery, error) {
+	var deliveries []*model.WebhookDelivery
+	err := m.db.Where("next_attempt_at <= ?", now).Order("next_attempt_at, id").Limit(limit).Find(&deliveries).Error
+	if err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+//ClaimWebhookDelivery 将投递的计划时间推迟到 until，其他进程在此之前不会投递同一条记录；
+//投递过程中进程退出时，until 之后重新投递。记录已经被其他进程领取时返回 false
+func (m *Manager) ClaimWebhookDelivery(delivery *model.WebhookDelivery, until time.Time) (bool, error) {
+	result := m.db.Model(&model.WebhookDelivery{}).
+		Where("id = ? AND next_attempt_at = ?", delivery.ID, delivery.NextAttemptAt).
+		Update("next_attempt_at", until)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+	delivery.NextAttemptAt = &until
+	return true, nil
+}
+
+//RecordWebhookDelivery 保存一次投递的结果，投递结束时（成功或者不再重试）更新订阅的连续失败次数，
+//连续失败达到 maxFailures 次后自动停用订阅；跳过的投递不影响失败次数
+func (m *Manager) RecordWebhookDelivery(delivery *model.WebhookDelivery, maxFailures int) error {
+	return m.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(delivery).Error; err != nil {
+			return err
+		}
+		if delivery.Pending() || delivery.Skipped {
+			return nil
+		}
+		query := tx.Model(&model.WebhookSubscription{}).Where("id = ?", delivery.SubscriptionID)
+		if delivery.Success {
+			return query.Update("consecutive_failures", 0).Error
+		}
+		if err := query.Update("consecutive_failures", gorm.Expr("consecutive_failures + 1")).Error; err != nil {
+			return err
+		}
+		return tx.Model(&model.WebhookSubscription{}).
+			Where("id = ? AND consecutive_failures >= ?", delivery.SubscriptionID, maxFailures).
+			Updates(map[string]interface{}{"active": false, "disabled_at": time.Now()}).Error
+	})
+}
@@ -0,0 +1,131 @@
+package service_test
+
+import (
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/model"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/service"
+)
+
+var _ = ginkgo.Describe("manager to manage webhooks", func() {
+	var manager *service.Manager
+	var mock sqlmock.Sqlmock
+
+	ginkgo.BeforeEach(func() {
+		manager, mock = newMockManager()
+	})
+
+	ginkgo.Describe("create webhook", func() {
+		ginkgo.Context("secret is empty", func() {
+			ginkgo.It("generate a secret", func() {
+				mock.ExpectBegin()
+				mock.ExpectExec("^INSERT INTO `webhook_subscriptions`").
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
+				subscription := &model.WebhookSubscription{URL: "http://127.0.0.1/hook", Active: true}
+				gomega.Expect(manager.CreateWebhook(subscription)).To(gomega.Succeed())
+				gomega.Expect(subscription.Secret).To(gomega.HaveLen(32))
+				gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+			})
+		})
+	})
+
+	ginkgo.Describe("record delivery", func() {
+		ginkgo.Context("delivery succeeded", func() {
+			ginkgo.It("reset consecutive failures", func() {
+				mock.ExpectBegin()
+				mock.ExpectExec("^UPDATE `webhook_deliveries` SET .* WHERE `id` = \\?").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec("UPDATE `webhook_subscriptions` SET `consecutive_failures`=\\?,`updated_at`=\\? WHERE id = \\?").
+					WithArgs(0, sqlmock.AnyArg(), 3).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+				delivery := &model.WebhookDelivery{ID: 7, SubscriptionID: 3, EventID: 1, Attempts: 1, Success: true}
+				gomega.Expect(manager.RecordWebhookDelivery(delivery, 5)).To(gomega.Succeed())
+				gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+			})
+		})
+		ginkgo.Context("delivery will be retried", func() {
+			ginkgo.It("save the next attempt without counting a failure", func() {
+				next := time.Now().Add(time.Minute)
+				mock.ExpectBegin()
+				mock.ExpectExec("^UPDATE `webhook_deliveries` SET .*`next_attempt_at`=\\?.* WHERE `id` = \\?").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+				delivery := &model.WebhookDelivery{ID: 7, SubscriptionID: 3, EventID: 1, Attempts: 1, NextAttemptAt: &next}
+				gomega.Expect(manager.RecordWebhookDelivery(delivery, 5)).To(gomega.Succeed())
+				gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+			})
+		})
+		ginkgo.Context("delivery skipped", func() {
+			ginkgo.It("save the delivery without counting a failure", func() {
+				mock.ExpectBegin()
+				mock.ExpectExec("^UPDATE `webhook_deliveries` SET .*`skipped`=\\?.* WHERE `id` = \\?").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+				delivery := &model.WebhookDelivery{ID: 7, SubscriptionID: 3, EventID: 1, Skipped: true, Error: "subscription is not active"}
+				gomega.Expect(manager.RecordWebhookDelivery(delivery, 5)).To(gomega.Succeed())
+				gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+			})
+		})
+		ginkgo.Context("delivery failed", func() {
+			ginkgo.It("increase failures & disable subscription reaching the limit", func() {
+				mock.ExpectBegin()
+				mock.ExpectExec("^UPDATE `webhook_deliveries` SET .* WHERE `id` = \\?").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec("UPDATE `webhook_subscriptions` SET `consecutive_failures`=consecutive_failures \\+ 1,`updated_at`=\\? WHERE id = \\?").
+					WithArgs(sqlmock.AnyArg(), 3).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec("UPDATE `webhook_subscriptions` SET `active`=\\?,`disabled_at`=\\?,`updated_at`=\\? WHERE \\(id = \\? AND consecutive_failures >= \\?\\)").
+					WithArgs(false, sqlmock.AnyArg(), sqlmock.AnyArg(), 3, 5).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+				delivery := &model.WebhookDelivery{ID: 7, SubscriptionID: 3, EventID: 1, Attempts: 4, Error: "receiver returned 500"}
+				gomega.Expect(manager.RecordWebhookDelivery(delivery, 5)).To(gomega.Succeed())
+				gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+			})
+		})
+	})
+
+	ginkgo.Describe("queue deliveries", func() {
+		ginkgo.It("ignore an event already queued for the subscription", func() {
+			now := time.Now()
+			mock.ExpectBegin()
+			mock.ExpectExec("^INSERT INTO `webhook_deliveries` .* ON DUPLICATE KEY UPDATE `id`=`id`").
+				WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectCommit()
+			delivery := &model.WebhookDelivery{SubscriptionID: 3, EventID: 1, NextAttemptAt: &now}
+			gomega.Expect(manager.EnqueueWebhookDelivery(delivery)).To(gomega.Succeed())
+			gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+		})
+
+		ginkgo.It("claim a due delivery only once", func() {
+			due := time.Now()
+			until := due.Add(time.Minute)
+			mock.ExpectBegin()
+			mock.ExpectExec("UPDATE `webhook_deliveries` SET `next_attempt_at`=\\?,`updated_at`=\\? WHERE id = \\? AND next_attempt_at = \\?").
+				WithArgs(until, sqlmock.AnyArg(), 7, due).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectCommit()
+			mock.ExpectBegin()
+			mock.ExpectExec("UPDATE `webhook_deliveries`").
+				WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectCommit()
+
+			delivery := &model.WebhookDelivery{ID: 7, NextAttemptAt: &due}
+			claimed, err := manager.ClaimWebhookDelivery(delivery, until)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(claimed).To(gomega.BeTrue())
+			gomega.Expect(*delivery.NextAttemptAt).To(gomega.Equal(until))
+
+			delivery.NextAttemptAt = &due
+			claimed, err = manager.ClaimWebhookDelivery(delivery, until)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(claimed).To(gomega.BeFalse())
+			gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+		})
+	})
+})
@@ -0,0 +1,199 @@
+package stream
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/model"
+)
+
+const (
+	DefaultBufferSize     = 1024 //DefaultBufferSize 保存最近的事件数量，用于断线重连后补发
+	DefaultSubscriberSize = 64   //DefaultSubscriberSize 每个订阅者待发送事件的队列长度
+	seenFactor            = 4    //seenFactor 用于去重的事件 ID 数量是缓冲区大小的倍数
+)
+
+//Broker 将 outbox 投递的 Book 事件广播给所有订阅者，实现了 outbox.Sink。
+//最近的事件按照到达的顺序保存在有界的缓冲区中，订阅时可以从 Last-Event-ID 之后补发；
+//订阅者的队列满时断开该订阅者，不阻塞事件投递，订阅者重连后从缓冲区补发。
+//事务提交的顺序与 ID 的顺序不一定相同，ID 较小的事件可能晚到达，不能按照 ID 判断重复
+type Broker struct {
+	mu sync.Mutex
+	//buffer 环形缓冲区，保存 start 开始的 size 个事件
+	buffer      []*model.OutboxEvent
+	start, size int
+	//floor 缓冲区可以为 Last-Event-ID 不小于 floor 的订阅者完整补发，之前的事件没有收到或者已经被移出缓冲区
+	floor   uint
+	started bool
+	//seen 最近投递过的事件 ID，用于忽略 outbox 重复投递的事件，seenOrder 为环形队列，按照到达的顺序淘汰
+	seen           map[uint]struct{}
+	seenOrder      []uint
+	seenNext       int
+	subscriberSize int
+	subscribers    map[*Subscription]struct{}
+}
+
+//NewBroker 创建保存最近 bufferSize 个事件的 Broker
+func NewBroker(bufferSize int) *Broker {
+	if bufferSize <= 0 {
+		bufferSize = DefaultBufferSize
+	}
+	return &Broker{
+		buffer:         make([]*model.OutboxEvent, bufferSize),
+		seen:           make(map[uint]struct{}, seenFactor*bufferSize),
+		seenOrder:      make([]uint, 0, seenFactor*bufferSize),
+		subscriberSize: DefaultSubscriberSize,
+		subscribers:    make(map[*Subscription]struct{}),
+	}
+}
+
+//SetSubscriberSize 设置之后订阅者的队列长度
+func (b *Broker) SetSubscriberSize(size int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscriberSize = size
+}
+
+//Publish 保存并广播 Book 的新增、更新与删除事件，忽略其他事件。
+//outbox 可能重复投递，最近投递过的事件 ID 再次到达时忽略
+func (b *Broker) Publish(ctx context.Context, event *model.OutboxEvent) error {
+	if !event.Type.IsBookEvent() {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.markSeen(event.ID) {
+		return nil
+	}
+	b.append(event)
+	for sub := range b.subscribers {
+		if !sub.accept(event) {
+			continue
+		}
+		select {
+		case sub.events <- event:
+		default:
+			//队列已满，断开慢的订阅者
+			b.remove(sub)
+		}
+	}
+	return nil
+}
+
+//markSeen 记录事件 ID，已经记录过时返回 false。最多记录 seenFactor 倍缓冲区大小的 ID，
+//outbox 重复投递发生在短时间内，更早的 ID 不会再次到达
+func (b *Broker) markSeen(id uint) bool {
+	if _, ok := b.seen[id]; ok {
+		return false
+	}
+	b.seen[id] = struct{}{}
+	if len(b.seenOrder) < cap(b.seenOrder) {
+		b.seenOrder = append(b.seenOrder, id)
+		return true
+	}
+	delete(b.seen, b.seenOrder[b.seenNext])
+	b.seenOrder[b.seenNext] = id
+	b.seenNext = (b.seenNext + 1) % len(b.seenOrder)
+	return true
+}
+
+func (b *Broker) append(event *model.OutboxEvent) {
+	if !b.started {
+		b.started = true
+		b.floor = event.ID - 1
+	}
+	if b.size < len(b.buffer) {
+		b.buffer[(b.start+b.size)%len(b.buffer)] = event
+		b.size++
+		return
+	}
+	if evicted := b.buffer[b.start].ID; evicted > b.floor {
+		b.floor = evicted
+	}
+	b.buffer[b.start] = event
+	b.start = (b.start + 1) % len(b.buffer)
+}
+
+func (b *Broker) at(i int) *model.OutboxEvent {
+	return b.buffer[(b.start+i)%len(b.buffer)]
+}
+
+//indexOf 返回事件在缓冲区中的位置，不在缓冲区中时返回 -1
+func (b *Broker) indexOf(id uint) int {
+	for i := b.size - 1; i >= 0; i-- {
+		if b.at(i).ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+//Subscription 一个订阅者
+type Subscription struct {
+	//Replay 订阅时需要补发的事件
+	Replay []*model.OutboxEvent
+	//Lost 为 true 时 Last-Event-ID 之后的部分事件已经不在缓冲区中，订阅者需要重新加载全部数据
+	Lost bool
+
+	tenantId   string
+	allTenants bool
+	events     chan *model.OutboxEvent
+	broker     *Broker
+	closed     bool
+}
+
+//Subscribe 订阅租户 tenantId 的事件，tenantId 为空时订阅所有租户的事件。
+//resume 为 true 时补发 lastEventId 之后到达的事件与 ID 大于 lastEventId 的事件，按照 ID 排序；
+//补发之后再次重连时可能收到少量重复的事件，订阅者需要按照 ID 去重
+func (b *Broker) Subscribe(tenantId string, resume bool, lastEventId uint) *Subscription {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	sub := &Subscription{
+		tenantId:   tenantId,
+		allTenants: tenantId == "",
+		events:     make(chan *model.OutboxEvent, b.subscriberSize),
+		broker:     b,
+	}
+	if resume {
+		//最后收到的事件仍在缓冲区中时，之后到达的事件都可以补发，包括 ID 较小、晚提交的事件。
+		//否则订阅者没有收到的事件可能已经被移出缓冲区，或者在进程启动之前投递，无法完整补发；
+		//事件 ID 不连续，可能误判为丢失，订阅者多重新加载一次数据
+		last := b.indexOf(lastEventId)
+		sub.Lost = last < 0 && (!b.started || lastEventId < b.floor)
+		for i := 0; i < b.size; i++ {
+			event := b.at(i)
+			if (event.ID > lastEventId || (last >= 0 && i > last)) && sub.accept(event) {
+				sub.Replay = append(sub.Replay, event)
+			}
+		}
+		sort.Slice(sub.Replay, func(i, j int) bool { return sub.Replay[i].ID < sub.Replay[j].ID })
+	}
+	b.subscribers[sub] = struct{}{}
+	return sub
+}
+
+func (s *Subscription) accept(event *model.OutboxEvent) bool {
+	return s.allTenants || event.TenantID == s.tenantId
+}
+
+//Events 返回订阅之后的事件，因为跟不上事件的速度被断开或者 Close 之后关闭
+func (s *Subscription) Events() <-chan *model.OutboxEvent {
+	return s.events
+}
+
+//Close 取消订阅
+func (s *Subscription) Close() {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+	s.broker.remove(s)
+}
+
+func (b *Broker) remove(sub *Subscription) {
+	if sub.closed {
+		return
+	}
+	sub.closed = true
+	delete(b.subscribers, sub)
+	close(sub.events)
+}
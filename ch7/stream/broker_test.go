@@ -0,0 +1,138 @@
+package stream_test
+
+import (
+	"context"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/model"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/stream"
+)
+
+var _ = ginkgo.Describe("broker", func() {
+	var broker *stream.Broker
+
+	ginkgo.BeforeEach(func() {
+		broker = stream.NewBroker(3)
+	})
+
+	publish := func(id uint, eventType model.EventType, tenantId string) *model.OutboxEvent {
+		event := &model.OutboxEvent{ID: id, Type: eventType, TenantID: tenantId, AggregateID: id}
+		gomega.Expect(broker.Publish(context.Background(), event)).To(gomega.Succeed())
+		return event
+	}
+
+	ids := func(events []*model.OutboxEvent) []uint {
+		var result []uint
+		for _, event := range events {
+			result = append(result, event.ID)
+		}
+		return result
+	}
+
+	ginkgo.It("broadcast book events to subscribers", func() {
+		sub := broker.Subscribe("", false, 0)
+		defer sub.Close()
+		created := publish(1, model.EventBookCreated, "")
+		publish(2, model.EventReviewSaved, "")
+		deleted := publish(3, model.EventBookDeleted, "")
+
+		gomega.Expect(sub.Replay).To(gomega.BeEmpty())
+		gomega.Expect(<-sub.Events()).To(gomega.Equal(created))
+		gomega.Expect(<-sub.Events()).To(gomega.Equal(deleted))
+		gomega.Expect(sub.Events()).NotTo(gomega.Receive())
+	})
+
+	ginkgo.It("ignore events delivered again", func() {
+		sub := broker.Subscribe("", false, 0)
+		defer sub.Close()
+		publish(1, model.EventBookCreated, "")
+		publish(1, model.EventBookCreated, "")
+
+		gomega.Expect(sub.Events()).To(gomega.HaveLen(1))
+	})
+
+	ginkgo.It("deliver events committed out of id order & ignore them delivered again", func() {
+		sub := broker.Subscribe("", false, 0)
+		defer sub.Close()
+		publish(2, model.EventBookCreated, "")
+		publish(1, model.EventBookUpdated, "")
+		publish(2, model.EventBookCreated, "")
+
+		gomega.Expect((<-sub.Events()).ID).To(gomega.Equal(uint(2)))
+		gomega.Expect((<-sub.Events()).ID).To(gomega.Equal(uint(1)))
+		gomega.Expect(sub.Events()).NotTo(gomega.Receive())
+	})
+
+	ginkgo.It("only send events of the tenant", func() {
+		sub := broker.Subscribe("acme", false, 0)
+		defer sub.Close()
+		publish(1, model.EventBookCreated, "other")
+		publish(2, model.EventBookCreated, "acme")
+
+		gomega.Expect((<-sub.Events()).ID).To(gomega.Equal(uint(2)))
+		gomega.Expect(sub.Events()).NotTo(gomega.Receive())
+	})
+
+	ginkgo.Describe("resume from last event id", func() {
+		ginkgo.It("replay buffered events after the id", func() {
+			for id := uint(1); id <= 3; id++ {
+				publish(id, model.EventBookUpdated, "")
+			}
+			sub := broker.Subscribe("", true, 1)
+			defer sub.Close()
+			gomega.Expect(sub.Lost).To(gomega.BeFalse())
+			gomega.Expect(ids(sub.Replay)).To(gomega.Equal([]uint{2, 3}))
+		})
+
+		ginkgo.It("replay late events after the last received event ordered by id", func() {
+			for _, id := range []uint{1, 3, 2, 4} {
+				publish(id, model.EventBookUpdated, "")
+			}
+			sub := broker.Subscribe("", true, 3)
+			defer sub.Close()
+			gomega.Expect(sub.Lost).To(gomega.BeFalse())
+			gomega.Expect(ids(sub.Replay)).To(gomega.Equal([]uint{2, 4}))
+		})
+
+		ginkgo.It("report lost events evicted from the buffer", func() {
+			for id := uint(1); id <= 5; id++ {
+				publish(id, model.EventBookUpdated, "")
+			}
+			lost := broker.Subscribe("", true, 1)
+			defer lost.Close()
+			gomega.Expect(lost.Lost).To(gomega.BeTrue())
+			gomega.Expect(ids(lost.Replay)).To(gomega.Equal([]uint{3, 4, 5}))
+
+			complete := broker.Subscribe("", true, 2)
+			defer complete.Close()
+			gomega.Expect(complete.Lost).To(gomega.BeFalse())
+		})
+
+		ginkgo.It("report lost events before the broker started", func() {
+			empty := broker.Subscribe("", true, 5)
+			defer empty.Close()
+			gomega.Expect(empty.Lost).To(gomega.BeTrue())
+
+			publish(10, model.EventBookCreated, "")
+			gomega.Expect(broker.Subscribe("", true, 5).Lost).To(gomega.BeTrue())
+			gomega.Expect(broker.Subscribe("", true, 9).Lost).To(gomega.BeFalse())
+		})
+	})
+
+	ginkgo.It("disconnect subscribers that fall behind", func() {
+		broker.SetSubscriberSize(1)
+		slow := broker.Subscribe("", false, 0)
+		publish(1, model.EventBookCreated, "")
+		publish(2, model.EventBookCreated, "")
+
+		gomega.Expect((<-slow.Events()).ID).To(gomega.Equal(uint(1)))
+		gomega.Eventually(slow.Events()).Should(gomega.BeClosed())
+		slow.Close()
+
+		//重连后从缓冲区补发
+		resumed := broker.Subscribe("", true, 1)
+		defer resumed.Close()
+		gomega.Expect(ids(resumed.Replay)).To(gomega.Equal([]uint{2}))
+	})
+})
@@ -0,0 +1,88 @@
+package trace
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+)
+
+//Exporter 接收已经结束的 Span，需要支持并发调用
+type Exporter interface {
+	Export(span *Span)
+}
+
+//exporterHolder atomic.Value 要求保存的值类型一致
+type exporterHolder struct {
+	exporter Exporter
+}
+
+var exporter atomic.Value
+
+//SetExporter 设置全局的 Exporter，为 nil 时不导出 Span
+func SetExporter(e Exporter) {
+	exporter.Store(exporterHolder{e})
+}
+
+func getExporter() Exporter {
+	holder, _ := exporter.Load().(exporterHolder)
+	return holder.exporter
+}
+
+//MemoryExporter 在内存中保存 Span，用于测试
+type MemoryExporter struct {
+	mu    sync.Mutex
+	spans []*Span
+}
+
+func NewMemoryExporter() *MemoryExporter {
+	return &MemoryExporter{}
+}
+
+func (e *MemoryExporter) Export(span *Span) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, span)
+}
+
+//Spans 按照结束的顺序返回导出的 Span
+func (e *MemoryExporter) Spans() []*Span {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]*Span(nil), e.spans...)
+}
+
+//Reset 清空保存的 Span
+func (e *MemoryExporter) Reset() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = nil
+}
+
+//WriterExporter 将 Span 以 JSON 格式逐行写入 io.Writer
+type WriterExporter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewWriterExporter(w io.Writer) *WriterExporter {
+	return &WriterExporter{w: w}
+}
+
+//NewStdoutExporter 创建写入标准输出的 WriterExporter
+func NewStdoutExporter() *WriterExporter {
+	return NewWriterExporter(os.Stdout)
+}
+
+func (e *WriterExporter) Export(span *Span) {
+	span.mu.Lock()
+	data, err := json.Marshal(span)
+	span.mu.Unlock()
+	if err != nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	_, _ = e.w.Write(append(data, '\n'))
+}
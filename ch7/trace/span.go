@@ -0,0 +1,206 @@
+package trace
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+//ErrInvalidTraceparent traceparent 请求头不符合 W3C Trace Context 格式
+var ErrInvalidTraceparent = errors.New("invalid traceparent")
+
+//TraceID 一次调用链的标识
+type TraceID [16]byte
+
+func (id TraceID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+func (id TraceID) IsValid() bool {
+	return id != TraceID{}
+}
+
+//SpanID 调用链中一个 Span 的标识
+type SpanID [8]byte
+
+func (id SpanID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+func (id SpanID) IsValid() bool {
+	return id != SpanID{}
+}
+
+//SpanContext 跨进程传递的 Span 信息
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+//Traceparent 返回 W3C traceparent 格式的字符串，用于传递给下游
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + flags
+}
+
+//ParseTraceparent 解析 W3C traceparent，例如 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01。
+//未来版本可能在末尾增加字段，版本不是 00 时忽略前 4 个字段之后的内容
+func ParseTraceparent(s string) (SpanContext, error) {
+	var sc SpanContext
+	if len(s) < 55 || (len(s) > 55 && (strings.HasPrefix(s, "00") || s[55] != '-')) {
+		return sc, ErrInvalidTraceparent
+	}
+	parts := strings.Split(s[:55], "-")
+	if len(parts) != 4 || !isLowerHex(s[:55]) || parts[0] == "ff" {
+		return sc, ErrInvalidTraceparent
+	}
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return sc, ErrInvalidTraceparent
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return sc, ErrInvalidTraceparent
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil || !sc.IsValid() {
+		return sc, ErrInvalidTraceparent
+	}
+	sc.Sampled = flags[0]&0x01 == 1
+	return sc, nil
+}
+
+func isLowerHex(s string) bool {
+	for _, c := range s {
+		if c != '-' && (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+//Span 一次操作的耗时与属性，End 之后交给 Exporter
+type Span struct {
+	Name       string            `json:"name"`
+	TraceID    string            `json:"trace_id"`
+	SpanID     string            `json:"span_id"`
+	ParentID   string            `json:"parent_id,omitempty"`
+	Start      time.Time         `json:"start"`
+	End        time.Time         `json:"end"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+	Error      string            `json:"error,omitempty"`
+
+	mu       sync.Mutex
+	context  SpanContext
+	exporter Exporter
+	ended    bool
+}
+
+//Context 返回用于创建子 Span 与传递给下游的 SpanContext
+func (s *Span) Context() SpanContext {
+	return s.context
+}
+
+//SetAttribute 设置 Span 的属性
+func (s *Span) SetAttribute(key, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Attributes == nil {
+		s.Attributes = make(map[string]string)
+	}
+	s.Attributes[key] = value
+}
+
+//SetError 记录操作失败的原因，err 为 nil 时忽略
+func (s *Span) SetError(err error) {
+	if err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Error = err.Error()
+}
+
+//Finish 结束 Span 并导出，多次调用只导出一次；未采样的 Span 不导出
+func (s *Span) Finish() {
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.End = time.Now()
+	s.mu.Unlock()
+	if s.context.Sampled && s.exporter != nil {
+		s.exporter.Export(s)
+	}
+}
+
+type contextKey int
+
+const (
+	spanKey   contextKey = iota //spanKey 当前的 Span
+	remoteKey                   //remoteKey 上游传入的 SpanContext
+)
+
+//ContextWithRemote 保存上游通过 traceparent 传入的 SpanContext，之后创建的 Span 作为它的子 Span
+func ContextWithRemote(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, remoteKey, sc)
+}
+
+//FromContext 返回 ctx 中当前的 Span，没有时返回 nil
+func FromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey).(*Span)
+	return span
+}
+
+//Start 创建 ctx 中当前 Span 的子 Span，没有当前 Span 时使用上游的 SpanContext，
+//都没有时开始新的调用链。返回的 ctx 中当前 Span 为新创建的 Span，调用方负责 Finish
+func Start(ctx context.Context, name string) (context.Context, *Span) {
+	var parent SpanContext
+	if span := FromContext(ctx); span != nil {
+		parent = span.context
+	} else if remote, ok := ctx.Value(remoteKey).(SpanContext); ok {
+		parent = remote
+	}
+
+	span := &Span{Name: name, Start: time.Now(), exporter: getExporter()}
+	span.context.SpanID = newSpanID()
+	if parent.IsValid() {
+		span.context.TraceID = parent.TraceID
+		span.context.Sampled = parent.Sampled
+		span.ParentID = parent.SpanID.String()
+	} else {
+		span.context.TraceID = newTraceID()
+		span.context.Sampled = true
+	}
+	span.TraceID = span.context.TraceID.String()
+	span.SpanID = span.context.SpanID.String()
+	return context.WithValue(ctx, spanKey, span), span
+}
+
+func newTraceID() TraceID {
+	var id TraceID
+	for !id.IsValid() {
+		_, _ = rand.Read(id[:])
+	}
+	return id
+}
+
+func newSpanID() SpanID {
+	var id SpanID
+	for !id.IsValid() {
+		_, _ = rand.Read(id[:])
+	}
+	return id
+}
@@ -0,0 +1,106 @@
+package trace_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/trace"
+)
+
+var _ = ginkgo.Describe("trace", func() {
+	var exporter *trace.MemoryExporter
+
+	ginkgo.BeforeEach(func() {
+		exporter = trace.NewMemoryExporter()
+		trace.SetExporter(exporter)
+		ginkgo.DeferCleanup(func() {
+			trace.SetExporter(nil)
+		})
+	})
+
+	ginkgo.Describe("parse traceparent", func() {
+		ginkgo.It("accept a valid header", func() {
+			sc, err := trace.ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(sc.TraceID.String()).To(gomega.Equal("4bf92f3577b34da6a3ce929d0e0e4736"))
+			gomega.Expect(sc.SpanID.String()).To(gomega.Equal("00f067aa0ba902b7"))
+			gomega.Expect(sc.Sampled).To(gomega.BeTrue())
+			gomega.Expect(sc.Traceparent()).To(gomega.Equal("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"))
+		})
+
+		ginkgo.It("ignore fields appended by future versions", func() {
+			sc, err := trace.ParseTraceparent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-extra")
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(sc.Sampled).To(gomega.BeFalse())
+		})
+
+		ginkgo.DescribeTable("reject invalid headers", func(header string) {
+			_, err := trace.ParseTraceparent(header)
+			gomega.Expect(err).To(gomega.MatchError(trace.ErrInvalidTraceparent))
+		},
+			ginkgo.Entry("empty", ""),
+			ginkgo.Entry("upper case", "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01"),
+			ginkgo.Entry("zero trace id", "00-00000000000000000000000000000000-00f067aa0ba902b7-01"),
+			ginkgo.Entry("zero span id", "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01"),
+			ginkgo.Entry("forbidden version", "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"),
+			ginkgo.Entry("trailing data in version 00", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-x"),
+			ginkgo.Entry("wrong separator", "00_4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"),
+		)
+	})
+
+	ginkgo.Describe("start spans", func() {
+		ginkgo.It("create children in the same trace", func() {
+			ctx, root := trace.Start(context.Background(), "root")
+			_, child := trace.Start(ctx, "child")
+			child.SetAttribute("db.table", "books")
+			child.SetError(errors.New("boom"))
+			child.Finish()
+			root.Finish()
+			root.Finish()
+
+			spans := exporter.Spans()
+			gomega.Expect(spans).To(gomega.HaveLen(2))
+			gomega.Expect(spans[0].Name).To(gomega.Equal("child"))
+			gomega.Expect(spans[0].TraceID).To(gomega.Equal(root.TraceID))
+			gomega.Expect(spans[0].ParentID).To(gomega.Equal(root.SpanID))
+			gomega.Expect(spans[0].Attributes).To(gomega.HaveKeyWithValue("db.table", "books"))
+			gomega.Expect(spans[0].Error).To(gomega.Equal("boom"))
+			gomega.Expect(spans[1].ParentID).To(gomega.BeEmpty())
+		})
+
+		ginkgo.It("continue the trace of the caller", func() {
+			remote, err := trace.ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			_, span := trace.Start(trace.ContextWithRemote(context.Background(), remote), "handler")
+			span.Finish()
+
+			gomega.Expect(span.TraceID).To(gomega.Equal("4bf92f3577b34da6a3ce929d0e0e4736"))
+			gomega.Expect(span.ParentID).To(gomega.Equal("00f067aa0ba902b7"))
+		})
+
+		ginkgo.It("not export spans the caller did not sample", func() {
+			remote, err := trace.ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			_, span := trace.Start(trace.ContextWithRemote(context.Background(), remote), "handler")
+			span.Finish()
+
+			gomega.Expect(exporter.Spans()).To(gomega.BeEmpty())
+		})
+	})
+
+	ginkgo.It("write spans as json lines", func() {
+		var buf bytes.Buffer
+		trace.SetExporter(trace.NewWriterExporter(&buf))
+		_, span := trace.Start(context.Background(), "root")
+		span.Finish()
+
+		var exported map[string]interface{}
+		gomega.Expect(json.Unmarshal(buf.Bytes(), &exported)).To(gomega.Succeed())
+		gomega.Expect(exported).To(gomega.HaveKeyWithValue("name", "root"))
+		gomega.Expect(exported).To(gomega.HaveKeyWithValue("trace_id", span.TraceID))
+	})
+})
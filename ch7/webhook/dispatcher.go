@@ -0,0 +1,311 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/model"
+)
+
+const (
+	SignatureHeader = "X-Webhook-Signature" //SignatureHeader 请求体签名，格式为 sha256=<hex>
+	TimestampHeader = "X-Webhook-Timestamp" //TimestampHeader 签名时间，unix 秒
+	EventIDHeader   = "X-Webhook-Event-ID"  //EventIDHeader 事件ID，用于接收方去重
+	EventTypeHeader = "X-Webhook-Event"     //EventTypeHeader 事件类型
+)
+
+//Store 订阅与投递记录的存储，service.Manager 实现了该接口
+type Store interface {
+	ActiveWebhooks() ([]*model.WebhookSubscription, error)
+	EnqueueWebhookDelivery(delivery *model.WebhookDelivery) error
+	DueWebhookDeliveries(now time.Time, limit int) ([]*model.WebhookDelivery, error)
+	ClaimWebhookDelivery(delivery *model.WebhookDelivery, until time.Time) (bool, error)
+	RecordWebhookDelivery(delivery *model.WebhookDelivery, maxFailures int) error
+}
+
+//Dispatcher 将 outbox 事件推送给匹配的订阅，实现了 outbox.Sink。
+//Publish 只把投递写入 webhook_deliveries，由 Run 启动的每个订阅一个的协程异步投递，
+//单个订阅变慢或者不可用时不会阻塞 outbox 投递、其他订阅和后续事件。
+//失败的投递按照指数退避记录下一次重试的时间，进程重启之后继续重试
+type Dispatcher struct {
+	Store        Store
+	Client       *http.Client
+	MaxRetries   int           //失败后的重试次数
+	Backoff      time.Duration //第一次重试前的等待时间，之后每次翻倍
+	MaxFailures  int           //连续失败多少个事件后停用订阅
+	PollInterval time.Duration //查询到期投递的间隔，Publish 之后立即查询
+	BatchSize    int           //每次查询的到期投递数量
+	Lease        time.Duration //投递前领取记录的时长，需要大于请求超时
+	Now          func() time.Time
+
+	wake chan struct{}
+	mu   sync.Mutex
+	//workers 每个订阅的投递协程，inFlight 已经交给协程但还没有完成的投递
+	workers  map[uint]chan job
+	inFlight map[uint]struct{}
+}
+
+//job 交给订阅协程的投递，subscription 为查询时最新的订阅
+type job struct {
+	subscription *model.WebhookSubscription
+	delivery     *model.WebhookDelivery
+}
+
+const (
+	workerQueueSize   = 64          //workerQueueSize 每个订阅等待投递的数量，超过时留在数据库中下次查询
+	workerIdleTimeout = time.Minute //workerIdleTimeout 订阅的协程空闲超过该时间后退出
+)
+
+//NewDispatcher 使用默认参数创建 Dispatcher
+func NewDispatcher(store Store) *Dispatcher {
+	return &Dispatcher{
+		Store:        store,
+		Client:       &http.Client{Timeout: 10 * time.Second},
+		MaxRetries:   3,
+		Backoff:      5 * time.Second,
+		MaxFailures:  10,
+		PollInterval: time.Second,
+		BatchSize:    100,
+		Lease:        time.Minute,
+		Now:          time.Now,
+		wake:         make(chan struct{}, 1),
+	}
+}
+
+//Sign 计算 HMAC-SHA256 签名，签名内容为 "<timestamp>.<body>"
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+//Verify 校验签名，供接收方使用
+func Verify(secret string, timestamp int64, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}
+
+//Publish 为所有匹配的订阅保存待投递的记录，不等待投递完成
+func (d *Dispatcher) Publish(ctx context.Context, event *model.OutboxEvent) error {
+	//订阅只能选择 Book 事件，评价、借阅等事件不推送
+	if !event.Type.IsBookEvent() {
+		return nil
+	}
+	subscriptions, err := d.Store.ActiveWebhooks()
+	if err != nil {
+		return err
+	}
+	var book model.Book
+	if err := json.Unmarshal(event.Payload, &book); err != nil {
+		return err
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	now := d.Now()
+	enqueued := false
+	for _, subscription := range subscriptions {
+		if !subscription.Matches(event, &book) {
+			continue
+		}
+		err := d.Store.EnqueueWebhookDelivery(&model.WebhookDelivery{
+			TenantID:       subscription.TenantID,
+			SubscriptionID: subscription.ID,
+			EventID:        event.ID,
+			EventType:      event.Type,
+			Payload:        body,
+			NextAttemptAt:  &now,
+		})
+		if err != nil {
+			return err
+		}
+		enqueued = true
+	}
+	if enqueued {
+		select {
+		case d.wake <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+//Run 定期查询到期的投递并交给订阅的协程，直到 ctx 结束，返回前等待进行中的投递完成
+func (d *Dispatcher) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	ticker := time.NewTicker(d.PollInterval)
+	defer ticker.Stop()
+	for {
+		if err := d.dispatchDue(ctx, &wg); err != nil {
+			log.Printf("dispatch webhook deliveries failed: %s", err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		case <-d.wake:
+		}
+	}
+}
+
+//dispatchDue 将到期的投递交给订阅的协程，订阅已经停用或删除时跳过投递
+func (d *Dispatcher) dispatchDue(ctx context.Context, wg *sync.WaitGroup) error {
+	deliveries, err := d.Store.DueWebhookDeliveries(d.Now(), d.BatchSize)
+	if err != nil || len(deliveries) == 0 {
+		return err
+	}
+	subscriptions, err := d.Store.ActiveWebhooks()
+	if err != nil {
+		return err
+	}
+	active := make(map[uint]*model.WebhookSubscription, len(subscriptions))
+	for _, subscription := range subscriptions {
+		active[subscription.ID] = subscription
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.workers == nil {
+		d.workers = make(map[uint]chan job)
+		d.inFlight = make(map[uint]struct{})
+	}
+	for _, delivery := range deliveries {
+		if _, ok := d.inFlight[delivery.ID]; ok {
+			continue
+		}
+		subscription, ok := active[delivery.SubscriptionID]
+		if !ok {
+			delivery.NextAttemptAt = nil
+			delivery.Skipped = true
+			delivery.Error = "subscription is not active"
+			if err := d.Store.RecordWebhookDelivery(delivery, d.MaxFailures); err != nil {
+				return err
+			}
+			continue
+		}
+		queue, ok := d.workers[subscription.ID]
+		if !ok {
+			queue = make(chan job, workerQueueSize)
+			d.workers[subscription.ID] = queue
+			wg.Add(1)
+			go func(subscriptionId uint) {
+				defer wg.Done()
+				d.work(ctx, subscriptionId, queue)
+			}(subscription.ID)
+		}
+		select {
+		case queue <- job{subscription: subscription, delivery: delivery}:
+			d.inFlight[delivery.ID] = struct{}{}
+		default:
+			//订阅的队列已满，留在数据库中下次查询
+		}
+	}
+	return nil
+}
+
+//work 依次投递一个订阅的记录，直到 ctx 结束或者空闲超过 workerIdleTimeout
+func (d *Dispatcher) work(ctx context.Context, subscriptionId uint, queue chan job) {
+	idle := time.NewTimer(workerIdleTimeout)
+	defer idle.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case j := <-queue:
+			d.deliver(ctx, j.subscription, j.delivery)
+			d.mu.Lock()
+			delete(d.inFlight, j.delivery.ID)
+			d.mu.Unlock()
+		case <-idle.C:
+			//dispatchDue 持有锁时才会写入队列，删除之后的投递由新的协程处理
+			d.mu.Lock()
+			if len(queue) == 0 {
+				delete(d.workers, subscriptionId)
+				d.mu.Unlock()
+				return
+			}
+			d.mu.Unlock()
+		}
+		if !idle.Stop() {
+			select {
+			case <-idle.C:
+			default:
+			}
+		}
+		idle.Reset(workerIdleTimeout)
+	}
+}
+
+//deliver 领取并投递一次，失败时按照指数退避记录下一次重试的时间，重试次数用完之后结束投递
+func (d *Dispatcher) deliver(ctx context.Context, subscription *model.WebhookSubscription, delivery *model.WebhookDelivery) {
+	claimed, err := d.Store.ClaimWebhookDelivery(delivery, d.Now().Add(d.Lease))
+	if err != nil {
+		log.Printf("claim webhook delivery %d failed: %s", delivery.ID, err)
+		return
+	}
+	if !claimed {
+		return
+	}
+	start := d.Now()
+	delivery.Attempts++
+	statusCode, err := d.post(ctx, subscription, delivery)
+	delivery.StatusCode = statusCode
+	delivery.DurationMs = d.Now().Sub(start).Milliseconds()
+	switch {
+	case err == nil:
+		delivery.Success = true
+		delivery.Error = ""
+		delivery.NextAttemptAt = nil
+	case ctx.Err() != nil:
+		//进程退出，领取到期之后重新投递，不计入重试次数
+		delivery.Attempts--
+		delivery.Error = ctx.Err().Error()
+	case delivery.Attempts > d.MaxRetries:
+		delivery.Error = err.Error()
+		delivery.NextAttemptAt = nil
+	default:
+		delivery.Error = err.Error()
+		next := d.Now().Add(d.Backoff << (delivery.Attempts - 1))
+		delivery.NextAttemptAt = &next
+	}
+	if err := d.Store.RecordWebhookDelivery(delivery, d.MaxFailures); err != nil {
+		log.Printf("record webhook delivery %d failed: %s", delivery.ID, err)
+	}
+}
+
+func (d *Dispatcher) post(ctx context.Context, subscription *model.WebhookSubscription,
+	delivery *model.WebhookDelivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, subscription.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := d.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(TimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(SignatureHeader, Sign(subscription.Secret, timestamp, delivery.Payload))
+	req.Header.Set(EventIDHeader, strconv.FormatUint(uint64(delivery.EventID), 10))
+	req.Header.Set(EventTypeHeader, string(delivery.EventType))
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("receiver returned %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
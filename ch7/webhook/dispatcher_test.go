@@ -0,0 +1,355 @@
+package webhook_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/model"
+	"github.com/weenxin/ulitmate_go_notebook_reading/ch7/webhook"
+	"gorm.io/gorm"
+)
+
+//memoryStore 测试用的订阅与投递存储，按照 service.Manager 的规则停用订阅
+type memoryStore struct {
+	mu            sync.Mutex
+	subscriptions []*model.WebhookSubscription
+	deliveries    []*model.WebhookDelivery
+}
+
+func (s *memoryStore) ActiveWebhooks() ([]*model.WebhookSubscription, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var active []*model.WebhookSubscription
+	for _, subscription := range s.subscriptions {
+		if subscription.Active {
+			copied := *subscription
+			active = append(active, &copied)
+		}
+	}
+	return active, nil
+}
+
+func (s *memoryStore) EnqueueWebhookDelivery(delivery *model.WebhookDelivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, existing := range s.deliveries {
+		if existing.SubscriptionID == delivery.SubscriptionID && existing.EventID == delivery.EventID {
+			return nil
+		}
+	}
+	delivery.ID = uint(len(s.deliveries) + 1)
+	copied := *delivery
+	s.deliveries = append(s.deliveries, &copied)
+	return nil
+}
+
+func (s *memoryStore) DueWebhookDeliveries(now time.Time, limit int) ([]*model.WebhookDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var due []*model.WebhookDelivery
+	for _, delivery := range s.deliveries {
+		if delivery.Pending() && !delivery.NextAttemptAt.After(now) && len(due) < limit {
+			copied := *delivery
+			due = append(due, &copied)
+		}
+	}
+	return due, nil
+}
+
+func (s *memoryStore) ClaimWebhookDelivery(delivery *model.WebhookDelivery, until time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored := s.deliveries[delivery.ID-1]
+	if !stored.Pending() || !stored.NextAttemptAt.Equal(*delivery.NextAttemptAt) {
+		return false, nil
+	}
+	stored.NextAttemptAt = &until
+	delivery.NextAttemptAt = &until
+	return true, nil
+}
+
+func (s *memoryStore) RecordWebhookDelivery(delivery *model.WebhookDelivery, maxFailures int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	copied := *delivery
+	s.deliveries[delivery.ID-1] = &copied
+	if delivery.Pending() || delivery.Skipped {
+		return nil
+	}
+	for _, subscription := range s.subscriptions {
+		if subscription.ID != delivery.SubscriptionID {
+			continue
+		}
+		if delivery.Success {
+			subscription.ConsecutiveFailures = 0
+			continue
+		}
+		subscription.ConsecutiveFailures++
+		if subscription.ConsecutiveFailures >= maxFailures {
+			subscription.Active = false
+		}
+	}
+	return nil
+}
+
+//finished 返回已经结束的投递
+func (s *memoryStore) finished() []*model.WebhookDelivery {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var finished []*model.WebhookDelivery
+	for _, delivery := range s.deliveries {
+		if !delivery.Pending() {
+			finished = append(finished, delivery)
+		}
+	}
+	return finished
+}
+
+func (s *memoryStore) active(subscriptionId uint) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.subscriptions[subscriptionId-1].Active
+}
+
+//receiver 记录收到的请求，status 为返回的状态码
+type receiver struct {
+	mu       sync.Mutex
+	status   int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	body, _ := io.ReadAll(req.Body)
+	r.requests = append(r.requests, req)
+	r.bodies = append(r.bodies, body)
+	w.WriteHeader(r.status)
+}
+
+func (r *receiver) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.requests)
+}
+
+func bookEvent(id uint, eventType model.EventType, pages int32) *model.OutboxEvent {
+	event, err := model.NewBookEvent(eventType, &model.Book{
+		Model:  gorm.Model{ID: 1},
+		Title:  "test title",
+		Author: "test author",
+		Pages:  pages,
+	})
+	gomega.Expect(err).NotTo(gomega.HaveOccurred())
+	event.ID = id
+	return event
+}
+
+var _ = ginkgo.Describe("dispatcher", func() {
+	var store *memoryStore
+	var recv *receiver
+	var server *httptest.Server
+	var dispatcher *webhook.Dispatcher
+
+	ginkgo.BeforeEach(func() {
+		recv = &receiver{status: http.StatusOK}
+		server = httptest.NewServer(recv)
+		ginkgo.DeferCleanup(server.Close)
+		store = &memoryStore{subscriptions: []*model.WebhookSubscription{{
+			Model:  gorm.Model{ID: 1},
+			URL:    server.URL,
+			Secret: "secret",
+			Active: true,
+		}}}
+		dispatcher = webhook.NewDispatcher(store)
+		dispatcher.Backoff = time.Millisecond
+		dispatcher.PollInterval = time.Millisecond
+		dispatcher.MaxRetries = 2
+		dispatcher.MaxFailures = 2
+	})
+
+	//run 在后台运行 Dispatcher，用例结束时停止
+	run := func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			_ = dispatcher.Run(ctx)
+		}()
+		ginkgo.DeferCleanup(func() {
+			cancel()
+			<-done
+		})
+	}
+
+	publish := func(event *model.OutboxEvent) {
+		gomega.Expect(dispatcher.Publish(context.Background(), event)).To(gomega.Succeed())
+	}
+
+	ginkgo.Context("receiver accepts the event", func() {
+		ginkgo.It("post a signed event & record a successful delivery", func() {
+			publish(bookEvent(9, model.EventBookCreated, 100))
+			gomega.Expect(recv.count()).To(gomega.BeZero())
+			run()
+			gomega.Eventually(store.finished).Should(gomega.HaveLen(1))
+			gomega.Expect(recv.requests).To(gomega.HaveLen(1))
+
+			req := recv.requests[0]
+			timestamp, err := strconv.ParseInt(req.Header.Get(webhook.TimestampHeader), 10, 64)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(webhook.Verify("secret", timestamp, recv.bodies[0], req.Header.Get(webhook.SignatureHeader))).To(gomega.BeTrue())
+			gomega.Expect(webhook.Verify("other", timestamp, recv.bodies[0], req.Header.Get(webhook.SignatureHeader))).To(gomega.BeFalse())
+			gomega.Expect(req.Header.Get(webhook.EventIDHeader)).To(gomega.Equal("9"))
+			gomega.Expect(req.Header.Get(webhook.EventTypeHeader)).To(gomega.Equal("book.created"))
+
+			var event model.OutboxEvent
+			gomega.Expect(json.Unmarshal(recv.bodies[0], &event)).To(gomega.Succeed())
+			gomega.Expect(event.ID).To(gomega.Equal(uint(9)))
+
+			delivery := store.finished()[0]
+			gomega.Expect(delivery.Success).To(gomega.BeTrue())
+			gomega.Expect(delivery.Attempts).To(gomega.Equal(1))
+		})
+
+		ginkgo.It("enqueue an event delivered again only once", func() {
+			publish(bookEvent(9, model.EventBookCreated, 100))
+			publish(bookEvent(9, model.EventBookCreated, 100))
+			run()
+			gomega.Eventually(store.finished).Should(gomega.HaveLen(1))
+			gomega.Consistently(recv.count, 50*time.Millisecond).Should(gomega.Equal(1))
+		})
+	})
+
+	ginkgo.Context("subscription filters events", func() {
+		ginkgo.It("skip events not matched", func() {
+			store.subscriptions[0].Events = model.EventTypes{model.EventBookDeleted}
+			store.subscriptions[0].Catalogs = model.Catalogs{model.CategoryNovel}
+			publish(bookEvent(1, model.EventBookCreated, 500))
+			publish(bookEvent(2, model.EventBookDeleted, 100))
+			gomega.Expect(store.deliveries).To(gomega.BeEmpty())
+
+			publish(bookEvent(3, model.EventBookDeleted, 500))
+			gomega.Expect(store.deliveries).To(gomega.HaveLen(1))
+			gomega.Expect(store.deliveries[0].EventID).To(gomega.Equal(uint(3)))
+		})
+	})
+
+	ginkgo.Context("event is not a book event", func() {
+		ginkgo.It("skip the event without delivery", func() {
+			event, err := model.NewEvent(model.EventReviewSaved, 1, &model.Review{BookID: 1, UserID: "alice", Rating: 5})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			publish(event)
+			gomega.Expect(store.deliveries).To(gomega.BeEmpty())
+		})
+	})
+
+	ginkgo.Context("subscription belongs to another tenant", func() {
+		ginkgo.It("skip events of other tenants", func() {
+			store.subscriptions[0].TenantID = "acme"
+			publish(bookEvent(1, model.EventBookCreated, 100))
+			gomega.Expect(store.deliveries).To(gomega.BeEmpty())
+
+			event := bookEvent(2, model.EventBookCreated, 100)
+			event.TenantID = "acme"
+			publish(event)
+			gomega.Expect(store.deliveries).To(gomega.HaveLen(1))
+			gomega.Expect(store.deliveries[0].TenantID).To(gomega.Equal("acme"))
+		})
+	})
+
+	ginkgo.Context("receiver keeps failing", func() {
+		ginkgo.BeforeEach(func() {
+			recv.status = http.StatusInternalServerError
+		})
+		ginkgo.It("schedule retries with backoff & record a failed delivery", func() {
+			dispatcher.Backoff = time.Hour
+			publish(bookEvent(1, model.EventBookCreated, 100))
+			run()
+			gomega.Eventually(recv.count).Should(gomega.Equal(1))
+			//下一次重试在一小时之后，保存在投递记录中
+			gomega.Eventually(func() int {
+				store.mu.Lock()
+				defer store.mu.Unlock()
+				return store.deliveries[0].Attempts
+			}).Should(gomega.Equal(1))
+			store.mu.Lock()
+			next := *store.deliveries[0].NextAttemptAt
+			gomega.Expect(store.deliveries[0].StatusCode).To(gomega.Equal(http.StatusInternalServerError))
+			//下一次重试提前到现在，模拟时间过去
+			past := time.Now()
+			store.deliveries[0].NextAttemptAt = &past
+			store.mu.Unlock()
+			gomega.Expect(next).To(gomega.BeTemporally("~", time.Now().Add(time.Hour), time.Minute))
+
+			gomega.Eventually(recv.count).Should(gomega.Equal(2))
+		})
+		ginkgo.It("give up after retries & disable subscription after repeated failures", func() {
+			for i := uint(1); i <= 3; i++ {
+				publish(bookEvent(i, model.EventBookCreated, 100))
+			}
+			run()
+			gomega.Eventually(store.finished).Should(gomega.HaveLen(3))
+			gomega.Expect(store.active(1)).To(gomega.BeFalse())
+			finished := store.finished()
+			gomega.Expect(finished[0].Attempts).To(gomega.Equal(3))
+			gomega.Expect(finished[0].Success).To(gomega.BeFalse())
+			//停用之后的事件不再投递
+			publish(bookEvent(4, model.EventBookCreated, 100))
+			gomega.Expect(store.finished()).To(gomega.HaveLen(3))
+			store.mu.Lock()
+			gomega.Expect(store.deliveries).To(gomega.HaveLen(3))
+			store.mu.Unlock()
+		})
+	})
+
+	ginkgo.Context("subscription is disabled after the event is queued", func() {
+		ginkgo.It("skip the delivery without counting a failure", func() {
+			publish(bookEvent(1, model.EventBookCreated, 100))
+			store.mu.Lock()
+			store.subscriptions[0].Active = false
+			store.subscriptions[0].ConsecutiveFailures = 1
+			store.mu.Unlock()
+			run()
+			gomega.Eventually(store.finished).Should(gomega.HaveLen(1))
+
+			delivery := store.finished()[0]
+			gomega.Expect(delivery.Skipped).To(gomega.BeTrue())
+			gomega.Expect(delivery.Attempts).To(gomega.BeZero())
+			gomega.Expect(recv.count()).To(gomega.BeZero())
+			store.mu.Lock()
+			defer store.mu.Unlock()
+			gomega.Expect(store.subscriptions[0].ConsecutiveFailures).To(gomega.Equal(1))
+		})
+	})
+
+	ginkgo.Context("one receiver hangs", func() {
+		ginkgo.It("deliver to other subscriptions without waiting", func() {
+			hang := make(chan struct{})
+			slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				<-hang
+			}))
+			ginkgo.DeferCleanup(slow.Close)
+			ginkgo.DeferCleanup(func() { close(hang) })
+			store.subscriptions = append([]*model.WebhookSubscription{{
+				Model: gorm.Model{ID: 2}, URL: slow.URL, Secret: "secret", Active: true,
+			}}, store.subscriptions...)
+			run()
+
+			start := time.Now()
+			for i := uint(1); i <= 3; i++ {
+				publish(bookEvent(i, model.EventBookCreated, 100))
+			}
+			gomega.Expect(time.Since(start)).To(gomega.BeNumerically("<", time.Second))
+			gomega.Eventually(recv.count).Should(gomega.Equal(3))
+		})
+	})
+})